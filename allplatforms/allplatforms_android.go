@@ -3,6 +3,8 @@ package allplatforms
 import (
 	"github.com/xaionaro-go/camera"
 	"github.com/xaionaro-go/camera/platform/libav"
+	"github.com/xaionaro-go/camera/platform/network"
+	"github.com/xaionaro-go/camera/platform/remote"
 	"github.com/xaionaro-go/camera/platform/v4l2"
 )
 
@@ -12,6 +14,10 @@ func Get(platID string) camera.Platform {
 		return nil
 	case "libav":
 		return libav.Platform{}
+	case "network":
+		return network.DefaultPlatform()
+	case "remote":
+		return remote.DefaultPlatform()
 	case "v4l2":
 		return v4l2.Platform{}
 	default:
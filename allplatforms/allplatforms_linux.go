@@ -5,14 +5,23 @@ package allplatforms
 
 import (
 	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/platform/camerad"
 	"github.com/xaionaro-go/camera/platform/libav"
+	"github.com/xaionaro-go/camera/platform/network"
+	"github.com/xaionaro-go/camera/platform/remote"
 	"github.com/xaionaro-go/camera/platform/v4l2"
 )
 
 func Get(platID string) camera.Platform {
 	switch platID {
+	case "camerad":
+		return camerad.Platform{}
 	case "libav":
 		return libav.Platform{}
+	case "network":
+		return network.DefaultPlatform()
+	case "remote":
+		return remote.DefaultPlatform()
 	case "v4l2":
 		return v4l2.Platform{}
 	default:
@@ -0,0 +1,27 @@
+package allplatforms
+
+import (
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/platform/network"
+	"github.com/xaionaro-go/camera/platform/remote"
+)
+
+// AddNetworkCamera makes the camera available via the default registry
+// if the device path is a URL of a network camera (like "rtsp://...")
+// or of a remote camera (like "remote://HOST:PORT//dev/video0", then all
+// the cameras of the server are added); otherwise it does nothing.
+// Network cameras cannot be discovered, so the URLs given by the user
+// should be added explicitly.
+func AddNetworkCamera(devicePath camera.DevicePath) error {
+	if remote.IsDeviceURL(devicePath) {
+		address, _, err := remote.ParseDevicePath(devicePath)
+		if err != nil {
+			return err
+		}
+		return remote.DefaultPlatform().AddServer(address)
+	}
+	if !network.IsStreamURL(devicePath) {
+		return nil
+	}
+	return network.DefaultPlatform().AddCamera(devicePath)
+}
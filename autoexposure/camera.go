@@ -0,0 +1,86 @@
+package autoexposure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// Camera is a camera.Camera passing every frame to the Controller.
+type Camera struct {
+	camera.Camera
+	Controller *Controller
+
+	controls camera.Controls
+}
+
+var _ camera.Camera = (*Camera)(nil)
+var _ camera.Controls = (*Camera)(nil)
+var _ camera.LatestFrameOnlySetter = (*Camera)(nil)
+
+// NewCamera returns the camera with the software auto-exposure and
+// auto-white-balance; if ctrls is nil, then the camera itself should
+// implement camera.Controls.
+func NewCamera(
+	cam camera.Camera,
+	ctrls camera.Controls,
+	cfg Config,
+) (*Camera, error) {
+	if ctrls == nil {
+		var ok bool
+		ctrls, ok = cam.(camera.Controls)
+		if !ok {
+			return nil, fmt.Errorf("the camera has no controls: %w", camera.ErrNotSupported)
+		}
+	}
+	ctrl, err := New(ctrls, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Camera{
+		Camera:     cam,
+		Controller: ctrl,
+		controls:   ctrls,
+	}, nil
+}
+
+// ListControls implements camera.Controls by forwarding to the controls
+// given to NewCamera. The controls adjusted by the Controller may be set
+// as well, but they are changed again on the next adjustment.
+func (c *Camera) ListControls() ([]camera.Control, error) {
+	return c.controls.ListControls()
+}
+
+func (c *Camera) GetControl(id camera.ControlID) (int32, error) {
+	return c.controls.GetControl(id)
+}
+
+func (c *Camera) SetControl(id camera.ControlID, value int32) error {
+	return c.controls.SetControl(id, value)
+}
+
+// SetLatestFrameOnly implements camera.LatestFrameOnlySetter; it does
+// nothing if the wrapped camera does not support it.
+func (c *Camera) SetLatestFrameOnly(v bool) {
+	if setter, ok := c.Camera.(camera.LatestFrameOnlySetter); ok {
+		setter.SetLatestFrameOnly(v)
+	}
+}
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	frame, err := c.Camera.GetFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Controller.Process(frame.Image()); err != nil && c.Controller.Config.OnError != nil {
+		c.Controller.Config.OnError(err)
+	}
+	return frame, nil
+}
+
+// Close restores the hardware automatic modes and closes the camera.
+func (c *Camera) Close() error {
+	return errors.Join(c.Controller.Restore(), c.Camera.Close())
+}
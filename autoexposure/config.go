@@ -0,0 +1,77 @@
+package autoexposure
+
+const (
+	DefaultTargetLuma      = 110
+	DefaultLumaTolerance   = 8
+	DefaultMaxHighlights   = 0.02
+	DefaultChromaTolerance = 2
+	DefaultDamping         = 0.5
+	DefaultSettleFrames    = 3
+	DefaultSampleStep      = 4
+)
+
+type Config struct {
+	// TargetLuma is the desired mean luma (within [0, 255]).
+	TargetLuma float64
+
+	// LumaTolerance is how far the mean luma may be from
+	// TargetLuma without adjusting the exposure.
+	LumaTolerance float64
+
+	// MaxHighlights is the fraction of the pixels which may be clipped
+	// to white; if exceeded, then the exposure is reduced even if
+	// the mean luma is on the target.
+	MaxHighlights float64
+
+	// DisableExposure and DisableWhiteBalance turn off
+	// the corresponding part of the control loop.
+	DisableExposure     bool
+	DisableWhiteBalance bool
+
+	// ChromaTolerance is how far the mean Cb and Cr may be from
+	// neutral (128) without adjusting the white balance.
+	ChromaTolerance float64
+
+	// Damping (within (0, 1]) is the fraction of the estimated
+	// correction applied per step; lower values converge slower,
+	// but do not oscillate.
+	Damping float64
+
+	// SettleFrames is the amount of frames ignored after a change of
+	// the controls, since a few frames are still captured with the old
+	// values.
+	SettleFrames uint
+
+	// SampleStep is the step (in pixels, both horizontally and
+	// vertically) of the pixels sampled for the statistics.
+	SampleStep int
+
+	// OnError (if set) is called by Camera on the errors of
+	// Controller.Process, which do not stop the capturing.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.TargetLuma == 0 {
+		cfg.TargetLuma = DefaultTargetLuma
+	}
+	if cfg.LumaTolerance == 0 {
+		cfg.LumaTolerance = DefaultLumaTolerance
+	}
+	if cfg.MaxHighlights == 0 {
+		cfg.MaxHighlights = DefaultMaxHighlights
+	}
+	if cfg.ChromaTolerance == 0 {
+		cfg.ChromaTolerance = DefaultChromaTolerance
+	}
+	if cfg.Damping <= 0 || cfg.Damping > 1 {
+		cfg.Damping = DefaultDamping
+	}
+	if cfg.SettleFrames == 0 {
+		cfg.SettleFrames = DefaultSettleFrames
+	}
+	if cfg.SampleStep == 0 {
+		cfg.SampleStep = DefaultSampleStep
+	}
+	return cfg
+}
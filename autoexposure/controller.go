@@ -0,0 +1,386 @@
+// Package autoexposure implements a software auto-exposure and
+// auto-white-balance for cameras without the hardware ones (or with
+// bad ones): the statistics of the captured frames (see imagestats)
+// are used to drive the exposure, gain and white balance controls
+// of the camera towards the configured targets.
+package autoexposure
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/imagestats"
+)
+
+const (
+	// the values of the "Auto Exposure" menu control (V4L2_EXPOSURE_*)
+	exposureModeManual = 1
+
+	// minWhiteBalanceLuma is the mean luma below which the chroma
+	// is mostly noise, so the white balance is not adjusted.
+	minWhiteBalanceLuma = 24
+)
+
+// the names (as in camera.FindControl) of the controls, in the order of preference
+var (
+	exposureModeControlNames = []string{"auto_exposure", "exposure_auto"}
+	exposureControlNames     = []string{"exposure_time_absolute", "exposure_absolute", "exposure"}
+	gainControlNames         = []string{"gain", "analogue_gain"}
+	autoWBControlNames       = []string{"white_balance_automatic", "white_balance_temperature_auto", "white_balance_auto", "auto_white_balance"}
+	redBalanceControlNames   = []string{"red_balance"}
+	blueBalanceControlNames  = []string{"blue_balance"}
+	temperatureControlNames  = []string{"white_balance_temperature"}
+)
+
+type controlState struct {
+	camera.Control
+	Value int32
+}
+
+// set rounds the value to the step of the control, clamps it
+// to the range and returns true if that is a change.
+func (s *controlState) set(v float64) bool {
+	step := float64(max(s.Step, 1))
+	v = float64(s.Min) + math.Round((v-float64(s.Min))/step)*step
+	newValue := int32(min(max(v, float64(s.Min)), float64(s.Max)))
+	if newValue == s.Value {
+		return false
+	}
+	s.Value = newValue
+	return true
+}
+
+// nudge changes the value by at least one step in the given direction,
+// for the cases when the proportional change is smaller than the step.
+func (s *controlState) nudge(v float64) bool {
+	if s.set(v) {
+		return true
+	}
+	step := float64(max(s.Step, 1))
+	if v > float64(s.Value) {
+		return s.set(float64(s.Value) + step)
+	}
+	if v < float64(s.Value) {
+		return s.set(float64(s.Value) - step)
+	}
+	return false
+}
+
+func (s *controlState) span() float64 {
+	return float64(s.Max) - float64(s.Min)
+}
+
+// autoModeState is a hardware automatic mode switched off by the controller.
+type autoModeState struct {
+	camera.Control
+	OriginalValue int32
+}
+
+// Controller adjusts the controls of a camera according to the frames
+// passed to Process. It is not safe for concurrent use.
+type Controller struct {
+	Config Config
+
+	controls    camera.Controls
+	autoModes   []autoModeState
+	exposure    *controlState
+	gain        *controlState
+	redBalance  *controlState
+	blueBalance *controlState
+	temperature *controlState
+
+	settleFrames uint
+	converged    bool
+	lastStats    imagestats.Stats
+}
+
+// New switches off the hardware auto-exposure and auto-white-balance
+// (where the software ones are enabled and the camera has the manual
+// controls to replace them) and returns a controller of
+// the controls. An error wrapping camera.ErrNotSupported is returned
+// if the camera has no controls to adjust.
+func New(
+	ctrls camera.Controls,
+	cfg Config,
+) (_ *Controller, _err error) {
+	available, err := ctrls.ListControls()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the controls: %w", err)
+	}
+
+	c := &Controller{
+		Config:   cfg.withDefaults(),
+		controls: ctrls,
+	}
+	defer func() {
+		if _err != nil {
+			c.Restore()
+		}
+	}()
+
+	// a hardware automatic mode is switched off only if there are
+	// the manual controls to replace it, otherwise nothing would
+	// control the image at all
+	if !c.Config.DisableExposure {
+		if c.exposure, err = c.findControl(available, exposureControlNames); err != nil {
+			return nil, err
+		}
+		if c.gain, err = c.findControl(available, gainControlNames); err != nil {
+			return nil, err
+		}
+		if c.exposure != nil || c.gain != nil {
+			if err := c.disableAutoMode(available, exposureModeControlNames, exposureModeManual); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !c.Config.DisableWhiteBalance {
+		if c.redBalance, err = c.findControl(available, redBalanceControlNames); err != nil {
+			return nil, err
+		}
+		if c.blueBalance, err = c.findControl(available, blueBalanceControlNames); err != nil {
+			return nil, err
+		}
+		if c.redBalance == nil || c.blueBalance == nil {
+			c.redBalance, c.blueBalance = nil, nil
+			if c.temperature, err = c.findControl(available, temperatureControlNames); err != nil {
+				return nil, err
+			}
+		}
+		if c.redBalance != nil || c.temperature != nil {
+			if err := c.disableAutoMode(available, autoWBControlNames, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if c.exposure == nil && c.gain == nil && c.redBalance == nil && c.temperature == nil {
+		return nil, fmt.Errorf("no exposure, gain or white balance controls: %w", camera.ErrNotSupported)
+	}
+	return c, nil
+}
+
+func findControl(available []camera.Control, names []string) (camera.Control, bool) {
+	for _, name := range names {
+		if ctrl, ok := camera.FindControl(available, name); ok {
+			return ctrl, true
+		}
+	}
+	return camera.Control{}, false
+}
+
+// findControl returns nil if there is no such control.
+func (c *Controller) findControl(
+	available []camera.Control,
+	names []string,
+) (*controlState, error) {
+	ctrl, ok := findControl(available, names)
+	if !ok {
+		return nil, nil
+	}
+	value, err := c.controls.GetControl(ctrl.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the value of control '%s': %w", ctrl.Name, err)
+	}
+	return &controlState{Control: ctrl, Value: value}, nil
+}
+
+func (c *Controller) disableAutoMode(
+	available []camera.Control,
+	names []string,
+	manualValue int32,
+) error {
+	ctrl, ok := findControl(available, names)
+	if !ok {
+		return nil
+	}
+	value, err := c.controls.GetControl(ctrl.ID)
+	if err != nil {
+		return fmt.Errorf("unable to get the value of control '%s': %w", ctrl.Name, err)
+	}
+	if value == manualValue {
+		return nil
+	}
+	if err := c.controls.SetControl(ctrl.ID, manualValue); err != nil {
+		return fmt.Errorf("unable to switch off '%s': %w", ctrl.Name, err)
+	}
+	c.autoModes = append(c.autoModes, autoModeState{Control: ctrl, OriginalValue: value})
+	return nil
+}
+
+// Restore switches the hardware automatic modes back
+// to the state they were in before New.
+func (c *Controller) Restore() error {
+	var result []error
+	for _, mode := range c.autoModes {
+		if err := c.controls.SetControl(mode.ID, mode.OriginalValue); err != nil {
+			result = append(result, fmt.Errorf("unable to restore '%s': %w", mode.Name, err))
+		}
+	}
+	c.autoModes = nil
+	return errors.Join(result...)
+}
+
+// Converged returns true if the last processed frame was
+// within the tolerances of the targets.
+func (c *Controller) Converged() bool {
+	return c.converged
+}
+
+// Stats returns the statistics of the last processed frame.
+func (c *Controller) Stats() imagestats.Stats {
+	return c.lastStats
+}
+
+// Process computes the statistics of the frame and adjusts the controls
+// (unless the frame is one of those captured before the previous
+// adjustment took effect).
+func (c *Controller) Process(img image.Image) error {
+	if c.settleFrames > 0 {
+		c.settleFrames--
+		return nil
+	}
+
+	stats := imagestats.Compute(img, c.Config.SampleStep)
+	c.lastStats = stats
+	var changed []*controlState
+	exposureConverged, whiteBalanceConverged := true, true
+	if c.exposure != nil || c.gain != nil {
+		var exposureChanged []*controlState
+		exposureConverged, exposureChanged = c.adjustExposure(stats)
+		changed = append(changed, exposureChanged...)
+	}
+	if c.redBalance != nil || c.temperature != nil {
+		var whiteBalanceChanged []*controlState
+		whiteBalanceConverged, whiteBalanceChanged = c.adjustWhiteBalance(stats)
+		changed = append(changed, whiteBalanceChanged...)
+	}
+	c.converged = exposureConverged && whiteBalanceConverged
+	if len(changed) == 0 {
+		return nil
+	}
+
+	c.settleFrames = c.Config.SettleFrames
+	var result []error
+	for _, s := range changed {
+		if err := c.controls.SetControl(s.ID, s.Value); err != nil {
+			result = append(result, fmt.Errorf("unable to set '%s' to %d: %w", s.Name, s.Value, err))
+		}
+	}
+	return errors.Join(result...)
+}
+
+// adjustExposure changes the exposure (preferred, since it adds no noise)
+// and the gain proportionally to the ratio between the target and
+// the actual mean luma.
+func (c *Controller) adjustExposure(stats imagestats.Stats) (bool, []*controlState) {
+	if stats.PixelCount == 0 {
+		return true, nil
+	}
+	_, highlights := stats.ClippedFractions()
+	tooBright := highlights > c.Config.MaxHighlights
+	if math.Abs(stats.MeanY-c.Config.TargetLuma) <= c.Config.LumaTolerance && !tooBright {
+		return true, nil
+	}
+
+	ratio := c.Config.TargetLuma / max(stats.MeanY, 1)
+	if tooBright {
+		// the mean luma of a clipped image underestimates
+		// the light, so at least some darkening is needed
+		ratio = min(ratio, 0.9)
+	}
+	ratio = min(max(math.Pow(ratio, c.Config.Damping), 0.5), 2)
+
+	var changed []*controlState
+	if ratio > 1 {
+		// brightening: exposure first, then gain
+		ratio = c.scaleExposure(ratio, &changed)
+		c.scaleGain(ratio, &changed)
+	} else {
+		// darkening: gain first, then exposure
+		ratio = c.scaleGain(ratio, &changed)
+		c.scaleExposure(ratio, &changed)
+	}
+	return false, changed
+}
+
+// scaleExposure multiplies the exposure by the ratio (as far as
+// the range allows) and returns the remaining part of the ratio.
+func (c *Controller) scaleExposure(ratio float64, changed *[]*controlState) float64 {
+	s := c.exposure
+	if s == nil || math.Abs(ratio-1) < 0.01 {
+		return ratio
+	}
+	oldValue := max(float64(s.Value), 1)
+	if !s.nudge(oldValue * ratio) {
+		return ratio
+	}
+	*changed = append(*changed, s)
+	return ratio * oldValue / max(float64(s.Value), 1)
+}
+
+// scaleGain changes the gain by the ratio and returns the remaining
+// part of the ratio. The units of the gain differ between the sensors,
+// so the gain is assumed to be linear within its range.
+func (c *Controller) scaleGain(ratio float64, changed *[]*controlState) float64 {
+	s := c.gain
+	if s == nil || math.Abs(ratio-1) < 0.01 || s.span() <= 0 {
+		return ratio
+	}
+	// a quarter of the range is treated as the doubling of the gain
+	unit := s.span() / 4
+	oldLevel := 1 + (float64(s.Value)-float64(s.Min))/unit
+	if !s.nudge(float64(s.Min) + (oldLevel*ratio-1)*unit) {
+		return ratio
+	}
+	*changed = append(*changed, s)
+	newLevel := 1 + (float64(s.Value)-float64(s.Min))/unit
+	return ratio * oldLevel / newLevel
+}
+
+// adjustWhiteBalance implements the "gray world" algorithm: the mean
+// color of a scene is assumed to be gray, so the red and blue channels
+// are scaled to match the green one.
+func (c *Controller) adjustWhiteBalance(stats imagestats.Stats) (bool, []*controlState) {
+	if stats.PixelCount == 0 || stats.MeanY < minWhiteBalanceLuma {
+		return true, nil
+	}
+	tolerance := c.Config.ChromaTolerance
+	if math.Abs(stats.MeanCb-128) <= tolerance && math.Abs(stats.MeanCr-128) <= tolerance {
+		return true, nil
+	}
+
+	r, g, b := stats.MeanRGB()
+	r, g, b = max(r, 1), max(g, 1), max(b, 1)
+	damp := func(ratio float64) float64 {
+		return min(max(math.Pow(ratio, c.Config.Damping), 0.5), 2)
+	}
+
+	var changed []*controlState
+	if c.redBalance != nil {
+		for _, item := range []struct {
+			State *controlState
+			Ratio float64
+		}{
+			{c.redBalance, g / r},
+			{c.blueBalance, g / b},
+		} {
+			if item.State.nudge(max(float64(item.State.Value), 1) * damp(item.Ratio)) {
+				changed = append(changed, item.State)
+			}
+		}
+		return false, changed
+	}
+
+	// a higher temperature setting compensates a bluer light,
+	// making the picture warmer
+	s := c.temperature
+	delta := c.Config.Damping * (b - r) / (b + r) * s.span()
+	if s.nudge(float64(s.Value) + delta) {
+		changed = append(changed, s)
+	}
+	return false, changed
+}
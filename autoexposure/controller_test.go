@@ -0,0 +1,358 @@
+package autoexposure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	controlIDAutoExposure = camera.ControlID(iota + 1)
+	controlIDExposure
+	controlIDGain
+	controlIDAutoWB
+	controlIDRedBalance
+	controlIDBlueBalance
+	controlIDTemperature
+	controlIDBrightness
+)
+
+// testControls are the controls of a simulated camera.
+type testControls struct {
+	controls []camera.Control
+	values   map[camera.ControlID]int32
+	sets     int
+}
+
+func newTestControls(ids ...camera.ControlID) *testControls {
+	all := map[camera.ControlID]struct {
+		ctrl  camera.Control
+		value int32
+	}{
+		controlIDAutoExposure: {camera.Control{Name: "Auto Exposure", Type: camera.ControlTypeMenu, Min: 0, Max: 3, Step: 1}, 3},
+		controlIDExposure:     {camera.Control{Name: "Exposure Time, Absolute", Type: camera.ControlTypeInteger, Min: 1, Max: 5000, Step: 1}, 20},
+		controlIDGain:         {camera.Control{Name: "Gain", Type: camera.ControlTypeInteger, Min: 0, Max: 100, Step: 1}, 0},
+		controlIDAutoWB:       {camera.Control{Name: "White Balance, Automatic", Type: camera.ControlTypeBoolean, Min: 0, Max: 1, Step: 1}, 1},
+		controlIDRedBalance:   {camera.Control{Name: "Red Balance", Type: camera.ControlTypeInteger, Min: 1, Max: 4000, Step: 1}, 1000},
+		controlIDBlueBalance:  {camera.Control{Name: "Blue Balance", Type: camera.ControlTypeInteger, Min: 1, Max: 4000, Step: 1}, 1000},
+		controlIDTemperature:  {camera.Control{Name: "White Balance Temperature", Type: camera.ControlTypeInteger, Min: 2800, Max: 6500, Step: 10}, 4600},
+		controlIDBrightness:   {camera.Control{Name: "Brightness", Type: camera.ControlTypeInteger, Min: 0, Max: 255, Step: 1}, 128},
+	}
+	c := &testControls{values: map[camera.ControlID]int32{}}
+	for _, id := range ids {
+		item := all[id]
+		item.ctrl.ID = id
+		c.controls = append(c.controls, item.ctrl)
+		c.values[id] = item.value
+	}
+	return c
+}
+
+func (c *testControls) ListControls() ([]camera.Control, error) {
+	return c.controls, nil
+}
+
+func (c *testControls) GetControl(id camera.ControlID) (int32, error) {
+	value, ok := c.values[id]
+	if !ok {
+		return 0, fmt.Errorf("%w: control %#x", camera.ErrNotSupported, id)
+	}
+	return value, nil
+}
+
+func (c *testControls) SetControl(id camera.ControlID, value int32) error {
+	if _, ok := c.values[id]; !ok {
+		return fmt.Errorf("%w: control %#x", camera.ErrNotSupported, id)
+	}
+	c.values[id] = value
+	c.sets++
+	return nil
+}
+
+// render simulates the capture of a scene of the given color (as if
+// captured with the exposure 100, no gain and neutral white balance).
+func (c *testControls) render(sceneR, sceneG, sceneB float64) image.Image {
+	light := 1.0
+	if exposure, ok := c.values[controlIDExposure]; ok {
+		light *= float64(exposure) / 100
+	}
+	if gain, ok := c.values[controlIDGain]; ok {
+		light *= 1 + float64(gain)/25
+	}
+	redScale, blueScale := 1.0, 1.0
+	if v, ok := c.values[controlIDRedBalance]; ok {
+		redScale = float64(v) / 1000
+		blueScale = float64(c.values[controlIDBlueBalance]) / 1000
+	}
+	if v, ok := c.values[controlIDTemperature]; ok {
+		// a higher setting makes the picture warmer
+		warmth := (float64(v) - 4600) / 4000
+		redScale, blueScale = 1+warmth, 1-warmth
+	}
+	clamp := func(v float64) uint8 {
+		return uint8(min(max(math.Round(v), 0), 255))
+	}
+	y, cb, cr := color.RGBToYCbCr(
+		clamp(sceneR*light*redScale),
+		clamp(sceneG*light),
+		clamp(sceneB*light*blueScale),
+	)
+
+	img := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = y
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = cb, cr
+	}
+	return img
+}
+
+// run processes the frames until the controller converges; it returns
+// the amount of processed frames or -1 if it did not converge.
+func run(t *testing.T, ctrl *Controller, ctrls *testControls, sceneR, sceneG, sceneB float64) int {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		if err := ctrl.Process(ctrls.render(sceneR, sceneG, sceneB)); err != nil {
+			t.Fatal(err)
+		}
+		if ctrl.Converged() {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func TestExposure(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		controls   []camera.ControlID
+		scene      float64
+		startValue int32
+	}{
+		{"dark_exposure_only", []camera.ControlID{controlIDAutoExposure, controlIDExposure}, 100, 20},
+		{"bright_exposure_only", []camera.ControlID{controlIDAutoExposure, controlIDExposure}, 100, 1000},
+		{"dark_exposure_and_gain", []camera.ControlID{controlIDAutoExposure, controlIDExposure, controlIDGain}, 100, 20},
+		{"gain_only", []camera.ControlID{controlIDGain}, 50, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrls := newTestControls(tc.controls...)
+			if _, ok := ctrls.values[controlIDExposure]; ok {
+				ctrls.values[controlIDExposure] = tc.startValue
+			}
+			ctrl, err := New(ctrls, Config{DisableWhiteBalance: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v, ok := ctrls.values[controlIDAutoExposure]; ok && v != exposureModeManual {
+				t.Errorf("expected the hardware auto-exposure to be switched off, got %d", v)
+			}
+
+			if frames := run(t, ctrl, ctrls, tc.scene, tc.scene, tc.scene); frames < 0 {
+				t.Fatalf("did not converge, the statistics: mean luma %v", ctrl.Stats().MeanY)
+			}
+			if meanY := ctrl.Stats().MeanY; math.Abs(meanY-DefaultTargetLuma) > DefaultLumaTolerance {
+				t.Errorf("expected the mean luma %v±%v, got %v", DefaultTargetLuma, DefaultLumaTolerance, meanY)
+			}
+
+			if err := ctrl.Restore(); err != nil {
+				t.Fatal(err)
+			}
+			if v, ok := ctrls.values[controlIDAutoExposure]; ok && v != 3 {
+				t.Errorf("expected the hardware auto-exposure to be restored, got %d", v)
+			}
+		})
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	ctrls := newTestControls(controlIDExposure)
+	ctrl, err := New(ctrls, Config{DisableWhiteBalance: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a dark image with a clipped window: the mean is on the target,
+	// but the window should be not blown out
+	img := image.NewYCbCr(image.Rect(0, 0, 100, 100), image.YCbCrSubsampleRatio420)
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			v := uint8(90)
+			if x < 20 && y < 20 {
+				v = 255
+			}
+			img.Y[img.YOffset(x, y)] = v
+		}
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 128, 128
+	}
+	before := ctrls.values[controlIDExposure]
+	if err := ctrl.Process(img); err != nil {
+		t.Fatal(err)
+	}
+	if ctrl.Converged() || ctrls.values[controlIDExposure] >= before {
+		t.Errorf("expected the exposure to be reduced from %d, got %d", before, ctrls.values[controlIDExposure])
+	}
+}
+
+func TestSettleFrames(t *testing.T) {
+	ctrls := newTestControls(controlIDExposure)
+	ctrl, err := New(ctrls, Config{DisableWhiteBalance: true, SettleFrames: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dark := ctrls.render(10, 10, 10)
+	for i, expectedSets := range []int{1, 1, 1, 2} {
+		if err := ctrl.Process(dark); err != nil {
+			t.Fatal(err)
+		}
+		if ctrls.sets != expectedSets {
+			t.Errorf("frame %d: expected %d adjustments, got %d", i, expectedSets, ctrls.sets)
+		}
+	}
+}
+
+func TestWhiteBalance(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		controls []camera.ControlID
+	}{
+		{"balances", []camera.ControlID{controlIDAutoWB, controlIDRedBalance, controlIDBlueBalance}},
+		{"temperature", []camera.ControlID{controlIDAutoWB, controlIDTemperature}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrls := newTestControls(tc.controls...)
+			ctrl, err := New(ctrls, Config{DisableExposure: true, ChromaTolerance: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ctrls.values[controlIDAutoWB] != 0 {
+				t.Errorf("expected the hardware auto-white-balance to be switched off")
+			}
+
+			// a gray scene under a bluish light
+			if frames := run(t, ctrl, ctrls, 90, 110, 130); frames < 0 {
+				stats := ctrl.Stats()
+				t.Fatalf("did not converge, the mean chroma: %v/%v", stats.MeanCb, stats.MeanCr)
+			}
+			stats := ctrl.Stats()
+			if math.Abs(stats.MeanCb-128) > 3 || math.Abs(stats.MeanCr-128) > 3 {
+				t.Errorf("expected neutral chroma, got %v/%v", stats.MeanCb, stats.MeanCr)
+			}
+
+			if err := ctrl.Restore(); err != nil {
+				t.Fatal(err)
+			}
+			if ctrls.values[controlIDAutoWB] != 1 {
+				t.Errorf("expected the hardware auto-white-balance to be restored")
+			}
+		})
+	}
+}
+
+func TestNoControls(t *testing.T) {
+	ctrls := newTestControls(controlIDAutoExposure, controlIDAutoWB, controlIDBrightness)
+	_, err := New(ctrls, Config{})
+	if !errors.Is(err, camera.ErrNotSupported) {
+		t.Errorf("expected no supported controls, got %v", err)
+	}
+	// the hardware modes are kept, since nothing would replace them
+	if ctrls.sets != 0 {
+		t.Errorf("expected no controls to be changed, got %d changes", ctrls.sets)
+	}
+}
+
+type testFrame struct {
+	img image.Image
+}
+
+func (f *testFrame) Image() image.Image {
+	return f.img
+}
+
+// testCamera is a camera with controls rendering a gray scene.
+type testCamera struct {
+	*testControls
+	latestFrameOnly bool
+	closed          bool
+}
+
+func (c *testCamera) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *testCamera) StartStreaming() error {
+	return nil
+}
+
+func (c *testCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *testCamera) GetFormat() camera.Format {
+	return camera.Format{Width: 64, Height: 48, PixelFormat: camera.PixelFormatYU12}
+}
+
+func (c *testCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	return &testFrame{img: c.render(100, 100, 100)}, nil
+}
+
+func (c *testCamera) ReleaseFrame(camera.Frame) error {
+	return nil
+}
+
+func (c *testCamera) SetLatestFrameOnly(v bool) {
+	c.latestFrameOnly = v
+}
+
+func TestCamera(t *testing.T) {
+	src := &testCamera{testControls: newTestControls(controlIDAutoExposure, controlIDExposure, controlIDBrightness)}
+	cam, err := NewCamera(src, nil, Config{DisableWhiteBalance: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the controls and the latest-frame-only mode are forwarded
+	ctrls, err := cam.ListControls()
+	if err != nil || len(ctrls) != 3 {
+		t.Errorf("expected the controls of the camera, got %v (%v)", ctrls, err)
+	}
+	if err := cam.SetControl(controlIDBrightness, 10); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := cam.GetControl(controlIDBrightness); err != nil || v != 10 {
+		t.Errorf("expected the brightness 10, got %d (%v)", v, err)
+	}
+	cam.SetLatestFrameOnly(true)
+	if !src.latestFrameOnly {
+		t.Errorf("expected the latest-frame-only mode to be forwarded")
+	}
+
+	for i := 0; i < 100 && !cam.Controller.Converged(); i++ {
+		frame, err := cam.GetFrame(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cam.ReleaseFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !cam.Controller.Converged() {
+		t.Errorf("expected the exposure to converge")
+	}
+
+	if err := cam.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !src.closed || src.values[controlIDAutoExposure] != 3 {
+		t.Errorf("expected the camera to be closed with the hardware auto-exposure restored")
+	}
+}
@@ -0,0 +1,534 @@
+package calibration
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	DefaultMaxIterations = 100
+
+	// DefaultMinViewChange is the default minimal mean movement of the
+	// corners (relative to the diagonal of the image) for a picture to
+	// be added as a new view by Calibrator.
+	DefaultMinViewChange = 0.05
+
+	// MinViews is the minimal amount of the views of the board.
+	MinViews = 3
+)
+
+// Board is the checkerboard used for the calibration.
+type Board struct {
+	// Cols and Rows are the amounts of the inner corners
+	// (the amounts of the squares minus one).
+	Cols, Rows int
+
+	// SquareSize is the size of a square in any units (only the
+	// distance to the board depends on it); 1 is used if zero.
+	SquareSize float64
+}
+
+// objectPoints returns the corners in the coordinates of the board,
+// in the order of FindChessboardCorners.
+func (b Board) objectPoints() [][3]float64 {
+	size := b.SquareSize
+	if size == 0 {
+		size = 1
+	}
+	result := make([][3]float64, 0, b.Cols*b.Rows)
+	for j := 0; j < b.Rows; j++ {
+		for i := 0; i < b.Cols; i++ {
+			result = append(result, [3]float64{float64(i) * size, float64(j) * size, 0})
+		}
+	}
+	return result
+}
+
+type Config struct {
+	Model Model
+	Board Board
+
+	// FixK3 keeps the pinhole coefficient k3 zero, which avoids
+	// overfitting unless the lens is strongly distorted.
+	FixK3 bool
+
+	// FixTangential keeps the tangential distortion (p1, p2) zero.
+	FixTangential bool
+
+	// MaxIterations limits the iterations of the optimization.
+	MaxIterations int
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.MaxIterations == 0 {
+		cfg.MaxIterations = DefaultMaxIterations
+	}
+	return cfg
+}
+
+// Calibrate estimates the calibration from the corners (as returned
+// by FindChessboardCorners) found in the pictures of the board taken
+// from different angles and covering different parts of the image.
+func Calibrate(
+	views [][]Point,
+	width, height uint64,
+	cfg Config,
+) (*Calibration, error) {
+	cfg = cfg.withDefaults()
+	object := cfg.Board.objectPoints()
+	if len(object) < 4 {
+		return nil, fmt.Errorf("the board is too small: %dx%d", cfg.Board.Cols, cfg.Board.Rows)
+	}
+	if len(views) < MinViews {
+		return nil, fmt.Errorf("at least %d views are required, but got %d", MinViews, len(views))
+	}
+	for idx, view := range views {
+		if len(view) != len(object) {
+			return nil, fmt.Errorf("view #%d has %d corners, but the board has %d", idx, len(view), len(object))
+		}
+	}
+
+	homographies := make([]mat3, len(views))
+	for idx, view := range views {
+		h, err := findHomography(object, view)
+		if err != nil {
+			return nil, fmt.Errorf("view #%d: %w", idx, err)
+		}
+		homographies[idx] = h
+	}
+	fx, fy, err := initFocalLength(homographies, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &problem{
+		Model:  cfg.Model,
+		Object: object,
+		Views:  views,
+	}
+	params := make([]float64, p.intrinsicCount()+6*len(views))
+	params[0], params[1] = fx, fy
+	params[2], params[3] = float64(width-1)/2, float64(height-1)/2
+	k := mat3{{fx, 0, params[2]}, {0, fy, params[3]}, {0, 0, 1}}
+	for idx, h := range homographies {
+		r, t := extrinsicsFromHomography(k, h)
+		copy(params[p.intrinsicCount()+6*idx:], r[:])
+		copy(params[p.intrinsicCount()+6*idx+3:], t[:])
+	}
+
+	fixed := make([]bool, len(params))
+	if cfg.Model == ModelPinhole {
+		fixed[4+2] = cfg.FixTangential
+		fixed[4+3] = cfg.FixTangential
+		fixed[4+4] = cfg.FixK3
+	}
+	sqErr, err := p.optimize(params, fixed, cfg.MaxIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Calibration{
+		Model:      cfg.Model,
+		Width:      width,
+		Height:     height,
+		Fx:         params[0],
+		Fy:         params[1],
+		Cx:         params[2],
+		Cy:         params[3],
+		Distortion: append([]float64(nil), params[4:p.intrinsicCount()]...),
+		RMSError:   math.Sqrt(sqErr / float64(len(views)*len(object))),
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("the calibration diverged: %w", err)
+	}
+	return c, nil
+}
+
+// Calibrator collects the views of the board from the pictures.
+type Calibrator struct {
+	Config Config
+
+	// MinViewChange is the minimal mean movement of the corners
+	// (relative to the diagonal of the image) for a picture to be
+	// added as a new view, to not collect the same view many times.
+	MinViewChange float64
+
+	Width, Height uint64
+	Views         [][]Point
+}
+
+func NewCalibrator(width, height uint64, cfg Config) *Calibrator {
+	return &Calibrator{
+		Config:        cfg.withDefaults(),
+		MinViewChange: DefaultMinViewChange,
+		Width:         width,
+		Height:        height,
+	}
+}
+
+// AddImage finds the board in the image and adds the view; it returns
+// false if the view is too close to an already added one.
+func (c *Calibrator) AddImage(img image.Image) (bool, error) {
+	r := img.Bounds()
+	if uint64(r.Dx()) != c.Width || uint64(r.Dy()) != c.Height {
+		return false, fmt.Errorf("the image is %dx%d, but %dx%d was expected", r.Dx(), r.Dy(), c.Width, c.Height)
+	}
+	corners, err := FindChessboardCorners(img, c.Config.Board.Cols, c.Config.Board.Rows)
+	if err != nil {
+		return false, err
+	}
+	return c.AddView(corners), nil
+}
+
+// AddView adds the corners found in a picture unless they are
+// too close to an already added view.
+func (c *Calibrator) AddView(corners []Point) bool {
+	diagonal := math.Hypot(float64(c.Width), float64(c.Height))
+	for _, view := range c.Views {
+		if len(view) != len(corners) {
+			continue
+		}
+		sum := 0.0
+		for i := range view {
+			sum += math.Hypot(view[i].X-corners[i].X, view[i].Y-corners[i].Y)
+		}
+		if sum/float64(len(view)) < c.MinViewChange*diagonal {
+			return false
+		}
+	}
+	c.Views = append(c.Views, corners)
+	return true
+}
+
+// Calibrate estimates the calibration from the collected views.
+func (c *Calibrator) Calibrate() (*Calibration, error) {
+	return Calibrate(c.Views, c.Width, c.Height, c.Config)
+}
+
+func mul3(a, b mat3) mat3 {
+	var r mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = a[i][0]*b[0][j] + a[i][1]*b[1][j] + a[i][2]*b[2][j]
+		}
+	}
+	return r
+}
+
+// normalization returns the similarity moving the centroid of the points
+// to the origin and scaling their mean distance from it to sqrt(2),
+// which makes the DLT numerically stable.
+func normalization(points []Point) (mat3, mat3) {
+	var cx, cy float64
+	for _, p := range points {
+		cx += p.X
+		cy += p.Y
+	}
+	cx /= float64(len(points))
+	cy /= float64(len(points))
+	meanDist := 0.0
+	for _, p := range points {
+		meanDist += math.Hypot(p.X-cx, p.Y-cy)
+	}
+	meanDist /= float64(len(points))
+	s := math.Sqrt2 / math.Max(meanDist, 1e-12)
+	t := mat3{{s, 0, -s * cx}, {0, s, -s * cy}, {0, 0, 1}}
+	inv := mat3{{1 / s, 0, cx}, {0, 1 / s, cy}, {0, 0, 1}}
+	return t, inv
+}
+
+// findHomography finds the homography mapping the planar
+// points of the board to the points of the image.
+func findHomography(object [][3]float64, points []Point) (mat3, error) {
+	src := make([]Point, len(object))
+	for i, o := range object {
+		src[i] = Point{X: o[0], Y: o[1]}
+	}
+	srcT, _ := normalization(src)
+	dstT, dstTInv := normalization(points)
+
+	ata := make([][]float64, 9)
+	for i := range ata {
+		ata[i] = make([]float64, 9)
+	}
+	for i := range src {
+		s := srcT.mulVec([3]float64{src[i].X, src[i].Y, 1})
+		d := dstT.mulVec([3]float64{points[i].X, points[i].Y, 1})
+		x, y, u, v := s[0], s[1], d[0], d[1]
+		for _, row := range [2][9]float64{
+			{-x, -y, -1, 0, 0, 0, u * x, u * y, u},
+			{0, 0, 0, -x, -y, -1, v * x, v * y, v},
+		} {
+			for a := 0; a < 9; a++ {
+				for b := 0; b < 9; b++ {
+					ata[a][b] += row[a] * row[b]
+				}
+			}
+		}
+	}
+	h := nullVector(ata)
+	hn := mat3{{h[0], h[1], h[2]}, {h[3], h[4], h[5]}, {h[6], h[7], h[8]}}
+	result := mul3(dstTInv, mul3(hn, srcT))
+	if math.Abs(result[2][2]) < 1e-12 {
+		return mat3{}, fmt.Errorf("degenerate homography (are the corners collinear?)")
+	}
+	for i := range result {
+		for j := range result[i] {
+			result[i][j] /= result[2][2]
+		}
+	}
+	return result, nil
+}
+
+// initFocalLength estimates the focal length assuming the principal point
+// is at the center of the image (as initIntrinsicParams2D of OpenCV):
+// the columns of a homography are the projections of two orthogonal
+// vectors of the same length.
+func initFocalLength(homographies []mat3, width, height uint64) (float64, float64, error) {
+	cx, cy := float64(width-1)/2, float64(height-1)/2
+	var a00, a01, a11, b0, b1 float64
+	for _, h := range homographies {
+		h = mul3(mat3{{1, 0, -cx}, {0, 1, -cy}, {0, 0, 1}}, h)
+		var hv, vv, d1, d2 [3]float64
+		for j := 0; j < 3; j++ {
+			hv[j], vv[j] = h[j][0], h[j][1]
+			d1[j], d2[j] = (h[j][0]+h[j][1])/2, (h[j][0]-h[j][1])/2
+		}
+		hv, vv = scale(hv, 1/norm(hv)), scale(vv, 1/norm(vv))
+		d1, d2 = scale(d1, 1/norm(d1)), scale(d2, 1/norm(d2))
+		for _, eq := range [2][3]float64{
+			{hv[0] * vv[0], hv[1] * vv[1], -hv[2] * vv[2]},
+			{d1[0] * d2[0], d1[1] * d2[1], -d1[2] * d2[2]},
+		} {
+			a00 += eq[0] * eq[0]
+			a01 += eq[0] * eq[1]
+			a11 += eq[1] * eq[1]
+			b0 += eq[0] * eq[2]
+			b1 += eq[1] * eq[2]
+		}
+	}
+	det := a00*a11 - a01*a01
+	if math.Abs(det) < 1e-300 {
+		return 0, 0, fmt.Errorf("unable to estimate the focal length: the views are degenerate (tilt the board more)")
+	}
+	f0 := (a11*b0 - a01*b1) / det
+	f1 := (a00*b1 - a01*b0) / det
+	fx, fy := math.Sqrt(math.Abs(1/f0)), math.Sqrt(math.Abs(1/f1))
+	if math.IsInf(fx, 0) || math.IsInf(fy, 0) || math.IsNaN(fx) || math.IsNaN(fy) {
+		return 0, 0, fmt.Errorf("unable to estimate the focal length: the views are degenerate (tilt the board more)")
+	}
+	return fx, fy, nil
+}
+
+// extrinsicsFromHomography returns the rotation vector and
+// the translation of the board relative to the camera.
+func extrinsicsFromHomography(k, h mat3) ([3]float64, [3]float64) {
+	kInv := mat3{
+		{1 / k[0][0], 0, -k[0][2] / k[0][0]},
+		{0, 1 / k[1][1], -k[1][2] / k[1][1]},
+		{0, 0, 1},
+	}
+	m := mul3(kInv, h)
+	r1 := [3]float64{m[0][0], m[1][0], m[2][0]}
+	r2 := [3]float64{m[0][1], m[1][1], m[2][1]}
+	t := [3]float64{m[0][2], m[1][2], m[2][2]}
+	lambda := 2 / (norm(r1) + norm(r2))
+	if t[2] < 0 {
+		// the board is in front of the camera
+		lambda = -lambda
+	}
+	r1, r2, t = scale(r1, lambda), scale(r2, lambda), scale(t, lambda)
+
+	// the closest rotation (approximately, via Gram-Schmidt)
+	r1 = scale(r1, 1/norm(r1))
+	r2 = [3]float64{r2[0] - dot(r1, r2)*r1[0], r2[1] - dot(r1, r2)*r1[1], r2[2] - dot(r1, r2)*r1[2]}
+	r2 = scale(r2, 1/norm(r2))
+	r3 := cross(r1, r2)
+	rot := mat3{
+		{r1[0], r2[0], r3[0]},
+		{r1[1], r2[1], r3[1]},
+		{r1[2], r2[2], r3[2]},
+	}
+	return vectorFromRotation(rot), t
+}
+
+// problem is the non-linear least squares problem of the calibration:
+// the parameters are the intrinsics followed by the rotation vector
+// and the translation of each view, and the residuals are the
+// reprojection errors of the corners.
+type problem struct {
+	Model  Model
+	Object [][3]float64
+	Views  [][]Point
+}
+
+func (p *problem) intrinsicCount() int {
+	return 4 + p.Model.distortionCount()
+}
+
+// residuals writes the reprojection errors of the view into out.
+func (p *problem) residuals(intrinsics, extrinsics []float64, view int, out []float64) {
+	rot := rotationFromVector([3]float64{extrinsics[0], extrinsics[1], extrinsics[2]})
+	fx, fy, cx, cy := intrinsics[0], intrinsics[1], intrinsics[2], intrinsics[3]
+	d := intrinsics[4:]
+	for i, o := range p.Object {
+		c := rot.mulVec(o)
+		xd, yd := distort(p.Model, d, c[0]+extrinsics[3], c[1]+extrinsics[4], c[2]+extrinsics[5])
+		obs := p.Views[view][i]
+		out[2*i] = fx*xd + cx - obs.X
+		out[2*i+1] = fy*yd + cy - obs.Y
+	}
+}
+
+func (p *problem) sqError(params []float64) float64 {
+	nI := p.intrinsicCount()
+	res := make([]float64, 2*len(p.Object))
+	sum := 0.0
+	for v := range p.Views {
+		p.residuals(params[:nI], params[nI+6*v:nI+6*v+6], v, res)
+		for _, r := range res {
+			sum += r * r
+		}
+	}
+	return sum
+}
+
+// optimize minimizes the squared reprojection error via the
+// Levenberg-Marquardt algorithm (with a numerical Jacobian, which is
+// block-sparse: a view depends only on the intrinsics and itself);
+// it returns the final squared error.
+func (p *problem) optimize(params []float64, fixed []bool, maxIterations int) (float64, error) {
+	nI := p.intrinsicCount()
+	n := len(params)
+	nRes := 2 * len(p.Object)
+
+	jtj := make([][]float64, n)
+	for i := range jtj {
+		jtj[i] = make([]float64, n)
+	}
+	grad := make([]float64, n)
+	res := make([]float64, nRes)
+	resPlus := make([]float64, nRes)
+	resMinus := make([]float64, nRes)
+	jac := make([][]float64, nI+6)
+	for i := range jac {
+		jac[i] = make([]float64, nRes)
+	}
+	globalIdx := make([]int, nI+6)
+	trial := make([]float64, n)
+	system := make([][]float64, n)
+	for i := range system {
+		system[i] = make([]float64, n)
+	}
+	rhs := make([]float64, n)
+
+	lambda := 1e-3
+	cost := p.sqError(params)
+	for iter := 0; iter < maxIterations; iter++ {
+		for i := range jtj {
+			clear(jtj[i])
+		}
+		clear(grad)
+
+		for v := range p.Views {
+			for i := 0; i < nI; i++ {
+				globalIdx[i] = i
+			}
+			for i := 0; i < 6; i++ {
+				globalIdx[nI+i] = nI + 6*v + i
+			}
+			// the slices alias params, so the perturbations are seen
+			intr, ext := params[:nI], params[nI+6*v:nI+6*v+6]
+			p.residuals(intr, ext, v, res)
+			for k, g := range globalIdx {
+				if fixed[g] {
+					clear(jac[k])
+					continue
+				}
+				orig := params[g]
+				step := 1e-6 * math.Max(math.Abs(orig), 1)
+				params[g] = orig + step
+				p.residuals(intr, ext, v, resPlus)
+				params[g] = orig - step
+				p.residuals(intr, ext, v, resMinus)
+				params[g] = orig
+				for r := range jac[k] {
+					jac[k][r] = (resPlus[r] - resMinus[r]) / (2 * step)
+				}
+			}
+			for a, ga := range globalIdx {
+				for b := a; b < len(globalIdx); b++ {
+					gb := globalIdx[b]
+					sum := 0.0
+					for r := 0; r < nRes; r++ {
+						sum += jac[a][r] * jac[b][r]
+					}
+					jtj[ga][gb] += sum
+					if ga != gb {
+						jtj[gb][ga] += sum
+					}
+				}
+				sum := 0.0
+				for r := 0; r < nRes; r++ {
+					sum += jac[a][r] * res[r]
+				}
+				grad[ga] += sum
+			}
+		}
+
+		improved := false
+		for attempt := 0; attempt < 10 && !improved; attempt++ {
+			for i := range system {
+				copy(system[i], jtj[i])
+				if fixed[i] {
+					clear(system[i])
+					system[i][i] = 1
+					rhs[i] = 0
+					continue
+				}
+				system[i][i] += lambda * math.Max(jtj[i][i], 1e-9)
+				rhs[i] = -grad[i]
+			}
+			for i := range system {
+				if fixed[i] {
+					continue
+				}
+				for j := range system[i] {
+					if fixed[j] {
+						system[i][j] = 0
+					}
+				}
+			}
+			delta, err := solveCholesky(system, rhs)
+			if err != nil {
+				lambda *= 10
+				continue
+			}
+			for i := range trial {
+				trial[i] = params[i] + delta[i]
+			}
+			trialCost := p.sqError(trial)
+			if trialCost < cost && !math.IsNaN(trialCost) {
+				converged := (cost-trialCost) < 1e-12*cost || cost-trialCost < 1e-18
+				copy(params, trial)
+				cost = trialCost
+				lambda = math.Max(lambda/10, 1e-12)
+				improved = true
+				if converged {
+					return cost, nil
+				}
+			} else {
+				lambda *= 10
+			}
+		}
+		if !improved {
+			// no step decreases the error: a minimum
+			break
+		}
+	}
+	if math.IsNaN(cost) || math.IsInf(cost, 0) {
+		return 0, fmt.Errorf("the optimization diverged")
+	}
+	return cost, nil
+}
@@ -0,0 +1,228 @@
+package calibration
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+var testBoard = Board{Cols: 7, Rows: 5}
+
+// testPose is the pose of the board: the rotation (in degrees) and
+// the position of the center of the board in the camera coordinates.
+type testPose struct {
+	AngleX, AngleY, AngleZ float64
+	X, Y, Z                float64
+}
+
+var testPoses = []testPose{
+	{0, 0, 0, 0, 0, 12},
+	{20, 0, 5, -1, -1, 12},
+	{-20, 10, -5, 1, 1, 13},
+	{0, 25, 0, 1.5, 0, 12},
+	{10, -25, 10, -1.5, 0.5, 11},
+	{-15, -15, -10, 0, -1, 12},
+	{25, -10, 15, 1.5, -1, 10},
+}
+
+func rotation(angleX, angleY, angleZ float64) mat3 {
+	ax, ay, az := angleX*math.Pi/180, angleY*math.Pi/180, angleZ*math.Pi/180
+	rx := mat3{{1, 0, 0}, {0, math.Cos(ax), -math.Sin(ax)}, {0, math.Sin(ax), math.Cos(ax)}}
+	ry := mat3{{math.Cos(ay), 0, math.Sin(ay)}, {0, 1, 0}, {-math.Sin(ay), 0, math.Cos(ay)}}
+	rz := mat3{{math.Cos(az), -math.Sin(az), 0}, {math.Sin(az), math.Cos(az), 0}, {0, 0, 1}}
+	return mul3(ry, mul3(rx, rz))
+}
+
+// transform returns the rotation and the translation from the board
+// coordinates to the camera coordinates.
+func (p testPose) transform(board Board) (mat3, [3]float64) {
+	r := rotation(p.AngleX, p.AngleY, p.AngleZ)
+	center := r.mulVec([3]float64{float64(board.Cols-1) / 2, float64(board.Rows-1) / 2, 0})
+	return r, [3]float64{p.X - center[0], p.Y - center[1], p.Z - center[2]}
+}
+
+// project returns the exact corners of the board as seen by the camera.
+func (p testPose) project(c *Calibration, board Board) []Point {
+	r, t := p.transform(board)
+	var result []Point
+	for _, obj := range board.objectPoints() {
+		v := r.mulVec(obj)
+		u, w := c.Project(v[0]+t[0], v[1]+t[1], v[2]+t[2])
+		result = append(result, Point{X: u, Y: w})
+	}
+	return result
+}
+
+// render ray-traces the board (with a margin of a white square around
+// it) as seen by the camera, averaging 4x4 samples per pixel.
+func (p testPose) render(c *Calibration, board Board) *image.Gray {
+	r, t := p.transform(board)
+	rt := mat3{
+		{r[0][0], r[1][0], r[2][0]},
+		{r[0][1], r[1][1], r[2][1]},
+		{r[0][2], r[1][2], r[2][2]},
+	}
+	tBoard := rt.mulVec(t)
+
+	const samples = 4
+	img := image.NewGray(image.Rect(0, 0, int(c.Width), int(c.Height)))
+	for y := 0; y < int(c.Height); y++ {
+		for x := 0; x < int(c.Width); x++ {
+			sum := 0
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					u := float64(x) + (float64(sx)+0.5)/samples - 0.5
+					v := float64(y) + (float64(sy)+0.5)/samples - 0.5
+					uu, vv, _ := c.Undistort(u, v)
+					ray := rt.mulVec([3]float64{(uu - c.Cx) / c.Fx, (vv - c.Cy) / c.Fy, 1})
+					s := tBoard[2] / ray[2]
+					bx, by := s*ray[0]-tBoard[0], s*ray[1]-tBoard[1]
+					sum += testBoardLuma(board, bx, by)
+				}
+			}
+			img.Pix[y*img.Stride+x] = uint8(sum / (samples * samples))
+		}
+	}
+	return img
+}
+
+func testBoardLuma(board Board, x, y float64) int {
+	const black, white = 30, 220
+	if x < -1 || y < -1 || x >= float64(board.Cols) || y >= float64(board.Rows) {
+		return white
+	}
+	if (int(math.Floor(x))+int(math.Floor(y)))%2 == 0 {
+		return black
+	}
+	return white
+}
+
+func newTestCalibration(model Model) *Calibration {
+	c := &Calibration{
+		Model:  model,
+		Width:  400,
+		Height: 300,
+		Fx:     340,
+		Fy:     335,
+		Cx:     203,
+		Cy:     147,
+	}
+	switch model {
+	case ModelPinhole:
+		c.Distortion = []float64{-0.2, 0.05, 0.001, -0.0005, 0}
+	case ModelFisheye:
+		c.Distortion = []float64{0.05, -0.01, 0, 0}
+	}
+	return c
+}
+
+func checkCalibration(t *testing.T, expected, got *Calibration, tolerance, distortionTolerance float64) {
+	t.Helper()
+	for _, v := range []struct {
+		name          string
+		expected, got float64
+		tolerance     float64
+	}{
+		{"fx", expected.Fx, got.Fx, tolerance},
+		{"fy", expected.Fy, got.Fy, tolerance},
+		{"cx", expected.Cx, got.Cx, tolerance},
+		{"cy", expected.Cy, got.Cy, tolerance},
+	} {
+		if math.Abs(v.expected-v.got) > v.tolerance {
+			t.Errorf("expected %s %v±%v, got %v", v.name, v.expected, v.tolerance, v.got)
+		}
+	}
+	if len(got.Distortion) != len(expected.Distortion) {
+		t.Fatalf("expected the distortion %v, got %v", expected.Distortion, got.Distortion)
+	}
+	for i := range expected.Distortion {
+		if math.Abs(expected.Distortion[i]-got.Distortion[i]) > distortionTolerance {
+			t.Errorf("expected the distortion %v±%v, got %v", expected.Distortion, distortionTolerance, got.Distortion)
+			break
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	for _, model := range []Model{ModelPinhole, ModelFisheye} {
+		t.Run(model.String(), func(t *testing.T) {
+			truth := newTestCalibration(model)
+			var views [][]Point
+			for _, pose := range testPoses {
+				views = append(views, pose.project(truth, testBoard))
+			}
+
+			calib, err := Calibrate(views, truth.Width, truth.Height, Config{
+				Model: model,
+				Board: testBoard,
+				FixK3: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkCalibration(t, truth, calib, 0.01, 1e-4)
+			if calib.RMSError > 1e-3 {
+				t.Errorf("expected no reprojection error, got %v", calib.RMSError)
+			}
+
+			if _, err := Calibrate(views[:MinViews-1], truth.Width, truth.Height, Config{Model: model, Board: testBoard}); err == nil {
+				t.Errorf("expected an error with too few views")
+			}
+		})
+	}
+}
+
+func TestFindChessboardCorners(t *testing.T) {
+	truth := newTestCalibration(ModelPinhole)
+	for idx, pose := range testPoses[:3] {
+		img := pose.render(truth, testBoard)
+		corners, err := FindChessboardCorners(img, testBoard.Cols, testBoard.Rows)
+		if err != nil {
+			t.Fatalf("pose %d: %v", idx, err)
+		}
+		for i, expected := range pose.project(truth, testBoard) {
+			if d := math.Hypot(corners[i].X-expected.X, corners[i].Y-expected.Y); d > 0.3 {
+				t.Errorf("pose %d: expected the corner #%d at %v, got %v", idx, i, expected, corners[i])
+			}
+		}
+	}
+
+	blank := image.NewGray(image.Rect(0, 0, 400, 300))
+	if _, err := FindChessboardCorners(blank, testBoard.Cols, testBoard.Rows); err == nil {
+		t.Errorf("expected no board in a blank image")
+	}
+}
+
+func TestCalibrator(t *testing.T) {
+	truth := newTestCalibration(ModelPinhole)
+	calibrator := NewCalibrator(truth.Width, truth.Height, Config{
+		Board:         testBoard,
+		FixK3:         true,
+		FixTangential: true,
+	})
+	for idx, pose := range testPoses {
+		img := pose.render(truth, testBoard)
+		added, err := calibrator.AddImage(img)
+		if err != nil {
+			t.Fatalf("pose %d: %v", idx, err)
+		}
+		if !added {
+			t.Errorf("pose %d: expected the view to be added", idx)
+		}
+		// the same view again is not added
+		if added, _ := calibrator.AddImage(img); added {
+			t.Errorf("pose %d: expected the repeated view to be skipped", idx)
+		}
+	}
+
+	calib, err := calibrator.Calibrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tangential distortion of the truth is tiny, so it is
+	// fine to have it fixed
+	checkCalibration(t, truth, calib, 3, 0.03)
+	if calib.RMSError > 0.3 {
+		t.Errorf("expected a sub-pixel reprojection error, got %v", calib.RMSError)
+	}
+}
@@ -0,0 +1,79 @@
+package calibration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// Camera rectifies the frames of the wrapped camera; the frames of
+// the wrapped camera are released right after the rectification.
+type Camera struct {
+	camera.Camera
+	Rectifier *Rectifier
+
+	pool sync.Pool
+}
+
+var _ camera.Camera = (*Camera)(nil)
+
+// NewCamera wraps the camera; the calibration is scaled
+// to the resolution of the camera if needed.
+func NewCamera(cam camera.Camera, calib *Calibration, cfg RectifyConfig) (*Camera, error) {
+	format := cam.GetFormat()
+	calib, err := calib.Scaled(format.Width, format.Height)
+	if err != nil {
+		return nil, err
+	}
+	rectifier, err := NewRectifier(calib, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Camera{
+		Camera:    cam,
+		Rectifier: rectifier,
+	}, nil
+}
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	frame, err := c.Camera.GetFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &camera.ImageFrame{
+		CaptureTS: camera.FrameTimestamp(frame),
+	}
+	if skipCounter, ok := frame.(camera.FrameSkipCounter); ok {
+		result.Skipped = skipCounter.SkippedFrames()
+	}
+
+	src := frame.Image()
+	dst, _ := c.pool.Get().(image.Image)
+	if dst == nil || dst.Bounds().Size() != src.Bounds().Size() {
+		dst, err = newImageLike(src)
+	}
+	if err == nil {
+		err = c.Rectifier.RectifyInto(dst, src)
+	}
+	if releaseErr := c.Camera.ReleaseFrame(frame); releaseErr != nil {
+		err = errors.Join(err, fmt.Errorf("unable to release a frame: %w", releaseErr))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to rectify a frame: %w", err)
+	}
+	result.Img = dst
+	return result, nil
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	f, ok := frame.(*camera.ImageFrame)
+	if !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	c.pool.Put(f.Img)
+	return nil
+}
@@ -0,0 +1,432 @@
+package calibration
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+const (
+	// chessRadius is the radius of the ring sampled by the corner
+	// detector; the squares of the board should be at least twice
+	// as large (in pixels).
+	chessRadius = 5
+
+	// maxCandidates limits the amount of the corner candidates
+	// (the strongest ones are kept).
+	maxCandidates = 2000
+
+	// maxSeeds is how many candidates are tried as the first corner
+	// of the grid before giving up.
+	maxSeeds = 20
+)
+
+// Point is a point of an image, in pixels.
+type Point struct {
+	X, Y float64
+}
+
+// chessRing are the offsets of the 16 points of the ring around
+// a pixel, in the order of the angle.
+var chessRing = func() [16]image.Point {
+	var ring [16]image.Point
+	for i := range ring {
+		angle := float64(i) * math.Pi / 8
+		ring[i] = image.Point{
+			X: int(math.Round(chessRadius * math.Cos(angle))),
+			Y: int(math.Round(chessRadius * math.Sin(angle))),
+		}
+	}
+	return ring
+}()
+
+// lumaPlane returns the Y plane of the image, without copying it
+// for the YUV and gray images; the bounds start at (0, 0).
+func lumaPlane(img image.Image) *image.Gray {
+	r := img.Bounds()
+	switch img := img.(type) {
+	case *ximage.NV12:
+		offset := img.YOffset(r.Min.X, r.Min.Y)
+		return &image.Gray{Pix: img.Y[offset:], Stride: img.YStride, Rect: image.Rect(0, 0, r.Dx(), r.Dy())}
+	case *image.YCbCr:
+		offset := img.YOffset(r.Min.X, r.Min.Y)
+		return &image.Gray{Pix: img.Y[offset:], Stride: img.YStride, Rect: image.Rect(0, 0, r.Dx(), r.Dy())}
+	case *image.Gray:
+		offset := img.PixOffset(r.Min.X, r.Min.Y)
+		return &image.Gray{Pix: img.Pix[offset:], Stride: img.Stride, Rect: image.Rect(0, 0, r.Dx(), r.Dy())}
+	}
+
+	result := image.NewGray(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := result.Pix[(y-r.Min.Y)*result.Stride:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			row[x-r.Min.X] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+		}
+	}
+	return result
+}
+
+type candidate struct {
+	Point
+	Response int
+}
+
+// chessResponse is the ChESS corner response (S. Bennett, J. Lasenby,
+// "ChESS - Quick and Robust Detection of Chess-board Features"):
+// positive at the saddle points of the checkerboard and low at
+// the edges and the blobs.
+func chessResponse(img *image.Gray, x, y int) int {
+	var ring [16]int
+	center := y*img.Stride + x
+	ringSum := 0
+	for i, offset := range chessRing {
+		ring[i] = int(img.Pix[center+offset.Y*img.Stride+offset.X])
+		ringSum += ring[i]
+	}
+
+	sumResponse, diffResponse := 0, 0
+	for i := 0; i < 4; i++ {
+		sumResponse += abs(ring[i] + ring[i+8] - ring[i+4] - ring[i+12])
+	}
+	for i := 0; i < 8; i++ {
+		diffResponse += abs(ring[i] - ring[i+8])
+	}
+
+	localSum := 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			localSum += int(img.Pix[center+dy*img.Stride+dx])
+		}
+	}
+	// 16 * |ringMean - localMean|
+	meanResponse := abs(ringSum*9-localSum*16) / 9
+	return sumResponse - diffResponse - meanResponse
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// findCandidates returns the local maxima of the corner response.
+func findCandidates(img *image.Gray) []candidate {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	border := chessRadius + 1
+	if w <= 2*border || h <= 2*border {
+		return nil
+	}
+
+	responses := make([]int, w*h)
+	maxResponse := 0
+	for y := border; y < h-border; y++ {
+		for x := border; x < w-border; x++ {
+			r := chessResponse(img, x, y)
+			responses[y*w+x] = r
+			maxResponse = max(maxResponse, r)
+		}
+	}
+	threshold := max(maxResponse/10, 16)
+
+	var result []candidate
+	const nmsRadius = chessRadius
+	for y := border; y < h-border; y++ {
+		for x := border; x < w-border; x++ {
+			r := responses[y*w+x]
+			if r < threshold {
+				continue
+			}
+			isMax := true
+			for dy := -nmsRadius; dy <= nmsRadius && isMax; dy++ {
+				yy := y + dy
+				if yy < 0 || yy >= h {
+					continue
+				}
+				for dx := -nmsRadius; dx <= nmsRadius; dx++ {
+					xx := x + dx
+					if xx < 0 || xx >= w || (dx == 0 && dy == 0) {
+						continue
+					}
+					other := responses[yy*w+xx]
+					// the ties are broken by the position, to keep one of them
+					if other > r || (other == r && (dy < 0 || (dy == 0 && dx < 0))) {
+						isMax = false
+						break
+					}
+				}
+			}
+			if isMax {
+				result = append(result, candidate{Point: Point{X: float64(x), Y: float64(y)}, Response: r})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Response > result[j].Response
+	})
+	if len(result) > maxCandidates {
+		result = result[:maxCandidates]
+	}
+	return result
+}
+
+// refineCorner finds the saddle point near p with a sub-pixel accuracy:
+// the gradients around a corner are orthogonal to the directions
+// to the corner, which gives a linear least-squares problem.
+func refineCorner(img *image.Gray, p Point, halfWindow int) Point {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	sigma2 := float64(halfWindow*halfWindow) / 2
+	for iter := 0; iter < 10; iter++ {
+		cx, cy := int(math.Round(p.X)), int(math.Round(p.Y))
+		if cx-halfWindow < 1 || cy-halfWindow < 1 || cx+halfWindow >= w-1 || cy+halfWindow >= h-1 {
+			return p
+		}
+		var a00, a01, a11, b0, b1 float64
+		for y := cy - halfWindow; y <= cy+halfWindow; y++ {
+			for x := cx - halfWindow; x <= cx+halfWindow; x++ {
+				gx := float64(int(img.Pix[y*img.Stride+x+1])-int(img.Pix[y*img.Stride+x-1])) / 2
+				gy := float64(int(img.Pix[(y+1)*img.Stride+x])-int(img.Pix[(y-1)*img.Stride+x])) / 2
+				dx, dy := float64(x)-p.X, float64(y)-p.Y
+				weight := math.Exp(-(dx*dx + dy*dy) / (2 * sigma2))
+				gxx, gxy, gyy := gx*gx*weight, gx*gy*weight, gy*gy*weight
+				a00 += gxx
+				a01 += gxy
+				a11 += gyy
+				b0 += gxx*float64(x) + gxy*float64(y)
+				b1 += gxy*float64(x) + gyy*float64(y)
+			}
+		}
+		det := a00*a11 - a01*a01
+		if det < 1e-9 {
+			return p
+		}
+		next := Point{
+			X: (a11*b0 - a01*b1) / det,
+			Y: (a00*b1 - a01*b0) / det,
+		}
+		if math.Hypot(next.X-p.X, next.Y-p.Y) > float64(halfWindow) {
+			// diverged, keeping the original estimate
+			return p
+		}
+		moved := math.Hypot(next.X-p.X, next.Y-p.Y)
+		p = next
+		if moved < 0.01 {
+			break
+		}
+	}
+	return p
+}
+
+// FindChessboardCorners finds the inner corners of a checkerboard with
+// the given amount of the inner corners per row (cols) and per column
+// (rows); only the Y plane of the image is used.
+//
+// The corners are returned row by row, so that the first row goes
+// left to right along the top of the board as seen by the camera
+// (for a square board any of the sides may be chosen as the top).
+func FindChessboardCorners(img image.Image, cols, rows int) ([]Point, error) {
+	if cols < 2 || rows < 2 {
+		return nil, fmt.Errorf("the board should have at least 2x2 inner corners, but it is %dx%d", cols, rows)
+	}
+	luma := lumaPlane(img)
+	candidates := findCandidates(luma)
+	if len(candidates) < cols*rows {
+		return nil, fmt.Errorf("found only %d corner candidates, but %d are expected", len(candidates), cols*rows)
+	}
+
+	for seed := 0; seed < min(maxSeeds, len(candidates)); seed++ {
+		grid := growGrid(candidates, seed)
+		if grid == nil {
+			continue
+		}
+		corners, ok := grid.corners(cols, rows)
+		if !ok {
+			continue
+		}
+		halfWindow := max(2, min(chessRadius, int(grid.Spacing/4)))
+		for i, c := range corners {
+			corners[i] = refineCorner(luma, c, halfWindow)
+		}
+		return corners, nil
+	}
+	return nil, fmt.Errorf("the checkerboard with %dx%d inner corners is not found", cols, rows)
+}
+
+type gridCell struct {
+	I, J int
+}
+
+type grid struct {
+	Points  map[gridCell]Point
+	Spacing float64
+}
+
+// growGrid assembles the candidates into a grid, starting from
+// the seed and predicting the position of each next corner from
+// the already found neighbors (which tolerates the perspective
+// and the lens distortion).
+func growGrid(candidates []candidate, seed int) *grid {
+	origin := candidates[seed].Point
+	dist := func(a, b Point) float64 {
+		return math.Hypot(a.X-b.X, a.Y-b.Y)
+	}
+
+	// the nearest neighbor gives the first axis
+	nearest, nearestDist := -1, math.Inf(1)
+	for i, c := range candidates {
+		if d := dist(c.Point, origin); i != seed && d < nearestDist {
+			nearest, nearestDist = i, d
+		}
+	}
+	if nearest < 0 || nearestDist < 2*chessRadius {
+		return nil
+	}
+	u := Point{X: candidates[nearest].X - origin.X, Y: candidates[nearest].Y - origin.Y}
+
+	// the nearest neighbor in a different direction gives the second axis
+	second, secondDist := -1, 2*nearestDist
+	for i, c := range candidates {
+		if i == seed || i == nearest {
+			continue
+		}
+		d := dist(c.Point, origin)
+		if d >= secondDist {
+			continue
+		}
+		cos := ((c.X-origin.X)*u.X + (c.Y-origin.Y)*u.Y) / (d * nearestDist)
+		if math.Abs(cos) < 0.6 {
+			second, secondDist = i, d
+		}
+	}
+	if second < 0 {
+		return nil
+	}
+	v := Point{X: candidates[second].X - origin.X, Y: candidates[second].Y - origin.Y}
+
+	g := &grid{
+		Points:  map[gridCell]Point{},
+		Spacing: nearestDist,
+	}
+	used := map[int]struct{}{seed: {}, nearest: {}, second: {}}
+	g.Points[gridCell{0, 0}] = origin
+	g.Points[gridCell{1, 0}] = candidates[nearest].Point
+	g.Points[gridCell{0, 1}] = candidates[second].Point
+	queue := []gridCell{{0, 0}, {1, 0}, {0, 1}}
+
+	// step returns the vector from the cell to its neighbor in
+	// the direction d, estimated from the nearby known pairs
+	step := func(cell, d gridCell) Point {
+		diff := func(a gridCell) (Point, bool) {
+			pa, okA := g.Points[a]
+			pb, okB := g.Points[gridCell{a.I + d.I, a.J + d.J}]
+			return Point{X: pb.X - pa.X, Y: pb.Y - pa.Y}, okA && okB
+		}
+		if s, ok := diff(gridCell{cell.I - d.I, cell.J - d.J}); ok {
+			return s
+		}
+		for _, side := range []gridCell{{cell.I + d.J, cell.J + d.I}, {cell.I - d.J, cell.J - d.I}} {
+			if s, ok := diff(side); ok {
+				return s
+			}
+			if s, ok := diff(gridCell{side.I - d.I, side.J - d.J}); ok {
+				return s
+			}
+		}
+		base := u
+		if d.J != 0 {
+			base = v
+		}
+		sign := float64(d.I + d.J)
+		return Point{X: base.X * sign, Y: base.Y * sign}
+	}
+
+	for len(queue) > 0 {
+		cell := queue[0]
+		queue = queue[1:]
+		p := g.Points[cell]
+		for _, dir := range []gridCell{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			next := gridCell{cell.I + dir.I, cell.J + dir.J}
+			if _, ok := g.Points[next]; ok {
+				continue
+			}
+			s := step(cell, dir)
+			predicted := Point{X: p.X + s.X, Y: p.Y + s.Y}
+			radius := 0.35 * math.Hypot(s.X, s.Y)
+
+			found, foundDist := -1, radius
+			for i, c := range candidates {
+				if _, ok := used[i]; ok {
+					continue
+				}
+				if d := dist(c.Point, predicted); d < foundDist {
+					found, foundDist = i, d
+				}
+			}
+			if found < 0 {
+				continue
+			}
+			used[found] = struct{}{}
+			g.Points[next] = candidates[found].Point
+			queue = append(queue, next)
+		}
+	}
+	return g
+}
+
+// corners returns the corners of the grid ordered row by row if
+// the grid is exactly of the size of the board.
+func (g *grid) corners(cols, rows int) ([]Point, bool) {
+	if len(g.Points) != cols*rows {
+		return nil, false
+	}
+	minI, minJ, maxI, maxJ := math.MaxInt, math.MaxInt, math.MinInt, math.MinInt
+	for cell := range g.Points {
+		minI, maxI = min(minI, cell.I), max(maxI, cell.I)
+		minJ, maxJ = min(minJ, cell.J), max(maxJ, cell.J)
+	}
+	width, height := maxI-minI+1, maxJ-minJ+1
+
+	at := func(i, j int) Point {
+		return g.Points[gridCell{minI + i, minJ + j}]
+	}
+	switch {
+	case width == cols && height == rows:
+	case width == rows && height == cols:
+		at = func(i, j int) Point {
+			return g.Points[gridCell{minI + j, minJ + i}]
+		}
+	default:
+		return nil, false
+	}
+
+	// making the rows go right and the columns go down (in the image
+	// coordinates), so that the board is not mirrored
+	p00, p10, p01 := at(0, 0), at(1, 0), at(0, 1)
+	crossZ := (p10.X-p00.X)*(p01.Y-p00.Y) - (p10.Y-p00.Y)*(p01.X-p00.X)
+	if crossZ < 0 {
+		orig := at
+		at = func(i, j int) Point {
+			return orig(cols-1-i, j)
+		}
+	}
+	// of the two rotations by 180 degrees, the first corner is the upper one
+	if first, last := at(0, 0), at(cols-1, rows-1); last.Y < first.Y {
+		orig := at
+		at = func(i, j int) Point {
+			return orig(cols-1-i, rows-1-j)
+		}
+	}
+
+	result := make([]Point, 0, cols*rows)
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			result = append(result, at(i, j))
+		}
+	}
+	return result, true
+}
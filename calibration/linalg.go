@@ -0,0 +1,198 @@
+package calibration
+
+import (
+	"fmt"
+	"math"
+)
+
+// The problems here are tiny (up to a few hundred unknowns), so the
+// plain dense algorithms are fast enough.
+
+type mat3 [3][3]float64
+
+func (a mat3) mulVec(v [3]float64) [3]float64 {
+	var r [3]float64
+	for i := 0; i < 3; i++ {
+		r[i] = a[i][0]*v[0] + a[i][1]*v[1] + a[i][2]*v[2]
+	}
+	return r
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func norm(a [3]float64) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+func scale(a [3]float64, s float64) [3]float64 {
+	return [3]float64{a[0] * s, a[1] * s, a[2] * s}
+}
+
+// rotationFromVector converts a rotation vector (the axis multiplied
+// by the angle) into a rotation matrix (the Rodrigues' formula).
+func rotationFromVector(r [3]float64) mat3 {
+	theta := norm(r)
+	if theta < 1e-12 {
+		return mat3{{1, -r[2], r[1]}, {r[2], 1, -r[0]}, {-r[1], r[0], 1}}
+	}
+	k := scale(r, 1/theta)
+	c, s := math.Cos(theta), math.Sin(theta)
+	t := 1 - c
+	return mat3{
+		{c + k[0]*k[0]*t, k[0]*k[1]*t - k[2]*s, k[0]*k[2]*t + k[1]*s},
+		{k[1]*k[0]*t + k[2]*s, c + k[1]*k[1]*t, k[1]*k[2]*t - k[0]*s},
+		{k[2]*k[0]*t - k[1]*s, k[2]*k[1]*t + k[0]*s, c + k[2]*k[2]*t},
+	}
+}
+
+// vectorFromRotation is the inverse of rotationFromVector.
+func vectorFromRotation(m mat3) [3]float64 {
+	cosTheta := math.Max(-1, math.Min(1, (m[0][0]+m[1][1]+m[2][2]-1)/2))
+	theta := math.Acos(cosTheta)
+	axis := [3]float64{m[2][1] - m[1][2], m[0][2] - m[2][0], m[1][0] - m[0][1]}
+	s := norm(axis)
+	switch {
+	case theta < 1e-9:
+		return [3]float64{}
+	case s < 1e-6:
+		// the angle is about pi: the axis is found from the diagonal
+		axis = [3]float64{
+			math.Sqrt(math.Max(0, (m[0][0]+1)/2)),
+			math.Sqrt(math.Max(0, (m[1][1]+1)/2)),
+			math.Sqrt(math.Max(0, (m[2][2]+1)/2)),
+		}
+		if m[0][1] < 0 {
+			axis[1] = -axis[1]
+		}
+		if m[0][2] < 0 {
+			axis[2] = -axis[2]
+		}
+		return scale(axis, theta/norm(axis))
+	}
+	return scale(axis, theta/s)
+}
+
+// symmetricEigen returns the eigenvalues and the eigenvectors (the columns
+// of the result) of the symmetric matrix via the Jacobi rotations.
+func symmetricEigen(a [][]float64) ([]float64, [][]float64) {
+	n := len(a)
+	m := make([][]float64, n)
+	v := make([][]float64, n)
+	for i := range a {
+		m[i] = append([]float64(nil), a[i]...)
+		v[i] = make([]float64, n)
+		v[i][i] = 1
+	}
+
+	for sweep := 0; sweep < 100; sweep++ {
+		off := 0.0
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				off += m[i][j] * m[i][j]
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(m[p][q]) < 1e-300 {
+					continue
+				}
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p] = c*mkp - s*mkq
+					m[k][q] = s*mkp + c*mkq
+				}
+				for k := 0; k < n; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k] = c*mpk - s*mqk
+					m[q][k] = s*mpk + c*mqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = c*vkp - s*vkq
+					v[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = m[i][i]
+	}
+	return values, v
+}
+
+// nullVector returns the unit vector x minimizing |Ax| given A^T A.
+func nullVector(ata [][]float64) []float64 {
+	values, vectors := symmetricEigen(ata)
+	best := 0
+	for i, value := range values {
+		if value < values[best] {
+			best = i
+		}
+	}
+	result := make([]float64, len(values))
+	for i := range result {
+		result[i] = vectors[i][best]
+	}
+	return result
+}
+
+// solveCholesky solves Ax = b for a symmetric positive-definite A.
+func solveCholesky(a [][]float64, b []float64) ([]float64, error) {
+	n := len(a)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, i+1)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return nil, fmt.Errorf("the matrix is not positive-definite")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for i := 0; i < n; i++ {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= l[i][k] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	for i := n - 1; i >= 0; i-- {
+		sum := x[i]
+		for k := i + 1; k < n; k++ {
+			sum -= l[k][i] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	return x, nil
+}
@@ -0,0 +1,179 @@
+// Package calibration estimates the intrinsics and the lens distortion
+// of a camera from pictures of a checkerboard, and rectifies the frames
+// (staying in YUV) via precomputed remap tables.
+//
+// Two lens models are supported: the pinhole model with the radial
+// and tangential (Brown-Conrady) distortion, and the equidistant
+// (Kannala-Brandt) fisheye model for the wide-angle lenses; the
+// coefficients are compatible with OpenCV (the "cv::fisheye" module
+// for the fisheye model).
+package calibration
+
+import (
+	"fmt"
+	"math"
+)
+
+// Model is the lens model.
+type Model int
+
+const (
+	// ModelPinhole has the distortion coefficients k1, k2, p1, p2, k3.
+	ModelPinhole = Model(iota)
+
+	// ModelFisheye has the distortion coefficients k1, k2, k3, k4.
+	ModelFisheye
+)
+
+func (m Model) String() string {
+	switch m {
+	case ModelPinhole:
+		return "pinhole"
+	case ModelFisheye:
+		return "fisheye"
+	}
+	return fmt.Sprintf("unknown_%d", int(m))
+}
+
+func (m Model) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Model) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "pinhole":
+		*m = ModelPinhole
+	case "fisheye":
+		*m = ModelFisheye
+	default:
+		return fmt.Errorf("unknown lens model '%s'", b)
+	}
+	return nil
+}
+
+// distortionCount returns the amount of the distortion coefficients.
+func (m Model) distortionCount() int {
+	if m == ModelFisheye {
+		return 4
+	}
+	return 5
+}
+
+// Calibration are the parameters of a camera at the given resolution.
+type Calibration struct {
+	Model  Model
+	Width  uint64
+	Height uint64
+
+	// Fx and Fy are the focal lengths and Cx and Cy is
+	// the principal point, in pixels.
+	Fx, Fy float64
+	Cx, Cy float64
+
+	// Distortion are the coefficients of the Model.
+	Distortion []float64
+
+	// RMSError is the root mean square reprojection error
+	// of the calibration, in pixels.
+	RMSError float64
+}
+
+func (c *Calibration) validate() error {
+	if c.Width == 0 || c.Height == 0 {
+		return fmt.Errorf("the resolution is not set")
+	}
+	if c.Fx <= 0 || c.Fy <= 0 {
+		return fmt.Errorf("the focal length should be positive, but it is %gx%g", c.Fx, c.Fy)
+	}
+	if len(c.Distortion) != c.Model.distortionCount() {
+		return fmt.Errorf("the %s model expects %d distortion coefficients, but got %d", c.Model, c.Model.distortionCount(), len(c.Distortion))
+	}
+	return nil
+}
+
+// Scaled returns the calibration for another resolution of the same
+// sensor, e.g. after calibrating at 1920x1080 and streaming at 1280x720;
+// the aspect ratio should be the same (the modes cropping the sensor
+// need a separate calibration).
+func (c *Calibration) Scaled(width, height uint64) (*Calibration, error) {
+	if width == c.Width && height == c.Height {
+		return c, nil
+	}
+	if width*c.Height != height*c.Width {
+		return nil, fmt.Errorf("the aspect ratio of %dx%d differs from the calibrated %dx%d", width, height, c.Width, c.Height)
+	}
+	scale := float64(width) / float64(c.Width)
+	result := *c
+	result.Width, result.Height = width, height
+	result.Fx *= scale
+	result.Fy *= scale
+	// the centers of the pixels are at +0.5
+	result.Cx = (c.Cx+0.5)*scale - 0.5
+	result.Cy = (c.Cy+0.5)*scale - 0.5
+	result.RMSError *= scale
+	result.Distortion = append([]float64(nil), c.Distortion...)
+	return &result, nil
+}
+
+// distort applies the lens distortion to the point (x, y, z) in the
+// coordinates of the camera, returning the distorted normalized
+// coordinates (to be multiplied by the focal length).
+func distort(model Model, d []float64, x, y, z float64) (float64, float64) {
+	if model == ModelFisheye {
+		r := math.Hypot(x, y)
+		if r < 1e-12 {
+			return 0, 0
+		}
+		theta := math.Atan2(r, z)
+		theta2 := theta * theta
+		thetaD := theta * (1 + theta2*(d[0]+theta2*(d[1]+theta2*(d[2]+theta2*d[3]))))
+		return thetaD * x / r, thetaD * y / r
+	}
+
+	x, y = x/z, y/z
+	k1, k2, p1, p2, k3 := d[0], d[1], d[2], d[3], d[4]
+	r2 := x*x + y*y
+	radial := 1 + r2*(k1+r2*(k2+r2*k3))
+	xd := x*radial + 2*p1*x*y + p2*(r2+2*x*x)
+	yd := y*radial + p1*(r2+2*y*y) + 2*p2*x*y
+	return xd, yd
+}
+
+// Project returns the pixel coordinates of the point (x, y, z)
+// in the coordinates of the camera.
+func (c *Calibration) Project(x, y, z float64) (float64, float64) {
+	xd, yd := distort(c.Model, c.Distortion, x, y, z)
+	return c.Fx*xd + c.Cx, c.Fy*yd + c.Cy
+}
+
+// Undistort returns the pixel coordinates the point (u, v) of the image
+// would have without the lens distortion (with the same focal length
+// and principal point); it returns false if the iterations did
+// not converge (e.g. far outside of the calibrated field of view).
+func (c *Calibration) Undistort(u, v float64) (float64, float64, bool) {
+	xd, yd := (u-c.Cx)/c.Fx, (v-c.Cy)/c.Fy
+	// Newton's method with a numerical Jacobian, starting
+	// from the distorted point
+	x, y := xd, yd
+	const eps = 1e-7
+	for i := 0; i < 20; i++ {
+		fx, fy := distort(c.Model, c.Distortion, x, y, 1)
+		ex, ey := fx-xd, fy-yd
+		if math.Hypot(ex, ey) < 1e-10 {
+			return c.Fx*x + c.Cx, c.Fy*y + c.Cy, true
+		}
+		ax, ay := distort(c.Model, c.Distortion, x+eps, y, 1)
+		bx, by := distort(c.Model, c.Distortion, x, y+eps, 1)
+		j00, j10 := (ax-fx)/eps, (ay-fy)/eps
+		j01, j11 := (bx-fx)/eps, (by-fy)/eps
+		det := j00*j11 - j01*j10
+		if math.Abs(det) < 1e-12 {
+			break
+		}
+		x -= (j11*ex - j01*ey) / det
+		y -= (-j10*ex + j00*ey) / det
+	}
+	fx, fy := distort(c.Model, c.Distortion, x, y, 1)
+	ok := math.Hypot(fx-xd, fy-yd) < 1e-6
+	return c.Fx*x + c.Cx, c.Fy*y + c.Cy, ok
+}
@@ -0,0 +1,341 @@
+package calibration
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+const (
+	// fillLuma and fillChroma are the color of the pixels
+	// outside of the source image (black).
+	fillLuma   = 0
+	fillChroma = 128
+)
+
+type RectifyConfig struct {
+	// Scale multiplies the focal length of the rectified image: below
+	// 1 more of the field of view is kept (with the black areas near
+	// the edges), above 1 the image is zoomed in; 1 is used if zero.
+	Scale float64
+}
+
+func (cfg RectifyConfig) withDefaults() RectifyConfig {
+	if cfg.Scale == 0 {
+		cfg.Scale = 1
+	}
+	return cfg
+}
+
+// planeMap is the remap table of a plane: for each pixel of the
+// rectified plane, the top-left of the 4 source pixels and the weights
+// of the right and the bottom ones (in 1/256); X0 is -1 if the
+// pixel is outside of the source image.
+type planeMap struct {
+	Width, Height int
+	X0, Y0        []int16
+	WX, WY        []uint8
+}
+
+// Rectifier removes the lens distortion from the images of the calibrated
+// resolution; the images stay in their YUV format (NV12, YUYV,
+// image.YCbCr or image.Gray), with bilinear interpolation
+// via the precomputed tables.
+type Rectifier struct {
+	Calibration *Calibration
+	Config      RectifyConfig
+
+	locker sync.Mutex
+	maps   map[image.Point]*planeMap
+}
+
+func NewRectifier(calib *Calibration, cfg RectifyConfig) (*Rectifier, error) {
+	if err := calib.validate(); err != nil {
+		return nil, fmt.Errorf("invalid calibration: %w", err)
+	}
+	if calib.Width > math.MaxInt16 || calib.Height > math.MaxInt16 {
+		return nil, fmt.Errorf("the resolution %dx%d is too high", calib.Width, calib.Height)
+	}
+	r := &Rectifier{
+		Calibration: calib,
+		Config:      cfg.withDefaults(),
+		maps:        map[image.Point]*planeMap{},
+	}
+	// the luma table is needed for any format
+	r.planeMap(1, 1)
+	return r, nil
+}
+
+// planeMap returns the table of a plane subsampled by the given
+// factors (e.g. 2x2 for the chroma of NV12), building it on first use.
+func (r *Rectifier) planeMap(subX, subY int) *planeMap {
+	key := image.Point{X: subX, Y: subY}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if m, ok := r.maps[key]; ok {
+		return m
+	}
+
+	c := r.Calibration
+	w, h := int(c.Width), int(c.Height)
+	pw, ph := (w+subX-1)/subX, (h+subY-1)/subY
+	m := &planeMap{
+		Width:  pw,
+		Height: ph,
+		X0:     make([]int16, pw*ph),
+		Y0:     make([]int16, pw*ph),
+		WX:     make([]uint8, pw*ph),
+		WY:     make([]uint8, pw*ph),
+	}
+	fx, fy := c.Fx*r.Config.Scale, c.Fy*r.Config.Scale
+	for j := 0; j < ph; j++ {
+		for i := 0; i < pw; i++ {
+			// the center of the pixel of the plane in the full resolution
+			u := (float64(i)+0.5)*float64(subX) - 0.5
+			v := (float64(j)+0.5)*float64(subY) - 0.5
+			srcU, srcV := c.Project((u-c.Cx)/fx, (v-c.Cy)/fy, 1)
+			// back to the coordinates of the plane
+			sx := (srcU+0.5)/float64(subX) - 0.5
+			sy := (srcV+0.5)/float64(subY) - 0.5
+
+			idx := j*pw + i
+			if math.IsNaN(sx) || math.IsNaN(sy) || sx < -0.5 || sy < -0.5 || sx > float64(pw)-0.5 || sy > float64(ph)-0.5 {
+				m.X0[idx] = -1
+				continue
+			}
+			x0, wx := splitCoordinate(sx, pw)
+			y0, wy := splitCoordinate(sy, ph)
+			m.X0[idx], m.Y0[idx] = int16(x0), int16(y0)
+			m.WX[idx], m.WY[idx] = wx, wy
+		}
+	}
+	r.maps[key] = m
+	return m
+}
+
+// splitCoordinate returns the integer part (so that the next pixel
+// exists as well) and the fractional part in 1/256.
+func splitCoordinate(s float64, size int) (int, uint8) {
+	s = math.Max(0, math.Min(float64(size-1), s))
+	i := min(int(s), max(size-2, 0))
+	frac := math.Round((s - float64(i)) * 256)
+	return i, uint8(min(frac, 255))
+}
+
+func lerp(p00, p01, p10, p11 uint8, wx, wy uint8) uint8 {
+	x1, y1 := uint32(wx), uint32(wy)
+	x0, y0 := 256-x1, 256-y1
+	top := uint32(p00)*x0 + uint32(p01)*x1
+	bottom := uint32(p10)*x0 + uint32(p11)*x1
+	return uint8((top*y0 + bottom*y1 + 1<<15) >> 16)
+}
+
+// remapPlane rectifies a plane of bytes.
+func remapPlane(m *planeMap, dst []uint8, dstStride int, src []uint8, srcStride int, fill uint8) {
+	for j := 0; j < m.Height; j++ {
+		row := dst[j*dstStride : j*dstStride+m.Width]
+		for i := range row {
+			idx := j*m.Width + i
+			x0 := int(m.X0[idx])
+			if x0 < 0 {
+				row[i] = fill
+				continue
+			}
+			offset := int(m.Y0[idx])*srcStride + x0
+			row[i] = lerp(
+				src[offset], src[offset+1],
+				src[offset+srcStride], src[offset+srcStride+1],
+				m.WX[idx], m.WY[idx],
+			)
+		}
+	}
+}
+
+func (r *Rectifier) checkSize(img image.Image) error {
+	b := img.Bounds()
+	if uint64(b.Dx()) != r.Calibration.Width || uint64(b.Dy()) != r.Calibration.Height {
+		return fmt.Errorf("the image is %dx%d, but the calibration is for %dx%d", b.Dx(), b.Dy(), r.Calibration.Width, r.Calibration.Height)
+	}
+	if b.Min.X%2 != 0 || b.Min.Y%2 != 0 {
+		return fmt.Errorf("the image starts at odd coordinates %v", b.Min)
+	}
+	return nil
+}
+
+// Rectify returns a new rectified image of the same type.
+func (r *Rectifier) Rectify(src image.Image) (image.Image, error) {
+	dst, err := newImageLike(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.RectifyInto(dst, src); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// newImageLike allocates an image of the same type, size and layout.
+func newImageLike(img image.Image) (image.Image, error) {
+	rect := image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+	switch img := img.(type) {
+	case *ximage.NV12:
+		return ximage.NewNV12(rect), nil
+	case *ximage.YUYV:
+		return ximage.NewYUYV(rect), nil
+	case *image.YCbCr:
+		return image.NewYCbCr(rect, img.SubsampleRatio), nil
+	case *image.Gray:
+		return image.NewGray(rect), nil
+	}
+	return nil, fmt.Errorf("unsupported image type %T (expected NV12, YUYV, YCbCr or Gray)", img)
+}
+
+// RectifyInto writes the rectified src into dst, which should be
+// an image of the same type and size (like the one from Rectify).
+func (r *Rectifier) RectifyInto(dst, src image.Image) error {
+	if err := r.checkSize(src); err != nil {
+		return err
+	}
+	if dst.Bounds().Size() != src.Bounds().Size() {
+		return fmt.Errorf("the sizes of the images differ: %v != %v", dst.Bounds().Size(), src.Bounds().Size())
+	}
+	sb, db := src.Bounds(), dst.Bounds()
+
+	switch src := src.(type) {
+	case *ximage.NV12:
+		dst, ok := dst.(*ximage.NV12)
+		if !ok {
+			return fmt.Errorf("expected the destination of type %T, but got %T", src, dst)
+		}
+		remapPlane(r.planeMap(1, 1), dst.Y[dst.YOffset(db.Min.X, db.Min.Y):], dst.YStride, src.Y[src.YOffset(sb.Min.X, sb.Min.Y):], src.YStride, fillLuma)
+		remapCbCr(r.planeMap(2, 2), dst.CbCr[dst.COffset(db.Min.X, db.Min.Y):], dst.YStride/2, src.CbCr[src.COffset(sb.Min.X, sb.Min.Y):], src.YStride/2)
+	case *ximage.YUYV:
+		dst, ok := dst.(*ximage.YUYV)
+		if !ok {
+			return fmt.Errorf("expected the destination of type %T, but got %T", src, dst)
+		}
+		r.remapYUYV(dst, src)
+	case *image.YCbCr:
+		dst, ok := dst.(*image.YCbCr)
+		if !ok || dst.SubsampleRatio != src.SubsampleRatio {
+			return fmt.Errorf("expected the destination of type %T with the same subsampling, but got %T", src, dst)
+		}
+		subX, subY := chromaSubsampling(src.SubsampleRatio)
+		if subX == 0 {
+			return fmt.Errorf("unsupported subsampling %v", src.SubsampleRatio)
+		}
+		remapPlane(r.planeMap(1, 1), dst.Y[dst.YOffset(db.Min.X, db.Min.Y):], dst.YStride, src.Y[src.YOffset(sb.Min.X, sb.Min.Y):], src.YStride, fillLuma)
+		m := r.planeMap(subX, subY)
+		dstC, srcC := dst.COffset(db.Min.X, db.Min.Y), src.COffset(sb.Min.X, sb.Min.Y)
+		remapPlane(m, dst.Cb[dstC:], dst.CStride, src.Cb[srcC:], src.CStride, fillChroma)
+		remapPlane(m, dst.Cr[dstC:], dst.CStride, src.Cr[srcC:], src.CStride, fillChroma)
+	case *image.Gray:
+		dst, ok := dst.(*image.Gray)
+		if !ok {
+			return fmt.Errorf("expected the destination of type %T, but got %T", src, dst)
+		}
+		remapPlane(r.planeMap(1, 1), dst.Pix[dst.PixOffset(db.Min.X, db.Min.Y):], dst.Stride, src.Pix[src.PixOffset(sb.Min.X, sb.Min.Y):], src.Stride, fillLuma)
+	default:
+		return fmt.Errorf("unsupported image type %T (expected NV12, YUYV, YCbCr or Gray)", src)
+	}
+	return nil
+}
+
+func chromaSubsampling(ratio image.YCbCrSubsampleRatio) (int, int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio444:
+		return 1, 1
+	case image.YCbCrSubsampleRatio422:
+		return 2, 1
+	case image.YCbCrSubsampleRatio420:
+		return 2, 2
+	case image.YCbCrSubsampleRatio440:
+		return 1, 2
+	case image.YCbCrSubsampleRatio411:
+		return 4, 1
+	case image.YCbCrSubsampleRatio410:
+		return 4, 2
+	}
+	return 0, 0
+}
+
+// remapCbCr rectifies the interleaved chroma plane of NV12.
+func remapCbCr(m *planeMap, dst []ximage.CbCr, dstStride int, src []ximage.CbCr, srcStride int) {
+	for j := 0; j < m.Height; j++ {
+		row := dst[j*dstStride : j*dstStride+m.Width]
+		for i := range row {
+			idx := j*m.Width + i
+			x0 := int(m.X0[idx])
+			if x0 < 0 {
+				row[i] = ximage.CbCr{Cb: fillChroma, Cr: fillChroma}
+				continue
+			}
+			offset := int(m.Y0[idx])*srcStride + x0
+			p00, p01 := src[offset], src[offset+1]
+			p10, p11 := src[offset+srcStride], src[offset+srcStride+1]
+			wx, wy := m.WX[idx], m.WY[idx]
+			row[i] = ximage.CbCr{
+				Cb: lerp(p00.Cb, p01.Cb, p10.Cb, p11.Cb, wx, wy),
+				Cr: lerp(p00.Cr, p01.Cr, p10.Cr, p11.Cr, wx, wy),
+			}
+		}
+	}
+}
+
+// remapYUYV rectifies the packed YUYV: the luma with the full-resolution
+// table and the chroma (shared by the pairs of pixels) with
+// the horizontally subsampled one.
+func (r *Rectifier) remapYUYV(dst, src *ximage.YUYV) {
+	lumaMap, chromaMap := r.planeMap(1, 1), r.planeMap(2, 1)
+	sb, db := src.Bounds(), dst.Bounds()
+	srcPix := src.Y0CbY1Cr[src.Y0CbY1CrOffset(sb.Min.X, sb.Min.Y):]
+	dstPix := dst.Y0CbY1Cr[dst.Y0CbY1CrOffset(db.Min.X, db.Min.Y):]
+	srcStride, dstStride := src.YStride/2, dst.YStride/2
+
+	lumaAt := func(x, y int) uint8 {
+		p := srcPix[y*srcStride+x/2]
+		if x&1 == 0 {
+			return p.Y0
+		}
+		return p.Y1
+	}
+	luma := func(idx int) uint8 {
+		x0 := int(lumaMap.X0[idx])
+		if x0 < 0 {
+			return fillLuma
+		}
+		y0 := int(lumaMap.Y0[idx])
+		return lerp(
+			lumaAt(x0, y0), lumaAt(x0+1, y0),
+			lumaAt(x0, y0+1), lumaAt(x0+1, y0+1),
+			lumaMap.WX[idx], lumaMap.WY[idx],
+		)
+	}
+
+	for j := 0; j < chromaMap.Height; j++ {
+		row := dstPix[j*dstStride : j*dstStride+chromaMap.Width]
+		for i := range row {
+			idx := j*chromaMap.Width + i
+			out := ximage.Y0CbY1Cr{
+				Y0: luma(j*lumaMap.Width + 2*i),
+				Cb: fillChroma,
+				Cr: fillChroma,
+			}
+			if 2*i+1 < lumaMap.Width {
+				out.Y1 = luma(j*lumaMap.Width + 2*i + 1)
+			}
+			if x0 := int(chromaMap.X0[idx]); x0 >= 0 {
+				offset := int(chromaMap.Y0[idx])*srcStride + x0
+				p00, p01 := srcPix[offset], srcPix[offset+1]
+				p10, p11 := srcPix[offset+srcStride], srcPix[offset+srcStride+1]
+				wx, wy := chromaMap.WX[idx], chromaMap.WY[idx]
+				out.Cb = lerp(p00.Cb, p01.Cb, p10.Cb, p11.Cb, wx, wy)
+				out.Cr = lerp(p00.Cr, p01.Cr, p10.Cr, p11.Cr, wx, wy)
+			}
+			row[i] = out
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package calibration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// Store is a set of the calibrations keyed by the camera (see CameraKey),
+// saved as JSON.
+type Store map[string]*Calibration
+
+// byIDDir contains the symlinks to the V4L2 devices named after
+// the model and the serial number of the camera.
+var byIDDir = "/dev/v4l/by-id"
+
+// CameraKey returns the key of the camera in a Store, which stays the same
+// when the camera is replugged (even into another port) or the device
+// nodes are renumbered: the name of the /dev/v4l/by-id symlink to
+// the device if any, otherwise the name and the bus of the device (if
+// the platform is a camera.DeviceDescriber), otherwise the device path.
+func CameraKey(dev camera.DevicePathAndPlatform) string {
+	if key, ok := byIDKey(dev.DevicePath); ok {
+		return key
+	}
+	if describer, ok := dev.Platform.(camera.DeviceDescriber); ok {
+		desc, err := describer.DescribeDevice(dev.DevicePath)
+		if err == nil && desc.Name != "" {
+			return "device:" + desc.Name + ":" + desc.BusInfo
+		}
+	}
+	return dev.DevicePath
+}
+
+func byIDKey(devicePath camera.DevicePath) (string, bool) {
+	target, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return "", false
+	}
+	entries, err := os.ReadDir(byIDDir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		linkTarget, err := filepath.EvalSymlinks(filepath.Join(byIDDir, entry.Name()))
+		if err == nil && linkTarget == target {
+			return "by-id:" + entry.Name(), true
+		}
+	}
+	return "", false
+}
+
+// LoadStore reads the store; a missing file is an empty store.
+func LoadStore(path string) (Store, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Store{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%s': %w", path, err)
+	}
+	s := Store{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("unable to parse '%s': %w", path, err)
+	}
+	for key, c := range s {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("invalid calibration of '%s' in '%s': %w", key, path, err)
+		}
+	}
+	return s, nil
+}
+
+// Save writes the store, replacing the file atomically.
+func (s Store) Save(path string) (_err error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to serialize the calibrations: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create a temporary file: %w", err)
+	}
+	defer func() {
+		if _err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	_, err = f.Write(append(b, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write '%s': %w", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace '%s': %w", path, err)
+	}
+	return nil
+}
+
+// Lookup returns the calibration of the camera scaled
+// to the resolution (see Calibration.Scaled).
+func (s Store) Lookup(key string, width, height uint64) (*Calibration, error) {
+	c, ok := s[key]
+	if !ok {
+		return nil, fmt.Errorf("camera '%s' is not calibrated", key)
+	}
+	return c.Scaled(width, height)
+}
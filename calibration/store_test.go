@@ -0,0 +1,95 @@
+package calibration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// testDescriber describes the devices with the given descriptor;
+// the other methods of the platform are not used.
+type testDescriber struct {
+	camera.Platform
+	Descriptor camera.DeviceDescriptor
+}
+
+func (p testDescriber) DescribeDevice(camera.DevicePath) (camera.DeviceDescriptor, error) {
+	return p.Descriptor, nil
+}
+
+func TestCameraKey(t *testing.T) {
+	dir := t.TempDir()
+	oldByIDDir := byIDDir
+	byIDDir = filepath.Join(dir, "by-id")
+	defer func() {
+		byIDDir = oldByIDDir
+	}()
+	for _, name := range []string{"video0", "video1", "video2"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(byIDDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for target, name := range map[string]string{
+		"video0": "usb-Vendor_Camera_SN123-video-index0",
+		"video1": "usb-Vendor_Camera_SN123-video-index1",
+	} {
+		if err := os.Symlink(filepath.Join("..", target), filepath.Join(byIDDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plat := testDescriber{
+		Descriptor: camera.DeviceDescriptor{Name: "Camera", BusInfo: "usb-0000:00:14.0-2"},
+	}
+	for _, tc := range []struct {
+		devicePath camera.DevicePath
+		platform   camera.Platform
+		key        string
+	}{
+		{filepath.Join(dir, "video0"), plat, "by-id:usb-Vendor_Camera_SN123-video-index0"},
+		{filepath.Join(byIDDir, "usb-Vendor_Camera_SN123-video-index0"), plat, "by-id:usb-Vendor_Camera_SN123-video-index0"},
+		{filepath.Join(dir, "video1"), plat, "by-id:usb-Vendor_Camera_SN123-video-index1"},
+		{filepath.Join(dir, "video2"), plat, "device:Camera:usb-0000:00:14.0-2"},
+		{"rtsp://camera/stream", testDescriber{}, "rtsp://camera/stream"},
+	} {
+		key := CameraKey(camera.DevicePathAndPlatform{DevicePath: tc.devicePath, Platform: tc.platform})
+		if key != tc.key {
+			t.Errorf("'%s': expected the key '%s', got '%s'", tc.devicePath, tc.key, key)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calibrations.json")
+	store, err := LoadStore(path)
+	if err != nil || len(store) != 0 {
+		t.Fatalf("expected an empty store, got %v (%v)", store, err)
+	}
+	store["camera"] = newTestCalibration(ModelPinhole)
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calib, err := store.Lookup("camera", 800, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calib.Width != 800 || calib.Fx != 680 || calib.Cx != 406.5 || calib.Model != ModelPinhole {
+		t.Errorf("unexpected scaled calibration %+v", calib)
+	}
+	if _, err := store.Lookup("camera", 800, 800); err == nil {
+		t.Errorf("expected an error for another aspect ratio")
+	}
+	if _, err := store.Lookup("other", 400, 300); err == nil {
+		t.Errorf("expected an error for an unknown camera")
+	}
+}
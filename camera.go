@@ -23,3 +23,10 @@ type CameraCompressed interface {
 	GetCompressedFrames(context.Context) (FramesCompressed, error)
 	ReleaseFrames(FramesCompressed) error
 }
+
+// LatestFrameOnlySetter is implemented by cameras which are able to drop
+// the frames queued while the consumer was busy, so that GetFrame always
+// returns the most recent frame (see also FrameSkipCounter).
+type LatestFrameOnlySetter interface {
+	SetLatestFrameOnly(bool)
+}
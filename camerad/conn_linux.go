@@ -0,0 +1,131 @@
+package camerad
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Conn is a connection between the daemon and a client.
+type Conn struct {
+	conn *net.UnixConn
+
+	writeLocker sync.Mutex
+
+	// buf and oob are only used by Receive
+	buf []byte
+	oob []byte
+}
+
+func NewConn(conn *net.UnixConn) *Conn {
+	return &Conn{
+		conn: conn,
+		buf:  make([]byte, maxMessageSize),
+		oob:  make([]byte, unix.CmsgSpace(4)),
+	}
+}
+
+// Dial connects to the daemon after checking the owner of the socket.
+func Dial(socketPath string) (*Conn, error) {
+	if err := checkSocket(socketPath); err != nil {
+		return nil, fmt.Errorf("unable to connect to the daemon at '%s': %w", socketPath, err)
+	}
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: socketPath, Net: "unixpacket"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the daemon at '%s': %w", socketPath, err)
+	}
+	return NewConn(conn), nil
+}
+
+// Send sends the message together with the file descriptor
+// (if it is not negative); it is safe for concurrent use.
+func (c *Conn) Send(msg *Message, fd int) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to serialize a message: %w", err)
+	}
+	if len(b) > maxMessageSize {
+		return fmt.Errorf("the message is too long: %d > %d", len(b), maxMessageSize)
+	}
+	var oob []byte
+	if fd >= 0 {
+		oob = unix.UnixRights(fd)
+	}
+
+	c.writeLocker.Lock()
+	defer c.writeLocker.Unlock()
+	if _, _, err := c.conn.WriteMsgUnix(b, oob, nil); err != nil {
+		return fmt.Errorf("unable to send a message: %w", err)
+	}
+	return nil
+}
+
+// Receive returns the next message and the received file descriptor
+// (or -1); it should not be called concurrently.
+func (c *Conn) Receive() (*Message, int, error) {
+	n, oobn, flags, _, err := c.conn.ReadMsgUnix(c.buf, c.oob)
+	if errors.Is(err, io.EOF) || errors.Is(err, unix.ECONNRESET) {
+		return nil, -1, net.ErrClosed
+	}
+	if err != nil {
+		return nil, -1, err
+	}
+	fd := -1
+	if oobn > 0 {
+		fds, err := parseRights(c.oob[:oobn])
+		if err != nil {
+			return nil, -1, err
+		}
+		for idx, received := range fds {
+			if idx == 0 {
+				fd = received
+				continue
+			}
+			unix.Close(received)
+		}
+	}
+	if flags&(unix.MSG_TRUNC|unix.MSG_CTRUNC) != 0 {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+		return nil, -1, fmt.Errorf("a truncated message")
+	}
+	if n == 0 {
+		// an empty read means the peer disconnected
+		return nil, -1, net.ErrClosed
+	}
+
+	var msg Message
+	if err := json.Unmarshal(c.buf[:n], &msg); err != nil {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+		return nil, -1, fmt.Errorf("unable to parse a message: %w", err)
+	}
+	return &msg, fd, nil
+}
+
+func parseRights(oob []byte) ([]int, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the control messages: %w", err)
+	}
+	var result []int
+	for _, msg := range msgs {
+		fds, err := unix.ParseUnixRights(&msg)
+		if err != nil {
+			continue
+		}
+		result = append(result, fds...)
+	}
+	return result, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
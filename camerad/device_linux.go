@@ -0,0 +1,365 @@
+package camerad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+)
+
+func frameSize(format camera.Format) int {
+	pixels := int(format.Width * format.Height)
+	if format.PixelFormat == camera.PixelFormatYUYV {
+		return pixels * 2
+	}
+	return pixels * 3 / 2
+}
+
+type subscriber struct {
+	Conn      *Conn
+	Streaming bool
+
+	// InFlight are the slots sent, but not released yet.
+	InFlight map[uint64]*slot
+
+	// Known are the slots which memfd was already sent.
+	Known map[uint64]bool
+
+	// Skipped is the amount of frames not sent since the last sent one.
+	Skipped uint64
+}
+
+// device is a camera shared between the subscribers.
+type device struct {
+	Server *Server
+	Device camera.DevicePathAndPlatform
+	Camera camera.Camera
+
+	// Format is the format of the frames in the slots.
+	Format camera.Format
+
+	closeCameraOnce sync.Once
+	closeCameraErr  error
+
+	// streamLocker serializes starting and stopping of the streaming.
+	streamLocker sync.Mutex
+	cancelFn     context.CancelFunc
+	done         chan struct{}
+
+	locker      sync.Mutex
+	subscribers map[*subscriber]struct{}
+	streamers   int
+	slots       []*slot
+	free        []*slot
+	seq         uint64
+	failure     error
+}
+
+func (d *device) addSubscriber(conn *Conn) *subscriber {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	sub := &subscriber{
+		Conn:     conn,
+		InFlight: map[uint64]*slot{},
+		Known:    map[uint64]bool{},
+	}
+	d.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// removeSubscriber returns true if it was the last subscriber;
+// the subscriber should be stopped already.
+func (d *device) removeSubscriber(sub *subscriber) bool {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	for id := range sub.InFlight {
+		d.releaseLocked(sub, id)
+	}
+	delete(d.subscribers, sub)
+	return len(d.subscribers) == 0
+}
+
+func (d *device) start(sub *subscriber) error {
+	d.streamLocker.Lock()
+	defer d.streamLocker.Unlock()
+	d.locker.Lock()
+	if d.failure != nil {
+		d.locker.Unlock()
+		return d.failure
+	}
+	if sub.Streaming {
+		d.locker.Unlock()
+		return nil
+	}
+	sub.Streaming = true
+	d.streamers++
+	first := d.streamers == 1
+	d.locker.Unlock()
+	if !first {
+		return nil
+	}
+
+	if err := d.Camera.StartStreaming(); err != nil {
+		d.locker.Lock()
+		sub.Streaming = false
+		d.streamers--
+		d.locker.Unlock()
+		return fmt.Errorf("unable to start streaming: %w", err)
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	d.cancelFn = cancelFn
+	d.done = make(chan struct{})
+	go func() {
+		defer close(d.done)
+		d.run(ctx)
+	}()
+	return nil
+}
+
+func (d *device) stop(sub *subscriber) error {
+	d.streamLocker.Lock()
+	defer d.streamLocker.Unlock()
+	d.locker.Lock()
+	if !sub.Streaming {
+		d.locker.Unlock()
+		return nil
+	}
+	sub.Streaming = false
+	d.streamers--
+	last := d.streamers == 0
+	d.locker.Unlock()
+	if !last {
+		return nil
+	}
+
+	d.cancelFn()
+	<-d.done
+	d.locker.Lock()
+	failed := d.failure != nil
+	d.locker.Unlock()
+	if failed {
+		// the camera is closed already (see fail)
+		return nil
+	}
+	if err := d.Camera.StopStreaming(); err != nil {
+		return fmt.Errorf("unable to stop streaming: %w", err)
+	}
+	return nil
+}
+
+func (d *device) release(sub *subscriber, slotID uint64) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	d.releaseLocked(sub, slotID)
+}
+
+func (d *device) releaseLocked(sub *subscriber, slotID uint64) {
+	s, ok := sub.InFlight[slotID]
+	if !ok {
+		return
+	}
+	delete(sub.InFlight, slotID)
+	s.Refs--
+	if s.Refs == 0 {
+		d.free = append(d.free, s)
+	}
+}
+
+// close closes the camera and frees the slots; it is called
+// after the last subscriber is removed.
+func (d *device) close() error {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	errs := []error{d.closeCamera()}
+	for _, s := range d.slots {
+		errs = append(errs, s.Close())
+	}
+	d.slots, d.free = nil, nil
+	return errors.Join(errs...)
+}
+
+// closeCamera closes the camera once.
+func (d *device) closeCamera() error {
+	d.closeCameraOnce.Do(func() {
+		d.closeCameraErr = d.Camera.Close()
+	})
+	return d.closeCameraErr
+}
+
+func (d *device) run(ctx context.Context) {
+	for {
+		frame, err := d.Camera.GetFrame(ctx)
+		if ctx.Err() != nil {
+			if frame != nil {
+				d.releaseFrame(frame)
+			}
+			return
+		}
+		if err != nil {
+			d.fail(fmt.Errorf("unable to get a frame of '%s': %w", d.Device.DevicePath, err))
+			return
+		}
+		err = d.distribute(frame)
+		d.releaseFrame(frame)
+		if err != nil {
+			d.fail(err)
+			return
+		}
+	}
+}
+
+func (d *device) releaseFrame(frame camera.Frame) {
+	if err := d.Camera.ReleaseFrame(frame); err != nil {
+		d.Server.reportError(fmt.Errorf("unable to release a frame of '%s': %w", d.Device.DevicePath, err))
+	}
+}
+
+// fail notifies the subscribers that no more frames will come; the camera
+// is closed and the device is forgotten by the server, so that the next
+// subscriber reopens it (while the current subscribers are still around).
+func (d *device) fail(err error) {
+	d.Server.reportError(err)
+	d.locker.Lock()
+	d.failure = err
+	subs := make([]*subscriber, 0, len(d.subscribers))
+	for sub := range d.subscribers {
+		subs = append(subs, sub)
+	}
+	d.locker.Unlock()
+	if closeErr := d.closeCamera(); closeErr != nil {
+		d.Server.reportError(fmt.Errorf("unable to close camera '%s': %w", d.Device.DevicePath, closeErr))
+	}
+	d.Server.forget(d)
+	msg := &Message{
+		Type:  MessageTypeFailure,
+		Error: NewError(err),
+	}
+	for _, sub := range subs {
+		sub.Conn.Send(msg, -1)
+	}
+}
+
+// takeSlot returns a free slot if any subscriber is ready to receive
+// a frame, or nil otherwise (then the frame and the sourceSkipped
+// frames before it are counted as skipped by the streaming subscribers).
+func (d *device) takeSlot(sourceSkipped uint64) (*slot, error) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	ready := false
+	for sub := range d.subscribers {
+		if sub.Streaming && len(sub.InFlight) < d.Server.Config.MaxInFlight {
+			ready = true
+			break
+		}
+	}
+	if !ready {
+		for sub := range d.subscribers {
+			if sub.Streaming {
+				sub.Skipped += 1 + sourceSkipped
+			}
+		}
+		return nil, nil
+	}
+	if n := len(d.free); n > 0 {
+		s := d.free[n-1]
+		d.free = d.free[:n-1]
+		return s, nil
+	}
+	s, err := newSlot(d.Server.nextSlotID.Add(1), frameSize(d.Format))
+	if err != nil {
+		return nil, err
+	}
+	d.slots = append(d.slots, s)
+	return s, nil
+}
+
+type delivery struct {
+	Subscriber *subscriber
+	Message    *Message
+	FD         int
+}
+
+func (d *device) distribute(frame camera.Frame) error {
+	info := FrameInfo{
+		Seq:       d.seq,
+		CaptureTS: camera.FrameTimestamp(frame),
+	}
+	d.seq++
+	if sequencer, ok := frame.(camera.FrameSequencer); ok {
+		info.Seq = sequencer.Sequence()
+	}
+	var sourceSkipped uint64
+	if skipCounter, ok := frame.(camera.FrameSkipCounter); ok {
+		sourceSkipped = skipCounter.SkippedFrames()
+	}
+
+	s, err := d.takeSlot(sourceSkipped)
+	if err != nil || s == nil {
+		return err
+	}
+	// the slot is not visible to anybody, so it is written without the lock
+	b, err := rawimage.AppendBytes(s.Mem[:0], &d.Format, frame.Image())
+	if err == nil && len(b) != len(s.Mem) {
+		err = fmt.Errorf("unexpected size of the frame: %d != %d", len(b), len(s.Mem))
+	}
+	if err != nil {
+		d.locker.Lock()
+		d.free = append(d.free, s)
+		d.locker.Unlock()
+		return fmt.Errorf("unable to copy a frame of '%s': %w", d.Device.DevicePath, err)
+	}
+	if &b[0] != &s.Mem[0] {
+		copy(s.Mem, b)
+	}
+	info.Slot = s.ID
+	info.Size = len(s.Mem)
+
+	d.locker.Lock()
+	var deliveries []delivery
+	for sub := range d.subscribers {
+		if !sub.Streaming {
+			continue
+		}
+		if len(sub.InFlight) >= d.Server.Config.MaxInFlight {
+			sub.Skipped += 1 + sourceSkipped
+			continue
+		}
+		subInfo := info
+		subInfo.Skipped = sub.Skipped + sourceSkipped
+		sub.Skipped = 0
+		sub.InFlight[s.ID] = s
+		s.Refs++
+		fd := -1
+		if !sub.Known[s.ID] {
+			sub.Known[s.ID] = true
+			fd = s.ReadOnlyFD
+		}
+		deliveries = append(deliveries, delivery{
+			Subscriber: sub,
+			Message:    &Message{Type: MessageTypeFrame, Frame: &subInfo},
+			FD:         fd,
+		})
+	}
+	if s.Refs == 0 {
+		d.free = append(d.free, s)
+	}
+	d.locker.Unlock()
+
+	for _, delivery := range deliveries {
+		// a failure means the client is gone, and its connection
+		// handler removes the subscriber
+		delivery.Subscriber.Conn.Send(delivery.Message, delivery.FD)
+	}
+	return nil
+}
+
+func (d *device) controls() (camera.Controls, error) {
+	ctrls, ok := d.Camera.(camera.Controls)
+	if !ok {
+		return nil, fmt.Errorf("the camera has no controls: %w", camera.ErrNotSupported)
+	}
+	return ctrls, nil
+}
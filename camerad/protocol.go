@@ -0,0 +1,192 @@
+// Package camerad implements a daemon sharing the cameras between local
+// processes: the daemon owns the devices (only one process can stream
+// a V4L2 device at a time) and any amount of clients subscribe to them
+// over a Unix socket. The frames are passed via shared memory (memfd),
+// and only their metadata is sent over the socket.
+//
+// The client side is the camera.Platform implemented by platform/camerad.
+//
+// The protocol is a sequence of JSON messages over a SOCK_SEQPACKET
+// socket, one message per packet. A connection either makes one-shot
+// queries (MessageTypeListCameras, MessageTypeListFormats) or opens a
+// camera (MessageTypeOpen) and then controls the subscription.
+package camerad
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	// SocketPathEnv overrides the default path of the socket.
+	SocketPathEnv = "CAMERAD_SOCKET"
+
+	DefaultSocketName = "camerad.sock"
+
+	// maxMessageSize limits the size of a message (the longest ones
+	// are the lists of the formats and the controls).
+	maxMessageSize = 1 << 20
+)
+
+// DefaultSocketPath returns the path from SocketPathEnv if set,
+// or the socket in the runtime directory of the user, or (if there
+// is no runtime directory) the socket in FallbackSocketDir.
+func DefaultSocketPath() string {
+	if path := os.Getenv(SocketPathEnv); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, DefaultSocketName)
+	}
+	return filepath.Join(FallbackSocketDir(), DefaultSocketName)
+}
+
+// FallbackSocketDir returns the per-user directory of the socket in
+// the temporary directory. Since the temporary directory is shared with
+// the other users, the daemon creates it accessible only by the user,
+// and both sides refuse to use it if it is owned by somebody else.
+func FallbackSocketDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("camerad-%d", os.Getuid()))
+}
+
+type MessageType string
+
+const (
+	// The requests of the clients (each one is answered with
+	// MessageTypeReply, except MessageTypeRelease):
+	MessageTypeListCameras  = MessageType("list_cameras")
+	MessageTypeListFormats  = MessageType("list_formats")
+	MessageTypeOpen         = MessageType("open")
+	MessageTypeStart        = MessageType("start")
+	MessageTypeStop         = MessageType("stop")
+	MessageTypeRelease      = MessageType("release")
+	MessageTypeListControls = MessageType("list_controls")
+	MessageTypeGetControl   = MessageType("get_control")
+	MessageTypeSetControl   = MessageType("set_control")
+
+	// The messages of the daemon:
+	MessageTypeReply = MessageType("reply")
+
+	// MessageTypeFrame carries the memfd of the slot if the slot
+	// is sent to the client for the first time.
+	MessageTypeFrame = MessageType("frame")
+
+	// MessageTypeFailure means the camera failed, no more
+	// frames will be sent.
+	MessageTypeFailure = MessageType("failure")
+)
+
+// Device is a camera available via the daemon.
+type Device struct {
+	DevicePath camera.DevicePath
+	PlatformID camera.PlatformID
+	Identity   string
+	Descriptor camera.DeviceDescriptor
+}
+
+// FrameInfo describes a frame in a shared memory slot.
+type FrameInfo struct {
+	// Slot identifies the shared memory; the identifiers are not reused
+	// for other memory while the daemon runs.
+	Slot      uint64
+	Size      int
+	Seq       uint64
+	Skipped   uint64
+	CaptureTS time.Time
+}
+
+// Message is the union of all the messages; only the fields relevant
+// to the Type are set.
+type Message struct {
+	Type  MessageType
+	Error *Error
+
+	DevicePath   camera.DevicePath
+	Format       camera.Format
+	Devices      []Device
+	Formats      camera.Formats
+	Controls     []camera.Control
+	ControlID    camera.ControlID
+	ControlValue int32
+	Frame        *FrameInfo
+}
+
+// ErrorKind preserves the error sentinels of the camera package
+// across the socket.
+type ErrorKind string
+
+const (
+	ErrorKindOther          = ErrorKind("")
+	ErrorKindNotSupported   = ErrorKind("not_supported")
+	ErrorKindNotFound       = ErrorKind("not_found")
+	ErrorKindDeviceBusy     = ErrorKind("device_busy")
+	ErrorKindDeviceGone     = ErrorKind("device_gone")
+	ErrorKindFormatRejected = ErrorKind("format_rejected")
+	ErrorKindTimeout        = ErrorKind("timeout")
+	ErrorKindNoFrame        = ErrorKind("no_frame")
+)
+
+var errorKinds = []struct {
+	Kind ErrorKind
+	Err  error
+}{
+	{ErrorKindNotSupported, camera.ErrNotSupported},
+	{ErrorKindNotFound, camera.ErrNotFound},
+	{ErrorKindDeviceBusy, camera.ErrDeviceBusy},
+	{ErrorKindDeviceGone, camera.ErrDeviceGone},
+	{ErrorKindFormatRejected, camera.ErrFormatRejected},
+	{ErrorKindTimeout, camera.ErrTimeout},
+	{ErrorKindNoFrame, camera.ErrNoFrame},
+}
+
+type Error struct {
+	Kind    ErrorKind
+	Message string
+}
+
+// NewError returns nil if err is nil.
+func NewError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	result := &Error{Message: err.Error()}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.Err) {
+			result.Kind = k.Kind
+			break
+		}
+	}
+	return result
+}
+
+// Err converts the error back (wrapping the sentinel of its kind);
+// it returns nil if e is nil.
+func (e *Error) Err() error {
+	if e == nil {
+		return nil
+	}
+	for _, k := range errorKinds {
+		if k.Kind == e.Kind {
+			return &remoteError{message: e.Message, sentinel: k.Err}
+		}
+	}
+	return &remoteError{message: e.Message}
+}
+
+type remoteError struct {
+	message  string
+	sentinel error
+}
+
+func (e *remoteError) Error() string {
+	return "camerad: " + e.message
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.sentinel
+}
@@ -0,0 +1,341 @@
+package camerad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultMaxInFlight is the default amount of frames a client may
+	// hold; the frames beyond it are skipped for this client only.
+	DefaultMaxInFlight = 2
+)
+
+type Config struct {
+	// Registry provides the cameras; camera.DefaultRegistry() if nil.
+	Registry *camera.Registry
+
+	MaxInFlight int
+
+	// OnError is called on errors which cannot be returned to a client.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Registry == nil {
+		cfg.Registry = camera.DefaultRegistry()
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = DefaultMaxInFlight
+	}
+	return cfg
+}
+
+// Server is the daemon: it opens a camera on the first subscription,
+// streams it while any subscriber wants the frames, and closes it after
+// the last subscriber disconnects.
+type Server struct {
+	Config Config
+
+	nextSlotID atomic.Uint64
+
+	locker  sync.Mutex
+	devices map[camera.DevicePath]*device
+	conns   map[*Conn]struct{}
+}
+
+func New(cfg Config) *Server {
+	return &Server{
+		Config:  cfg.withDefaults(),
+		devices: map[camera.DevicePath]*device{},
+		conns:   map[*Conn]struct{}{},
+	}
+}
+
+func (s *Server) reportError(err error) {
+	if s.Config.OnError != nil {
+		s.Config.OnError(err)
+	}
+}
+
+// ListenAndServe listens on the socket (replacing a stale one) and
+// serves it until the context is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, socketPath string) error {
+	if err := prepareSocketDir(socketPath); err != nil {
+		return err
+	}
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.Dial("unixpacket", socketPath); err == nil {
+			conn.Close()
+			return fmt.Errorf("the daemon is already running at '%s': %w", socketPath, camera.ErrDeviceBusy)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return fmt.Errorf("unable to remove the stale socket '%s': %w", socketPath, err)
+		}
+	}
+	l, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: socketPath, Net: "unixpacket"})
+	if err != nil {
+		return fmt.Errorf("unable to listen at '%s': %w", socketPath, err)
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts the clients until the context is cancelled; then it
+// disconnects all the clients (which closes the cameras) and closes
+// the listener.
+func (s *Server) Serve(ctx context.Context, l *net.UnixListener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopCh:
+		}
+		l.Close()
+		s.locker.Lock()
+		defer s.locker.Unlock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+	}()
+
+	for {
+		unixConn, err := l.AcceptUnix()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("unable to accept a connection: %w", err)
+		}
+		conn := NewConn(unixConn)
+		s.locker.Lock()
+		if ctx.Err() != nil {
+			s.locker.Unlock()
+			conn.Close()
+			return ctx.Err()
+		}
+		s.conns[conn] = struct{}{}
+		s.locker.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(conn)
+			s.locker.Lock()
+			delete(s.conns, conn)
+			s.locker.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn *Conn) {
+	var (
+		d   *device
+		sub *subscriber
+	)
+	defer func() {
+		if sub != nil {
+			s.unsubscribe(d, sub)
+		}
+		conn.Close()
+	}()
+	for {
+		msg, fd, err := conn.Receive()
+		if fd >= 0 {
+			// clients have nothing to pass
+			unix.Close(fd)
+		}
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.reportError(fmt.Errorf("unable to receive a message: %w", err))
+			}
+			return
+		}
+
+		reply := &Message{Type: MessageTypeReply}
+		if d == nil {
+			switch msg.Type {
+			case MessageTypeListCameras, MessageTypeListFormats, MessageTypeOpen:
+			default:
+				err = fmt.Errorf("the camera is not opened")
+			}
+		}
+		if err == nil {
+			switch msg.Type {
+			case MessageTypeListCameras:
+				reply.Devices, err = s.listDevices()
+			case MessageTypeListFormats:
+				reply.Formats, err = s.listFormats(msg.DevicePath)
+			case MessageTypeOpen:
+				if d != nil {
+					err = fmt.Errorf("the camera is already opened")
+					break
+				}
+				d, sub, err = s.subscribe(msg.DevicePath, msg.Format, conn)
+				if err == nil {
+					reply.Format = d.Format
+				}
+			case MessageTypeStart:
+				err = d.start(sub)
+			case MessageTypeStop:
+				err = d.stop(sub)
+			case MessageTypeRelease:
+				if msg.Frame != nil {
+					d.release(sub, msg.Frame.Slot)
+				}
+				continue
+			case MessageTypeListControls:
+				var ctrls camera.Controls
+				if ctrls, err = d.controls(); err == nil {
+					reply.Controls, err = ctrls.ListControls()
+				}
+			case MessageTypeGetControl:
+				var ctrls camera.Controls
+				if ctrls, err = d.controls(); err == nil {
+					reply.ControlValue, err = ctrls.GetControl(msg.ControlID)
+				}
+			case MessageTypeSetControl:
+				var ctrls camera.Controls
+				if ctrls, err = d.controls(); err == nil {
+					err = ctrls.SetControl(msg.ControlID, msg.ControlValue)
+				}
+			default:
+				err = fmt.Errorf("unknown message type '%s'", msg.Type)
+			}
+		}
+		reply.Error = NewError(err)
+		if err := conn.Send(reply, -1); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) listDevices() ([]Device, error) {
+	cameras, err := s.Config.Registry.ListCameras()
+	result := make([]Device, 0, len(cameras))
+	for _, c := range cameras {
+		dev := Device{
+			DevicePath: c.DevicePath,
+			PlatformID: c.PlatformID,
+			Identity:   c.Identity(),
+		}
+		if describer, ok := c.Platform.(camera.DeviceDescriber); ok {
+			dev.Descriptor, _ = describer.DescribeDevice(c.DevicePath)
+		}
+		result = append(result, dev)
+	}
+	return result, err
+}
+
+func (s *Server) listFormats(devicePath camera.DevicePath) (camera.Formats, error) {
+	dev, err := s.Config.Registry.FindCamera(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	formats, err := dev.ListFormats()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the formats of '%s': %w", devicePath, err)
+	}
+	return rawimage.RawFormats(formats), nil
+}
+
+// subscribe opens the device if it is not opened yet; if it is, then
+// the format should match the opened one (or be zero).
+func (s *Server) subscribe(
+	devicePath camera.DevicePath,
+	format camera.Format,
+	conn *Conn,
+) (*device, *subscriber, error) {
+	dev, err := s.Config.Registry.FindCamera(devicePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	d, ok := s.devices[dev.DevicePath]
+	if ok {
+		if format != (camera.Format{}) && format != d.Format {
+			return nil, nil, fmt.Errorf(
+				"camera '%s' is shared in format %v, requested %v: %w",
+				devicePath, d.Format, format, camera.ErrDeviceBusy,
+			)
+		}
+		return d, d.addSubscriber(conn), nil
+	}
+
+	d, err = s.openDevice(dev, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.devices[dev.DevicePath] = d
+	return d, d.addSubscriber(conn), nil
+}
+
+func (s *Server) openDevice(dev camera.DevicePathAndPlatform, format camera.Format) (*device, error) {
+	devicePath := dev.DevicePath
+	formats, err := dev.ListFormats()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the formats of '%s': %w", devicePath, err)
+	}
+	if format == (camera.Format{}) {
+		if len(formats) == 0 {
+			return nil, fmt.Errorf("camera '%s' has no formats: %w", devicePath, camera.ErrFormatRejected)
+		}
+		format = rawimage.RawFormat(formats[0])
+	}
+	devFormat, ok := rawimage.SourceFormat(formats, format)
+	if !ok {
+		return nil, fmt.Errorf("camera '%s' does not support format %v: %w", devicePath, format, camera.ErrFormatRejected)
+	}
+	cam, err := dev.OpenCamera(devFormat)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open camera '%s': %w", devicePath, err)
+	}
+	return &device{
+		Server:      s,
+		Device:      dev,
+		Camera:      cam,
+		Format:      format,
+		subscribers: map[*subscriber]struct{}{},
+	}, nil
+}
+
+func (s *Server) unsubscribe(d *device, sub *subscriber) {
+	// stopping before taking the lock, since the streaming goroutine
+	// may need it (see forget)
+	if err := d.stop(sub); err != nil {
+		s.reportError(err)
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if !d.removeSubscriber(sub) {
+		return
+	}
+	if s.devices[d.Device.DevicePath] == d {
+		delete(s.devices, d.Device.DevicePath)
+	}
+	if err := d.close(); err != nil {
+		s.reportError(fmt.Errorf("unable to close camera '%s': %w", d.Device.DevicePath, err))
+	}
+}
+
+// forget makes the next subscription to reopen the device.
+func (s *Server) forget(d *device) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.devices[d.Device.DevicePath] == d {
+		delete(s.devices, d.Device.DevicePath)
+	}
+}
@@ -0,0 +1,67 @@
+package camerad
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// slot is a shared memory buffer of a frame; it is reused once
+// all the clients released it.
+type slot struct {
+	ID  uint64
+	FD  int
+	Mem []byte
+
+	// ReadOnlyFD is the descriptor sent to the clients, so that
+	// they cannot modify the frames seen by the other clients.
+	ReadOnlyFD int
+
+	Refs int
+}
+
+func newSlot(id uint64, size int) (_ *slot, _err error) {
+	fd, err := unix.MemfdCreate(fmt.Sprintf("camerad-frame-%d", id), unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a memfd: %w", err)
+	}
+	defer func() {
+		if _err != nil {
+			unix.Close(fd)
+		}
+	}()
+	if err := unix.Ftruncate(fd, int64(size)); err != nil {
+		return nil, fmt.Errorf("unable to resize the memfd to %d bytes: %w", size, err)
+	}
+	// a client could reopen the descriptor for writing
+	// via /proc unless the memfd itself is read-only
+	if err := unix.Fchmod(fd, 0400); err != nil {
+		return nil, fmt.Errorf("unable to make the memfd read-only: %w", err)
+	}
+	roFD, err := unix.Open(fmt.Sprintf("/proc/self/fd/%d", fd), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reopen the memfd read-only: %w", err)
+	}
+	defer func() {
+		if _err != nil {
+			unix.Close(roFD)
+		}
+	}()
+	mem, err := unix.Mmap(fd, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("unable to map the memfd: %w", err)
+	}
+	return &slot{
+		ID:         id,
+		FD:         fd,
+		Mem:        mem,
+		ReadOnlyFD: roFD,
+	}, nil
+}
+
+func (s *slot) Close() error {
+	err := unix.Munmap(s.Mem)
+	unix.Close(s.ReadOnlyFD)
+	unix.Close(s.FD)
+	return err
+}
@@ -0,0 +1,66 @@
+package camerad
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// prepareSocketDir creates the fallback directory of the socket (if
+// the socket is in it) and makes sure nobody else controls it.
+func prepareSocketDir(socketPath string) error {
+	dir := filepath.Dir(socketPath)
+	if dir != FallbackSocketDir() {
+		return nil
+	}
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("unable to create the directory '%s': %w", dir, err)
+	}
+	return checkPrivateDir(dir)
+}
+
+// checkPrivateDir returns an error if the directory is not a real
+// directory of the current user, or is accessible by the other users.
+func checkPrivateDir(dir string) error {
+	var stat unix.Stat_t
+	if err := unix.Lstat(dir, &stat); err != nil {
+		return fmt.Errorf("unable to stat '%s': %w", dir, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+	if int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("the directory '%s' is owned by another user (uid %d)", dir, stat.Uid)
+	}
+	if stat.Mode&0077 != 0 {
+		return fmt.Errorf("the directory '%s' is accessible by other users (mode %o)", dir, stat.Mode&0777)
+	}
+	return nil
+}
+
+// checkSocket returns an error if the socket is not owned by the
+// current user or root (so that a socket planted by another user
+// does not receive the frames and the controls of the client); if
+// the socket is in the fallback directory, the directory is checked
+// as well. A missing socket results in an error wrapping ENOENT.
+func checkSocket(socketPath string) error {
+	if dir := filepath.Dir(socketPath); dir == FallbackSocketDir() {
+		if err := checkPrivateDir(dir); err != nil {
+			return err
+		}
+	}
+	var stat unix.Stat_t
+	if err := unix.Lstat(socketPath, &stat); err != nil {
+		return fmt.Errorf("unable to stat '%s': %w", socketPath, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFSOCK {
+		return fmt.Errorf("'%s' is not a socket", socketPath)
+	}
+	if int(stat.Uid) != os.Getuid() && stat.Uid != 0 {
+		return fmt.Errorf("the socket '%s' is owned by another user (uid %d)", socketPath, stat.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package camerad
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCheckSocket(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, DefaultSocketName)
+	if err := checkSocket(socketPath); !errors.Is(err, syscall.ENOENT) {
+		t.Errorf("expected ENOENT for a missing socket, got %v", err)
+	}
+
+	l, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: socketPath, Net: "unixpacket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := checkSocket(socketPath); err != nil {
+		t.Errorf("expected the socket of the user to be accepted, got %v", err)
+	}
+
+	filePath := filepath.Join(dir, "file")
+	if err := os.WriteFile(filePath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocket(filePath); err == nil {
+		t.Errorf("expected an error for a regular file")
+	}
+}
+
+func TestCheckPrivateDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		t.Errorf("expected a private directory, got %v", err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivateDir(dir); err == nil {
+		t.Errorf("expected an error for a directory readable by others")
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivateDir(link); err == nil {
+		t.Errorf("expected an error for a symlink")
+	}
+}
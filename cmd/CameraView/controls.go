@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/xaionaro-go/camera"
+)
+
+// newControlsPanel returns the widgets to change the camera controls.
+func newControlsPanel(
+	controls camera.Controls,
+	onError func(error),
+) fyne.CanvasObject {
+	if controls == nil {
+		return widget.NewLabel("no controls")
+	}
+	list, err := controls.ListControls()
+	if err != nil {
+		onError(fmt.Errorf("unable to list the controls: %w", err))
+		return widget.NewLabel("no controls")
+	}
+
+	items := container.NewVBox()
+	for _, c := range list {
+		if obj := newControlWidget(controls, c, onError); obj != nil {
+			items.Add(obj)
+		}
+	}
+	return items
+}
+
+func newControlWidget(
+	controls camera.Controls,
+	c camera.Control,
+	onError func(error),
+) fyne.CanvasObject {
+	set := func(value int32) {
+		log.Printf("setting control '%s' to %d", c.Name, value)
+		if err := controls.SetControl(c.ID, value); err != nil {
+			onError(fmt.Errorf("unable to set control '%s' to %d: %w", c.Name, value, err))
+		}
+	}
+
+	if c.Type == camera.ControlTypeButton {
+		return widget.NewButton(c.Name, func() { set(1) })
+	}
+
+	value, err := controls.GetControl(c.ID)
+	if err != nil {
+		// e.g. write-only or inactive controls
+		log.Printf("unable to get control '%s': %v", c.Name, err)
+		return nil
+	}
+
+	switch c.Type {
+	case camera.ControlTypeBoolean:
+		check := widget.NewCheck(c.Name, nil)
+		check.SetChecked(value != 0)
+		check.OnChanged = func(checked bool) {
+			if checked {
+				set(1)
+			} else {
+				set(0)
+			}
+		}
+		return check
+	case camera.ControlTypeInteger, camera.ControlTypeMenu:
+		if c.Min >= c.Max {
+			return nil
+		}
+		label := widget.NewLabel(fmt.Sprintf("%s: %d", c.Name, value))
+		slider := widget.NewSlider(float64(c.Min), float64(c.Max))
+		if c.Step > 0 {
+			slider.Step = float64(c.Step)
+		}
+		slider.SetValue(float64(value))
+		slider.OnChanged = func(v float64) {
+			label.SetText(fmt.Sprintf("%s: %d", c.Name, int32(v)))
+		}
+		slider.OnChangeEnded = func(v float64) {
+			set(int32(v))
+		}
+		return container.NewVBox(label, slider)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/xaionaro-go/camera"
+)
+
+// gridCamera is a camera to show in a grid cell.
+type gridCamera struct {
+	DevicePath camera.DevicePath
+
+	// Find returns the camera to open; it is called on each (re)opening,
+	// so a camera which is not found is shown as a failed cell.
+	Find func() (camera.DevicePathAndPlatform, error)
+}
+
+// gridCamerasOf returns the grid cameras of the already found devices.
+func gridCamerasOf(devices []camera.DevicePathAndPlatform) []gridCamera {
+	result := make([]gridCamera, 0, len(devices))
+	for _, dev := range devices {
+		result = append(result, gridCamera{
+			DevicePath: dev.DevicePath,
+			Find:       func() (camera.DevicePathAndPlatform, error) { return dev, nil },
+		})
+	}
+	return result
+}
+
+// showGrid shows the cameras in a grid. Each camera is opened and served
+// independently, so a failure of one of them does not affect the others.
+func showGrid(
+	w fyne.Window,
+	cameras []gridCamera,
+	filter formatFilter,
+	outputDir string,
+) {
+	cells := make([]fyne.CanvasObject, 0, len(cameras))
+	var viewers []*viewer
+	for _, cam := range cameras {
+		cell, v := newGridCell(cam, filter, outputDir)
+		cells = append(cells, cell)
+		viewers = append(viewers, v)
+	}
+
+	columns := int(math.Ceil(math.Sqrt(float64(len(cells)))))
+	w.SetContent(container.NewGridWithColumns(columns, cells...))
+	w.SetOnClosed(func() {
+		for _, v := range viewers {
+			v.StopRecording()
+			v.Close()
+		}
+	})
+}
+
+func newGridCell(
+	cam gridCamera,
+	filter formatFilter,
+	outputDir string,
+) (fyne.CanvasObject, *viewer) {
+	img := canvas.NewImageFromImage(image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	img.FillMode = canvas.ImageFillContain
+	img.ScaleMode = canvas.ImageScaleFastest
+
+	indicator := canvas.NewCircle(viewerStateClosed.Color())
+	statusLabel := widget.NewLabel("")
+	statusLabel.Truncation = fyne.TextTruncateEllipsis
+	titleLabel := widget.NewLabel(cam.DevicePath)
+	v := &viewer{
+		Image:     img,
+		Overlay:   widget.NewLabel(""),
+		Status:    statusLabel,
+		OutputDir: outputDir,
+		Indicator: indicator,
+	}
+
+	open := func() {
+		defer v.recoverPanic()
+		dev, err := cam.Find()
+		if err != nil {
+			v.setState(viewerStateFailed)
+			v.setStatus("%v", err)
+			return
+		}
+		titleLabel.SetText(fmt.Sprintf("%s (%s)", dev.DevicePath, dev.PlatformID))
+		format, err := filter.Select(dev)
+		if err != nil {
+			v.setState(viewerStateFailed)
+			v.setStatus("%v", err)
+			return
+		}
+		if err := v.Switch(dev, format); err != nil {
+			v.setStatus("%s: %v", dev.DevicePath, err)
+		}
+	}
+	go open()
+
+	retryButton := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() { go open() })
+	snapshotButton := widget.NewButtonWithIcon("", theme.FileImageIcon(), v.RequestSnapshot)
+	header := container.NewBorder(
+		nil, nil,
+		container.NewHBox(
+			container.NewGridWrap(fyne.NewSize(theme.IconInlineSize(), theme.IconInlineSize()), indicator),
+			titleLabel,
+		),
+		container.NewHBox(snapshotButton, retryButton),
+	)
+	video := container.NewStack(
+		img,
+		container.NewVBox(container.NewHBox(v.Overlay, layout.NewSpacer()), layout.NewSpacer()),
+	)
+	return container.NewBorder(header, statusLabel, nil, nil, video), v
+}
@@ -10,35 +10,41 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"runtime/debug"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/widget"
 	"github.com/spf13/pflag"
 	"github.com/xaionaro-go/camera"
 	"github.com/xaionaro-go/camera/allplatforms"
+	"github.com/xaionaro-go/camera/metrics"
+	"github.com/xaionaro-go/camera/platform/remote"
 )
 
 func main() {
-	availableCameras, err := camera.ListCameras()
-	if err != nil {
-		panic(fmt.Errorf("unable to get the list of cameras: %w", err))
-	}
-	if len(availableCameras) == 0 {
-		panic("no cameras found")
-	}
-
-	netPprofAddr := pflag.String("net-pprof-addr", "", "")
+	netPprofAddr := pflag.String("net-pprof-addr", "", "the address to serve pprof (under /debug/pprof/) and the metrics (under /metrics) on")
 	widthFlag := pflag.Uint64("width", 0, "")
 	fpsFlag := pflag.Float64("fps", math.NaN(), "")
 	pixFmtFlag := pflag.String("pixel-format", "", "")
 	platformFlag := pflag.String("platform", "", "")
-	deviceFlag := pflag.String("device", availableCameras[0].DevicePath, "")
+	deviceFlag := pflag.StringSlice("device", nil, "the camera(s) to show (a device path or a URL of a network camera); if more than one is given, then they are shown in a grid (the first available camera is used if empty)")
+	allFlag := pflag.Bool("all", false, "show all the available cameras in a grid")
+	outputDirFlag := pflag.String("output-dir", ".", "the directory to save snapshots and recordings into")
+	remoteInsecureFlag := pflag.Bool("remote-insecure", false, "connect to the 'remote://' servers without TLS")
+	remoteCAFlag := pflag.String("remote-ca", "", "the PEM file of the certificate authority of the 'remote://' servers (the system ones are used if empty)")
+	remoteTokenFileFlag := pflag.String("remote-token-file", "", "the file of the token required by the 'remote://' servers")
+	diagnoseFlag := pflag.Bool("diagnose", false, "explain which devices are found and why some of them are skipped, and exit")
 	pflag.Parse()
 
+	if *diagnoseFlag {
+		for _, d := range camera.DiagnoseCameras() {
+			fmt.Println(d)
+		}
+		return
+	}
+
 	if *netPprofAddr != "" {
+		http.Handle("/metrics", metrics.Handler())
 		go func() {
 			log.Println(http.ListenAndServe(*netPprofAddr, nil))
 		}()
@@ -49,147 +55,164 @@ func main() {
 	w.Show()
 	defer func() { processRecover(w, recover()) }()
 
-	var plat camera.Platform
-	var devicePath camera.DevicePath
-	if *platformFlag != "" {
-		plat = allplatforms.Get(*platformFlag)
-		if plat == nil {
-			panicInUI(w, fmt.Errorf("platform '%s' is unknown", *platformFlag))
+	remoteCfg, err := remote.LoadConfig(*remoteInsecureFlag, *remoteCAFlag, *remoteTokenFileFlag)
+	if err != nil {
+		panicInUI(w, err)
+	}
+	remote.DefaultPlatform().SetConfig(remoteCfg)
+
+	for _, devicePath := range *deviceFlag {
+		if err := allplatforms.AddNetworkCamera(devicePath); err != nil {
+			panicInUI(w, err)
 		}
-		availableCameras, err := plat.ListCameras()
-		if err != nil {
-			panicInUI(w, fmt.Errorf("unable to list cameras: %w", err))
+	}
+	cameras, err := listCameras(*platformFlag)
+	if err != nil {
+		panicInUI(w, err)
+	}
+	if len(cameras) == 0 {
+		panicInUI(w, fmt.Errorf("no cameras found (use --diagnose to find out why)"))
+	}
+
+	filter := formatFilter{
+		Width:       *widthFlag,
+		FPS:         *fpsFlag,
+		PixelFormat: camera.PixelFormatByName(*pixFmtFlag),
+	}
+
+	switch {
+	case *allFlag:
+		showGrid(w, gridCamerasOf(cameras), filter, *outputDirFlag)
+	case len(*deviceFlag) > 1:
+		var gridCameras []gridCamera
+		for _, devicePath := range *deviceFlag {
+			gridCameras = append(gridCameras, gridCamera{
+				DevicePath: devicePath,
+				Find: func() (camera.DevicePathAndPlatform, error) {
+					return findCamera(cameras, *platformFlag, devicePath)
+				},
+			})
 		}
-		for _, c := range availableCameras {
-			if c == *deviceFlag {
-				devicePath = c
-				break
+		showGrid(w, gridCameras, filter, *outputDirFlag)
+	default:
+		dev := cameras[0]
+		if len(*deviceFlag) == 1 {
+			dev, err = findCamera(cameras, *platformFlag, (*deviceFlag)[0])
+			if err != nil {
+				panicInUI(w, err)
 			}
 		}
-		if devicePath == "" {
-			panicInUI(w, fmt.Errorf("camera with path '%s' is not found (available: %#+v)", *deviceFlag, availableCameras))
+		format, err := filter.Select(dev)
+		if err != nil {
+			panicInUI(w, err)
 		}
-	} else {
-		var cameraSelector camera.DevicePathAndPlatform
-		for _, c := range availableCameras {
-			if c.DevicePath == *deviceFlag {
-				cameraSelector = c
-				break
-			}
+		v := showSingle(w, cameras, dev, format, *outputDirFlag)
+		defer v.Close()
+		defer v.StopRecording()
+	}
+
+	a.Run()
+}
+
+// listCameras returns the cameras of the given platform,
+// or of all the platforms if it is empty.
+func listCameras(platID string) ([]camera.DevicePathAndPlatform, error) {
+	if platID == "" {
+		cameras, err := camera.ListCameras()
+		if err != nil {
+			// the listing is still valid, but may be incomplete
+			log.Printf("unable to list some cameras: %v", err)
 		}
-		if cameraSelector.Platform == nil {
-			panicInUI(w, fmt.Errorf("camera with path '%s' is not found (available: %#+v)", *deviceFlag, availableCameras))
+		return cameras, nil
+	}
+
+	plat := allplatforms.Get(platID)
+	if plat == nil {
+		return nil, fmt.Errorf("platform '%s' is unknown", platID)
+	}
+	devicePaths, err := plat.ListCameras()
+	if err != nil {
+		log.Printf("unable to list some cameras: %v", err)
+	}
+	var result []camera.DevicePathAndPlatform
+	for _, devicePath := range devicePaths {
+		result = append(result, camera.DevicePathAndPlatform{
+			DevicePath: devicePath,
+			Platform:   plat,
+			PlatformID: camera.PlatformID(platID),
+		})
+	}
+	return result, nil
+}
+
+func findCamera(
+	cameras []camera.DevicePathAndPlatform,
+	platID string,
+	devicePath camera.DevicePath,
+) (camera.DevicePathAndPlatform, error) {
+	for _, c := range cameras {
+		if c.DevicePath == devicePath {
+			return c, nil
 		}
-		plat = cameraSelector.Platform
-		devicePath = cameraSelector.DevicePath
 	}
+	if platID != "" {
+		return camera.DevicePathAndPlatform{}, fmt.Errorf("camera with path '%s' is not found (available: %#+v)", devicePath, cameras)
+	}
+	cameraSelector, err := camera.DefaultRegistry().FindCamera(devicePath)
+	if err != nil {
+		return camera.DevicePathAndPlatform{}, fmt.Errorf("unable to find the camera (available: %#+v): %w", cameras, err)
+	}
+	return cameraSelector, nil
+}
+
+type formatFilter struct {
+	Width       uint64
+	FPS         float64
+	PixelFormat camera.PixelFormat
+}
 
-	formats, err := plat.ListFormats(devicePath)
+// Select returns the best resolution among the formats of the device
+// matching the filter.
+func (f formatFilter) Select(dev camera.DevicePathAndPlatform) (camera.Format, error) {
+	formats, err := dev.ListFormats()
 	if err != nil {
-		panicInUI(w, fmt.Errorf("unable to list the formats: %w", err))
+		return camera.Format{}, fmt.Errorf("unable to list the formats of '%s': %w", dev.DevicePath, err)
 	}
 	if len(formats) == 0 {
-		panicInUI(w, fmt.Errorf("the list of available formats is empty"))
+		return camera.Format{}, fmt.Errorf("the list of available formats of '%s' is empty", dev.DevicePath)
 	}
 
 	var buf bytes.Buffer
 	jsonEnc := json.NewEncoder(&buf)
 	jsonEnc.SetIndent("", " ")
 	jsonEnc.Encode(formats)
-	log.Printf("available formats:\n%s", buf.Bytes())
+	log.Printf("available formats of '%s':\n%s", dev.DevicePath, buf.Bytes())
 
-	if *pixFmtFlag != "" {
-		pixFmt := camera.PixelFormatByName(*pixFmtFlag)
-		if pixFmt == camera.PixelFormatUndefined {
-			panicInUI(w, fmt.Errorf("unknown pixel format name '%s'", *pixFmtFlag))
-		}
-		formats = formats.FilterByPixelFormat(pixFmt)
+	if f.PixelFormat != camera.PixelFormatUndefined {
+		formats = formats.FilterByPixelFormat(f.PixelFormat)
 		buf.Reset()
 		jsonEnc.Encode(formats)
-		log.Printf("available formats for the pixel format %v:\n%s", *pixFmtFlag, buf.Bytes())
+		log.Printf("available formats for the pixel format %v:\n%s", f.PixelFormat, buf.Bytes())
 	}
 
-	if *widthFlag != 0 {
-		formats = formats.FilterByWidth(*widthFlag)
+	if f.Width != 0 {
+		formats = formats.FilterByWidth(f.Width)
 		buf.Reset()
 		jsonEnc.Encode(formats)
-		log.Printf("available formats for width %d:\n%s", *widthFlag, buf.Bytes())
+		log.Printf("available formats for width %d:\n%s", f.Width, buf.Bytes())
 	}
 
-	if !math.IsNaN(*fpsFlag) {
-		formats = formats.FilterByFPS(*fpsFlag)
+	if !math.IsNaN(f.FPS) {
+		formats = formats.FilterByFPS(f.FPS)
 		buf.Reset()
 		jsonEnc.Encode(formats)
-		log.Printf("available formats for FPS %f:\n%s", *fpsFlag, buf.Bytes())
+		log.Printf("available formats for FPS %f:\n%s", f.FPS, buf.Bytes())
 	}
 
 	if len(formats) == 0 {
-		panicInUI(w, fmt.Errorf("no appropriate formats available"))
-	}
-
-	format := formats.BestResolution()
-
-	log.Printf("requesting format %#+v", format)
-	camera, err := plat.OpenCamera(devicePath, format)
-	if err != nil {
-		panicInUI(w, fmt.Errorf("unable to open the camera: %w", err))
-	}
-	defer camera.Close()
-
-	log.Printf("starting streaming")
-	err = camera.StartStreaming()
-	if err != nil {
-		panicInUI(w, fmt.Errorf("unable to initiate the streaming on the camera: %w", err))
-	}
-	defer camera.StopStreaming()
-	ctx := context.Background()
-
-	frameReadCtx, cancelFn := context.WithTimeout(ctx, 10*time.Second)
-	defer cancelFn()
-
-	log.Printf("getting a frame")
-	frame, err := camera.GetFrame(frameReadCtx)
-	if err != nil {
-		panicInUI(w, fmt.Errorf("unable to get a video frame: %w", err))
+		return camera.Format{}, fmt.Errorf("no appropriate formats available for '%s'", dev.DevicePath)
 	}
-
-	log.Printf("releasing the memory buffer of the frame")
-	err = camera.ReleaseFrame(frame)
-	if err != nil {
-		panicInUI(w, fmt.Errorf("unable to release frame %d: %w", frame, err))
-	}
-
-	log.Printf("getting the second frame")
-	frame, err = camera.GetFrame(frameReadCtx)
-	if err != nil {
-		panicInUI(w, fmt.Errorf("unable to get a video frame: %w", err))
-	}
-
-	img := canvas.NewImageFromImage(frame.Image())
-	img.FillMode = canvas.ImageFillOriginal
-	img.ScaleMode = canvas.ImageScaleFastest
-	w.Canvas().SetContent(img)
-
-	prevFrame := frame
-	go func() {
-		defer func() { processRecover(w, recover()) }()
-		for {
-			frame, err := camera.GetFrame(ctx)
-			if err != nil {
-				panicInUI(w, fmt.Errorf("unable to get a video frame: %w", err))
-			}
-			img.Image = frame.Image()
-			img.Refresh()
-
-			err = camera.ReleaseFrame(prevFrame)
-			if err != nil {
-				panicInUI(w, fmt.Errorf("unable to release frame %d: %w", frame, err))
-			}
-			prevFrame = frame
-		}
-	}()
-
-	a.Run()
+	return formats.BestResolution(), nil
 }
 
 func panicInUI(
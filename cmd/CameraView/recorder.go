@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"sync"
+)
+
+const recordingQuality = 85
+
+// recorder writes the frames as a stream of JPEG images
+// (which could be played with 'ffplay -f mjpeg').
+type recorder struct {
+	FileName string
+
+	locker sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	frames uint64
+}
+
+func newRecorder(fileName string) (*recorder, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the recording file: %w", err)
+	}
+	return &recorder{
+		FileName: fileName,
+		file:     f,
+		writer:   bufio.NewWriterSize(f, 1<<20),
+	}, nil
+}
+
+func (r *recorder) WriteFrame(img image.Image) error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if r.file == nil {
+		return fmt.Errorf("the recording is already finished")
+	}
+	if err := jpeg.Encode(r.writer, img, &jpeg.Options{Quality: recordingQuality}); err != nil {
+		return err
+	}
+	r.frames++
+	return nil
+}
+
+func (r *recorder) Frames() uint64 {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.frames
+}
+
+func (r *recorder) Close() error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.writer.Flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return err
+}
+
+func writePNG(fileName string, img image.Image) (_err error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil && _err == nil {
+			_err = err
+		}
+	}()
+	w := bufio.NewWriter(f)
+	if err := png.Encode(w, img); err != nil {
+		return err
+	}
+	return w.Flush()
+}
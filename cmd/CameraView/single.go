@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/xaionaro-go/camera"
+)
+
+// showSingle shows a single camera with the UI to switch the camera,
+// the format and to change the controls.
+func showSingle(
+	w fyne.Window,
+	cameras []camera.DevicePathAndPlatform,
+	dev camera.DevicePathAndPlatform,
+	format camera.Format,
+	outputDir string,
+) *viewer {
+	img := canvas.NewImageFromImage(image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	img.FillMode = canvas.ImageFillOriginal
+	img.ScaleMode = canvas.ImageScaleFastest
+
+	statusLabel := widget.NewLabel("")
+	statusLabel.Wrapping = fyne.TextWrapWord
+	controlsBox := container.NewStack()
+	v := &viewer{
+		Image:     img,
+		Overlay:   widget.NewLabel(""),
+		Status:    statusLabel,
+		OutputDir: outputDir,
+	}
+	v.OnControls = func(controls camera.Controls) {
+		controlsBox.Objects = []fyne.CanvasObject{
+			newControlsPanel(controls, func(err error) { v.setStatus("%v", err) }),
+		}
+		controlsBox.Refresh()
+	}
+
+	var currentCamera camera.DevicePathAndPlatform
+	formatsByName := map[string]camera.Format{}
+	formatSelect := widget.NewSelect(nil, func(name string) {
+		format, ok := formatsByName[name]
+		if !ok {
+			return
+		}
+		dev := currentCamera
+		go func() {
+			defer func() { processRecover(w, recover()) }()
+			if err := v.Switch(dev, format); err != nil {
+				v.setStatus("unable to switch to %s %s: %v", dev.DevicePath, name, err)
+			}
+		}()
+	})
+
+	selectCamera := func(dev camera.DevicePathAndPlatform, format camera.Format) {
+		formats, err := dev.ListFormats()
+		if err != nil {
+			v.setStatus("unable to list the formats of %s: %v", dev.DevicePath, err)
+			return
+		}
+		if len(formats) == 0 {
+			v.setStatus("the list of available formats of %s is empty", dev.DevicePath)
+			return
+		}
+		if format == (camera.Format{}) {
+			format = formats.BestResolution()
+		}
+
+		currentCamera = dev
+		formatsByName = map[string]camera.Format{}
+		names := make([]string, 0, len(formats))
+		selectedIdx := 0
+		for _, f := range formats {
+			name := formatName(f)
+			if _, ok := formatsByName[name]; ok {
+				continue
+			}
+			if f == format {
+				selectedIdx = len(names)
+			}
+			formatsByName[name] = f
+			names = append(names, name)
+		}
+		formatSelect.SetOptions(names)
+		formatSelect.SetSelectedIndex(selectedIdx)
+	}
+
+	cameraNames := make([]string, 0, len(cameras))
+	for _, c := range cameras {
+		cameraNames = append(cameraNames, fmt.Sprintf("%s (%s)", c.DevicePath, c.PlatformID))
+	}
+	cameraSelect := widget.NewSelect(cameraNames, nil)
+
+	snapshotButton := widget.NewButtonWithIcon("Snapshot", theme.FileImageIcon(), v.RequestSnapshot)
+	var recordButton *widget.Button
+	recordButton = widget.NewButtonWithIcon("Record", theme.MediaRecordIcon(), func() {
+		if v.recorder.Load() != nil {
+			v.StopRecording()
+			recordButton.SetText("Record")
+			recordButton.SetIcon(theme.MediaRecordIcon())
+			return
+		}
+		if err := v.StartRecording(); err != nil {
+			v.setStatus("unable to start recording: %v", err)
+			return
+		}
+		recordButton.SetText("Stop")
+		recordButton.SetIcon(theme.MediaStopIcon())
+	})
+
+	toolbar := container.NewHBox(cameraSelect, formatSelect, snapshotButton, recordButton)
+	video := container.NewStack(
+		img,
+		container.NewVBox(container.NewHBox(v.Overlay, layout.NewSpacer()), layout.NewSpacer()),
+	)
+	w.SetContent(container.NewBorder(
+		toolbar,
+		statusLabel,
+		nil,
+		container.NewVScroll(controlsBox),
+		video,
+	))
+
+	// the handler is set after the initial selection, since the initial
+	// format is selected by the flags rather than by the best resolution
+	if idx := slices.IndexFunc(cameras, func(c camera.DevicePathAndPlatform) bool {
+		return c.DevicePath == dev.DevicePath && c.PlatformID == dev.PlatformID
+	}); idx >= 0 {
+		cameraSelect.SetSelectedIndex(idx)
+	}
+	cameraSelect.OnChanged = func(string) {
+		selectCamera(cameras[cameraSelect.SelectedIndex()], camera.Format{})
+	}
+	selectCamera(dev, format)
+	return v
+}
+
+func formatName(f camera.Format) string {
+	return fmt.Sprintf("%s %dx%d @ %g FPS", f.PixelFormat, f.Width, f.Height, f.FPS.Float64())
+}
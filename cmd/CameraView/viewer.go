@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/widget"
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/metrics"
+)
+
+type viewerState int
+
+const (
+	viewerStateClosed = viewerState(iota)
+	viewerStateOpening
+	viewerStateStreaming
+	viewerStateFailed
+)
+
+func (s viewerState) Color() color.Color {
+	switch s {
+	case viewerStateOpening:
+		return color.NRGBA{R: 0xff, G: 0xc0, A: 0xff}
+	case viewerStateStreaming:
+		return color.NRGBA{G: 0xc0, A: 0xff}
+	case viewerStateFailed:
+		return color.NRGBA{R: 0xe0, A: 0xff}
+	}
+	return color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+}
+
+// viewer shows the frames of the currently opened camera and allows to
+// switch to another camera or format at runtime.
+type viewer struct {
+	Image     *canvas.Image
+	Overlay   *widget.Label
+	Status    *widget.Label
+	OutputDir string
+
+	// Indicator (if set) is colored according to the state of the camera.
+	Indicator *canvas.Circle
+
+	// OnControls is called once a camera is opened (with nil on closing).
+	OnControls func(camera.Controls)
+
+	locker  sync.Mutex
+	session *session
+
+	snapshotRequested atomic.Bool
+	recorder          atomic.Pointer[recorder]
+}
+
+// session is an opened camera with the goroutine showing its frames.
+type session struct {
+	Device   camera.DevicePathAndPlatform
+	Camera   camera.Camera
+	Controls camera.ControlsCloser
+
+	cancelFn context.CancelFunc
+	done     chan struct{}
+}
+
+func (v *viewer) setState(state viewerState) {
+	if v.Indicator == nil {
+		return
+	}
+	v.Indicator.FillColor = state.Color()
+	v.Indicator.Refresh()
+}
+
+// recoverPanic reports a panic as a failure of this viewer only,
+// instead of bringing down the whole application.
+func (v *viewer) recoverPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	debug.PrintStack()
+	v.setState(viewerStateFailed)
+	v.setStatus("panic: %v", r)
+}
+
+func (v *viewer) setStatus(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Println(msg)
+	v.Status.SetText(msg)
+}
+
+// Switch closes the current camera (if any) and opens the given one.
+func (v *viewer) Switch(
+	dev camera.DevicePathAndPlatform,
+	format camera.Format,
+) error {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	v.closeSession()
+
+	v.setState(viewerStateOpening)
+	log.Printf("opening '%s' via '%s' with format %#+v", dev.DevicePath, dev.PlatformID, format)
+	cam, err := dev.OpenCamera(format)
+	if err != nil {
+		v.setState(viewerStateFailed)
+		return fmt.Errorf("unable to open the camera: %w", err)
+	}
+	if err := cam.StartStreaming(); err != nil {
+		cam.Close()
+		v.setState(viewerStateFailed)
+		return fmt.Errorf("unable to initiate the streaming on the camera: %w", err)
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	s := &session{
+		Device:   dev,
+		Camera:   metrics.WrapCamera(cam, metrics.LabelsOf(dev)),
+		cancelFn: cancelFn,
+		done:     make(chan struct{}),
+	}
+
+	var controls camera.Controls
+	if c, ok := cam.(camera.Controls); ok {
+		controls = c
+	} else if opener, ok := dev.Platform.(camera.ControlsOpener); ok {
+		s.Controls, err = opener.OpenControls(dev.DevicePath)
+		if err != nil {
+			log.Printf("unable to open the controls: %v", err)
+		} else {
+			controls = s.Controls
+		}
+	}
+
+	v.session = s
+	go func() {
+		defer close(s.done)
+		defer v.recoverPanic()
+		v.serve(ctx, s)
+	}()
+
+	if v.OnControls != nil {
+		v.OnControls(controls)
+	}
+	v.setState(viewerStateStreaming)
+	v.setStatus("opened %s (%s)", dev.DevicePath, dev.PlatformID)
+	return nil
+}
+
+func (v *viewer) Close() {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+	v.closeSession()
+}
+
+// closeSession must be called with v.locker locked.
+func (v *viewer) closeSession() {
+	s := v.session
+	if s == nil {
+		return
+	}
+	v.session = nil
+	if v.OnControls != nil {
+		v.OnControls(nil)
+	}
+
+	s.cancelFn()
+	<-s.done
+	if s.Controls != nil {
+		s.Controls.Close()
+	}
+	if err := s.Camera.StopStreaming(); err != nil {
+		log.Printf("unable to stop streaming: %v", err)
+	}
+	if err := s.Camera.Close(); err != nil {
+		log.Printf("unable to close the camera: %v", err)
+	}
+	v.setState(viewerStateClosed)
+}
+
+// RequestSnapshot makes the next frame to be saved into a PNG file.
+func (v *viewer) RequestSnapshot() {
+	v.snapshotRequested.Store(true)
+}
+
+// StartRecording starts writing the frames into an MJPEG file.
+func (v *viewer) StartRecording() error {
+	r, err := newRecorder(filepath.Join(v.OutputDir, timestampedName("recording", ".mjpeg")))
+	if err != nil {
+		return err
+	}
+	if old := v.recorder.Swap(r); old != nil {
+		old.Close()
+	}
+	v.setStatus("recording into %s", r.FileName)
+	return nil
+}
+
+func (v *viewer) StopRecording() {
+	r := v.recorder.Swap(nil)
+	if r == nil {
+		return
+	}
+	if err := r.Close(); err != nil {
+		v.setStatus("unable to finish the recording %s: %v", r.FileName, err)
+		return
+	}
+	v.setStatus("recorded %d frames into %s", r.Frames(), r.FileName)
+}
+
+type frameStats struct {
+	Format           camera.Format
+	ExpectedInterval time.Duration
+
+	WindowStart  time.Time
+	WindowFrames uint
+	PrevTS       time.Time
+	Dropped      uint64
+	FPS          float64
+}
+
+func newFrameStats(format camera.Format) *frameStats {
+	s := &frameStats{
+		Format:      format,
+		WindowStart: time.Now(),
+	}
+	if format.FPS.Numerator != 0 && format.FPS.Denominator != 0 {
+		s.ExpectedInterval = time.Duration(float64(time.Second) / format.FPS.Float64())
+	}
+	return s
+}
+
+// Add accounts a frame and returns true if the overlay should be updated.
+func (s *frameStats) Add(frame camera.Frame) bool {
+	now := time.Now()
+	if counter, ok := frame.(camera.FrameSkipCounter); ok {
+		s.Dropped += counter.SkippedFrames()
+	}
+	if !s.PrevTS.IsZero() && s.ExpectedInterval > 0 {
+		if interval := now.Sub(s.PrevTS); interval > s.ExpectedInterval*3/2 {
+			s.Dropped += uint64(math.Round(float64(interval)/float64(s.ExpectedInterval))) - 1
+		}
+	}
+	s.PrevTS = now
+	s.WindowFrames++
+
+	elapsed := now.Sub(s.WindowStart)
+	if elapsed < time.Second {
+		return false
+	}
+	s.FPS = float64(s.WindowFrames) / elapsed.Seconds()
+	s.WindowStart, s.WindowFrames = now, 0
+	return true
+}
+
+func (s *frameStats) String() string {
+	return fmt.Sprintf("%.1f FPS (of %g) | %dx%d | %s | dropped: %d",
+		s.FPS, s.Format.FPS.Float64(), s.Format.Width, s.Format.Height, s.Format.PixelFormat, s.Dropped)
+}
+
+func (v *viewer) serve(ctx context.Context, s *session) {
+	stats := newFrameStats(s.Camera.GetFormat())
+	v.Overlay.SetText(stats.String())
+
+	var prevFrame camera.Frame
+	defer func() {
+		if prevFrame == nil {
+			return
+		}
+		// the frame buffer may be unmapped once the camera is closed
+		v.Image.Image = cloneImage(prevFrame.Image())
+		v.Image.Refresh()
+		if err := s.Camera.ReleaseFrame(prevFrame); err != nil {
+			log.Printf("unable to release a frame: %v", err)
+		}
+	}()
+
+	for {
+		frame, err := s.Camera.GetFrame(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			v.setState(viewerStateFailed)
+			v.setStatus("unable to get a video frame from %s: %v", s.Device.DevicePath, err)
+			return
+		}
+
+		img := frame.Image()
+		v.Image.Image = img
+		v.Image.Refresh()
+		if stats.Add(frame) {
+			v.Overlay.SetText(stats.String())
+		}
+		v.processFrame(img)
+
+		if prevFrame != nil {
+			if err := s.Camera.ReleaseFrame(prevFrame); err != nil {
+				v.setState(viewerStateFailed)
+				v.setStatus("unable to release a frame: %v", err)
+				return
+			}
+		}
+		prevFrame = frame
+	}
+}
+
+func (v *viewer) processFrame(img image.Image) {
+	if v.snapshotRequested.Swap(false) {
+		fileName := filepath.Join(v.OutputDir, timestampedName("snapshot", ".png"))
+		if err := writePNG(fileName, img); err != nil {
+			v.setStatus("unable to save the snapshot: %v", err)
+		} else {
+			v.setStatus("saved %s", fileName)
+		}
+	}
+
+	if r := v.recorder.Load(); r != nil {
+		if err := r.WriteFrame(img); err != nil {
+			v.setStatus("unable to record the frame: %v", err)
+			v.StopRecording()
+		}
+	}
+}
+
+func cloneImage(src image.Image) image.Image {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	return dst
+}
+
+func timestampedName(prefix, ext string) string {
+	return prefix + "-" + time.Now().Format("20060102-150405.000") + ext
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type benchResult struct {
+	Format camera.Format
+
+	Frames   uint64
+	Duration time.Duration
+	FPS      float64
+
+	FirstFrameLatency time.Duration
+	LatencyMin        time.Duration
+	LatencyAvg        time.Duration
+	LatencyP95        time.Duration
+	LatencyMax        time.Duration
+
+	// SkippedFrames is the amount of frames reported as dropped by the camera
+	// (see --latest-frame-only).
+	SkippedFrames uint64
+
+	// GapFrames is the amount of frames estimated to be lost by the
+	// intervals between frames exceeding the expected one.
+	GapFrames uint64
+}
+
+func runBench(ctx context.Context, args []string) error {
+	flags := newFlagSet("bench")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	durationFlag := flags.Duration("duration", 10*time.Second, "how long to measure")
+	latestFrameOnlyFlag := flags.Bool("latest-frame-only", false, "drop the frames queued while processing the previous one")
+	jsonFlag := flags.Bool("json", false, "print as JSON")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+
+	startTS := time.Now()
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+	if setter, ok := cam.(camera.LatestFrameOnlySetter); ok {
+		setter.SetLatestFrameOnly(*latestFrameOnlyFlag)
+	} else if *latestFrameOnlyFlag {
+		return fmt.Errorf("--latest-frame-only is %w by platform '%s'", camera.ErrNotSupported, dev.PlatformID)
+	}
+
+	result := benchResult{Format: cam.GetFormat()}
+	expectedInterval := time.Duration(float64(time.Second) / result.Format.FPS.Float64())
+	if result.Format.FPS.Numerator == 0 || result.Format.FPS.Denominator == 0 {
+		expectedInterval = 0
+	}
+
+	var latencies []time.Duration
+	var firstTS, prevTS time.Time
+	for {
+		reqTS := time.Now()
+		if !firstTS.IsZero() && reqTS.Sub(firstTS) >= *durationFlag {
+			break
+		}
+		err := withFrame(ctx, cam, func(frame camera.Frame) error {
+			if counter, ok := frame.(camera.FrameSkipCounter); ok {
+				result.SkippedFrames += counter.SkippedFrames()
+			}
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+		now := time.Now()
+
+		if firstTS.IsZero() {
+			firstTS = now
+			result.FirstFrameLatency = now.Sub(startTS)
+		} else {
+			latencies = append(latencies, now.Sub(reqTS))
+			if interval := now.Sub(prevTS); expectedInterval > 0 && interval > expectedInterval*3/2 {
+				result.GapFrames += uint64(math.Round(float64(interval)/float64(expectedInterval))) - 1
+			}
+		}
+		prevTS = now
+		result.Frames++
+	}
+	if result.Frames == 0 {
+		return fmt.Errorf("no frames received")
+	}
+
+	result.Duration = prevTS.Sub(firstTS)
+	if result.Duration > 0 {
+		result.FPS = float64(result.Frames-1) / result.Duration.Seconds()
+	}
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		var sum time.Duration
+		for _, l := range latencies {
+			sum += l
+		}
+		result.LatencyMin = latencies[0]
+		result.LatencyAvg = sum / time.Duration(len(latencies))
+		result.LatencyP95 = latencies[len(latencies)*95/100]
+		result.LatencyMax = latencies[len(latencies)-1]
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", " ")
+		return enc.Encode(result)
+	}
+
+	fmt.Printf("format:              %s %dx%d@%g\n", result.Format.PixelFormat, result.Format.Width, result.Format.Height, result.Format.FPS.Float64())
+	fmt.Printf("frames:              %d in %v\n", result.Frames, result.Duration.Round(time.Millisecond))
+	fmt.Printf("measured FPS:        %.2f\n", result.FPS)
+	fmt.Printf("first frame after:   %v\n", result.FirstFrameLatency.Round(time.Microsecond))
+	fmt.Printf("GetFrame latency:    min %v, avg %v, p95 %v, max %v\n",
+		result.LatencyMin.Round(time.Microsecond),
+		result.LatencyAvg.Round(time.Microsecond),
+		result.LatencyP95.Round(time.Microsecond),
+		result.LatencyMax.Round(time.Microsecond),
+	)
+	fmt.Printf("skipped frames:      %d\n", result.SkippedFrames)
+	fmt.Printf("estimated gaps:      %d frames\n", result.GapFrames)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/calibration"
+)
+
+func runCalibrate(ctx context.Context, args []string) error {
+	flags := newFlagSet("calibrate")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	boardFlag := flags.String("board", "9x6", "the amount of the inner corners of the checkerboard (the squares minus one), COLSxROWS")
+	squareSizeFlag := flags.Float64("square-size", 1, "the size of a square of the board (in any units)")
+	fisheyeFlag := flags.Bool("fisheye", false, "use the fisheye lens model (for the lenses wider than about 120 degrees)")
+	fixK3Flag := flags.Bool("fix-k3", false, "do not estimate the distortion coefficient k3 (recommended unless the lens is strongly distorted)")
+	viewsFlag := flags.Int("views", 15, "the amount of the views of the board to collect")
+	intervalFlag := flags.Duration("interval", time.Second, "the minimal interval between the collected views (to move the board)")
+	storeFlag := flags.String("calibration", defaultCalibrationStore(), "the file with the calibrations of the cameras (the calibration is added to it)")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	var board calibration.Board
+	if _, err := fmt.Sscanf(*boardFlag, "%dx%d", &board.Cols, &board.Rows); err != nil {
+		return fmt.Errorf("unable to parse --board '%s': %w", *boardFlag, err)
+	}
+	board.SquareSize = *squareSizeFlag
+	if *viewsFlag < calibration.MinViews {
+		return fmt.Errorf("--views should be at least %d", calibration.MinViews)
+	}
+	store, err := calibration.LoadStore(*storeFlag)
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+	if setter, ok := cam.(camera.LatestFrameOnlySetter); ok {
+		// the detection may be slower than the camera
+		setter.SetLatestFrameOnly(true)
+	}
+
+	cfg := calibration.Config{
+		Board: board,
+		FixK3: *fixK3Flag,
+	}
+	if *fisheyeFlag {
+		cfg.Model = calibration.ModelFisheye
+	}
+	format = cam.GetFormat()
+	calibrator := calibration.NewCalibrator(format.Width, format.Height, cfg)
+	log.Printf("show the %s board to the camera at different angles, covering the whole picture", *boardFlag)
+	var lastViewTS time.Time
+	for len(calibrator.Views) < *viewsFlag {
+		err := withFrame(ctx, cam, func(frame camera.Frame) error {
+			if time.Since(lastViewTS) < *intervalFlag {
+				return nil
+			}
+			added, err := calibrator.AddImage(frame.Image())
+			if err != nil || !added {
+				return nil
+			}
+			lastViewTS = time.Now()
+			log.Printf("view %d/%d collected", len(calibrator.Views), *viewsFlag)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	calib, err := calibrator.Calibrate()
+	if err != nil {
+		return err
+	}
+	log.Printf("%s model: focal length %.2fx%.2f, principal point %.2f,%.2f, distortion %v, RMS error %.3f pixels",
+		calib.Model, calib.Fx, calib.Fy, calib.Cx, calib.Cy, calib.Distortion, calib.RMSError)
+	if calib.RMSError > 1 {
+		log.Printf("the error is high: make sure the board is flat and sharp in the pictures")
+	}
+
+	key := calibration.CameraKey(dev)
+	store[key] = calib
+	if err := os.MkdirAll(filepath.Dir(*storeFlag), 0o755); err != nil {
+		return fmt.Errorf("unable to create the directory of '%s': %w", *storeFlag, err)
+	}
+	if err := store.Save(*storeFlag); err != nil {
+		return err
+	}
+	log.Printf("saved the calibration of '%s' into '%s'", key, *storeFlag)
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type controlValue struct {
+	camera.Control
+	Key   string
+	Value *int32 `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+func runControls(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected a subcommand: 'get' or 'set'")
+	}
+	switch args[0] {
+	case "get":
+		return runControlsGet(args[1:])
+	case "set":
+		return runControlsSet(args[1:])
+	}
+	return fmt.Errorf("unknown subcommand '%s', expected 'get' or 'set'", args[0])
+}
+
+func openControls(dev camera.DevicePathAndPlatform) (camera.ControlsCloser, error) {
+	opener, ok := dev.Platform.(camera.ControlsOpener)
+	if !ok {
+		return nil, fmt.Errorf("controls of platform '%s' are %w", dev.PlatformID, camera.ErrNotSupported)
+	}
+	ctrls, err := opener.OpenControls(dev.DevicePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the controls of '%s': %w", dev.DevicePath, err)
+	}
+	return ctrls, nil
+}
+
+func runControlsGet(args []string) error {
+	flags := newFlagSet("controls")
+	devFlags := addDeviceFlags(flags)
+	jsonFlag := flags.Bool("json", false, "print as JSON")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+
+	var devicePath camera.DevicePath
+	var names []string
+	if flags.NArg() > 0 {
+		devicePath, names = flags.Arg(0), flags.Args()[1:]
+	}
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	ctrls, err := openControls(dev)
+	if err != nil {
+		return err
+	}
+	defer ctrls.Close()
+
+	available, err := ctrls.ListControls()
+	if err != nil {
+		return fmt.Errorf("unable to list the controls: %w", err)
+	}
+	selected := available
+	if len(names) > 0 {
+		selected = selected[:0:0]
+		for _, name := range names {
+			c, ok := camera.FindControl(available, name)
+			if !ok {
+				return fmt.Errorf("control '%s' is not found", name)
+			}
+			selected = append(selected, c)
+		}
+	}
+
+	values := make([]controlValue, 0, len(selected))
+	for _, c := range selected {
+		v := controlValue{Control: c, Key: c.Key()}
+		if c.Type != camera.ControlTypeButton {
+			value, err := ctrls.GetControl(c.ID)
+			if err != nil {
+				v.Error = err.Error()
+			} else {
+				v.Value = &value
+			}
+		}
+		values = append(values, v)
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", " ")
+		return enc.Encode(values)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tMIN\tMAX\tSTEP\tVALUE")
+	for _, v := range values {
+		value := "-"
+		switch {
+		case v.Error != "":
+			value = "error: " + v.Error
+		case v.Value != nil:
+			value = strconv.FormatInt(int64(*v.Value), 10)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", v.Key, v.Type, v.Min, v.Max, v.Step, value)
+	}
+	return tw.Flush()
+}
+
+func runControlsSet(args []string) error {
+	flags := newFlagSet("controls")
+	devFlags := addDeviceFlags(flags)
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return fmt.Errorf("expected a device and at least one NAME=VALUE")
+	}
+
+	dev, err := devFlags.Resolve(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	ctrls, err := openControls(dev)
+	if err != nil {
+		return err
+	}
+	defer ctrls.Close()
+
+	available, err := ctrls.ListControls()
+	if err != nil {
+		return fmt.Errorf("unable to list the controls: %w", err)
+	}
+
+	for _, assignment := range flags.Args()[1:] {
+		name, valueString, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return fmt.Errorf("invalid assignment '%s', expected NAME=VALUE", assignment)
+		}
+		c, ok := camera.FindControl(available, name)
+		if !ok {
+			return fmt.Errorf("control '%s' is not found", name)
+		}
+		value, err := parseControlValue(c, valueString)
+		if err != nil {
+			return fmt.Errorf("invalid value of control '%s': %w", name, err)
+		}
+		if err := ctrls.SetControl(c.ID, value); err != nil {
+			return fmt.Errorf("unable to set control '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+func parseControlValue(c camera.Control, s string) (int32, error) {
+	if c.Type == camera.ControlTypeBoolean {
+		if b, err := strconv.ParseBool(s); err == nil {
+			if b {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	v, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return 0, err
+	}
+	if c.Min < c.Max && (int32(v) < c.Min || int32(v) > c.Max) {
+		return 0, fmt.Errorf("%d is out of range [%d, %d]", v, c.Min, c.Max)
+	}
+	return int32(v), nil
+}
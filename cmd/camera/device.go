@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/pflag"
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/allplatforms"
+	"github.com/xaionaro-go/camera/autoexposure"
+	"github.com/xaionaro-go/camera/calibration"
+	"github.com/xaionaro-go/camera/platform/remote"
+	"github.com/xaionaro-go/camera/ptz"
+)
+
+func newFlagSet(cmdName string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(cmdName, pflag.ContinueOnError)
+	flags.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.Name == cmdName {
+				fmt.Fprintf(os.Stderr, "usage: %s %s\n\n%s\n\nflags:\n", os.Args[0], cmd.Usage, cmd.Description)
+			}
+		}
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags returns nil error if the help was requested, so the caller
+// should just exit in that case (ok == false).
+func parseFlags(flags *pflag.FlagSet, args []string) (bool, error) {
+	err := flags.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type deviceFlags struct {
+	Platform        *string
+	RemoteInsecure  *bool
+	RemoteCA        *string
+	RemoteTokenFile *string
+}
+
+func addDeviceFlags(flags *pflag.FlagSet) deviceFlags {
+	return deviceFlags{
+		Platform:        flags.String("platform", "", "use the given platform instead of choosing it automatically (e.g. 'v4l2', 'libav' or 'network')"),
+		RemoteInsecure:  flags.Bool("remote-insecure", false, "connect to the 'remote://' servers without TLS"),
+		RemoteCA:        flags.String("remote-ca", "", "the PEM file of the certificate authority of the 'remote://' servers (the system ones are used if empty)"),
+		RemoteTokenFile: flags.String("remote-token-file", "", "the file of the token required by the 'remote://' servers"),
+	}
+}
+
+// configureRemote configures the connections to the 'remote://' servers.
+func (f deviceFlags) configureRemote() error {
+	cfg, err := remote.LoadConfig(*f.RemoteInsecure, *f.RemoteCA, *f.RemoteTokenFile)
+	if err != nil {
+		return err
+	}
+	remote.DefaultPlatform().SetConfig(cfg)
+	return nil
+}
+
+// Resolve finds the device; if the device path is empty,
+// then the first available camera is used.
+func (f deviceFlags) Resolve(devicePath camera.DevicePath) (camera.DevicePathAndPlatform, error) {
+	if err := f.configureRemote(); err != nil {
+		return camera.DevicePathAndPlatform{}, err
+	}
+	if err := allplatforms.AddNetworkCamera(devicePath); err != nil {
+		return camera.DevicePathAndPlatform{}, err
+	}
+
+	if *f.Platform != "" {
+		plat := allplatforms.Get(*f.Platform)
+		if plat == nil {
+			return camera.DevicePathAndPlatform{}, fmt.Errorf("platform '%s' is unknown", *f.Platform)
+		}
+		cameras, err := plat.ListCameras()
+		if err != nil {
+			log.Printf("unable to list some cameras: %v", err)
+		}
+		switch {
+		case devicePath == "" && len(cameras) == 0:
+			return camera.DevicePathAndPlatform{}, fmt.Errorf("no cameras found on platform '%s'", *f.Platform)
+		case devicePath == "":
+			devicePath = cameras[0]
+		case !slices.Contains(cameras, devicePath):
+			return camera.DevicePathAndPlatform{}, fmt.Errorf("camera with path '%s' is not found (available: %v)", devicePath, cameras)
+		}
+		return camera.DevicePathAndPlatform{
+			DevicePath: devicePath,
+			Platform:   plat,
+			PlatformID: camera.PlatformID(*f.Platform),
+		}, nil
+	}
+
+	if devicePath != "" {
+		return camera.DefaultRegistry().FindCamera(devicePath)
+	}
+
+	cameras, err := camera.ListCameras()
+	if err != nil {
+		log.Printf("unable to list some cameras: %v", err)
+	}
+	if len(cameras) == 0 {
+		return camera.DevicePathAndPlatform{}, fmt.Errorf("no cameras found (use 'list --diagnose' to find out why)")
+	}
+	return cameras[0], nil
+}
+
+type formatFlags struct {
+	Width       *uint64
+	Height      *uint64
+	FPS         *float64
+	PixelFormat *string
+}
+
+func addFormatFlags(flags *pflag.FlagSet) formatFlags {
+	return formatFlags{
+		Width:       flags.Uint64("width", 0, "the frame width (any if zero)"),
+		Height:      flags.Uint64("height", 0, "the frame height (any if zero)"),
+		FPS:         flags.Float64("fps", math.NaN(), "the frame rate (any if not set)"),
+		PixelFormat: flags.String("pixel-format", "", "the pixel format, e.g. 'YUYV' or 'NV12' (any if empty)"),
+	}
+}
+
+// Select returns the best resolution among the formats of the device
+// matching the flags.
+func (f formatFlags) Select(dev camera.DevicePathAndPlatform) (camera.Format, error) {
+	formats, err := dev.ListFormats()
+	if err != nil {
+		return camera.Format{}, fmt.Errorf("unable to list the formats: %w", err)
+	}
+	if len(formats) == 0 {
+		return camera.Format{}, fmt.Errorf("the list of available formats is empty")
+	}
+
+	all := formats
+	if *f.PixelFormat != "" {
+		formats = formats.FilterByPixelFormat(camera.PixelFormatByName(*f.PixelFormat))
+	}
+	if *f.Width != 0 {
+		formats = formats.FilterByWidth(*f.Width)
+	}
+	if *f.Height != 0 {
+		formats = formats.FilterByHeight(*f.Height)
+	}
+	if !math.IsNaN(*f.FPS) {
+		formats = formats.FilterByFPS(*f.FPS)
+	}
+	if len(formats) == 0 {
+		return camera.Format{}, fmt.Errorf("no appropriate formats available (see 'formats %s': %d formats in total)", dev.DevicePath, len(all))
+	}
+	return formats.BestResolution(), nil
+}
+
+// openCamera opens the camera and starts streaming.
+func openCamera(
+	dev camera.DevicePathAndPlatform,
+	format camera.Format,
+) (camera.Camera, error) {
+	log.Printf("opening '%s' via platform '%s' with format %s %dx%d@%g", dev.DevicePath, dev.PlatformID, format.PixelFormat, format.Width, format.Height, format.FPS.Float64())
+	cam, err := dev.OpenCamera(format)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the camera: %w", err)
+	}
+	if err := cam.StartStreaming(); err != nil {
+		cam.Close()
+		return nil, fmt.Errorf("unable to start streaming: %w", err)
+	}
+	return cam, nil
+}
+
+type autoExposureFlags struct {
+	Enable     *bool
+	TargetLuma *float64
+}
+
+func addAutoExposureFlags(flags *pflag.FlagSet) autoExposureFlags {
+	return autoExposureFlags{
+		Enable:     flags.Bool("software-ae", false, "adjust the exposure, gain and white balance by the software (for cameras without a working hardware auto-exposure)"),
+		TargetLuma: flags.Float64("ae-target", autoexposure.DefaultTargetLuma, "the mean brightness (0-255) targeted by --software-ae"),
+	}
+}
+
+// Wrap returns the camera with the software auto-exposure if it is
+// enabled; the camera is closed on failure.
+func (f autoExposureFlags) Wrap(cam camera.Camera) (camera.Camera, error) {
+	if !*f.Enable {
+		return cam, nil
+	}
+	aeCam, err := autoexposure.NewCamera(cam, nil, autoexposure.Config{
+		TargetLuma: *f.TargetLuma,
+		OnError: func(err error) {
+			log.Printf("auto-exposure: %v", err)
+		},
+	})
+	if err != nil {
+		closeCamera(cam)
+		return nil, fmt.Errorf("unable to enable the software auto-exposure: %w", err)
+	}
+	return aeCam, nil
+}
+
+// defaultCalibrationStore returns the path of the calibrations
+// in the configuration directory of the user.
+func defaultCalibrationStore() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "calibration.json"
+	}
+	return filepath.Join(dir, "camera", "calibration.json")
+}
+
+type undistortFlags struct {
+	Enable *bool
+	Store  *string
+	Scale  *float64
+}
+
+func addUndistortFlags(flags *pflag.FlagSet) undistortFlags {
+	return undistortFlags{
+		Enable: flags.Bool("undistort", false, "remove the lens distortion (the camera should be calibrated via the 'calibrate' command)"),
+		Store:  flags.String("calibration", defaultCalibrationStore(), "the file with the calibrations of the cameras"),
+		Scale:  flags.Float64("undistort-scale", 1, "the zoom of the undistorted image: below 1 more of the field of view is kept"),
+	}
+}
+
+// Wrap returns the camera removing the lens distortion if it is
+// enabled; the camera is closed on failure.
+func (f undistortFlags) Wrap(
+	cam camera.Camera,
+	dev camera.DevicePathAndPlatform,
+) (_ camera.Camera, _err error) {
+	if !*f.Enable {
+		return cam, nil
+	}
+	defer func() {
+		if _err != nil {
+			closeCamera(cam)
+		}
+	}()
+	store, err := calibration.LoadStore(*f.Store)
+	if err != nil {
+		return nil, err
+	}
+	format := cam.GetFormat()
+	calib, err := store.Lookup(calibration.CameraKey(dev), format.Width, format.Height)
+	if err != nil {
+		return nil, fmt.Errorf("unable to undistort: %w", err)
+	}
+	rectCam, err := calibration.NewCamera(cam, calib, calibration.RectifyConfig{Scale: *f.Scale})
+	if err != nil {
+		return nil, fmt.Errorf("unable to undistort: %w", err)
+	}
+	return rectCam, nil
+}
+
+type digitalPTZFlags struct {
+	Size *string
+	Pan  *float64
+	Tilt *float64
+	Zoom *float64
+}
+
+func addPTZFlags(flags *pflag.FlagSet) digitalPTZFlags {
+	return digitalPTZFlags{
+		Size: flags.String("ptz", "", "crop and scale a region of the frames to the given resolution, like '1280x720' (the digital pan-tilt-zoom)"),
+		Pan:  flags.Float64("pan", 0, "the horizontal position of the region within [-1, 1] (with --ptz)"),
+		Tilt: flags.Float64("tilt", 0, "the vertical position of the region within [-1, 1] (with --ptz)"),
+		Zoom: flags.Float64("zoom", 1, "the magnification of the region (with --ptz)"),
+	}
+}
+
+// Wrap returns the digital pan-tilt-zoom camera if it is enabled;
+// the camera is closed on failure.
+func (f digitalPTZFlags) Wrap(cam camera.Camera) (_ camera.Camera, _err error) {
+	if *f.Size == "" {
+		return cam, nil
+	}
+	defer func() {
+		if _err != nil {
+			closeCamera(cam)
+		}
+	}()
+	output := cam.GetFormat()
+	if output.PixelFormat != camera.PixelFormatYUYV {
+		output.PixelFormat = camera.PixelFormatNV12
+	}
+	if _, err := fmt.Sscanf(*f.Size, "%dx%d", &output.Width, &output.Height); err != nil {
+		return nil, fmt.Errorf("unable to parse --ptz '%s': %w", *f.Size, err)
+	}
+	ptzCam, err := ptz.NewCamera(cam, output, ptz.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up the pan-tilt-zoom: %w", err)
+	}
+	ptzCam.SetPosition(ptz.Position{Pan: *f.Pan, Tilt: *f.Tilt, Zoom: *f.Zoom}, 0)
+	return ptzCam, nil
+}
+
+func closeCamera(cam camera.Camera) {
+	if err := cam.StopStreaming(); err != nil {
+		log.Printf("unable to stop streaming: %v", err)
+	}
+	if err := cam.Close(); err != nil {
+		log.Printf("unable to close the camera: %v", err)
+	}
+}
+
+func deviceArg(args []string) (camera.DevicePath, error) {
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
+	}
+	return "", fmt.Errorf("expected at most one device, but got %d arguments: %v", len(args), args)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/dvr"
+	"github.com/xaionaro-go/camera/motion"
+)
+
+func runDVR(ctx context.Context, args []string) error {
+	flags := newFlagSet("dvr")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	aeFlags := addAutoExposureFlags(flags)
+	detFlags := addMotionFlags(flags)
+	outputFlag := flags.StringP("output", "o", "recording-%s.mjpeg", "the file of a recording; '%s' is replaced with the start time")
+	encodingFlag := flags.String("encoding", "jpeg", "'jpeg' (a stream of JPEGs, e.g. for 'ffplay -f mjpeg') or 'raw' (the pixel data as is, e.g. for 'ffplay -f rawvideo')")
+	preRollFlag := flags.Duration("pre-roll", dvr.DefaultPreRoll, "how much of the time before an event to record")
+	postRollFlag := flags.Duration("post-roll", dvr.DefaultPostRoll, "how much of the time after an event to record")
+	maxMBFlag := flags.Int("max-mb", 0, "limit the memory of the pre-roll buffer to the given amount of megabytes (the default limit if zero, no limit if negative)")
+	noMotionFlag := flags.Bool("no-motion", false, "do not record on motion, only when triggered by a line on stdin")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(*outputFlag, "%s") {
+		return fmt.Errorf("--output should contain '%%s' for the start time, to not overwrite the recordings")
+	}
+	motionCfg, err := detFlags.Config()
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	if cam, err = aeFlags.Wrap(cam); err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+
+	storageFormat := cam.GetFormat()
+	switch encoding(*encodingFlag) {
+	case encodingJPEG:
+		storageFormat.PixelFormat = camera.PixelFormatMJPEG
+	case encodingRaw:
+		if storageFormat.PixelFormat != camera.PixelFormatYUYV {
+			storageFormat.PixelFormat = camera.PixelFormatNV12
+		}
+	default:
+		return fmt.Errorf("unknown encoding '%s'", *encodingFlag)
+	}
+	buf, err := dvr.New(storageFormat, dvr.Config{
+		PreRoll:  *preRollFlag,
+		PostRoll: *postRollFlag,
+		MaxBytes: *maxMBFlag << 20,
+		NewRecording: func(startTS time.Time) (io.WriteCloser, error) {
+			fileName := fmt.Sprintf(*outputFlag, startTS.Format("20060102-150405"))
+			log.Printf("recording '%s'", fileName)
+			return os.Create(fileName)
+		},
+		OnError: func(err error) {
+			log.Printf("%v", err)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer buf.Close()
+
+	go func() {
+		// any line on stdin is a manual trigger
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if err := buf.Trigger(); err != nil {
+				log.Printf("%v", err)
+			}
+		}
+	}()
+
+	if !*noMotionFlag {
+		cam = &motionCamera{
+			Camera:   cam,
+			Detector: motion.NewDetector(motionCfg),
+			Buffer:   buf,
+		}
+	}
+	log.Printf("buffering the last %v of '%s'", *preRollFlag, dev.DevicePath)
+	err = buf.Run(ctx, cam)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// motionCamera starts and stops the recordings of the buffer on motion.
+type motionCamera struct {
+	camera.Camera
+	Detector *motion.Detector
+	Buffer   *dvr.Buffer
+}
+
+func (c *motionCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	frame, err := c.Camera.GetFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, event := c.Detector.Process(frame.Image(), camera.FrameTimestamp(frame))
+	if event != nil {
+		log.Printf("motion %s at %v", event.Type, event.Bounds)
+		if err := c.Buffer.HandleMotionEvent(*event); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	return frame, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+type encoding string
+
+const (
+	encodingPNG  = encoding("png")
+	encodingJPEG = encoding("jpeg")
+	encodingRaw  = encoding("raw")
+)
+
+// encodingFromPath guesses the encoding by the file extension.
+func encodingFromPath(path string) (encoding, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return encodingPNG, true
+	case ".jpg", ".jpeg", ".mjpeg", ".mjpg":
+		return encodingJPEG, true
+	case ".raw", ".yuv":
+		return encodingRaw, true
+	}
+	return "", false
+}
+
+func (e encoding) Extension() string {
+	switch e {
+	case encodingJPEG:
+		return ".jpg"
+	case encodingRaw:
+		return ".raw"
+	}
+	return ".png"
+}
+
+func encodeImage(w io.Writer, img image.Image, enc encoding, jpegQuality int) error {
+	switch enc {
+	case encodingPNG:
+		return png.Encode(w, img)
+	case encodingJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case encodingRaw:
+		return writeRaw(w, img)
+	}
+	return fmt.Errorf("unknown encoding '%s'", enc)
+}
+
+// writeRaw writes the pixel data as is, so that it could be consumed by
+// tools like 'ffplay -f rawvideo'.
+func writeRaw(w io.Writer, img image.Image) error {
+	var planes [][]byte
+	switch img := img.(type) {
+	case *ximage.NV12:
+		planes = [][]byte{img.Y, img.CbCrBytes()}
+	case *ximage.YUYV:
+		planes = [][]byte{img.Y0CbY1CrBytes()}
+	case *image.YCbCr:
+		planes = [][]byte{img.Y, img.Cb, img.Cr}
+	case *image.RGBA:
+		planes = [][]byte{img.Pix}
+	case *image.Gray:
+		planes = [][]byte{img.Pix}
+	default:
+		return fmt.Errorf("raw output of %T is not supported", img)
+	}
+	for _, plane := range planes {
+		if _, err := w.Write(plane); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func runFormats(ctx context.Context, args []string) error {
+	flags := newFlagSet("formats")
+	devFlags := addDeviceFlags(flags)
+	jsonFlag := flags.Bool("json", false, "print as JSON")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	formats, err := dev.ListFormats()
+	if err != nil {
+		return fmt.Errorf("unable to list the formats of '%s': %w", dev.DevicePath, err)
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", " ")
+		return enc.Encode(formats)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PIXEL FORMAT\tWIDTH\tHEIGHT\tFPS")
+	for _, f := range formats {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%g (%d/%d)\n", f.PixelFormat, f.Width, f.Height, f.FPS.Float64(), f.FPS.Numerator, f.FPS.Denominator)
+	}
+	return tw.Flush()
+}
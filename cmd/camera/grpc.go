@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/xaionaro-go/camera/remote"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func runGRPC(ctx context.Context, args []string) error {
+	flags := newFlagSet("grpc")
+	listenFlag := flags.String("listen", "localhost:9000", "the address to accept gRPC connections on (only the local ones by default)")
+	tlsCertFlag := flags.String("tls-cert", "", "the PEM file of the TLS certificate (required unless --insecure)")
+	tlsKeyFlag := flags.String("tls-key", "", "the PEM file of the private key of the TLS certificate")
+	insecureFlag := flags.Bool("insecure", false, "serve without TLS, e.g. within a trusted network (the clients need '--remote-insecure')")
+	tokenFileFlag := flags.String("token-file", "", "the file of the token required from the clients (see '--remote-token-file' of the clients)")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	if (*tlsCertFlag == "") != (*tlsKeyFlag == "") {
+		return fmt.Errorf("--tls-cert and --tls-key should be set together")
+	}
+	// the clients require TLS unless told otherwise, so does the server
+	if (*tlsCertFlag == "") != *insecureFlag {
+		return fmt.Errorf("either --tls-cert (with --tls-key) or --insecure should be set")
+	}
+
+	var opts []grpc.ServerOption
+	if *tlsCertFlag != "" {
+		creds, err := credentials.NewServerTLSFromFile(*tlsCertFlag, *tlsKeyFlag)
+		if err != nil {
+			return fmt.Errorf("unable to load the TLS certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	var token string
+	if *tokenFileFlag != "" {
+		var err error
+		token, err = remote.ReadTokenFile(*tokenFileFlag)
+		if err != nil {
+			return err
+		}
+	}
+	if *insecureFlag || token == "" {
+		log.Printf("WARNING: without --tls-cert and --token-file the cameras are available to anybody able to connect to %s", *listenFlag)
+	}
+
+	srv := remote.New(remote.Config{
+		Token: token,
+		OnError: func(err error) {
+			log.Printf("%v", err)
+		},
+	})
+	log.Printf("serving the cameras at %s (use them as 'remote://HOST:PORT/DEVICE')", *listenFlag)
+	err := srv.ListenAndServe(ctx, *listenFlag, opts...)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
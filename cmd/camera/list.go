@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type listEntry struct {
+	PlatformID camera.PlatformID
+	DevicePath camera.DevicePath
+	camera.DeviceDescriptor
+}
+
+func runList(ctx context.Context, args []string) error {
+	flags := newFlagSet("list")
+	jsonFlag := flags.Bool("json", false, "print as JSON")
+	diagnoseFlag := flags.Bool("diagnose", false, "explain which devices are found and why some of them are skipped")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	if *diagnoseFlag {
+		for _, d := range camera.DiagnoseCameras() {
+			fmt.Println(d)
+		}
+		return nil
+	}
+
+	cameras, err := camera.ListCameras()
+	if err != nil {
+		log.Printf("unable to list some cameras: %v", err)
+	}
+
+	entries := make([]listEntry, 0, len(cameras))
+	for _, c := range cameras {
+		entry := listEntry{
+			PlatformID: c.PlatformID,
+			DevicePath: c.DevicePath,
+		}
+		if describer, ok := c.Platform.(camera.DeviceDescriber); ok {
+			entry.DeviceDescriptor, err = describer.DescribeDevice(c.DevicePath)
+			if err != nil {
+				log.Printf("unable to describe '%s': %v", c.DevicePath, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", " ")
+		return enc.Encode(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "no cameras found (use --diagnose to find out why)")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tPLATFORM\tNAME\tDRIVER\tBUS")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.DevicePath, e.PlatformID, e.Name, e.Driver, e.BusInfo)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/filesink"
+)
+
+func runLoopback(ctx context.Context, args []string) error {
+	flags := newFlagSet("loopback")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	sinkFlag := flags.String("sink", "", "the output device (e.g. a v4l2loopback node like /dev/video10) or a file")
+	sinkPixFmtFlag := flags.String("sink-pixel-format", string(camera.PixelFormatYUYV), "the pixel format of the output: 'YUYV', 'NV12' or 'MJPG'")
+	durationFlag := flags.Duration("duration", 0, "stop after the given time (never if zero)")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	if *sinkFlag == "" {
+		return fmt.Errorf("--sink is required")
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+
+	sinkFormat := cam.GetFormat()
+	sinkFormat.PixelFormat = camera.PixelFormatByName(*sinkPixFmtFlag)
+	sink, err := openSink(*sinkFlag, sinkFormat)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			log.Printf("unable to close the sink: %v", err)
+		}
+	}()
+	if sink.GetFormat() != sinkFormat {
+		return fmt.Errorf("the sink adjusted the format %#+v to %#+v, but scaling is not supported", sinkFormat, sink.GetFormat())
+	}
+
+	if *durationFlag > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, *durationFlag)
+		defer cancelFn()
+	}
+
+	startTS := time.Now()
+	var frameCount uint64
+	for {
+		err := withFrame(ctx, cam, sink.WriteFrame)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to pass frame #%d: %w", frameCount, err)
+		}
+		frameCount++
+	}
+	log.Printf("passed %d frames in %v", frameCount, time.Since(startTS).Round(time.Millisecond))
+	return nil
+}
+
+// openSink opens the output device via the first platform supporting it,
+// or falls back to writing into a file if the path is not a device.
+func openSink(path string, format camera.Format) (camera.CameraSink, error) {
+	if !strings.HasPrefix(path, "/dev/") {
+		log.Printf("writing %s %dx%d frames into file '%s'", format.PixelFormat, format.Width, format.Height, path)
+		return filesink.Create(path, format)
+	}
+
+	for _, p := range camera.DefaultRegistry().Platforms() {
+		opener, ok := p.Platform.(camera.SinkOpener)
+		if !ok {
+			continue
+		}
+		log.Printf("opening sink '%s' via platform '%s' with format %#+v", path, p.ID, format)
+		sink, err := opener.OpenSink(path, format)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open sink '%s': %w", path, err)
+		}
+		return sink, nil
+	}
+	return nil, fmt.Errorf("output devices are %w by the registered platforms", camera.ErrNotSupported)
+}
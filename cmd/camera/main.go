@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+type command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(ctx context.Context, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// initialized in init() since the commands refer to the list for the usage help
+	commands = []command{
+		{
+			Name:        "list",
+			Usage:       "list [--json] [--diagnose]",
+			Description: "list the available cameras",
+			Run:         runList,
+		},
+		{
+			Name:        "formats",
+			Usage:       "formats [--platform PLATFORM] [--json] [DEVICE]",
+			Description: "list the formats supported by the camera",
+			Run:         runFormats,
+		},
+		{
+			Name:        "controls",
+			Usage:       "controls get [--platform PLATFORM] [--json] [DEVICE [NAME...]]\n       controls set [--platform PLATFORM] DEVICE NAME=VALUE...",
+			Description: "show or change the camera controls",
+			Run:         runControls,
+		},
+		{
+			Name:        "snapshot",
+			Usage:       "snapshot [flags] [DEVICE]",
+			Description: "capture pictures as PNG, JPEG or raw pixel data",
+			Run:         runSnapshot,
+		},
+		{
+			Name:        "stream",
+			Usage:       "stream [flags] [DEVICE]",
+			Description: "write the video stream to stdout or a file",
+			Run:         runStream,
+		},
+		{
+			Name:        "bench",
+			Usage:       "bench [flags] [DEVICE]",
+			Description: "measure the actual FPS, the latency and the frame drops",
+			Run:         runBench,
+		},
+		{
+			Name:        "loopback",
+			Usage:       "loopback --sink OUTPUT [flags] [DEVICE]",
+			Description: "pass the frames into an output device (like v4l2loopback) or a file",
+			Run:         runLoopback,
+		},
+		{
+			Name:        "rtsp",
+			Usage:       "rtsp [--listen ADDR] [--path PATH] [flags] [DEVICE]",
+			Description: "serve the camera as an RTSP stream (MJPEG over RTP)",
+			Run:         runRTSP,
+		},
+		{
+			Name:        "webrtc",
+			Usage:       "webrtc [--listen ADDR] [--codec vp8|h264] [flags] [DEVICE]",
+			Description: "serve the camera via WebRTC with a player page for browsers",
+			Run:         runWebRTC,
+		},
+		{
+			Name:        "grpc",
+			Usage:       "grpc [--listen ADDR] (--tls-cert FILE --tls-key FILE | --insecure) [--token-file FILE]",
+			Description: "serve all the cameras to other machines (see the 'remote' platform)",
+			Run:         runGRPC,
+		},
+		{
+			Name:        "motion",
+			Usage:       "motion [--threshold N] [--region X0,Y0,X1,Y1] [--exec CMD] [flags] [DEVICE]",
+			Description: "detect motion and print the events as JSON lines",
+			Run:         runMotion,
+		},
+		{
+			Name:        "dvr",
+			Usage:       "dvr [--pre-roll DURATION] [--post-roll DURATION] [--output PATTERN] [flags] [DEVICE]",
+			Description: "record on motion (or a line on stdin) including the time before it",
+			Run:         runDVR,
+		},
+		{
+			Name:        "multicam",
+			Usage:       "multicam [--master INDEX] [--tolerance DURATION] [--output PATTERN] [flags] DEVICE DEVICE...",
+			Description: "capture from multiple cameras synchronously and report the skews",
+			Run:         runMulticam,
+		},
+		{
+			Name:        "calibrate",
+			Usage:       "calibrate [--board COLSxROWS] [--fisheye] [--views N] [flags] [DEVICE]",
+			Description: "estimate the lens distortion from the views of a checkerboard",
+			Run:         runCalibrate,
+		},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s COMMAND [ARGS]\n\ncommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintf(os.Stderr, "\nuse '%s COMMAND --help' for the details\n", os.Args[0])
+}
+
+func main() {
+	log.SetFlags(log.Ltime | log.Lmicroseconds)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmdName := os.Args[1]
+	if cmdName == "help" || cmdName == "-h" || cmdName == "--help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name != cmdName {
+			continue
+		}
+
+		ctx, cancelFn := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := cmd.Run(ctx, os.Args[2:])
+		cancelFn()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.Name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n", cmdName)
+	usage()
+	os.Exit(2)
+}
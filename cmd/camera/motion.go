@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/xaionaro-go/camera/motion"
+)
+
+type motionFlags struct {
+	Threshold     *uint8
+	MinArea       *int
+	CellSize      *int
+	StopDelay     *time.Duration
+	Regions       *[]string
+	IgnoreRegions *[]string
+}
+
+func addMotionFlags(flags *pflag.FlagSet) motionFlags {
+	return motionFlags{
+		Threshold:     flags.Uint8("threshold", motion.DefaultThreshold, "the minimal change of the brightness (0-255) to detect; lower is more sensitive"),
+		MinArea:       flags.Int("min-area", motion.DefaultMinBlobArea, "the minimal area (in pixels) of a moving object"),
+		CellSize:      flags.Int("cell-size", motion.DefaultCellSize, "the size (in pixels) of the blocks the image is averaged over"),
+		StopDelay:     flags.Duration("stop-delay", motion.DefaultStopDelay, "how long there should be no motion to report its stop"),
+		Regions:       flags.StringArray("region", nil, "detect only within the area 'X0,Y0,X1,Y1' (may be repeated)"),
+		IgnoreRegions: flags.StringArray("ignore", nil, "ignore the area 'X0,Y0,X1,Y1' (may be repeated)"),
+	}
+}
+
+func (f motionFlags) Config() (motion.Config, error) {
+	regions, err := parseRects(*f.Regions)
+	if err != nil {
+		return motion.Config{}, fmt.Errorf("invalid --region: %w", err)
+	}
+	ignoreRegions, err := parseRects(*f.IgnoreRegions)
+	if err != nil {
+		return motion.Config{}, fmt.Errorf("invalid --ignore: %w", err)
+	}
+	return motion.Config{
+		CellSize:      *f.CellSize,
+		Threshold:     *f.Threshold,
+		MinBlobArea:   *f.MinArea,
+		StopDelay:     *f.StopDelay,
+		Regions:       regions,
+		IgnoreRegions: ignoreRegions,
+	}, nil
+}
+
+func runMotion(ctx context.Context, args []string) error {
+	flags := newFlagSet("motion")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	aeFlags := addAutoExposureFlags(flags)
+	detFlags := addMotionFlags(flags)
+	execFlag := flags.String("exec", "", "run the shell command on every event; the event is passed via the environment variables MOTION_EVENT ('start' or 'stop') and MOTION_BOUNDS ('X0,Y0,X1,Y1')")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	motionCfg, err := detFlags.Config()
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	if cam, err = aeFlags.Wrap(cam); err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+
+	detector := motion.NewDetector(motionCfg)
+
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	events := make(chan motion.Event, 1)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- detector.Run(ctx, cam, events)
+	}()
+
+	log.Printf("watching '%s' for motion", dev.DevicePath)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case err := <-runErr:
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		case event := <-events:
+			if err := enc.Encode(event); err != nil {
+				return fmt.Errorf("unable to write the event: %w", err)
+			}
+			if *execFlag != "" {
+				runEventCommand(ctx, *execFlag, event)
+			}
+		}
+	}
+}
+
+func runEventCommand(ctx context.Context, command string, event motion.Event) {
+	b := event.Bounds
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"MOTION_EVENT="+event.Type.String(),
+		fmt.Sprintf("MOTION_BOUNDS=%d,%d,%d,%d", b.Min.X, b.Min.Y, b.Max.X, b.Max.Y),
+	)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("the command failed on the motion %s: %v", event.Type, err)
+	}
+}
+
+func parseRects(args []string) ([]image.Rectangle, error) {
+	var result []image.Rectangle
+	for _, arg := range args {
+		var r image.Rectangle
+		if _, err := fmt.Sscanf(arg, "%d,%d,%d,%d", &r.Min.X, &r.Min.Y, &r.Max.X, &r.Max.Y); err != nil {
+			return nil, fmt.Errorf("unable to parse '%s' as 'X0,Y0,X1,Y1': %w", arg, err)
+		}
+		result = append(result, r.Canon())
+	}
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/multicam"
+)
+
+func runMulticam(ctx context.Context, args []string) error {
+	flags := newFlagSet("multicam")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	masterFlag := flags.Int("master", -1, "pace the frame sets by the camera with the given index (the sets may lack the frames of the other cameras); by default only complete sets are emitted")
+	toleranceFlag := flags.Duration("tolerance", 0, "the maximal skew of a frame within a set (default: a half of the frame interval)")
+	outputFlag := flags.StringP("output", "o", "", "write the frames of the sets into the files; the pattern should contain two verbs: for the number of the set and for the index of the camera, e.g. 'set-%05d-cam%d.jpg' (by default nothing is written)")
+	qualityFlag := flags.Int("quality", 90, "the JPEG quality")
+	countFlag := flags.Uint64("count", 0, "stop after the given amount of the sets (no limit if zero)")
+	statsIntervalFlag := flags.Duration("stats-interval", 5*time.Second, "how often to log the skews and the drops")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return fmt.Errorf("expected at least two devices, but got %d", flags.NArg())
+	}
+	enc := encodingPNG
+	if *outputFlag != "" {
+		if strings.Count(*outputFlag, "%") < 2 {
+			return fmt.Errorf("--output should contain two verbs like 'set-%%05d-cam%%d.jpg'")
+		}
+		if guessed, ok := encodingFromPath(*outputFlag); ok {
+			enc = guessed
+		}
+	}
+
+	cfg := multicam.Config{
+		Tolerance: *toleranceFlag,
+		OnError: func(err error) {
+			log.Printf("%v", err)
+		},
+	}
+	if *masterFlag >= 0 {
+		cfg.Mode = multicam.ModeMaster
+		cfg.Master = *masterFlag
+	}
+
+	var devices []camera.DevicePathAndPlatform
+	for _, devicePath := range flags.Args() {
+		dev, err := devFlags.Resolve(devicePath)
+		if err != nil {
+			return err
+		}
+		devices = append(devices, dev)
+	}
+	// the same format for all the cameras, since usually
+	// they are of the same model
+	format, err := fmtFlags.Select(devices[0])
+	if err != nil {
+		return err
+	}
+	log.Printf("opening %d cameras with format %s %dx%d@%g", len(devices), format.PixelFormat, format.Width, format.Height, format.FPS.Float64())
+	syncer, err := multicam.Open(devices, format, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		logMulticamStats(syncer.Stats())
+		if err := syncer.Close(); err != nil {
+			log.Printf("%v", err)
+		}
+	}()
+	log.Printf("mode: %s, tolerance: %v", syncer.Config.Mode, syncer.Config.Tolerance)
+
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	sets := make(chan *multicam.FrameSet)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Run(ctx, sets)
+	}()
+
+	statsTicker := time.NewTicker(*statsIntervalFlag)
+	defer statsTicker.Stop()
+	for setIdx := uint64(0); *countFlag == 0 || setIdx < *countFlag; {
+		select {
+		case err := <-errCh:
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		case <-statsTicker.C:
+			logMulticamStats(syncer.Stats())
+		case set := <-sets:
+			err := writeFrameSet(*outputFlag, setIdx, set, enc, *qualityFlag)
+			if releaseErr := set.Release(); releaseErr != nil {
+				log.Printf("%v", releaseErr)
+			}
+			if err != nil {
+				return err
+			}
+			setIdx++
+		}
+	}
+	cancelFn()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func writeFrameSet(
+	output string,
+	setIdx uint64,
+	set *multicam.FrameSet,
+	enc encoding,
+	jpegQuality int,
+) error {
+	if output == "" {
+		return nil
+	}
+	for camIdx, frame := range set.Frames {
+		if frame == nil {
+			continue
+		}
+		fileName := fmt.Sprintf(output, setIdx, camIdx)
+		err := writeFile(fileName, func(w io.Writer) error {
+			return encodeImage(w, frame.Image(), enc, jpegQuality)
+		})
+		if err != nil {
+			return fmt.Errorf("unable to write '%s': %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+func logMulticamStats(stats multicam.Stats) {
+	log.Printf("sets: %d", stats.Sets)
+	for idx, s := range stats.Cameras {
+		log.Printf("  camera #%d: frames: %d, drops: %d, missing: %d, skipped by the camera: %d, skew: last %v, mean %v, max %v",
+			idx, s.Frames, s.Drops, s.Missing, s.Skipped, s.LastSkew, s.MeanSkew(), s.MaxSkew)
+	}
+}
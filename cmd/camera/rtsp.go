@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/xaionaro-go/camera/rtspserver"
+)
+
+func runRTSP(ctx context.Context, args []string) error {
+	flags := newFlagSet("rtsp")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	listenFlag := flags.String("listen", ":8554", "the address to accept RTSP connections on")
+	pathFlag := flags.String("path", "", "the path of the stream in the URL (any path is accepted if empty)")
+	qualityFlag := flags.Int("quality", rtspserver.DefaultJPEGQuality, "the JPEG quality")
+	rtpPortFlag := flags.Int("rtp-port", 0, "the UDP port to send RTP from (and the next one for RTCP); chosen automatically if zero")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+
+	srv, err := rtspserver.New(cam, rtspserver.Config{
+		Path:        *pathFlag,
+		JPEGQuality: *qualityFlag,
+		RTPPort:     *rtpPortFlag,
+		OnError: func(err error) {
+			log.Printf("%v", err)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("serving '%s' at rtsp://%s%s", dev.DevicePath, *listenFlag, *pathFlag)
+	err = srv.ListenAndServe(ctx, *listenFlag)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+func runSnapshot(ctx context.Context, args []string) error {
+	flags := newFlagSet("snapshot")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	aeFlags := addAutoExposureFlags(flags)
+	udFlags := addUndistortFlags(flags)
+	ptzFlags := addPTZFlags(flags)
+	outputFlag := flags.StringP("output", "o", "", "the output file; '-' means stdout; if --count is more than one, then it should contain a verb like '%03d' for the frame number (default: 'snapshot.png' or 'snapshot-%03d.png')")
+	encodingFlag := flags.String("encoding", "", "'png', 'jpeg' or 'raw' (default: guessed by the output file extension, or 'png')")
+	qualityFlag := flags.Int("quality", 90, "the JPEG quality")
+	countFlag := flags.Uint("count", 1, "the amount of pictures to take")
+	intervalFlag := flags.Duration("interval", 0, "the interval between the pictures")
+	delayFlag := flags.Duration("delay", 0, "how long to stream before taking the first picture (e.g. to let the auto-exposure settle)")
+	warmupFlag := flags.Uint("warmup-frames", 1, "the amount of the first frames to discard")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	if *countFlag == 0 {
+		return fmt.Errorf("--count should be positive")
+	}
+
+	enc := encoding(*encodingFlag)
+	if enc == "" {
+		enc = encodingPNG
+		if guessed, ok := encodingFromPath(*outputFlag); ok {
+			enc = guessed
+		}
+	}
+	output := *outputFlag
+	switch {
+	case output == "" && *countFlag == 1:
+		output = "snapshot" + enc.Extension()
+	case output == "":
+		output = "snapshot-%03d" + enc.Extension()
+	case output != "-" && *countFlag > 1 && !strings.Contains(output, "%"):
+		return fmt.Errorf("--output should contain a verb like '%%03d' to take more than one picture")
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	if cam, err = aeFlags.Wrap(cam); err != nil {
+		return err
+	}
+	if cam, err = udFlags.Wrap(cam, dev); err != nil {
+		return err
+	}
+	if cam, err = ptzFlags.Wrap(cam); err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+
+	discardUntil := time.Now().Add(*delayFlag)
+	for i := uint(0); i < *warmupFlag || time.Now().Before(discardUntil); i++ {
+		if err := withFrame(ctx, cam, func(camera.Frame) error { return nil }); err != nil {
+			return fmt.Errorf("unable to get a warm-up frame: %w", err)
+		}
+	}
+
+	for i := uint(0); i < *countFlag; i++ {
+		if i > 0 && *intervalFlag > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(*intervalFlag):
+			}
+		}
+
+		err := withFrame(ctx, cam, func(frame camera.Frame) error {
+			if output == "-" {
+				return encodeImage(os.Stdout, frame.Image(), enc, *qualityFlag)
+			}
+			fileName := output
+			if *countFlag > 1 {
+				fileName = fmt.Sprintf(output, i)
+			}
+			log.Printf("writing '%s'", fileName)
+			return writeFile(fileName, func(w io.Writer) error {
+				return encodeImage(w, frame.Image(), enc, *qualityFlag)
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("unable to take picture #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// withFrame gets a frame, calls the callback and releases the frame.
+func withFrame(
+	ctx context.Context,
+	cam camera.Camera,
+	callback func(camera.Frame) error,
+) (_err error) {
+	frame, err := cam.GetFrame(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get a frame: %w", err)
+	}
+	defer func() {
+		if err := cam.ReleaseFrame(frame); err != nil && _err == nil {
+			_err = fmt.Errorf("unable to release the frame: %w", err)
+		}
+	}()
+	return callback(frame)
+}
+
+func writeFile(fileName string, write func(io.Writer) error) (_err error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil && _err == nil {
+			_err = err
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
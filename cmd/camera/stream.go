@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+func runStream(ctx context.Context, args []string) (_err error) {
+	flags := newFlagSet("stream")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	aeFlags := addAutoExposureFlags(flags)
+	udFlags := addUndistortFlags(flags)
+	ptzFlags := addPTZFlags(flags)
+	outputFlag := flags.StringP("output", "o", "-", "the output file; '-' means stdout")
+	encodingFlag := flags.String("encoding", "raw", "'raw' (the pixel data as is, e.g. for 'ffplay -f rawvideo') or 'jpeg' (a stream of JPEGs, e.g. for 'ffplay -f mjpeg')")
+	qualityFlag := flags.Int("quality", 80, "the JPEG quality")
+	durationFlag := flags.Duration("duration", 0, "stop after the given time (never if zero)")
+	countFlag := flags.Uint64("count", 0, "stop after the given amount of frames (never if zero)")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	enc := encoding(*encodingFlag)
+	if enc != encodingRaw && enc != encodingJPEG {
+		return fmt.Errorf("unsupported encoding '%s'", enc)
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputFlag != "-" {
+		f, err := os.Create(*outputFlag)
+		if err != nil {
+			return fmt.Errorf("unable to create the output file: %w", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil && _err == nil {
+				_err = err
+			}
+		}()
+		out = f
+	}
+	w := bufio.NewWriterSize(out, 1<<20)
+	defer func() {
+		if err := w.Flush(); err != nil && _err == nil {
+			_err = err
+		}
+	}()
+
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	if cam, err = aeFlags.Wrap(cam); err != nil {
+		return err
+	}
+	if cam, err = udFlags.Wrap(cam, dev); err != nil {
+		return err
+	}
+	if cam, err = ptzFlags.Wrap(cam); err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+	if enc == encodingRaw {
+		format := cam.GetFormat()
+		log.Printf("writing raw %s %dx%d frames", format.PixelFormat, format.Width, format.Height)
+	}
+
+	if *durationFlag > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, *durationFlag)
+		defer cancelFn()
+	}
+
+	startTS := time.Now()
+	var frameCount uint64
+	for *countFlag == 0 || frameCount < *countFlag {
+		err := withFrame(ctx, cam, func(frame camera.Frame) error {
+			if err := encodeImage(w, frame.Image(), enc, *qualityFlag); err != nil {
+				return err
+			}
+			// not keeping the frames in the buffer if the reader is fast enough
+			return w.Flush()
+		})
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to stream frame #%d: %w", frameCount, err)
+		}
+		frameCount++
+	}
+	log.Printf("streamed %d frames in %v", frameCount, time.Since(startTS).Round(time.Millisecond))
+	return nil
+}
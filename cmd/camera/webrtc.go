@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/platform/libav"
+	"github.com/xaionaro-go/camera/webrtcserver"
+)
+
+// webrtcEncoders are the libav encoders of the codecs supported by browsers.
+var webrtcEncoders = map[string]struct {
+	Codec   camera.PixelFormat
+	Encoder string
+}{
+	"vp8":  {Codec: camera.PixelFormatVP8, Encoder: "libvpx"},
+	"h264": {Codec: camera.PixelFormatH264, Encoder: "libx264"},
+}
+
+func runWebRTC(ctx context.Context, args []string) error {
+	flags := newFlagSet("webrtc")
+	devFlags := addDeviceFlags(flags)
+	fmtFlags := addFormatFlags(flags)
+	listenFlag := flags.String("listen", ":8080", "the address to serve the player page and the signaling on")
+	codecFlag := flags.String("codec", "vp8", "'vp8' or 'h264'")
+	bitrateFlag := flags.Uint64("bitrate", webrtcserver.DefaultInitialBitrate, "the initial bitrate (in bits per second)")
+	maxBitrateFlag := flags.Uint64("max-bitrate", webrtcserver.DefaultMaxBitrate, "the maximal bitrate (in bits per second)")
+	if ok, err := parseFlags(flags, args); !ok {
+		return err
+	}
+	devicePath, err := deviceArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	codec, ok := webrtcEncoders[*codecFlag]
+	if !ok {
+		return fmt.Errorf("unsupported codec '%s'", *codecFlag)
+	}
+
+	dev, err := devFlags.Resolve(devicePath)
+	if err != nil {
+		return err
+	}
+	format, err := fmtFlags.Select(dev)
+	if err != nil {
+		return err
+	}
+	cam, err := openCamera(dev, format)
+	if err != nil {
+		return err
+	}
+	defer closeCamera(cam)
+
+	enc, err := libav.NewEncoder(codec.Encoder, cam.GetFormat(), *bitrateFlag, libav.LowLatencyEncoderOptions[codec.Encoder])
+	if err != nil {
+		return fmt.Errorf("unable to initialize the encoder: %w", err)
+	}
+	defer enc.Close()
+
+	srv, err := webrtcserver.New(cam, enc, webrtcserver.Config{
+		Codec:          codec.Codec,
+		InitialBitrate: *bitrateFlag,
+		MaxBitrate:     *maxBitrateFlag,
+		OnError: func(err error) {
+			log.Printf("%v", err)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("serving '%s' at http://%s/", dev.DevicePath, *listenFlag)
+	err = srv.ListenAndServe(ctx, *listenFlag)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+// camerad shares the cameras between local processes: the programs using
+// the registry (with the camerad platform registered, see allplatforms)
+// open the cameras via the daemon while it runs, so that many of them
+// can stream the same device at once.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/pflag"
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/allplatforms"
+	"github.com/xaionaro-go/camera/camerad"
+	platformcamerad "github.com/xaionaro-go/camera/platform/camerad"
+)
+
+func main() {
+	socketFlag := pflag.String("socket", camerad.DefaultSocketPath(), "the path of the socket to listen on (the default may be changed via $"+camerad.SocketPathEnv+")")
+	maxInFlightFlag := pflag.Int("max-in-flight", camerad.DefaultMaxInFlight, "how many frames a client may hold before the next ones are skipped for it")
+	networkCamerasFlag := pflag.StringSlice("network-camera", nil, "a URL of a network camera to share (may be repeated)")
+	pflag.Parse()
+
+	// the daemon opens the devices directly, not via itself
+	if err := camera.DefaultRegistry().SetPlatformEnabled(platformcamerad.PlatformID, false); err != nil {
+		log.Fatal(err)
+	}
+	for _, url := range *networkCamerasFlag {
+		if err := allplatforms.AddNetworkCamera(url); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, cancelFn := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelFn()
+
+	srv := camerad.New(camerad.Config{
+		MaxInFlight: *maxInFlightFlag,
+		OnError: func(err error) {
+			log.Println(err)
+		},
+	})
+	log.Printf("listening at '%s'", *socketFlag)
+	err := srv.ListenAndServe(ctx, *socketFlag)
+	os.Remove(*socketFlag)
+	if err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
@@ -17,41 +17,71 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/xaionaro-go/camera"
 	"github.com/xaionaro-go/camera/allplatforms"
+	"github.com/xaionaro-go/camera/metrics"
+	"github.com/xaionaro-go/camera/platform/remote"
 )
 
 func main() {
-	availableCameras, err := camera.ListCameras()
-	if err != nil {
-		panic(fmt.Errorf("unable to get the list of cameras: %w", err))
-	}
-	if len(availableCameras) == 0 {
-		panic("no cameras found")
-	}
-
-	netPprofAddr := pflag.String("net-pprof-addr", "", "")
+	netPprofAddr := pflag.String("net-pprof-addr", "", "the address to serve pprof (under /debug/pprof/) and the metrics (under /metrics) on")
 	widthFlag := pflag.Uint64("width", 0, "")
 	fpsFlag := pflag.Float64("fps", math.NaN(), "")
 	pixFmtFlag := pflag.String("pixel-format", "", "")
 	platformFlag := pflag.String("platform", "", "")
-	deviceFlag := pflag.String("device", availableCameras[0].DevicePath, "")
+	deviceFlag := pflag.String("device", "", "a device path or a URL of a network camera; the first available camera is used if empty")
+	diagnoseFlag := pflag.Bool("diagnose", false, "explain which devices are found and why some of them are skipped, and exit")
+	remoteInsecureFlag := pflag.Bool("remote-insecure", false, "connect to the 'remote://' servers without TLS")
+	remoteCAFlag := pflag.String("remote-ca", "", "the PEM file of the certificate authority of the 'remote://' servers (the system ones are used if empty)")
+	remoteTokenFileFlag := pflag.String("remote-token-file", "", "the file of the token required by the 'remote://' servers")
+	tlFlags := addTimelapseFlags()
 	pflag.Parse()
 
+	if *diagnoseFlag {
+		for _, d := range camera.DiagnoseCameras() {
+			fmt.Println(d)
+		}
+		return
+	}
+
+	remoteCfg, err := remote.LoadConfig(*remoteInsecureFlag, *remoteCAFlag, *remoteTokenFileFlag)
+	if err != nil {
+		panic(err)
+	}
+	remote.DefaultPlatform().SetConfig(remoteCfg)
+
+	if err := allplatforms.AddNetworkCamera(*deviceFlag); err != nil {
+		panic(err)
+	}
+	availableCameras, err := camera.ListCameras()
+	if err != nil {
+		// the listing is still valid, but may be incomplete
+		log.Printf("unable to list some cameras: %v", err)
+	}
+	if len(availableCameras) == 0 {
+		panic(fmt.Errorf("no cameras found (use --diagnose to find out why)"))
+	}
+	if *deviceFlag == "" {
+		*deviceFlag = availableCameras[0].DevicePath
+	}
+
 	if *netPprofAddr != "" {
+		http.Handle("/metrics", metrics.Handler())
 		go func() {
 			log.Println(http.ListenAndServe(*netPprofAddr, nil))
 		}()
 	}
 
 	var plat camera.Platform
+	var platformID camera.PlatformID
 	var devicePath camera.DevicePath
 	if *platformFlag != "" {
+		platformID = camera.PlatformID(*platformFlag)
 		plat = allplatforms.Get(*platformFlag)
 		if plat == nil {
 			panic(fmt.Errorf("platform '%s' is unknown", *platformFlag))
 		}
 		availableCameras, err := plat.ListCameras()
 		if err != nil {
-			panic(fmt.Errorf("unable to list cameras: %w", err))
+			log.Printf("unable to list some cameras: %v", err)
 		}
 		for _, c := range availableCameras {
 			if c == *deviceFlag {
@@ -63,16 +93,13 @@ func main() {
 			panic(fmt.Errorf("camera with path '%s' is not found (available: %#+v)", *deviceFlag, availableCameras))
 		}
 	} else {
-		var cameraSelector camera.DevicePathAndPlatform
-		for _, c := range availableCameras {
-			if c.DevicePath == *deviceFlag {
-				cameraSelector = c
-				break
-			}
-		}
-		if cameraSelector.Platform == nil {
-			panic(fmt.Errorf("camera with path '%s' is not found (available: %#+v)", *deviceFlag, availableCameras))
+		cameraSelector, err := camera.DefaultRegistry().FindCamera(*deviceFlag)
+		if err != nil {
+			panic(fmt.Errorf("unable to find the camera (available: %#+v): %w", availableCameras, err))
 		}
+		plat = cameraSelector.Platform
+		platformID = cameraSelector.PlatformID
+		devicePath = cameraSelector.DevicePath
 	}
 
 	formats, err := plat.ListFormats(devicePath)
@@ -120,11 +147,24 @@ func main() {
 
 	format := formats.BestResolution()
 
+	if tlFlags.Enabled() {
+		if err := runTimelapse(tlFlags, plat, devicePath, format); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	log.Printf("requesting format %#+v", format)
-	camera, err := plat.OpenCamera(devicePath, format)
+	dev := camera.DevicePathAndPlatform{
+		DevicePath: devicePath,
+		Platform:   plat,
+		PlatformID: platformID,
+	}
+	rawCamera, err := plat.OpenCamera(devicePath, format)
 	if err != nil {
 		panic(fmt.Errorf("unable to open the camera: %w", err))
 	}
+	camera := metrics.WrapCamera(rawCamera, metrics.LabelsOf(dev))
 	defer camera.Close()
 
 	log.Printf("starting streaming")
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/platform/libav"
+	"github.com/xaionaro-go/camera/timelapse"
+)
+
+type timelapseFlags struct {
+	Interval    *time.Duration
+	Schedule    *string
+	Count       *uint64
+	Output      *string
+	Video       *string
+	Quality     *int
+	Bitrate     *uint64
+	StopBetween *bool
+}
+
+func addTimelapseFlags() timelapseFlags {
+	return timelapseFlags{
+		Interval:    pflag.Duration("interval", 0, "take a picture every given interval (a time-lapse)"),
+		Schedule:    pflag.String("schedule", "", "take the pictures on a cron-like schedule, e.g. '*/5 8-18 * * 1-5' or '@every 10m' (a time-lapse)"),
+		Count:       pflag.Uint64("count", 0, "the amount of the pictures of a time-lapse (no limit if zero)"),
+		Output:      pflag.String("output", "timelapse-%05d.jpg", "the files of the pictures of a time-lapse ('.jpg' or '.png'); '%05d' is replaced with the number of the picture"),
+		Video:       pflag.String("video", "", "write the time-lapse as a video into the given file ('.mjpeg' or '.h264') instead of the separate pictures"),
+		Quality:     pflag.Int("quality", timelapse.DefaultJPEGQuality, "the JPEG quality of a time-lapse"),
+		Bitrate:     pflag.Uint64("bitrate", 4_000_000, "the bitrate (in bits per second) of an H.264 time-lapse"),
+		StopBetween: pflag.Bool("stop-between", false, "stop streaming between the pictures of a time-lapse (to save the power and the USB bandwidth)"),
+	}
+}
+
+func (f timelapseFlags) Enabled() bool {
+	return *f.Interval > 0 || *f.Schedule != ""
+}
+
+func (f timelapseFlags) schedule() (timelapse.Schedule, error) {
+	if *f.Schedule != "" {
+		if *f.Interval > 0 {
+			return nil, fmt.Errorf("--interval and --schedule are mutually exclusive")
+		}
+		return timelapse.ParseSchedule(*f.Schedule)
+	}
+	return timelapse.Interval{Period: *f.Interval}, nil
+}
+
+func (f timelapseFlags) writer(format camera.Format) (timelapse.Writer, error) {
+	if *f.Video == "" {
+		return timelapse.NewImageFiles(*f.Output, *f.Quality)
+	}
+
+	ext := strings.ToLower(filepath.Ext(*f.Video))
+	switch ext {
+	case ".mjpeg", ".mjpg", ".h264":
+	default:
+		return nil, fmt.Errorf("unknown extension of '%s', expected '.mjpeg' or '.h264'", *f.Video)
+	}
+	file, err := os.Create(*f.Video)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create '%s': %w", *f.Video, err)
+	}
+	if ext != ".h264" {
+		return timelapse.NewMJPEGWriter(file, *f.Quality), nil
+	}
+	// the low latency options disable the frame reordering,
+	// so no frames are left in the encoder on closing
+	enc, err := libav.NewEncoder("libx264", format, *f.Bitrate, libav.LowLatencyEncoderOptions["libx264"])
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to initialize the H.264 encoder: %w", err)
+	}
+	return timelapse.NewEncoderWriter(file, enc), nil
+}
+
+func runTimelapse(
+	f timelapseFlags,
+	plat camera.Platform,
+	devicePath camera.DevicePath,
+	format camera.Format,
+) (_err error) {
+	schedule, err := f.schedule()
+	if err != nil {
+		return err
+	}
+	capturer, err := timelapse.New(plat, devicePath, format, timelapse.Config{
+		Schedule:             schedule,
+		Count:                *f.Count,
+		StopStreamingBetween: *f.StopBetween,
+		OnError: func(err error) {
+			log.Printf("%v", err)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	w, err := f.writer(format)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := w.Close(); err != nil && _err == nil {
+			_err = fmt.Errorf("unable to finish the time-lapse: %w", err)
+		}
+	}()
+
+	ctx, cancelFn := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelFn()
+	log.Printf("starting a time-lapse")
+	err = capturer.Run(ctx, &loggingWriter{Writer: w})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+type loggingWriter struct {
+	timelapse.Writer
+}
+
+func (w *loggingWriter) WriteFrame(index uint64, ts time.Time, img image.Image) error {
+	log.Printf("picture #%d taken at %s", index, ts.Format(time.RFC3339))
+	return w.Writer.WriteFrame(index, ts, img)
+}
@@ -0,0 +1,96 @@
+package camera
+
+import (
+	"io"
+	"strings"
+)
+
+type ControlID uint32
+
+type ControlType uint
+
+const (
+	ControlTypeUndefined = ControlType(iota)
+	ControlTypeInteger
+	ControlTypeBoolean
+	ControlTypeMenu
+	ControlTypeButton
+	ControlTypeOther
+)
+
+func (t ControlType) String() string {
+	switch t {
+	case ControlTypeUndefined:
+		return "undefined"
+	case ControlTypeInteger:
+		return "integer"
+	case ControlTypeBoolean:
+		return "boolean"
+	case ControlTypeMenu:
+		return "menu"
+	case ControlTypeButton:
+		return "button"
+	case ControlTypeOther:
+		return "other"
+	}
+	return "unknown"
+}
+
+// Control describes a device setting, like brightness or exposure.
+type Control struct {
+	ID   ControlID
+	Name string
+	Type ControlType
+	Min  int32
+	Max  int32
+	Step int32
+}
+
+type Controls interface {
+	ListControls() ([]Control, error)
+	GetControl(ControlID) (int32, error)
+	SetControl(ControlID, int32) error
+}
+
+type ControlsCloser interface {
+	Controls
+	io.Closer
+}
+
+// ControlsOpener may be implemented by a Platform to access the controls
+// of a device without opening it as a camera (and so without touching
+// its format or streaming state).
+type ControlsOpener interface {
+	OpenControls(DevicePath) (ControlsCloser, error)
+}
+
+// Key returns the name in a form convenient for referring to the
+// control from the command line or a config: "White Balance, Auto" becomes
+// "white_balance_auto".
+func (c Control) Key() string {
+	var buf strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(c.Name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if underscore && buf.Len() > 0 {
+				buf.WriteByte('_')
+			}
+			underscore = false
+			buf.WriteRune(r)
+		default:
+			underscore = true
+		}
+	}
+	return buf.String()
+}
+
+// FindControl returns the control with the given Key or Name.
+func FindControl(controls []Control, name string) (Control, bool) {
+	for _, c := range controls {
+		if c.Key() == name || strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Control{}, false
+}
@@ -0,0 +1,76 @@
+package camera
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeviceDiagnostics explains if a device node is usable as a camera.
+type DeviceDiagnostics struct {
+	DevicePath DevicePath
+
+	// Problem is nil if the device is usable, otherwise it explains why
+	// the device is skipped (check it with errors.Is against
+	// fs.ErrPermission, ErrNotSupported, ErrDeviceBusy and so on).
+	Problem error
+}
+
+func (d DeviceDiagnostics) String() string {
+	if d.Problem == nil {
+		return fmt.Sprintf("%s: OK", d.DevicePath)
+	}
+	return fmt.Sprintf("%s: %v", d.DevicePath, d.Problem)
+}
+
+// DiagnosticsProvider may be implemented by a Platform to explain
+// which devices it considers and why some of them are skipped.
+type DiagnosticsProvider interface {
+	DiagnoseCameras() ([]DeviceDiagnostics, error)
+}
+
+type PlatformDiagnostics struct {
+	PlatformID PlatformID
+	Enabled    bool
+	Devices    []DeviceDiagnostics
+
+	// Err is the error of the enumeration itself.
+	Err error
+}
+
+// Diagnose collects the diagnostics of all the registered platforms
+// (including the disabled ones).
+func (r *Registry) Diagnose() []PlatformDiagnostics {
+	var result []PlatformDiagnostics
+	for _, p := range r.Platforms() {
+		d := PlatformDiagnostics{
+			PlatformID: p.ID,
+			Enabled:    p.Enabled,
+		}
+		if provider, ok := p.Platform.(DiagnosticsProvider); ok {
+			d.Devices, d.Err = provider.DiagnoseCameras()
+		} else {
+			d.Err = fmt.Errorf("diagnostics are %w by the platform", ErrNotSupported)
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func DiagnoseCameras() []PlatformDiagnostics {
+	return DefaultRegistry().Diagnose()
+}
+
+func (d PlatformDiagnostics) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "platform '%s'", d.PlatformID)
+	if !d.Enabled {
+		buf.WriteString(" (disabled)")
+	}
+	if d.Err != nil {
+		fmt.Fprintf(&buf, ": %v", d.Err)
+	}
+	for _, dev := range d.Devices {
+		fmt.Fprintf(&buf, "\n\t%s", dev)
+	}
+	return buf.String()
+}
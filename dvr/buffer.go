@@ -0,0 +1,373 @@
+// Package dvr implements a DVR-style pre-roll buffer: the recent frames
+// of a camera are continuously kept in memory, so when something happens
+// (an API call or a motion detected), the recording includes the seconds
+// before the event (the pre-roll) as well as the ones after it (the post-roll).
+//
+// The frames are copied out of the buffers of the camera, so they are
+// released as soon as they are added.
+package dvr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/motion"
+	"github.com/xaionaro-go/camera/rawimage"
+)
+
+// Frame is a copy of a frame kept in the buffer.
+type Frame struct {
+	Timestamp time.Time
+	Data      []byte
+}
+
+// Buffer keeps the recent frames and writes them into recordings.
+type Buffer struct {
+	// Format is the format of the data of the frames: raw frames
+	// are converted into it (e.g. to MJPEG to save the memory),
+	// compressed frames are expected to be in it already.
+	Format camera.Format
+	Config Config
+
+	locker        sync.Mutex
+	frames        []*Frame
+	size          int
+	limitReported bool
+	recording     *recording
+	wg            sync.WaitGroup
+}
+
+func New(format camera.Format, cfg Config) (*Buffer, error) {
+	cfg = cfg.withDefaults(format)
+	if cfg.NewRecording == nil {
+		return nil, fmt.Errorf("NewRecording is not set")
+	}
+	return &Buffer{
+		Format: format,
+		Config: cfg,
+	}, nil
+}
+
+func (b *Buffer) reportError(err error) {
+	if b.Config.OnError != nil {
+		b.Config.OnError(err)
+	}
+}
+
+// AddFrame copies the frame into the buffer (converting it into Format);
+// the frame may be released right after the call. See Run for
+// releasing the frame before an expensive conversion.
+func (b *Buffer) AddFrame(frame camera.Frame) error {
+	data, err := rawimage.AppendBytes(nil, &b.Format, frame.Image())
+	if err != nil {
+		return fmt.Errorf("unable to copy the frame: %w", err)
+	}
+	b.add(&Frame{
+		Timestamp: camera.FrameTimestamp(frame),
+		Data:      data,
+	})
+	return nil
+}
+
+// AddCompressed copies the frames into the buffer; they may be
+// released right after the call.
+func (b *Buffer) AddCompressed(frames camera.FramesCompressed) {
+	ts := time.Now()
+	if timestamper, ok := frames.(camera.FrameTimestamper); ok && !timestamper.Timestamp().IsZero() {
+		ts = timestamper.Timestamp()
+	}
+	b.add(&Frame{
+		Timestamp: ts,
+		Data:      slices.Clone(frames.Bytes()),
+	})
+}
+
+func (b *Buffer) add(frame *Frame) {
+	if err := b.push(frame); err != nil {
+		b.reportError(err)
+	}
+}
+
+// push adds the frame and passes it to the recording (if any).
+func (b *Buffer) push(frame *Frame) error {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	b.frames = append(b.frames, frame)
+	b.size += len(frame.Data)
+	var limitErr error
+	if b.trim(frame.Timestamp) && !b.limitReported {
+		// reported once, the frames are of about the same size anyway
+		b.limitReported = true
+		limitErr = fmt.Errorf("the frames do not fit into %d bytes, the pre-roll is limited to %v", b.Config.MaxBytes, b.preRoll())
+	}
+
+	rec := b.recording
+	if rec == nil {
+		return limitErr
+	}
+	if !rec.Holding && frame.Timestamp.After(rec.StopTS) {
+		b.finishRecording()
+		return limitErr
+	}
+	select {
+	case rec.Queue <- frame:
+		return limitErr
+	default:
+		// not blocking the capturing, the recording is behind anyway
+		return errors.Join(limitErr, fmt.Errorf("the recording is too slow, a frame is dropped"))
+	}
+}
+
+// trim drops the frames which are too old or do not fit into MaxBytes
+// (always keeping the latest one); it returns true if a frame within
+// PreRoll was dropped due to MaxBytes.
+func (b *Buffer) trim(now time.Time) bool {
+	dropCount := 0
+	limited := false
+	for dropCount < len(b.frames)-1 {
+		frame := b.frames[dropCount]
+		tooOld := now.Sub(frame.Timestamp) > b.Config.PreRoll
+		if !tooOld && (b.Config.MaxBytes < 0 || b.size <= b.Config.MaxBytes) {
+			break
+		}
+		limited = limited || !tooOld
+		b.size -= len(frame.Data)
+		dropCount++
+	}
+	if dropCount == 0 {
+		return false
+	}
+	clear(b.frames[:dropCount])
+	b.frames = b.frames[dropCount:]
+	if cap(b.frames) > 2*len(b.frames)+64 {
+		// to not keep growing the underlying array
+		b.frames = slices.Clone(b.frames)
+	}
+	return limited
+}
+
+// PreRoll returns the time span of the frames in the buffer, which is
+// shorter than Config.PreRoll if the frames do not fit into MaxBytes
+// (or the buffering started recently).
+func (b *Buffer) PreRoll() time.Duration {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	return b.preRoll()
+}
+
+func (b *Buffer) preRoll() time.Duration {
+	if len(b.frames) == 0 {
+		return 0
+	}
+	return b.frames[len(b.frames)-1].Timestamp.Sub(b.frames[0].Timestamp)
+}
+
+// Frames returns the frames currently in the buffer,
+// from the oldest to the newest.
+func (b *Buffer) Frames() []*Frame {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	return slices.Clone(b.frames)
+}
+
+// Run adds the frames of the camera until the context is done
+// or the camera fails. The camera should be already streaming.
+//
+// The frames are copied in a raw format and released before
+// the conversion into Format (if needed).
+func (b *Buffer) Run(ctx context.Context, cam camera.Camera) error {
+	copyFormat := cam.GetFormat()
+	switch copyFormat.PixelFormat {
+	case camera.PixelFormatNV12, camera.PixelFormatYUYV:
+	default:
+		copyFormat.PixelFormat = camera.PixelFormatNV12
+	}
+
+	for {
+		frame, err := cam.GetFrame(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("unable to get a frame: %w", err)
+		}
+		ts := camera.FrameTimestamp(frame)
+		data, err := rawimage.AppendBytes(nil, &copyFormat, frame.Image())
+		if err := cam.ReleaseFrame(frame); err != nil {
+			return fmt.Errorf("unable to release a frame: %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to copy the frame: %w", err)
+		}
+
+		if copyFormat.PixelFormat != b.Format.PixelFormat {
+			img, err := rawimage.NewRawImage(&copyFormat, data)
+			if err != nil {
+				return fmt.Errorf("unable to parse the copy of the frame: %w", err)
+			}
+			if data, err = rawimage.AppendBytes(nil, &b.Format, img); err != nil {
+				return fmt.Errorf("unable to convert the frame: %w", err)
+			}
+		}
+		b.add(&Frame{
+			Timestamp: ts,
+			Data:      data,
+		})
+	}
+}
+
+// RunCompressed adds the frames of the camera until the context is done
+// or the camera fails. The camera should be already streaming.
+func (b *Buffer) RunCompressed(ctx context.Context, cam camera.CameraCompressed) error {
+	for {
+		frames, err := cam.GetCompressedFrames(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("unable to get frames: %w", err)
+		}
+		b.AddCompressed(frames)
+		if err := cam.ReleaseFrames(frames); err != nil {
+			return fmt.Errorf("unable to release frames: %w", err)
+		}
+	}
+}
+
+// Trigger starts a recording (with the pre-roll) which stops after
+// PostRoll; if a recording is in progress already, then it is extended
+// to at least PostRoll from now.
+func (b *Buffer) Trigger() error {
+	return b.start(false)
+}
+
+// Start starts a recording (with the pre-roll) which lasts until Stop.
+func (b *Buffer) Start() error {
+	return b.start(true)
+}
+
+// Stop makes the recording stop after PostRoll.
+func (b *Buffer) Stop() {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	rec := b.recording
+	if rec == nil || !rec.Holding {
+		return
+	}
+	rec.Holding = false
+	rec.StopTS = later(rec.StopTS, time.Now().Add(b.Config.PostRoll))
+	b.scheduleFinish(rec)
+}
+
+// HandleMotionEvent records while the motion lasts (plus the pre-roll
+// and the post-roll).
+func (b *Buffer) HandleMotionEvent(event motion.Event) error {
+	switch event.Type {
+	case motion.EventTypeStart:
+		return b.Start()
+	case motion.EventTypeStop:
+		b.Stop()
+	}
+	return nil
+}
+
+// Recording returns true if a recording is in progress.
+func (b *Buffer) Recording() bool {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	return b.recording != nil
+}
+
+func (b *Buffer) start(hold bool) error {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	stopTS := time.Now().Add(b.Config.PostRoll)
+	if rec := b.recording; rec != nil {
+		rec.Holding = rec.Holding || hold
+		rec.StopTS = later(rec.StopTS, stopTS)
+		b.scheduleFinish(rec)
+		return nil
+	}
+
+	preRoll := slices.Clone(b.frames)
+	startTS := time.Now()
+	if len(preRoll) > 0 {
+		startTS = preRoll[0].Timestamp
+	}
+	w, err := b.Config.NewRecording(startTS)
+	if err != nil {
+		return fmt.Errorf("unable to start a recording: %w", err)
+	}
+
+	rec := &recording{
+		Queue:   make(chan *Frame, b.Config.QueueSize),
+		Holding: hold,
+		StopTS:  stopTS,
+	}
+	b.recording = rec
+	b.scheduleFinish(rec)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		if err := rec.write(w, preRoll); err != nil {
+			b.reportError(err)
+		}
+	}()
+	return nil
+}
+
+// scheduleFinish makes sure the recording finishes after StopTS even
+// if no frames arrive anymore (e.g. the camera stalled); the locker
+// should be held.
+func (b *Buffer) scheduleFinish(rec *recording) {
+	if rec.FinishTimer != nil {
+		rec.FinishTimer.Stop()
+		rec.FinishTimer = nil
+	}
+	if rec.Holding {
+		return
+	}
+	rec.FinishTimer = time.AfterFunc(time.Until(rec.StopTS)+finishDelay, func() {
+		b.locker.Lock()
+		defer b.locker.Unlock()
+		if b.recording == rec && !rec.Holding && time.Now().After(rec.StopTS) {
+			b.finishRecording()
+		}
+	})
+}
+
+// finishRecording makes the recording finish writing the already
+// queued frames; the locker should be held.
+func (b *Buffer) finishRecording() {
+	if timer := b.recording.FinishTimer; timer != nil {
+		timer.Stop()
+	}
+	close(b.recording.Queue)
+	b.recording = nil
+}
+
+// Close finishes the recording in progress (if any)
+// and waits until it is written.
+func (b *Buffer) Close() error {
+	b.locker.Lock()
+	if b.recording != nil {
+		b.finishRecording()
+	}
+	b.locker.Unlock()
+	b.wg.Wait()
+	return nil
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
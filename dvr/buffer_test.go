@@ -0,0 +1,305 @@
+package dvr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/motion"
+)
+
+// testFrames is a compressed frame of a single byte
+// (to tell the frames apart in the recordings).
+type testFrames struct {
+	data []byte
+	ts   time.Time
+}
+
+func (f *testFrames) Bytes() []byte {
+	return f.data
+}
+
+func (f *testFrames) Timestamp() time.Time {
+	return f.ts
+}
+
+type testRecording struct {
+	bytes.Buffer
+	StartTS time.Time
+	Closed  chan struct{}
+}
+
+func (r *testRecording) Close() error {
+	close(r.Closed)
+	return nil
+}
+
+type testRecordings struct {
+	locker     sync.Mutex
+	recordings []*testRecording
+}
+
+func (r *testRecordings) new(startTS time.Time) (io.WriteCloser, error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	rec := &testRecording{
+		StartTS: startTS,
+		Closed:  make(chan struct{}),
+	}
+	r.recordings = append(r.recordings, rec)
+	return rec, nil
+}
+
+func (r *testRecordings) get(t *testing.T) []*testRecording {
+	t.Helper()
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.recordings
+}
+
+// waitFinished waits until the only recording is written and returns it.
+func (r *testRecordings) waitFinished(t *testing.T) *testRecording {
+	t.Helper()
+	recordings := r.get(t)
+	if len(recordings) != 1 {
+		t.Fatalf("expected a single recording, got %d", len(recordings))
+	}
+	select {
+	case <-recordings[0].Closed:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the recording is not finished")
+	}
+	return recordings[0]
+}
+
+func addFrame(b *Buffer, id byte, ts time.Time) {
+	b.AddCompressed(&testFrames{data: []byte{id}, ts: ts})
+}
+
+func TestTrim(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		frameSize    int
+		maxBytes     int
+		expectedIDs  []byte
+		limitReports int
+	}{
+		{"pre_roll", 1, 0, []byte{19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29}, 0},
+		{"unlimited", 1000, -1, []byte{19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29}, 0},
+		{"max_bytes", 10, 50, []byte{25, 26, 27, 28, 29}, 1},
+		{"huge_frames", 100, 50, []byte{29}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs []error
+			b, err := New(camera.Format{PixelFormat: camera.PixelFormatH264}, Config{
+				PreRoll:  time.Second,
+				MaxBytes: tc.maxBytes,
+				NewRecording: func(time.Time) (io.WriteCloser, error) {
+					return nil, errors.New("unexpected recording")
+				},
+				OnError: func(err error) {
+					errs = append(errs, err)
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Unix(1000, 0)
+			for id := byte(0); id < 30; id++ {
+				data := bytes.Repeat([]byte{id}, tc.frameSize)
+				b.AddCompressed(&testFrames{data: data, ts: start.Add(time.Duration(id) * 100 * time.Millisecond)})
+			}
+
+			var ids []byte
+			for _, frame := range b.Frames() {
+				ids = append(ids, frame.Data[0])
+			}
+			if !bytes.Equal(ids, tc.expectedIDs) {
+				t.Errorf("expected the frames %v, got %v", tc.expectedIDs, ids)
+			}
+			expectedPreRoll := time.Duration(len(tc.expectedIDs)-1) * 100 * time.Millisecond
+			if preRoll := b.PreRoll(); preRoll != expectedPreRoll {
+				t.Errorf("expected the pre-roll %v, got %v", expectedPreRoll, preRoll)
+			}
+			if len(errs) != tc.limitReports {
+				t.Errorf("expected %d reports of the limited pre-roll, got %v", tc.limitReports, errs)
+			}
+		})
+	}
+}
+
+func TestPreRollBytes(t *testing.T) {
+	fps30 := camera.Fraction{Numerator: 30, Denominator: 1}
+	for _, tc := range []struct {
+		format camera.Format
+		size   int
+		ok     bool
+	}{
+		{camera.Format{Width: 1920, Height: 1080, PixelFormat: camera.PixelFormatNV12, FPS: fps30}, 1920 * 1080 * 3 / 2 * 151, true},
+		{camera.Format{Width: 640, Height: 480, PixelFormat: camera.PixelFormatYUYV, FPS: fps30}, 640 * 480 * 2 * 151, true},
+		{camera.Format{Width: 1920, Height: 1080, PixelFormat: camera.PixelFormatMJPEG, FPS: fps30}, 0, false},
+		{camera.Format{Width: 1920, Height: 1080, PixelFormat: camera.PixelFormatNV12}, 0, false},
+	} {
+		size, ok := PreRollBytes(tc.format, 5*time.Second)
+		if size != tc.size || ok != tc.ok {
+			t.Errorf("%v: expected %d, %v; got %d, %v", tc.format, tc.size, tc.ok, size, ok)
+		}
+	}
+
+	// the default fits the default pre-roll of 1080p
+	b, err := New(camera.Format{Width: 1920, Height: 1080, PixelFormat: camera.PixelFormatNV12, FPS: fps30}, Config{
+		NewRecording: (&testRecordings{}).new,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Config.MaxBytes != 1920*1080*3/2*151 {
+		t.Errorf("unexpected default MaxBytes %d", b.Config.MaxBytes)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	recordings := &testRecordings{}
+	b, err := New(camera.Format{PixelFormat: camera.PixelFormatH264}, Config{
+		PreRoll:      time.Second,
+		PostRoll:     time.Second,
+		NewRecording: recordings.new,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	now := time.Now()
+	addFrame(b, 0, now.Add(-2*time.Second)) // out of the pre-roll
+	addFrame(b, 1, now.Add(-time.Second))
+	addFrame(b, 2, now)
+	if err := b.Trigger(); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Recording() {
+		t.Errorf("expected a recording in progress")
+	}
+	addFrame(b, 3, now.Add(500*time.Millisecond))
+	// extending the recording instead of starting another one
+	if err := b.Trigger(); err != nil {
+		t.Fatal(err)
+	}
+	addFrame(b, 4, now.Add(time.Second))
+	// captured after the post-roll, so it finishes the recording
+	addFrame(b, 5, now.Add(10*time.Second))
+	addFrame(b, 6, now.Add(11*time.Second))
+
+	rec := recordings.waitFinished(t)
+	if b.Recording() {
+		t.Errorf("expected the recording to be finished")
+	}
+	if !rec.StartTS.Equal(now.Add(-time.Second)) {
+		t.Errorf("expected the recording to start with the pre-roll, got %v", rec.StartTS)
+	}
+	if data := rec.Bytes(); !bytes.Equal(data, []byte{1, 2, 3, 4}) {
+		t.Errorf("expected the frames [1 2 3 4], got %v", data)
+	}
+}
+
+func TestMotionEvents(t *testing.T) {
+	recordings := &testRecordings{}
+	b, err := New(camera.Format{PixelFormat: camera.PixelFormatH264}, Config{
+		PostRoll:     time.Second,
+		NewRecording: recordings.new,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	now := time.Now()
+	addFrame(b, 0, now)
+	if err := b.HandleMotionEvent(motion.Event{Type: motion.EventTypeStart}); err != nil {
+		t.Fatal(err)
+	}
+	// the recording is held until the motion stops
+	addFrame(b, 1, now.Add(time.Minute))
+	if !b.Recording() {
+		t.Fatalf("expected the recording to last until the motion stops")
+	}
+	if err := b.HandleMotionEvent(motion.Event{Type: motion.EventTypeStop}); err != nil {
+		t.Fatal(err)
+	}
+	addFrame(b, 2, now.Add(time.Minute+time.Second))
+	addFrame(b, 3, now.Add(time.Minute+2*time.Second))
+
+	rec := recordings.waitFinished(t)
+	if data := rec.Bytes(); !bytes.Equal(data, []byte{0, 1}) {
+		t.Errorf("expected the frames [0 1], got %v", data)
+	}
+}
+
+func TestFinishWithoutFrames(t *testing.T) {
+	recordings := &testRecordings{}
+	b, err := New(camera.Format{PixelFormat: camera.PixelFormatH264}, Config{
+		PostRoll:     10 * time.Millisecond,
+		NewRecording: recordings.new,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	addFrame(b, 0, time.Now())
+	if err := b.Trigger(); err != nil {
+		t.Fatal(err)
+	}
+	// the camera stalled, but the recording is finished anyway
+	rec := recordings.waitFinished(t)
+	if data := rec.Bytes(); !bytes.Equal(data, []byte{0}) {
+		t.Errorf("expected the frames [0], got %v", data)
+	}
+	if b.Recording() {
+		t.Errorf("expected the recording to be finished")
+	}
+}
+
+func TestClose(t *testing.T) {
+	recordings := &testRecordings{}
+	b, err := New(camera.Format{PixelFormat: camera.PixelFormatH264}, Config{
+		NewRecording: recordings.new,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addFrame(b, 0, time.Now())
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addFrame(b, 1, time.Now())
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rec := recordings.waitFinished(t)
+	if data := rec.Bytes(); !bytes.Equal(data, []byte{0, 1}) {
+		t.Errorf("expected the frames [0 1], got %v", data)
+	}
+}
+
+func TestRecordingError(t *testing.T) {
+	b, err := New(camera.Format{PixelFormat: camera.PixelFormatH264}, Config{
+		NewRecording: func(time.Time) (io.WriteCloser, error) {
+			return nil, errors.New("no space left")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.Trigger(); err == nil {
+		t.Errorf("expected an error")
+	}
+	if b.Recording() {
+		t.Errorf("expected no recording")
+	}
+}
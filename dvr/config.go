@@ -0,0 +1,92 @@
+package dvr
+
+import (
+	"io"
+	"math"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	DefaultPreRoll   = 5 * time.Second
+	DefaultPostRoll  = 5 * time.Second
+	DefaultQueueSize = 128
+
+	// DefaultMaxBytes limits the memory if the size of the pre-roll is
+	// not known in advance (e.g. for MJPEG).
+	DefaultMaxBytes = 256 << 20
+)
+
+type Config struct {
+	// PreRoll is how long the frames are kept in the buffer,
+	// and so how much of the time before a trigger is recorded.
+	PreRoll time.Duration
+
+	// MaxBytes limits the memory used by the frames in the buffer; the
+	// oldest frames are dropped first (so the pre-roll gets shorter,
+	// see Buffer.PreRoll). If zero, it fits PreRoll of raw frames (see
+	// PreRollBytes) or is DefaultMaxBytes if their size is not known;
+	// the memory is not limited if negative.
+	MaxBytes int
+
+	// PostRoll is how long the recording continues after
+	// the trigger (or after Stop).
+	PostRoll time.Duration
+
+	// NewRecording opens the destination of a recording starting with
+	// a frame captured at the given time. The frames are written back
+	// to back, in the format of the Buffer.
+	NewRecording func(startTS time.Time) (io.WriteCloser, error)
+
+	// QueueSize is the amount of frames which may wait to be written
+	// into the recording; further frames are dropped (and reported via
+	// OnError) if the destination is too slow.
+	QueueSize int
+
+	// OnError (if set) is called on errors which do not stop
+	// the buffering, like failures of recordings.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults(format camera.Format) Config {
+	if cfg.PreRoll == 0 {
+		cfg.PreRoll = DefaultPreRoll
+	}
+	if cfg.PostRoll == 0 {
+		cfg.PostRoll = DefaultPostRoll
+	}
+	if cfg.MaxBytes == 0 {
+		if size, ok := PreRollBytes(format, cfg.PreRoll); ok {
+			cfg.MaxBytes = size
+		} else {
+			cfg.MaxBytes = DefaultMaxBytes
+		}
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	return cfg
+}
+
+// PreRollBytes returns the memory needed to keep the given duration
+// of raw frames of the format; it returns false if the size of
+// the frames is not known (compressed frames or an unknown FPS).
+func PreRollBytes(format camera.Format, preRoll time.Duration) (int, bool) {
+	var frameSize uint64
+	switch format.PixelFormat {
+	case camera.PixelFormatNV12:
+		frameSize = format.Width * format.Height * 3 / 2
+	case camera.PixelFormatYUYV:
+		frameSize = format.Width * format.Height * 2
+	default:
+		return 0, false
+	}
+	fps := format.FPS.Float64()
+	if frameSize == 0 || !(fps > 0) || math.IsInf(fps, 0) {
+		return 0, false
+	}
+	// plus the frame being added before the oldest one is dropped
+	frameCount := uint64(math.Ceil(fps*preRoll.Seconds())) + 1
+	return int(frameSize * frameCount), true
+}
@@ -0,0 +1,71 @@
+package dvr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// finishDelay is how long after StopTS a recording is finished if no
+// frame captured after StopTS arrives, since the frames arrive a bit
+// later than they are captured.
+const finishDelay = time.Second
+
+type recording struct {
+	Queue chan *Frame
+
+	// Holding means the recording lasts until Stop,
+	// otherwise it lasts until StopTS.
+	Holding bool
+	StopTS  time.Time
+
+	// FinishTimer finishes the recording if the frames stop arriving.
+	FinishTimer *time.Timer
+}
+
+// write writes the pre-roll and then the queued frames until the queue
+// is closed; after a write error the queue is still drained, to not
+// fill it up.
+func (rec *recording) write(
+	w io.WriteCloser,
+	preRoll []*Frame,
+) (_err error) {
+	defer func() {
+		if err := w.Close(); err != nil {
+			_err = errors.Join(_err, fmt.Errorf("unable to close the recording: %w", err))
+		}
+	}()
+
+	bufW := bufio.NewWriterSize(w, 1<<20)
+	var writeErr error
+	writeFrame := func(frame *Frame) {
+		if writeErr != nil {
+			return
+		}
+		if _, err := bufW.Write(frame.Data); err != nil {
+			writeErr = fmt.Errorf("unable to write the recording: %w", err)
+		}
+	}
+
+	for _, frame := range preRoll {
+		writeFrame(frame)
+	}
+	for frame := range rec.Queue {
+		writeFrame(frame)
+		if writeErr == nil && len(rec.Queue) == 0 {
+			// keeping the recording up to date while waiting for frames
+			if err := bufW.Flush(); err != nil {
+				writeErr = fmt.Errorf("unable to write the recording: %w", err)
+			}
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := bufW.Flush(); err != nil {
+		return fmt.Errorf("unable to write the recording: %w", err)
+	}
+	return nil
+}
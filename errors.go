@@ -0,0 +1,51 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// The errors below are wrapped by the platforms and the other
+// implementations, so that the callers may use errors.Is to decide how
+// to handle a failure.
+var (
+	// ErrNotSupported means the operation or the requested
+	// parameters are not supported at all; retrying is pointless.
+	ErrNotSupported = errors.New("not supported")
+
+	// ErrDeviceBusy means the device is used by somebody else;
+	// it makes sense to retry later.
+	ErrDeviceBusy = errors.New("device is busy")
+
+	// ErrDeviceGone means the device disappeared or the stream broke;
+	// the camera should be reopened.
+	ErrDeviceGone = errors.New("device is gone")
+
+	// ErrNotFound means there is no device with the given path (e.g. the
+	// path is mistyped); unlike ErrDeviceGone, retrying is pointless
+	// unless the device was seen before (and so it may be plugged back).
+	ErrNotFound = errors.New("not found")
+
+	// ErrFormatRejected means the device does not accept the
+	// requested Format; another Format should be tried.
+	ErrFormatRejected = errors.New("format is rejected")
+
+	// ErrTimeout means the operation did not complete in time;
+	// it may be retried.
+	ErrTimeout = errors.New("timeout")
+
+	// ErrNoFrame means there is no frame available (yet);
+	// it may be retried.
+	ErrNoFrame = errors.New("no frame")
+)
+
+// ContextErr returns the error of the context (nil if it is not done);
+// an exceeded deadline is wrapped with ErrTimeout.
+func ContextErr(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+// Package filesink provides a camera.CameraSink which writes the frames
+// into a file, e.g. to test the pipelines without a v4l2loopback device.
+//
+// Raw frames are written back-to-back (playable with
+// 'ffplay -f rawvideo -pixel_format nv12 -video_size WxH'), MJPEG frames
+// are written as concatenated JPEG images (playable with 'ffplay -f mjpeg').
+package filesink
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+)
+
+type Sink struct {
+	Format camera.Format
+
+	locker sync.Mutex
+	writer *bufio.Writer
+	closer io.Closer
+	buf    []byte
+	frames uint64
+}
+
+var _ camera.CameraSink = (*Sink)(nil)
+
+func checkFormat(format camera.Format) error {
+	switch format.PixelFormat {
+	case camera.PixelFormatNV12, camera.PixelFormatYUYV, camera.PixelFormatMJPEG:
+		return nil
+	}
+	return fmt.Errorf("pixel format %s: %w", format.PixelFormat, camera.ErrNotSupported)
+}
+
+// New returns a sink writing into w; w is closed on Close.
+func New(w io.WriteCloser, format camera.Format) (*Sink, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, err
+	}
+	return &Sink{
+		Format: format,
+		writer: bufio.NewWriterSize(w, 1<<20),
+		closer: w,
+	}, nil
+}
+
+// Create returns a sink writing into a new file.
+func Create(path string, format camera.Format) (*Sink, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create '%s': %w", path, err)
+	}
+	return New(f, format)
+}
+
+func (s *Sink) GetFormat() camera.Format {
+	return s.Format
+}
+
+func (s *Sink) WriteFrame(frame camera.Frame) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.closer == nil {
+		return fmt.Errorf("the sink is closed")
+	}
+
+	var err error
+	s.buf, err = rawimage.AppendBytes(s.buf[:0], &s.Format, frame.Image())
+	if err != nil {
+		return fmt.Errorf("unable to convert the frame: %w", err)
+	}
+	if _, err := s.writer.Write(s.buf); err != nil {
+		return fmt.Errorf("unable to write the frame: %w", err)
+	}
+	s.frames++
+	return nil
+}
+
+// Frames returns the amount of written frames.
+func (s *Sink) Frames() uint64 {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.frames
+}
+
+func (s *Sink) Close() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.closer == nil {
+		return nil
+	}
+	err := s.writer.Flush()
+	if closeErr := s.closer.Close(); err == nil {
+		err = closeErr
+	}
+	s.closer = nil
+	return err
+}
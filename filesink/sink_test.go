@@ -0,0 +1,163 @@
+package filesink
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+type yCbCrImage interface {
+	YCbCrAt(x, y int) color.YCbCr
+}
+
+type testFrame struct {
+	img image.Image
+}
+
+func (f testFrame) Image() image.Image {
+	return f.img
+}
+
+// newTestImage returns an NV12 image with a gradient depending on seed.
+func newTestImage(w, h int, seed uint8) *ximage.NV12 {
+	img := ximage.NewNV12(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Y[y*img.YStride+x] = uint8(x+y) + seed
+		}
+	}
+	for i := range img.CbCr {
+		img.CbCr[i] = ximage.CbCr{Cb: 100 + seed, Cr: 150 - seed}
+	}
+	return img
+}
+
+func TestRaw(t *testing.T) {
+	for _, pixFmt := range []camera.PixelFormat{camera.PixelFormatNV12, camera.PixelFormatYUYV} {
+		t.Run(string(pixFmt), func(t *testing.T) {
+			format := camera.Format{Width: 16, Height: 8, PixelFormat: pixFmt}
+			path := filepath.Join(t.TempDir(), "frames.raw")
+			sink, err := Create(path, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var images []image.Image
+			for seed := uint8(0); seed < 3; seed++ {
+				img := newTestImage(16, 8, seed*10)
+				images = append(images, img)
+				if err := sink.WriteFrame(testFrame{img: img}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if sink.Frames() != 3 {
+				t.Errorf("expected 3 frames, got %d", sink.Frames())
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.WriteFrame(testFrame{img: images[0]}); err == nil {
+				t.Errorf("expected an error on writing into the closed sink")
+			}
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frameSize := 16 * 8 * 2
+			if pixFmt == camera.PixelFormatNV12 {
+				frameSize = 16 * 8 * 3 / 2
+			}
+			if len(b) != frameSize*len(images) {
+				t.Fatalf("expected %d bytes, got %d", frameSize*len(images), len(b))
+			}
+			for idx, expected := range images {
+				img, err := rawimage.NewRawImage(&format, b[idx*frameSize:(idx+1)*frameSize])
+				if err != nil {
+					t.Fatal(err)
+				}
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 16; x++ {
+						got := img.(yCbCrImage).YCbCrAt(x, y)
+						want := expected.(yCbCrImage).YCbCrAt(x, y)
+						if got != want {
+							t.Fatalf("frame %d: expected %v at (%d, %d), got %v", idx, want, x, y, got)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMJPEG(t *testing.T) {
+	var buf closingBuffer
+	sink, err := New(&buf, camera.Format{Width: 16, Height: 8, PixelFormat: camera.PixelFormatMJPEG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seed := uint8(0); seed < 2; seed++ {
+		if err := sink.WriteFrame(testFrame{img: newTestImage(16, 8, seed)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !buf.closed {
+		t.Errorf("expected the writer to be closed")
+	}
+
+	b := buf.Bytes()
+	soi := []byte{0xFF, 0xD8, 0xFF}
+	if count := bytes.Count(b, soi); count != 2 {
+		t.Errorf("expected 2 JPEG images, got %d", count)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(16, 8) {
+		t.Errorf("unexpected size of the image: %v", size)
+	}
+}
+
+func TestUnexpectedImage(t *testing.T) {
+	var buf closingBuffer
+	sink, err := New(&buf, camera.Format{Width: 16, Height: 8, PixelFormat: camera.PixelFormatNV12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.WriteFrame(testFrame{img: newTestImage(8, 8, 0)}); err == nil {
+		t.Errorf("expected an error on writing an image of another size")
+	}
+	if sink.Frames() != 0 {
+		t.Errorf("expected no written frames, got %d", sink.Frames())
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	_, err := New(&closingBuffer{}, camera.Format{Width: 16, Height: 8, PixelFormat: camera.PixelFormatYU12})
+	if !errors.Is(err, camera.ErrNotSupported) {
+		t.Errorf("expected the format to be not supported, got %v", err)
+	}
+}
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
@@ -25,6 +25,12 @@ const (
 	PixelFormatNV12 = PixelFormat("NV12") // https://www.kernel.org/doc/html/v4.10/media/uapi/v4l/pixfmt-nv12.html
 	PixelFormatYU12 = PixelFormat("YU12") // https://www.kernel.org/doc/html/v4.10/media/uapi/v4l/pixfmt-yuv420.html
 	PixelFormatYUYV = PixelFormat("YUYV") // https://www.kernel.org/doc/html/v4.10/media/uapi/v4l/pixfmt-yuyv.html
+
+	// Compressed formats:
+	PixelFormatMJPEG = PixelFormat("MJPG") // https://www.kernel.org/doc/html/v4.10/media/uapi/v4l/pixfmt-013.html
+	PixelFormatH264  = PixelFormat("H264") // https://www.kernel.org/doc/html/v4.10/media/uapi/v4l/pixfmt-013.html
+	PixelFormatHEVC  = PixelFormat("HEVC") // https://www.kernel.org/doc/html/latest/userspace-api/media/v4l/pixfmt-compressed.html
+	PixelFormatVP8   = PixelFormat("VP80") // https://www.kernel.org/doc/html/latest/userspace-api/media/v4l/pixfmt-compressed.html
 )
 
 func PixelFormatByName(pixFmtName string) PixelFormat {
@@ -82,6 +88,17 @@ func (s Formats) FilterByWidth(width uint64) Formats {
 	return result
 }
 
+func (s Formats) FilterByHeight(height uint64) Formats {
+	var result Formats
+
+	for _, f := range s {
+		if f.Height == height {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
 func (s Formats) FilterByFPS(fps float64) Formats {
 	var result Formats
 
@@ -117,3 +134,39 @@ func (s Formats) BestResolution() Format {
 	}
 	return best
 }
+
+// Closest returns the format which is the most similar to the given one:
+// the same pixel format is preferred first, then the closest resolution
+// and then the closest FPS.
+func (s Formats) Closest(f Format) (Format, bool) {
+	if len(s) == 0 {
+		return Format{}, false
+	}
+
+	absDiff := func(a, b float64) float64 {
+		if a > b {
+			return a - b
+		}
+		return b - a
+	}
+	isBetter := func(a, b Format) bool {
+		aSamePixFmt, bSamePixFmt := a.PixelFormat == f.PixelFormat, b.PixelFormat == f.PixelFormat
+		if aSamePixFmt != bSamePixFmt {
+			return aSamePixFmt
+		}
+		area := float64(f.Width * f.Height)
+		aAreaDiff, bAreaDiff := absDiff(float64(a.Width*a.Height), area), absDiff(float64(b.Width*b.Height), area)
+		if aAreaDiff != bAreaDiff {
+			return aAreaDiff < bAreaDiff
+		}
+		return absDiff(a.FPS.Float64(), f.FPS.Float64()) < absDiff(b.FPS.Float64(), f.FPS.Float64())
+	}
+
+	best := s[0]
+	for _, candidate := range s[1:] {
+		if isBetter(candidate, best) {
+			best = candidate
+		}
+	}
+	return best, true
+}
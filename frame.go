@@ -2,6 +2,7 @@ package camera
 
 import (
 	"image"
+	"time"
 )
 
 type FramesCompressed interface {
@@ -12,6 +13,41 @@ type Frame interface {
 	Image() image.Image
 }
 
+// FrameSkipCounter is implemented by frames which report how many older
+// frames were dropped to return this one (see LatestFrameOnlySetter).
+type FrameSkipCounter interface {
+	SkippedFrames() uint64
+}
+
+// FrameSequencer is implemented by frames numbered by the driver; a gap
+// in the sequence means the frames were dropped before reaching the
+// application.
+type FrameSequencer interface {
+	Sequence() uint64
+}
+
+// FrameTimestamper is implemented by frames which know
+// when they were captured.
+type FrameTimestamper interface {
+	Timestamp() time.Time
+}
+
+// FrameTimestamp returns the time when the frame was captured
+// if the frame knows it, or the current time otherwise.
+func FrameTimestamp(frame Frame) time.Time {
+	if ts, ok := frame.(FrameTimestamper); ok {
+		if t := ts.Timestamp(); !t.IsZero() {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// FrameFromImage wraps the image into a Frame (e.g. to write it into a CameraSink).
+func FrameFromImage(img image.Image) Frame {
+	return imageWrapper{Img: img}
+}
+
 type imageWrapper struct {
 	Img image.Image
 }
@@ -19,3 +55,28 @@ type imageWrapper struct {
 func (w imageWrapper) Image() image.Image {
 	return w.Img
 }
+
+// ImageFrame is a Frame of a decoded image with the metadata carried
+// over from the source frame; the wrappers producing new images (and the
+// platforms with extra metadata, by embedding it) use it as their frame.
+type ImageFrame struct {
+	Img       image.Image
+	Skipped   uint64
+	CaptureTS time.Time
+}
+
+var _ Frame = (*ImageFrame)(nil)
+var _ FrameSkipCounter = (*ImageFrame)(nil)
+var _ FrameTimestamper = (*ImageFrame)(nil)
+
+func (f *ImageFrame) Image() image.Image {
+	return f.Img
+}
+
+func (f *ImageFrame) SkippedFrames() uint64 {
+	return f.Skipped
+}
+
+func (f *ImageFrame) Timestamp() time.Time {
+	return f.CaptureTS
+}
@@ -22,6 +22,6 @@ func NewFrameDecompressor(
 	case CompressionMJPEG:
 		return newFrameDecompressorMJPEG(), nil
 	default:
-		return nil, fmt.Errorf("compression '%s' is not supported", compression)
+		return nil, fmt.Errorf("compression '%s': %w", compression, ErrNotSupported)
 	}
 }
@@ -11,20 +11,20 @@ type frameDecompressorHEIC struct {
 var _ FrameDecompressor = (*frameDecompressorHEIC)(nil)
 
 func newFrameDecompressorHEIC() (*frameDecompressorHEIC, error) {
-	return nil, fmt.Errorf("not implemented")
+	return nil, fmt.Errorf("HEIC is not implemented: %w", ErrNotSupported)
 }
 
 func (frameDecompressorHEIC) Close() error {
-	return fmt.Errorf("not implemented")
+	return fmt.Errorf("HEIC is not implemented: %w", ErrNotSupported)
 }
 func (frameDecompressorHEIC) NewImage() image.Image {
 	return nil
 }
 func (frameDecompressorHEIC) WriteCompressed(FramesCompressed) error {
-	return fmt.Errorf("not implemented")
+	return fmt.Errorf("HEIC is not implemented: %w", ErrNotSupported)
 }
 func (frameDecompressorHEIC) DecompressNext() (Frame, error) {
-	return nil, fmt.Errorf("not implemented")
+	return nil, fmt.Errorf("HEIC is not implemented: %w", ErrNotSupported)
 }
 func (frameDecompressorHEIC) ReleaseFrame(Frame) {
 }
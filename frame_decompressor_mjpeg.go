@@ -1,6 +1,7 @@
 package camera
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -42,6 +43,9 @@ func (d *frameDecompressorMJPEG) WriteCompressed(
 func (d *frameDecompressorMJPEG) DecompressNext() (Frame, error) {
 	img, err := d.MJPEGDecoder.Decode()
 	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+			err = fmt.Errorf("%w: %w", ErrNoFrame, err)
+		}
 		return nil, fmt.Errorf("unable to decode the frame: %w", err)
 	}
 
@@ -0,0 +1,204 @@
+// Package imagestats computes the exposure and color statistics of images
+// (like those needed for an auto-exposure or an auto-white-balance),
+// reading the Y and CbCr planes of the YUV images directly.
+package imagestats
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+const (
+	// ClipLow and ClipHigh are the luma levels at which (and beyond which)
+	// a pixel is considered clipped to black or white.
+	ClipLow  = 4
+	ClipHigh = 251
+)
+
+// Stats are the statistics of an image (or of the sampled pixels of it).
+type Stats struct {
+	// Histogram is the amount of pixels per luma level.
+	Histogram [256]uint64
+
+	// PixelCount is the amount of sampled pixels (the sum of Histogram).
+	PixelCount uint64
+
+	// ClippedLow and ClippedHigh are the amounts of pixels with
+	// the luma not above ClipLow and not below ClipHigh.
+	ClippedLow  uint64
+	ClippedHigh uint64
+
+	// MeanY, MeanCb and MeanCr are the mean values of the channels;
+	// the chroma ones are averaged over the chroma samples.
+	MeanY  float64
+	MeanCb float64
+	MeanCr float64
+}
+
+// Compute returns the statistics of the image, sampling every step-th
+// pixel of every step-th row (every pixel if step is less than 2).
+//
+// ximage.NV12, ximage.YUYV and image.YCbCr are read directly,
+// any other image is converted pixel by pixel.
+func Compute(img image.Image, step int) Stats {
+	step = max(step, 1)
+	var acc accumulator
+	switch img := img.(type) {
+	case *ximage.NV12:
+		acc.addNV12(img, step)
+	case *ximage.YUYV:
+		acc.addYUYV(img, step)
+	case *image.YCbCr:
+		acc.addYCbCr(img, step)
+	default:
+		acc.addGeneric(img, step)
+	}
+	return acc.stats()
+}
+
+type accumulator struct {
+	histogram   [256]uint64
+	chromaCount uint64
+	sumCb       uint64
+	sumCr       uint64
+}
+
+func (acc *accumulator) addLuma(row []uint8, step int) {
+	for i := 0; i < len(row); i += step {
+		acc.histogram[row[i]]++
+	}
+}
+
+func (acc *accumulator) addChroma(cb, cr uint8) {
+	acc.chromaCount++
+	acc.sumCb += uint64(cb)
+	acc.sumCr += uint64(cr)
+}
+
+func (acc *accumulator) addNV12(img *ximage.NV12, step int) {
+	r := img.Rect
+	w := r.Dx()
+	for y := r.Min.Y; y < r.Max.Y; y += step {
+		offset := img.YOffset(r.Min.X, y)
+		acc.addLuma(img.Y[offset:offset+w], step)
+	}
+
+	// a chroma sample per 2x2 block of pixels
+	for y := r.Min.Y &^ 1; y < r.Max.Y; y += 2 * step {
+		offset := img.COffset(r.Min.X, y)
+		row := img.CbCr[offset : offset+(r.Max.X-1)/2-r.Min.X/2+1]
+		for i := 0; i < len(row); i += step {
+			acc.addChroma(row[i].Cb, row[i].Cr)
+		}
+	}
+}
+
+func (acc *accumulator) addYUYV(img *ximage.YUYV, step int) {
+	r := img.Rect
+	w := r.Dx()
+	for y := r.Min.Y; y < r.Max.Y; y += step {
+		offset := img.Y0CbY1CrOffset(r.Min.X, y)
+		row := img.Y0CbY1Cr[offset : offset+(w+1)/2]
+		// a macropixel is two pixels, so the step is applied to
+		// the macropixels to not sample only the even (or odd) pixels
+		for i := 0; i < len(row); i += step {
+			acc.histogram[row[i].Y0]++
+			if 2*i+1 < w {
+				acc.histogram[row[i].Y1]++
+			}
+			acc.addChroma(row[i].Cb, row[i].Cr)
+		}
+	}
+}
+
+func (acc *accumulator) addYCbCr(img *image.YCbCr, step int) {
+	r := img.Rect
+	for y := r.Min.Y; y < r.Max.Y; y += step {
+		offset := img.YOffset(r.Min.X, y)
+		acc.addLuma(img.Y[offset:offset+r.Dx()], step)
+	}
+
+	// the chroma planes are sampled at the same pixels, so
+	// the subsampling ratio does not need to be handled here
+	for y := r.Min.Y; y < r.Max.Y; y += step {
+		for x := r.Min.X; x < r.Max.X; x += step {
+			offset := img.COffset(x, y)
+			acc.addChroma(img.Cb[offset], img.Cr[offset])
+		}
+	}
+}
+
+func (acc *accumulator) addGeneric(img image.Image, step int) {
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y += step {
+		for x := r.Min.X; x < r.Max.X; x += step {
+			c := color.YCbCrModel.Convert(img.At(x, y)).(color.YCbCr)
+			acc.histogram[c.Y]++
+			acc.addChroma(c.Cb, c.Cr)
+		}
+	}
+}
+
+func (acc *accumulator) stats() Stats {
+	s := Stats{
+		Histogram: acc.histogram,
+		MeanCb:    128,
+		MeanCr:    128,
+	}
+	var sumY uint64
+	for level, count := range acc.histogram {
+		s.PixelCount += count
+		sumY += uint64(level) * count
+		if level <= ClipLow {
+			s.ClippedLow += count
+		}
+		if level >= ClipHigh {
+			s.ClippedHigh += count
+		}
+	}
+	if s.PixelCount > 0 {
+		s.MeanY = float64(sumY) / float64(s.PixelCount)
+	}
+	if acc.chromaCount > 0 {
+		s.MeanCb = float64(acc.sumCb) / float64(acc.chromaCount)
+		s.MeanCr = float64(acc.sumCr) / float64(acc.chromaCount)
+	}
+	return s
+}
+
+// MeanRGB returns the mean values of the red, green and blue channels
+// (within [0, 255]), derived from the mean Y, Cb and Cr (with the JFIF
+// conversion, as in the image/color package).
+func (s Stats) MeanRGB() (r, g, b float64) {
+	cb, cr := s.MeanCb-128, s.MeanCr-128
+	r = s.MeanY + 1.402*cr
+	g = s.MeanY - 0.344136*cb - 0.714136*cr
+	b = s.MeanY + 1.772*cb
+	clamp := func(v float64) float64 { return min(max(v, 0), 255) }
+	return clamp(r), clamp(g), clamp(b)
+}
+
+// ClippedFractions returns the fractions of the pixels
+// clipped to black and to white.
+func (s Stats) ClippedFractions() (low, high float64) {
+	if s.PixelCount == 0 {
+		return 0, 0
+	}
+	return float64(s.ClippedLow) / float64(s.PixelCount), float64(s.ClippedHigh) / float64(s.PixelCount)
+}
+
+// Percentile returns the lowest luma level such that at least
+// the given fraction (within [0, 1]) of the pixels are not brighter.
+func (s Stats) Percentile(fraction float64) uint8 {
+	threshold := fraction * float64(s.PixelCount)
+	var cumulative uint64
+	for level, count := range s.Histogram {
+		cumulative += count
+		if cumulative > 0 && float64(cumulative) >= threshold {
+			return uint8(level)
+		}
+	}
+	return 255
+}
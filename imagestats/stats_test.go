@@ -0,0 +1,186 @@
+package imagestats
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+// newNV12 returns an NV12 image with the luma given by the function
+// and the same chroma everywhere.
+func newNV12(w, h int, luma func(x, y int) uint8, cb, cr uint8) image.Image {
+	img := ximage.NewNV12(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Y[y*img.YStride+x] = luma(x, y)
+		}
+	}
+	for i := range img.CbCr {
+		img.CbCr[i] = ximage.CbCr{Cb: cb, Cr: cr}
+	}
+	return img
+}
+
+func newYUYV(w, h int, luma func(x, y int) uint8, cb, cr uint8) image.Image {
+	img := ximage.NewYUYV(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		row := img.Y0CbY1Cr[y*img.YStride/2:]
+		for x := 0; x < w; x += 2 {
+			row[x/2] = ximage.Y0CbY1Cr{Y0: luma(x, y), Cb: cb, Y1: luma(x+1, y), Cr: cr}
+		}
+	}
+	return img
+}
+
+func newYCbCr(w, h int, ratio image.YCbCrSubsampleRatio, luma func(x, y int) uint8, cb, cr uint8) image.Image {
+	img := image.NewYCbCr(image.Rect(0, 0, w, h), ratio)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Y[img.YOffset(x, y)] = luma(x, y)
+		}
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = cb, cr
+	}
+	return img
+}
+
+func newRGBA(w, h int, luma func(x, y int) uint8, cb, cr uint8) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.YCbCr{Y: luma(x, y), Cb: cb, Cr: cr})
+		}
+	}
+	return img
+}
+
+func uniform(v uint8) func(x, y int) uint8 {
+	return func(x, y int) uint8 { return v }
+}
+
+// halves is black on the left half and white on the right one.
+func halves(x, y int) uint8 {
+	if x < 8 {
+		return 0
+	}
+	return 255
+}
+
+func TestCompute(t *testing.T) {
+	type constructor func(w, h int, luma func(x, y int) uint8, cb, cr uint8) image.Image
+	constructors := map[string]constructor{
+		"NV12": newNV12,
+		"YUYV": newYUYV,
+		"YCbCr420": func(w, h int, luma func(x, y int) uint8, cb, cr uint8) image.Image {
+			return newYCbCr(w, h, image.YCbCrSubsampleRatio420, luma, cb, cr)
+		},
+		"YCbCr422": func(w, h int, luma func(x, y int) uint8, cb, cr uint8) image.Image {
+			return newYCbCr(w, h, image.YCbCrSubsampleRatio422, luma, cb, cr)
+		},
+		"RGBA": newRGBA,
+	}
+
+	for name, newImage := range constructors {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range []struct {
+				name            string
+				luma            func(x, y int) uint8
+				cb, cr          uint8
+				step            int
+				pixelCount      uint64
+				meanY           float64
+				clippedLow      uint64
+				clippedHigh     uint64
+				checkChroma     bool
+				expectedPercent uint8
+			}{
+				{"gray", uniform(100), 128, 128, 1, 16 * 8, 100, 0, 0, true, 100},
+				{"tinted", uniform(100), 90, 160, 1, 16 * 8, 100, 0, 0, true, 100},
+				{"halves", halves, 128, 128, 1, 16 * 8, 127.5, 64, 64, true, 0},
+				{"sampled", halves, 128, 128, 2, 8 * 4, 127.5, 16, 16, true, 0},
+			} {
+				stats := Compute(newImage(16, 8, tc.luma, tc.cb, tc.cr), tc.step)
+				if stats.PixelCount != tc.pixelCount {
+					t.Errorf("%s: expected %d pixels, got %d", tc.name, tc.pixelCount, stats.PixelCount)
+				}
+				if math.Abs(stats.MeanY-tc.meanY) > 0.5 {
+					t.Errorf("%s: expected the mean luma %v, got %v", tc.name, tc.meanY, stats.MeanY)
+				}
+				if stats.ClippedLow != tc.clippedLow || stats.ClippedHigh != tc.clippedHigh {
+					t.Errorf("%s: expected %d/%d clipped pixels, got %d/%d", tc.name, tc.clippedLow, tc.clippedHigh, stats.ClippedLow, stats.ClippedHigh)
+				}
+				// the RGB round-trip is lossy
+				tolerance := 0.01
+				if name == "RGBA" {
+					tolerance = 2
+				}
+				if math.Abs(stats.MeanCb-float64(tc.cb)) > tolerance || math.Abs(stats.MeanCr-float64(tc.cr)) > tolerance {
+					t.Errorf("%s: expected the mean chroma %d/%d, got %v/%v", tc.name, tc.cb, tc.cr, stats.MeanCb, stats.MeanCr)
+				}
+				if p := stats.Percentile(0.5); p != tc.expectedPercent && name != "RGBA" {
+					t.Errorf("%s: expected the median %d, got %d", tc.name, tc.expectedPercent, p)
+				}
+			}
+		})
+	}
+}
+
+func TestSubImage(t *testing.T) {
+	img := newNV12(16, 8, halves, 128, 128).(*ximage.NV12)
+	stats := Compute(img.SubImage(image.Rect(8, 0, 16, 8)), 1)
+	if stats.PixelCount != 64 || stats.MeanY != 255 {
+		t.Errorf("expected 64 white pixels, got %d with the mean %v", stats.PixelCount, stats.MeanY)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	stats := Compute(image.NewRGBA(image.Rect(0, 0, 0, 0)), 1)
+	if stats.PixelCount != 0 || stats.MeanCb != 128 || stats.MeanCr != 128 {
+		t.Errorf("unexpected statistics of an empty image: %+v", stats)
+	}
+	if low, high := stats.ClippedFractions(); low != 0 || high != 0 {
+		t.Errorf("expected no clipped pixels, got %v/%v", low, high)
+	}
+}
+
+func TestStats(t *testing.T) {
+	var stats Stats
+	stats.Histogram[0] = 10
+	stats.Histogram[100] = 70
+	stats.Histogram[255] = 20
+	stats.PixelCount = 100
+	stats.ClippedLow = 10
+	stats.ClippedHigh = 20
+	stats.MeanY, stats.MeanCb, stats.MeanCr = 100, 128, 128
+
+	for _, tc := range []struct {
+		fraction float64
+		level    uint8
+	}{
+		{0, 0},
+		{0.1, 0},
+		{0.11, 100},
+		{0.8, 100},
+		{0.81, 255},
+		{1, 255},
+	} {
+		if level := stats.Percentile(tc.fraction); level != tc.level {
+			t.Errorf("expected the percentile %v at %d, got %d", tc.fraction, tc.level, level)
+		}
+	}
+
+	if low, high := stats.ClippedFractions(); low != 0.1 || high != 0.2 {
+		t.Errorf("expected the clipped fractions 0.1/0.2, got %v/%v", low, high)
+	}
+	if r, g, b := stats.MeanRGB(); r != 100 || g != 100 || b != 100 {
+		t.Errorf("expected gray for neutral chroma, got %v/%v/%v", r, g, b)
+	}
+	stats.MeanCr = 160
+	if r, g, b := stats.MeanRGB(); r <= g || g >= b {
+		t.Errorf("expected reddish for high Cr, got %v/%v/%v", r, g, b)
+	}
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// pendingFrames counts the frames delivered by a wrapper and not
+// released yet, so that they are removed from the outstanding frames
+// of the series when the wrapper is closed.
+type pendingFrames struct {
+	count atomic.Int64
+}
+
+// release returns false if the frame is not pending
+// (e.g. it is released after Close).
+func (p *pendingFrames) release() bool {
+	for {
+		count := p.count.Load()
+		if count <= 0 {
+			return false
+		}
+		if p.count.CompareAndSwap(count, count-1) {
+			return true
+		}
+	}
+}
+
+// ReopenCounter is implemented by the cameras reopening the device
+// by themselves (like resilient.Camera).
+type ReopenCounter interface {
+	ReopenCount() uint64
+}
+
+// Camera is a camera.Camera recording the metrics of the wrapped camera;
+// the optional interfaces (like camera.Controls) are not forwarded, they
+// should be used via the wrapped camera.
+type Camera struct {
+	camera.Camera
+
+	series      *series
+	pending     pendingFrames
+	reopenCount uint64
+}
+
+var _ camera.Camera = (*Camera)(nil)
+
+// WrapCamera instruments the camera; the cameras with the same labels
+// share the series, so the counters continue where a closed camera left
+// them. Only the reopens reported by the camera itself (see
+// ReopenCounter) are counted as reopens.
+func (r *Registry) WrapCamera(cam camera.Camera, labels Labels) *Camera {
+	s := r.getSeries(labels)
+	s.resetSequence()
+	c := &Camera{
+		Camera: cam,
+		series: s,
+	}
+	if counter, ok := cam.(ReopenCounter); ok {
+		c.reopenCount = counter.ReopenCount()
+	}
+	return c
+}
+
+// WrapCamera instruments the camera in DefaultRegistry.
+func WrapCamera(cam camera.Camera, labels Labels) *Camera {
+	return defaultRegistry.WrapCamera(cam, labels)
+}
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	startTS := time.Now()
+	frame, err := c.Camera.GetFrame(ctx)
+	d := time.Since(startTS)
+	c.updateReopens()
+	if err != nil {
+		if ctx.Err() == nil {
+			c.series.observeError(d)
+		}
+		return nil, err
+	}
+	c.series.observeFrame(frame, 0, d)
+	c.pending.count.Add(1)
+	return frame, nil
+}
+
+func (c *Camera) updateReopens() {
+	counter, ok := c.Camera.(ReopenCounter)
+	if !ok {
+		return
+	}
+	count := counter.ReopenCount()
+	if count > c.reopenCount {
+		c.series.addReopens(count - c.reopenCount)
+		// the sequence numbers start over on a reopen
+		c.series.resetSequence()
+	}
+	c.reopenCount = count
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	if c.pending.release() {
+		c.series.addOutstanding(-1)
+	}
+	return c.Camera.ReleaseFrame(frame)
+}
+
+// Close closes the wrapped camera; the frames which are not
+// released yet are no longer counted as outstanding.
+func (c *Camera) Close() error {
+	c.series.addOutstanding(-c.pending.count.Swap(0))
+	return c.Camera.Close()
+}
+
+func (c *Camera) StartStreaming() error {
+	c.series.resetSequence()
+	return c.Camera.StartStreaming()
+}
+
+// CameraCompressed is a camera.CameraCompressed recording the metrics
+// of the wrapped camera.
+type CameraCompressed struct {
+	camera.CameraCompressed
+
+	series  *series
+	pending pendingFrames
+}
+
+var _ camera.CameraCompressed = (*CameraCompressed)(nil)
+
+// WrapCameraCompressed instruments the camera (see WrapCamera).
+func (r *Registry) WrapCameraCompressed(cam camera.CameraCompressed, labels Labels) *CameraCompressed {
+	s := r.getSeries(labels)
+	s.resetSequence()
+	return &CameraCompressed{
+		CameraCompressed: cam,
+		series:           s,
+	}
+}
+
+// WrapCameraCompressed instruments the camera in DefaultRegistry.
+func WrapCameraCompressed(cam camera.CameraCompressed, labels Labels) *CameraCompressed {
+	return defaultRegistry.WrapCameraCompressed(cam, labels)
+}
+
+func (c *CameraCompressed) GetCompressedFrames(ctx context.Context) (camera.FramesCompressed, error) {
+	startTS := time.Now()
+	frames, err := c.CameraCompressed.GetCompressedFrames(ctx)
+	d := time.Since(startTS)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.series.observeError(d)
+		}
+		return nil, err
+	}
+	c.series.observeFrame(frames, len(frames.Bytes()), d)
+	c.pending.count.Add(1)
+	return frames, nil
+}
+
+func (c *CameraCompressed) ReleaseFrames(frames camera.FramesCompressed) error {
+	if c.pending.release() {
+		c.series.addOutstanding(-1)
+	}
+	return c.CameraCompressed.ReleaseFrames(frames)
+}
+
+// Close closes the wrapped camera (see Camera.Close).
+func (c *CameraCompressed) Close() error {
+	c.series.addOutstanding(-c.pending.count.Swap(0))
+	return c.CameraCompressed.Close()
+}
+
+func (c *CameraCompressed) StartStreaming() error {
+	c.series.resetSequence()
+	return c.CameraCompressed.StartStreaming()
+}
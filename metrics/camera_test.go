@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type testFrame struct {
+	seq     uint64
+	skipped uint64
+}
+
+func (f *testFrame) Image() image.Image {
+	return nil
+}
+
+func (f *testFrame) SkippedFrames() uint64 {
+	return f.skipped
+}
+
+// testSequencedFrame reports the sequence number
+// (and the skipped frames, which are ignored then).
+type testSequencedFrame struct {
+	testFrame
+}
+
+func (f *testSequencedFrame) Sequence() uint64 {
+	return f.seq
+}
+
+// testCamera returns the queued frames, or the error if none.
+type testCamera struct {
+	frames  []camera.Frame
+	err     error
+	reopens uint64
+	closed  bool
+}
+
+var _ camera.Camera = (*testCamera)(nil)
+
+func (c *testCamera) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *testCamera) StartStreaming() error {
+	return nil
+}
+
+func (c *testCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *testCamera) GetFormat() camera.Format {
+	return camera.Format{}
+}
+
+func (c *testCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.frames) == 0 {
+		return nil, c.err
+	}
+	frame := c.frames[0]
+	c.frames = c.frames[1:]
+	return frame, nil
+}
+
+func (c *testCamera) ReleaseFrame(camera.Frame) error {
+	return nil
+}
+
+func (c *testCamera) ReopenCount() uint64 {
+	return c.reopens
+}
+
+func sequenced(seqs ...uint64) []camera.Frame {
+	var result []camera.Frame
+	for _, seq := range seqs {
+		result = append(result, &testSequencedFrame{testFrame{seq: seq, skipped: 100}})
+	}
+	return result
+}
+
+func getSnapshot(t *testing.T, r *Registry, labels Labels) snapshot {
+	t.Helper()
+	for _, s := range r.snapshots() {
+		if s.Labels == labels {
+			return s
+		}
+	}
+	t.Fatalf("no series %v", labels)
+	return snapshot{}
+}
+
+// getFrames gets count frames; they are not released.
+func getFrames(t *testing.T, cam camera.Camera, count int) []camera.Frame {
+	t.Helper()
+	var result []camera.Frame
+	for i := 0; i < count; i++ {
+		frame, err := cam.GetFrame(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, frame)
+	}
+	return result
+}
+
+func TestDrops(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		frames []camera.Frame
+		drops  uint64
+	}{
+		{"contiguous", sequenced(1, 2, 3, 4), 0},
+		{"gaps", sequenced(10, 11, 14, 20), 7},
+		{"first_frame", sequenced(100), 0},
+		// the sequence numbers going back are not drops
+		{"restarted", sequenced(5, 6, 1, 2, 4), 1},
+		{"skip_counter", []camera.Frame{&testFrame{skipped: 0}, &testFrame{skipped: 2}, &testFrame{skipped: 3}}, 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			labels := Labels{Device: "camera"}
+			src := &testCamera{frames: tc.frames}
+			cam := r.WrapCamera(src, labels)
+			for _, frame := range getFrames(t, cam, len(tc.frames)) {
+				if err := cam.ReleaseFrame(frame); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := getSnapshot(t, r, labels)
+			if s.Drops != tc.drops || s.Frames != uint64(len(tc.frames)) {
+				t.Errorf("expected %d frames with %d drops, got %d with %d", len(tc.frames), tc.drops, s.Frames, s.Drops)
+			}
+		})
+	}
+}
+
+func TestReopens(t *testing.T) {
+	r := NewRegistry()
+	labels := Labels{Device: "camera"}
+	src := &testCamera{frames: sequenced(1, 2, 3), reopens: 5}
+	cam := r.WrapCamera(src, labels)
+	getFrames(t, cam, 3)
+
+	// the sequence numbers start over after a reopen
+	src.reopens = 6
+	src.frames = sequenced(1, 2)
+	getFrames(t, cam, 2)
+
+	s := getSnapshot(t, r, labels)
+	if s.Reopens != 1 || s.Drops != 0 {
+		t.Errorf("expected a reopen without drops, got %d reopens and %d drops", s.Reopens, s.Drops)
+	}
+}
+
+func TestOutstanding(t *testing.T) {
+	r := NewRegistry()
+	labels := Labels{Device: "camera"}
+	src := &testCamera{frames: sequenced(1, 2, 3, 4, 5, 6)}
+	cam := r.WrapCamera(src, labels)
+
+	frames := getFrames(t, cam, 3)
+	if err := cam.ReleaseFrame(frames[0]); err != nil {
+		t.Fatal(err)
+	}
+	if s := getSnapshot(t, r, labels); s.Outstanding != 2 {
+		t.Errorf("expected 2 outstanding frames, got %d", s.Outstanding)
+	}
+
+	// a camera of the same device shares the series
+	other := r.WrapCamera(&testCamera{frames: sequenced(1)}, labels)
+	getFrames(t, other, 1)
+	if s := getSnapshot(t, r, labels); s.Outstanding != 3 || s.Frames != 4 {
+		t.Errorf("expected 3 outstanding frames of 4, got %d of %d", s.Outstanding, s.Frames)
+	}
+
+	// the frames of a closed camera are not outstanding anymore,
+	// even if they are released after that
+	if err := cam.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cam.ReleaseFrame(frames[1]); err != nil {
+		t.Fatal(err)
+	}
+	if s := getSnapshot(t, r, labels); s.Outstanding != 1 {
+		t.Errorf("expected 1 outstanding frame, got %d", s.Outstanding)
+	}
+	if !src.closed {
+		t.Errorf("expected the camera to be closed")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	r := NewRegistry()
+	labels := Labels{Device: "camera"}
+	cam := r.WrapCamera(&testCamera{err: camera.ErrTimeout}, labels)
+	if _, err := cam.GetFrame(context.Background()); !errors.Is(err, camera.ErrTimeout) {
+		t.Errorf("expected the error of the camera, got %v", err)
+	}
+
+	// the cancellations are not errors of the camera
+	ctx, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+	if _, err := cam.GetFrame(ctx); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	s := getSnapshot(t, r, labels)
+	if s.Errors != 1 || s.Frames != 0 || s.GetFrame.Count != 1 {
+		t.Errorf("expected 1 error, got %d errors, %d frames and %d observations", s.Errors, s.Frames, s.GetFrame.Count)
+	}
+}
+
+type testFrames struct {
+	data []byte
+	seq  uint64
+}
+
+func (f *testFrames) Bytes() []byte {
+	return f.data
+}
+
+func (f *testFrames) Sequence() uint64 {
+	return f.seq
+}
+
+type testCameraCompressed struct {
+	camera.CameraCompressed
+	frames []camera.FramesCompressed
+}
+
+func (c *testCameraCompressed) GetCompressedFrames(context.Context) (camera.FramesCompressed, error) {
+	frames := c.frames[0]
+	c.frames = c.frames[1:]
+	return frames, nil
+}
+
+func (c *testCameraCompressed) ReleaseFrames(camera.FramesCompressed) error {
+	return nil
+}
+
+func TestCameraCompressed(t *testing.T) {
+	r := NewRegistry()
+	labels := Labels{Device: "camera"}
+	cam := r.WrapCameraCompressed(&testCameraCompressed{frames: []camera.FramesCompressed{
+		&testFrames{data: make([]byte, 100), seq: 1},
+		&testFrames{data: make([]byte, 50), seq: 3},
+	}}, labels)
+	for i := 0; i < 2; i++ {
+		frames, err := cam.GetCompressedFrames(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := cam.ReleaseFrames(frames); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	s := getSnapshot(t, r, labels)
+	if s.Frames != 2 || s.Bytes != 150 || s.Drops != 1 || s.Outstanding != 1 {
+		t.Errorf("unexpected metrics %+v", s)
+	}
+}
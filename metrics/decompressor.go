@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// FrameDecompressor is a camera.FrameDecompressor recording the decoding
+// time into the series of the camera the compressed frames come from.
+type FrameDecompressor struct {
+	camera.FrameDecompressor
+
+	series *series
+
+	// pending is the time spent in WriteCompressed since the last
+	// decompressed frame; it is only accessed by the decoding goroutine.
+	pending time.Duration
+}
+
+var _ camera.FrameDecompressor = (*FrameDecompressor)(nil)
+
+// WrapDecompressor instruments the decompressor; labels are
+// the labels of the camera.
+func (r *Registry) WrapDecompressor(d camera.FrameDecompressor, labels Labels) *FrameDecompressor {
+	return &FrameDecompressor{
+		FrameDecompressor: d,
+		series:            r.getSeries(labels),
+	}
+}
+
+// WrapDecompressor instruments the decompressor in DefaultRegistry.
+func WrapDecompressor(d camera.FrameDecompressor, labels Labels) *FrameDecompressor {
+	return defaultRegistry.WrapDecompressor(d, labels)
+}
+
+func (d *FrameDecompressor) WriteCompressed(frames camera.FramesCompressed) error {
+	startTS := time.Now()
+	err := d.FrameDecompressor.WriteCompressed(frames)
+	d.pending += time.Since(startTS)
+	return err
+}
+
+func (d *FrameDecompressor) DecompressNext() (camera.Frame, error) {
+	startTS := time.Now()
+	frame, err := d.FrameDecompressor.DecompressNext()
+	if err != nil {
+		return nil, err
+	}
+	d.series.observeDecode(d.pending + time.Since(startTS))
+	d.pending = 0
+	return frame, nil
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"time"
+)
+
+// DefaultDurationBuckets are the upper bounds (in seconds) of the
+// histograms of the durations: from a millisecond to a few seconds.
+var DefaultDurationBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5,
+}
+
+// histogram is a cumulative histogram; it is protected
+// by the lock of its series.
+type histogram struct {
+	Bounds []float64
+
+	// Counts are per bucket (not cumulative); the last one
+	// is the +Inf bucket.
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) Observe(d time.Duration) {
+	v := d.Seconds()
+	idx := len(h.Bounds)
+	for i, bound := range h.Bounds {
+		if v <= bound {
+			idx = i
+			break
+		}
+	}
+	h.Counts[idx]++
+	h.Sum += v
+	h.Count++
+}
+
+func (h *histogram) clone() histogram {
+	result := *h
+	result.Counts = append([]uint64(nil), h.Counts...)
+	return result
+}
@@ -0,0 +1,252 @@
+// Package metrics instruments cameras and exposes their metrics (the
+// delivered FPS, the frame interval jitter, the GetFrame latency, the
+// dropped frames and so on) in the Prometheus text format or in the
+// OpenMetrics format, so that a camera silently dropping to a low frame
+// rate is noticed.
+//
+// The handler is usually mounted next to the pprof endpoint:
+//
+//	http.Handle("/metrics", metrics.Handler())
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// Labels identify the series of a camera.
+type Labels struct {
+	Device   string
+	Platform string
+}
+
+// LabelsOf returns the labels of the device: its identity (which is
+// stable across reconnections) and its platform.
+func LabelsOf(dev camera.DevicePathAndPlatform) Labels {
+	return Labels{
+		Device:   dev.Identity(),
+		Platform: string(dev.PlatformID),
+	}
+}
+
+// Registry keeps the metrics of the instrumented cameras.
+type Registry struct {
+	locker sync.Mutex
+	series map[Labels]*series
+}
+
+var defaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		series: map[Labels]*series{},
+	}
+}
+
+// DefaultRegistry returns the registry used by the package-level functions.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Handler serves the metrics of DefaultRegistry.
+func Handler() http.Handler {
+	return defaultRegistry
+}
+
+func (r *Registry) getSeries(labels Labels) *series {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	s := r.series[labels]
+	if s == nil {
+		s = newSeries(labels)
+		r.series[labels] = s
+	}
+	return s
+}
+
+func (r *Registry) snapshots() []snapshot {
+	r.locker.Lock()
+	all := make([]*series, 0, len(r.series))
+	for _, s := range r.series {
+		all = append(all, s)
+	}
+	r.locker.Unlock()
+
+	now := time.Now()
+	result := make([]snapshot, 0, len(all))
+	for _, s := range all {
+		result = append(result, s.snapshot(now))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Labels.Device != result[j].Labels.Device {
+			return result[i].Labels.Device < result[j].Labels.Device
+		}
+		return result[i].Labels.Platform < result[j].Labels.Platform
+	})
+	return result
+}
+
+const (
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypeText)
+	}
+	r.write(w, openMetrics)
+}
+
+// WriteText writes the metrics in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	return r.write(w, false)
+}
+
+// WriteOpenMetrics writes the metrics in the OpenMetrics text format.
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, true)
+}
+
+type metricType string
+
+const (
+	metricTypeCounter   = metricType("counter")
+	metricTypeGauge     = metricType("gauge")
+	metricTypeHistogram = metricType("histogram")
+)
+
+type family struct {
+	Name  string
+	Type  metricType
+	Help  string
+	Value func(s *snapshot) float64
+	Hist  func(s *snapshot) *histogram
+}
+
+var families = []family{
+	{
+		Name:  "camera_frames_total",
+		Type:  metricTypeCounter,
+		Help:  "The frames delivered to the application.",
+		Value: func(s *snapshot) float64 { return float64(s.Frames) },
+	},
+	{
+		Name:  "camera_fps",
+		Type:  metricTypeGauge,
+		Help:  "The recent rate of the delivered frames.",
+		Value: func(s *snapshot) float64 { return s.FPS },
+	},
+	{
+		Name:  "camera_frame_interval_jitter_seconds",
+		Type:  metricTypeGauge,
+		Help:  "The standard deviation of the recent intervals between the capture timestamps of the frames.",
+		Value: func(s *snapshot) float64 { return s.Jitter },
+	},
+	{
+		Name: "camera_get_frame_duration_seconds",
+		Type: metricTypeHistogram,
+		Help: "The time spent waiting for a frame.",
+		Hist: func(s *snapshot) *histogram { return &s.GetFrame },
+	},
+	{
+		Name:  "camera_dropped_frames_total",
+		Type:  metricTypeCounter,
+		Help:  "The frames lost before reaching the application (the gaps in the sequence numbers or the skipped frames).",
+		Value: func(s *snapshot) float64 { return float64(s.Drops) },
+	},
+	{
+		Name: "camera_decode_duration_seconds",
+		Type: metricTypeHistogram,
+		Help: "The time spent decompressing a frame.",
+		Hist: func(s *snapshot) *histogram { return &s.Decode },
+	},
+	{
+		Name:  "camera_outstanding_frames",
+		Type:  metricTypeGauge,
+		Help:  "The frames delivered, but not released yet.",
+		Value: func(s *snapshot) float64 { return float64(s.Outstanding) },
+	},
+	{
+		Name:  "camera_reopens_total",
+		Type:  metricTypeCounter,
+		Help:  "The times the camera was reopened.",
+		Value: func(s *snapshot) float64 { return float64(s.Reopens) },
+	},
+	{
+		Name:  "camera_errors_total",
+		Type:  metricTypeCounter,
+		Help:  "The failed attempts to get a frame.",
+		Value: func(s *snapshot) float64 { return float64(s.Errors) },
+	},
+	{
+		Name:  "camera_received_bytes_total",
+		Type:  metricTypeCounter,
+		Help:  "The size of the delivered compressed frames.",
+		Value: func(s *snapshot) float64 { return float64(s.Bytes) },
+	},
+}
+
+func (r *Registry) write(out io.Writer, openMetrics bool) error {
+	w := bufio.NewWriter(out)
+	snapshots := r.snapshots()
+	for _, f := range families {
+		name := f.Name
+		if openMetrics && f.Type == metricTypeCounter {
+			// the family of a counter is named without the suffix
+			name = strings.TrimSuffix(name, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n", name, f.Help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.Type)
+		for idx := range snapshots {
+			s := &snapshots[idx]
+			labels := formatLabels(s.Labels)
+			if f.Hist == nil {
+				fmt.Fprintf(w, "%s{%s} %s\n", f.Name, labels, formatFloat(f.Value(s)))
+				continue
+			}
+			h := f.Hist(s)
+			cumulative := uint64(0)
+			for i, count := range h.Counts {
+				cumulative += count
+				bound := "+Inf"
+				if i < len(h.Bounds) {
+					bound = formatFloat(h.Bounds[i])
+				}
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", f.Name, labels, bound, cumulative)
+			}
+			fmt.Fprintf(w, "%s_sum{%s} %s\n", f.Name, labels, formatFloat(h.Sum))
+			fmt.Fprintf(w, "%s_count{%s} %d\n", f.Name, labels, h.Count)
+		}
+	}
+	if openMetrics {
+		fmt.Fprintf(w, "# EOF\n")
+	}
+	return w.Flush()
+}
+
+func formatLabels(labels Labels) string {
+	return fmt.Sprintf(`device="%s",platform="%s"`, escapeLabel(labels.Device), escapeLabel(labels.Platform))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// newTestRegistry returns a registry with the series of fixed values.
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	for idx, labels := range []Labels{
+		{Device: "/dev/video0", Platform: "v4l2"},
+		{Device: "camera \"1\"\\\n", Platform: "remote"},
+	} {
+		s := r.getSeries(labels)
+		s.frames = 1000 * uint64(idx+1)
+		s.bytes = 123456789 * uint64(idx)
+		s.drops = 3
+		s.errors = uint64(idx)
+		s.reopens = 2 * uint64(idx)
+		s.outstanding = 1
+		s.meanInterval = 0.04
+		s.intervalVariance = 0.000004
+		// in the future, so that the FPS is not lowered by the waiting
+		s.lastDeliveryTS = time.Now().Add(time.Hour)
+		s.getFrame = newHistogram([]float64{0.01, 0.1})
+		s.getFrame.Observe(5 * time.Millisecond)
+		s.getFrame.Observe(20 * time.Millisecond)
+		s.getFrame.Observe(time.Second)
+		s.decode = newHistogram([]float64{0.01, 0.1})
+		if idx == 0 {
+			s.decode.Observe(2500 * time.Microsecond)
+		}
+	}
+	return r
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("the output differs from '%s' (rerun with -update to update it):\n%s", path, got)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestRegistry().WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "metrics.txt", buf.Bytes())
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestRegistry().WriteOpenMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "metrics.openmetrics.txt", buf.Bytes())
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := newTestRegistry()
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		golden      string
+	}{
+		{"", contentTypeText, "metrics.txt"},
+		{"text/plain", contentTypeText, "metrics.txt"},
+		{"application/openmetrics-text; version=1.0.0,text/plain;q=0.5", contentTypeOpenMetrics, "metrics.openmetrics.txt"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", tc.accept)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if contentType := rec.Header().Get("Content-Type"); contentType != tc.contentType {
+			t.Errorf("Accept '%s': expected the content type '%s', got '%s'", tc.accept, tc.contentType, contentType)
+		}
+		checkGolden(t, tc.golden, rec.Body.Bytes())
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewRegistry().WriteOpenMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("# HELP camera_frames The frames delivered to the application.\n# TYPE camera_frames counter\n")) ||
+		!bytes.HasSuffix(buf.Bytes(), []byte("# TYPE camera_received_bytes counter\n# EOF\n")) {
+		t.Errorf("unexpected output without cameras:\n%s", buf.Bytes())
+	}
+}
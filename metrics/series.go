@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// intervalSmoothing is the weight of the latest frame interval in the
+// moving averages (so the estimations follow about the last ten frames).
+const intervalSmoothing = 0.1
+
+// series are the metrics of a camera; they outlive the instrumented
+// cameras, so that the counters are not reset if a camera is reopened.
+type series struct {
+	Labels Labels
+
+	locker      sync.Mutex
+	frames      uint64
+	bytes       uint64
+	drops       uint64
+	errors      uint64
+	reopens     uint64
+	outstanding int64
+	getFrame    histogram
+	decode      histogram
+
+	lastDeliveryTS time.Time
+	lastCaptureTS  time.Time
+	lastSeq        uint64
+	haveSeq        bool
+
+	// in seconds
+	meanInterval     float64
+	intervalVariance float64
+}
+
+func newSeries(labels Labels) *series {
+	return &series{
+		Labels:   labels,
+		getFrame: newHistogram(DefaultDurationBuckets),
+		decode:   newHistogram(DefaultDurationBuckets),
+	}
+}
+
+func (s *series) resetSequence() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.resetSequenceLocked()
+}
+
+func (s *series) resetSequenceLocked() {
+	s.haveSeq = false
+	s.lastCaptureTS = time.Time{}
+}
+
+func (s *series) addReopens(n uint64) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.reopens += n
+}
+
+func (s *series) observeError(d time.Duration) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.getFrame.Observe(d)
+	s.errors++
+}
+
+func (s *series) observeDecode(d time.Duration) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.decode.Observe(d)
+}
+
+func (s *series) addOutstanding(delta int64) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.outstanding += delta
+}
+
+// observeFrame accounts a delivered frame; frame is a camera.Frame or
+// camera.FramesCompressed, possibly implementing camera.FrameSequencer,
+// camera.FrameSkipCounter and camera.FrameTimestamper.
+func (s *series) observeFrame(frame any, size int, d time.Duration) {
+	now := time.Now()
+	captureTS := now
+	if ts, ok := frame.(camera.FrameTimestamper); ok && !ts.Timestamp().IsZero() {
+		captureTS = ts.Timestamp()
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.getFrame.Observe(d)
+	s.frames++
+	s.bytes += uint64(size)
+	s.outstanding++
+	s.lastDeliveryTS = now
+
+	// the sequence gaps include the frames skipped in the latest-frame-only
+	// mode, so the skip counters are only used without the sequence numbers
+	if sequencer, ok := frame.(camera.FrameSequencer); ok {
+		seq := sequencer.Sequence()
+		if s.haveSeq && seq > s.lastSeq {
+			s.drops += seq - s.lastSeq - 1
+		}
+		s.lastSeq, s.haveSeq = seq, true
+	} else if skipCounter, ok := frame.(camera.FrameSkipCounter); ok {
+		s.drops += skipCounter.SkippedFrames()
+	}
+
+	if !s.lastCaptureTS.IsZero() {
+		if interval := captureTS.Sub(s.lastCaptureTS).Seconds(); interval > 0 {
+			if s.meanInterval == 0 {
+				s.meanInterval = interval
+			} else {
+				diff := interval - s.meanInterval
+				s.meanInterval += intervalSmoothing * diff
+				s.intervalVariance = (1 - intervalSmoothing) * (s.intervalVariance + intervalSmoothing*diff*diff)
+			}
+		}
+	}
+	s.lastCaptureTS = captureTS
+}
+
+type snapshot struct {
+	Labels      Labels
+	Frames      uint64
+	Bytes       uint64
+	Drops       uint64
+	Errors      uint64
+	Reopens     uint64
+	Outstanding int64
+	FPS         float64
+	Jitter      float64
+	GetFrame    histogram
+	Decode      histogram
+}
+
+func (s *series) snapshot(now time.Time) snapshot {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	result := snapshot{
+		Labels:      s.Labels,
+		Frames:      s.frames,
+		Bytes:       s.bytes,
+		Drops:       s.drops,
+		Errors:      s.errors,
+		Reopens:     s.reopens,
+		Outstanding: s.outstanding,
+		Jitter:      math.Sqrt(s.intervalVariance),
+		GetFrame:    s.getFrame.clone(),
+		Decode:      s.decode.clone(),
+	}
+	if s.meanInterval > 0 {
+		// if the frames stopped coming, then the rate should go down
+		// without waiting for the next frame
+		interval := max(s.meanInterval, now.Sub(s.lastDeliveryTS).Seconds())
+		result.FPS = 1 / interval
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package motion
+
+import (
+	"image"
+)
+
+// findBlobs groups the adjacent (including diagonally) changed cells
+// and returns the bounding boxes of the groups not smaller than
+// MinBlobArea.
+func (d *Detector) findBlobs() []image.Rectangle {
+	g := &d.grid
+	cellArea := g.CellSize * g.CellSize
+	var boxes []image.Rectangle
+	visited := d.visited
+	clear(visited)
+	var stack []int
+	for start, changed := range d.changed {
+		if !changed || visited[start] {
+			continue
+		}
+
+		x0, y0 := start%g.Width, start/g.Width
+		x1, y1 := x0, y0
+		cellCount := 0
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			cellCount++
+			x, y := idx%g.Width, idx/g.Width
+			x0, y0, x1, y1 = min(x0, x), min(y0, y), max(x1, x), max(y1, y)
+			for ny := max(y-1, 0); ny <= min(y+1, g.Height-1); ny++ {
+				for nx := max(x-1, 0); nx <= min(x+1, g.Width-1); nx++ {
+					neighbor := ny*g.Width + nx
+					if d.changed[neighbor] && !visited[neighbor] {
+						visited[neighbor] = true
+						stack = append(stack, neighbor)
+					}
+				}
+			}
+		}
+
+		if cellCount*cellArea < d.Config.MinBlobArea {
+			continue
+		}
+		boxes = append(boxes, g.cellRect(x0, y0, x1, y1))
+	}
+	return boxes
+}
@@ -0,0 +1,83 @@
+package motion
+
+import (
+	"image"
+	"time"
+)
+
+const (
+	DefaultCellSize     = 8
+	DefaultThreshold    = 20
+	DefaultLearningRate = 0.05
+	DefaultMinBlobArea  = 400
+	DefaultMaxChange    = 0.6
+	DefaultStartFrames  = 2
+	DefaultStopDelay    = 2 * time.Second
+)
+
+type Config struct {
+	// CellSize is the size (in pixels) of the square blocks the luma is
+	// averaged over; larger cells are faster and less sensitive to noise,
+	// but give less precise bounding boxes.
+	CellSize int
+
+	// Threshold is the minimal difference of the luma of a cell from
+	// the background (within [1, 255]) to consider the cell changed;
+	// lower values are more sensitive.
+	Threshold uint8
+
+	// LearningRate (within (0, 1]) is how fast the background adapts
+	// to the changes of the scene; the changed cells adapt ten times
+	// slower, so that a stopped object becomes the background eventually.
+	LearningRate float64
+
+	// Regions limit the detection to the given areas (of the frame
+	// coordinates); the whole frame is used if empty.
+	Regions []image.Rectangle
+
+	// IgnoreRegions are excluded from the detection (e.g. a tree
+	// moving in the wind or a clock).
+	IgnoreRegions []image.Rectangle
+
+	// MinBlobArea is the minimal area (in pixels) of a group of
+	// adjacent changed cells to be considered a motion.
+	MinBlobArea int
+
+	// MaxChange is the fraction of the detected cells above which
+	// the change is considered a change of lighting (or of the exposure)
+	// rather than a motion, and the background is reset.
+	MaxChange float64
+
+	// StartFrames is the amount of consecutive frames with motion
+	// needed to start a motion event.
+	StartFrames uint
+
+	// StopDelay is how long there should be no motion
+	// to stop a motion event.
+	StopDelay time.Duration
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.CellSize <= 0 {
+		cfg.CellSize = DefaultCellSize
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultThreshold
+	}
+	if cfg.LearningRate <= 0 || cfg.LearningRate > 1 {
+		cfg.LearningRate = DefaultLearningRate
+	}
+	if cfg.MinBlobArea == 0 {
+		cfg.MinBlobArea = DefaultMinBlobArea
+	}
+	if cfg.MaxChange <= 0 {
+		cfg.MaxChange = DefaultMaxChange
+	}
+	if cfg.StartFrames == 0 {
+		cfg.StartFrames = DefaultStartFrames
+	}
+	if cfg.StopDelay == 0 {
+		cfg.StopDelay = DefaultStopDelay
+	}
+	return cfg
+}
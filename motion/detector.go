@@ -0,0 +1,256 @@
+// Package motion detects motion in the frames of a camera by comparing
+// the luma (read directly from the Y plane of the YUV frames, without
+// the conversion to RGB) to a slowly adapting model of the background.
+package motion
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type EventType int
+
+const (
+	EventTypeUndefined = EventType(iota)
+	EventTypeStart
+	EventTypeStop
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventTypeUndefined:
+		return "undefined"
+	case EventTypeStart:
+		return "start"
+	case EventTypeStop:
+		return "stop"
+	}
+	return fmt.Sprintf("unknown_%d", int(t))
+}
+
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Event is the start or the stop of a motion.
+type Event struct {
+	Type EventType
+
+	// Timestamp is the capture time of the frame
+	// which started or stopped the motion.
+	Timestamp time.Time
+
+	// Boxes are the bounding boxes of the moving areas in the frame
+	// which started the motion (empty on the stop).
+	Boxes []image.Rectangle
+
+	// Bounds is the bounding box of all the motion since the start.
+	Bounds image.Rectangle
+}
+
+// Detector keeps the background model and the state of the motion
+// between the frames. It is not safe for concurrent use.
+type Detector struct {
+	Config Config
+
+	grid       lumaGrid
+	background []float32
+	mask       []bool
+	changed    []bool
+	visited    []bool
+
+	active       bool
+	startFrames  uint
+	lastMotionTS time.Time
+	bounds       image.Rectangle
+}
+
+func NewDetector(cfg Config) *Detector {
+	return &Detector{
+		Config: cfg.withDefaults(),
+	}
+}
+
+// Active returns true if a motion event is in progress.
+func (d *Detector) Active() bool {
+	return d.active
+}
+
+// Reset forgets the background, so it is learned from the next frame.
+func (d *Detector) Reset() {
+	d.background = d.background[:0]
+}
+
+// Process updates the background model with the image captured at
+// the given time; it returns the bounding boxes of the moving areas and
+// the event if the motion started or stopped with this image.
+func (d *Detector) Process(
+	img image.Image,
+	ts time.Time,
+) ([]image.Rectangle, *Event) {
+	cfg := &d.Config
+	prevRect := d.grid.Rect
+	d.grid.compute(img, cfg.CellSize)
+	if d.grid.Rect != prevRect || len(d.mask) != len(d.grid.Luma) {
+		d.updateMask()
+		d.Reset()
+	}
+
+	if len(d.background) != len(d.grid.Luma) {
+		// the first frame is the initial background
+		d.background = d.background[:0]
+		for _, v := range d.grid.Luma {
+			d.background = append(d.background, float32(v))
+		}
+		return nil, d.updateState(nil, ts)
+	}
+
+	var changedCount, maskedCount int
+	for i, v := range d.grid.Luma {
+		d.changed[i] = false
+		if !d.mask[i] {
+			continue
+		}
+		maskedCount++
+		if math.Abs(float64(v)-float64(d.background[i])) >= float64(cfg.Threshold) {
+			d.changed[i] = true
+			changedCount++
+		}
+	}
+
+	if maskedCount > 0 && float64(changedCount) > cfg.MaxChange*float64(maskedCount) {
+		// most likely the lighting has changed, there is no use in
+		// comparing to the old background anymore
+		for i, v := range d.grid.Luma {
+			d.background[i] = float32(v)
+		}
+		return nil, d.updateState(nil, ts)
+	}
+
+	boxes := d.findBlobs()
+
+	rate := float32(cfg.LearningRate)
+	for i, v := range d.grid.Luma {
+		r := rate
+		if d.changed[i] {
+			r /= 10
+		}
+		d.background[i] += r * (float32(v) - d.background[i])
+	}
+	return boxes, d.updateState(boxes, ts)
+}
+
+// updateMask marks the cells (by their centers) within the regions.
+func (d *Detector) updateMask() {
+	g := &d.grid
+	d.mask = make([]bool, len(g.Luma))
+	d.changed = make([]bool, len(g.Luma))
+	d.visited = make([]bool, len(g.Luma))
+	for cy := 0; cy < g.Height; cy++ {
+		for cx := 0; cx < g.Width; cx++ {
+			center := g.Rect.Min.Add(image.Pt(cx*g.CellSize+g.CellSize/2, cy*g.CellSize+g.CellSize/2))
+			included := len(d.Config.Regions) == 0
+			for _, r := range d.Config.Regions {
+				if center.In(r) {
+					included = true
+					break
+				}
+			}
+			for _, r := range d.Config.IgnoreRegions {
+				if center.In(r) {
+					included = false
+					break
+				}
+			}
+			d.mask[cy*g.Width+cx] = included
+		}
+	}
+}
+
+func (d *Detector) updateState(
+	boxes []image.Rectangle,
+	ts time.Time,
+) *Event {
+	if len(boxes) > 0 {
+		d.lastMotionTS = ts
+	}
+
+	if !d.active {
+		if len(boxes) == 0 {
+			d.startFrames = 0
+			return nil
+		}
+		d.startFrames++
+		if d.startFrames < d.Config.StartFrames {
+			return nil
+		}
+		d.active = true
+		d.startFrames = 0
+		d.bounds = unionRect(boxes)
+		return &Event{
+			Type:      EventTypeStart,
+			Timestamp: ts,
+			Boxes:     boxes,
+			Bounds:    d.bounds,
+		}
+	}
+
+	if len(boxes) > 0 {
+		d.bounds = d.bounds.Union(unionRect(boxes))
+		return nil
+	}
+	if ts.Sub(d.lastMotionTS) < d.Config.StopDelay {
+		return nil
+	}
+	d.active = false
+	return &Event{
+		Type:      EventTypeStop,
+		Timestamp: ts,
+		Bounds:    d.bounds,
+	}
+}
+
+func unionRect(rects []image.Rectangle) image.Rectangle {
+	var result image.Rectangle
+	for _, r := range rects {
+		result = result.Union(r)
+	}
+	return result
+}
+
+// Run processes the frames of the camera and sends the events until
+// the context is done or the camera fails. The camera should be already
+// streaming. The sending blocks, so the channel should be read promptly
+// (or buffered) to not slow down the processing.
+func (d *Detector) Run(
+	ctx context.Context,
+	cam camera.Camera,
+	events chan<- Event,
+) error {
+	for {
+		frame, err := cam.GetFrame(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("unable to get a frame: %w", err)
+		}
+		_, event := d.Process(frame.Image(), camera.FrameTimestamp(frame))
+		if err := cam.ReleaseFrame(frame); err != nil {
+			return fmt.Errorf("unable to release a frame: %w", err)
+		}
+		if event == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case events <- *event:
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package motion
+
+import (
+	"context"
+	"image"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const testFrameInterval = 100 * time.Millisecond
+
+var (
+	testObject      = image.Rect(16, 16, 32, 32)
+	testSmallObject = image.Rect(40, 40, 48, 48)
+)
+
+// testScene is a frame of a gray background with white objects.
+type testScene struct {
+	Background uint8
+	Objects    []image.Rectangle
+}
+
+func (s testScene) render() *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, 64, 64), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = s.Background
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 128, 128
+	}
+	for _, r := range s.Objects {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.Y[img.YOffset(x, y)] = 255
+			}
+		}
+	}
+	return img
+}
+
+// scenes returns count frames of the scene.
+func scenes(count int, background uint8, objects ...image.Rectangle) []testScene {
+	result := make([]testScene, count)
+	for i := range result {
+		result[i] = testScene{Background: background, Objects: objects}
+	}
+	return result
+}
+
+type testEvent struct {
+	Frame  int
+	Type   EventType
+	Bounds image.Rectangle
+}
+
+func TestDetector(t *testing.T) {
+	baseCfg := Config{
+		MinBlobArea: 64,
+		StopDelay:   500 * time.Millisecond,
+	}
+	withCfg := func(modify func(cfg *Config)) Config {
+		cfg := baseCfg
+		modify(&cfg)
+		return cfg
+	}
+
+	for _, tc := range []struct {
+		name   string
+		cfg    Config
+		frames []testScene
+		events []testEvent
+	}{
+		{
+			name:   "static",
+			cfg:    baseCfg,
+			frames: scenes(10, 50),
+		},
+		{
+			name:   "start_and_stop",
+			cfg:    baseCfg,
+			frames: slices.Concat(scenes(3, 50), scenes(4, 50, testObject), scenes(8, 50)),
+			events: []testEvent{
+				{Frame: 4, Type: EventTypeStart, Bounds: testObject},
+				// the last motion is at the frame 6
+				{Frame: 11, Type: EventTypeStop, Bounds: testObject},
+			},
+		},
+		{
+			name:   "flash",
+			cfg:    baseCfg,
+			frames: slices.Concat(scenes(3, 50), scenes(1, 50, testObject), scenes(3, 50)),
+		},
+		{
+			name:   "start_frames",
+			cfg:    withCfg(func(cfg *Config) { cfg.StartFrames = 3 }),
+			frames: slices.Concat(scenes(3, 50), scenes(3, 50, testObject)),
+			events: []testEvent{
+				{Frame: 5, Type: EventTypeStart, Bounds: testObject},
+			},
+		},
+		{
+			name:   "bounds_grow",
+			cfg:    baseCfg,
+			frames: slices.Concat(scenes(1, 50), scenes(2, 50, testObject), scenes(1, 50, testObject, testSmallObject), scenes(6, 50)),
+			events: []testEvent{
+				{Frame: 2, Type: EventTypeStart, Bounds: testObject},
+				{Frame: 8, Type: EventTypeStop, Bounds: testObject.Union(testSmallObject)},
+			},
+		},
+		{
+			name:   "min_blob_area",
+			cfg:    withCfg(func(cfg *Config) { cfg.MinBlobArea = 65 }),
+			frames: slices.Concat(scenes(1, 50), scenes(3, 50, testSmallObject)),
+		},
+		{
+			name:   "ignore_regions",
+			cfg:    withCfg(func(cfg *Config) { cfg.IgnoreRegions = []image.Rectangle{image.Rect(0, 0, 32, 32)} }),
+			frames: slices.Concat(scenes(1, 50), scenes(3, 50, testObject)),
+		},
+		{
+			name:   "regions_outside",
+			cfg:    withCfg(func(cfg *Config) { cfg.Regions = []image.Rectangle{image.Rect(32, 32, 64, 64)} }),
+			frames: slices.Concat(scenes(1, 50), scenes(3, 50, testObject)),
+		},
+		{
+			name:   "regions_inside",
+			cfg:    withCfg(func(cfg *Config) { cfg.Regions = []image.Rectangle{image.Rect(32, 32, 64, 64)} }),
+			frames: slices.Concat(scenes(1, 50), scenes(3, 50, testObject, testSmallObject)),
+			events: []testEvent{
+				{Frame: 2, Type: EventTypeStart, Bounds: testSmallObject},
+			},
+		},
+		{
+			name: "lighting_change",
+			cfg:  baseCfg,
+			// the background is reset to the new lighting,
+			// so an object after it is still detected
+			frames: slices.Concat(scenes(2, 50), scenes(4, 150), scenes(2, 150, testObject)),
+			events: []testEvent{
+				{Frame: 7, Type: EventTypeStart, Bounds: testObject},
+			},
+		},
+		{
+			name:   "lighting_change_during_motion",
+			cfg:    baseCfg,
+			frames: slices.Concat(scenes(1, 50), scenes(2, 50, testObject), scenes(6, 150, testObject)),
+			events: []testEvent{
+				{Frame: 2, Type: EventTypeStart, Bounds: testObject},
+				// the object became a part of the new background,
+				// so the last motion is at the frame 2
+				{Frame: 7, Type: EventTypeStop, Bounds: testObject},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewDetector(tc.cfg)
+			start := time.Unix(1000, 0)
+			var events []testEvent
+			for idx, scene := range tc.frames {
+				ts := start.Add(time.Duration(idx) * testFrameInterval)
+				boxes, event := d.Process(scene.render(), ts)
+				if len(boxes) > 0 && len(scene.Objects) == 0 {
+					t.Errorf("frame %d: unexpected motion %v", idx, boxes)
+				}
+				if event == nil {
+					continue
+				}
+				if !event.Timestamp.Equal(ts) {
+					t.Errorf("frame %d: expected the timestamp %v, got %v", idx, ts, event.Timestamp)
+				}
+				if event.Type == EventTypeStart && unionRect(event.Boxes) != event.Bounds {
+					t.Errorf("frame %d: the boxes %v do not match the bounds %v", idx, event.Boxes, event.Bounds)
+				}
+				events = append(events, testEvent{Frame: idx, Type: event.Type, Bounds: event.Bounds})
+			}
+			if !slices.Equal(events, tc.events) {
+				t.Errorf("expected the events %v, got %v", tc.events, events)
+			}
+			if active := len(tc.events) > 0 && tc.events[len(tc.events)-1].Type == EventTypeStart; d.Active() != active {
+				t.Errorf("expected the activity %v, got %v", active, d.Active())
+			}
+		})
+	}
+}
+
+func TestResolutionChange(t *testing.T) {
+	d := NewDetector(Config{MinBlobArea: 64, StartFrames: 1})
+	ts := time.Unix(1000, 0)
+	d.Process(testScene{Background: 50}.render(), ts)
+
+	// the background of another resolution is not comparable
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	if boxes, event := d.Process(img, ts.Add(testFrameInterval)); len(boxes) > 0 || event != nil {
+		t.Errorf("expected no motion after the resolution change, got %v %v", boxes, event)
+	}
+}
+
+type testFrame struct {
+	img image.Image
+	ts  time.Time
+}
+
+func (f *testFrame) Image() image.Image {
+	return f.img
+}
+
+func (f *testFrame) Timestamp() time.Time {
+	return f.ts
+}
+
+// testCamera replays the scenes and then blocks.
+type testCamera struct {
+	frames   []testScene
+	idx      int
+	released int
+}
+
+func (c *testCamera) Close() error {
+	return nil
+}
+
+func (c *testCamera) StartStreaming() error {
+	return nil
+}
+
+func (c *testCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *testCamera) GetFormat() camera.Format {
+	return camera.Format{Width: 64, Height: 64, PixelFormat: camera.PixelFormatYU12}
+}
+
+func (c *testCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	if c.idx >= len(c.frames) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	frame := &testFrame{
+		img: c.frames[c.idx].render(),
+		ts:  time.Unix(1000, 0).Add(time.Duration(c.idx) * testFrameInterval),
+	}
+	c.idx++
+	return frame, nil
+}
+
+func (c *testCamera) ReleaseFrame(camera.Frame) error {
+	c.released++
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	cam := &testCamera{frames: slices.Concat(scenes(1, 50), scenes(2, 50, testObject), scenes(6, 50))}
+	d := NewDetector(Config{MinBlobArea: 64, StopDelay: 500 * time.Millisecond})
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	events := make(chan Event)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- d.Run(ctx, cam, events)
+	}()
+	for _, expected := range []EventType{EventTypeStart, EventTypeStop} {
+		select {
+		case event := <-events:
+			if event.Type != expected || event.Bounds != testObject {
+				t.Errorf("expected the %s event of %v, got %s of %v", expected, testObject, event.Type, event.Bounds)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no %s event", expected)
+		}
+	}
+	cancelFn()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("expected the context to be canceled, got %v", err)
+	}
+	if cam.released != len(cam.frames) {
+		t.Errorf("expected %d released frames, got %d", len(cam.frames), cam.released)
+	}
+}
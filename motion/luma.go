@@ -0,0 +1,110 @@
+package motion
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+// lumaGrid is the luma of an image averaged over square cells.
+type lumaGrid struct {
+	Rect     image.Rectangle
+	CellSize int
+	Width    int
+	Height   int
+	Luma     []uint8
+
+	sums   []uint32
+	counts []uint32
+	rowBuf []uint8
+}
+
+func (g *lumaGrid) reset(r image.Rectangle, cellSize int) {
+	g.Rect = r
+	g.CellSize = cellSize
+	g.Width = (r.Dx() + cellSize - 1) / cellSize
+	g.Height = (r.Dy() + cellSize - 1) / cellSize
+	cellCount := g.Width * g.Height
+	if cap(g.Luma) < cellCount {
+		g.Luma = make([]uint8, cellCount)
+		g.sums = make([]uint32, cellCount)
+		g.counts = make([]uint32, cellCount)
+	}
+	g.Luma, g.sums, g.counts = g.Luma[:cellCount], g.sums[:cellCount], g.counts[:cellCount]
+	clear(g.sums)
+	clear(g.counts)
+	if cap(g.rowBuf) < r.Dx() {
+		g.rowBuf = make([]uint8, r.Dx())
+	}
+	g.rowBuf = g.rowBuf[:r.Dx()]
+}
+
+// addRow accumulates the luma of the row (relative to Rect.Min.Y).
+func (g *lumaGrid) addRow(y int, row []uint8) {
+	cellRow := (y / g.CellSize) * g.Width
+	sums, counts := g.sums[cellRow:cellRow+g.Width], g.counts[cellRow:cellRow+g.Width]
+	for x, v := range row {
+		cell := x / g.CellSize
+		sums[cell] += uint32(v)
+		counts[cell]++
+	}
+}
+
+// compute fills the grid with the luma of the image; the Y plane is read
+// directly for the YUV and gray images, other ones are converted.
+func (g *lumaGrid) compute(img image.Image, cellSize int) {
+	r := img.Bounds()
+	g.reset(r, cellSize)
+	w := r.Dx()
+
+	switch img := img.(type) {
+	case *ximage.NV12:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			offset := img.YOffset(r.Min.X, y)
+			g.addRow(y-r.Min.Y, img.Y[offset:offset+w])
+		}
+	case *image.YCbCr:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			offset := img.YOffset(r.Min.X, y)
+			g.addRow(y-r.Min.Y, img.Y[offset:offset+w])
+		}
+	case *image.Gray:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			offset := img.PixOffset(r.Min.X, y)
+			g.addRow(y-r.Min.Y, img.Pix[offset:offset+w])
+		}
+	case *ximage.YUYV:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				macropixel := img.Y0CbY1Cr[img.Y0CbY1CrOffset(x, y)]
+				if x&1 == 0 {
+					g.rowBuf[x-r.Min.X] = macropixel.Y0
+				} else {
+					g.rowBuf[x-r.Min.X] = macropixel.Y1
+				}
+			}
+			g.addRow(y-r.Min.Y, g.rowBuf)
+		}
+	default:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				g.rowBuf[x-r.Min.X] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			}
+			g.addRow(y-r.Min.Y, g.rowBuf)
+		}
+	}
+
+	for i, sum := range g.sums {
+		g.Luma[i] = uint8(sum / max(g.counts[i], 1))
+	}
+}
+
+// cellRect returns the area of the image covered by the cells
+// from (x0, y0) to (x1, y1) inclusive.
+func (g *lumaGrid) cellRect(x0, y0, x1, y1 int) image.Rectangle {
+	return image.Rect(
+		x0*g.CellSize, y0*g.CellSize,
+		(x1+1)*g.CellSize, (y1+1)*g.CellSize,
+	).Add(g.Rect.Min).Intersect(g.Rect)
+}
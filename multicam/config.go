@@ -0,0 +1,71 @@
+package multicam
+
+import (
+	"time"
+)
+
+const (
+	// DefaultMaxPending keeps the driver buffers available: with the
+	// usual 4 buffers, 2 are pending, 1 is being received and 1 is
+	// held by the consumer.
+	DefaultMaxPending = 2
+
+	// defaultFPS is assumed for the cameras which report no FPS.
+	defaultFPS = 30
+)
+
+// Mode defines how the frame sets are paced.
+type Mode int
+
+const (
+	// ModeAll emits a set only when all the cameras have a frame
+	// within the tolerance; the frames without a match are dropped.
+	ModeAll = Mode(iota)
+
+	// ModeMaster emits a set on each frame of the master camera with
+	// the closest frames of the other cameras; if a camera has no frame
+	// within the tolerance, then its frame in the set is nil.
+	ModeMaster
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeAll:
+		return "all"
+	case ModeMaster:
+		return "master"
+	}
+	return "unknown"
+}
+
+type Config struct {
+	Mode Mode
+
+	// Master is the index of the master camera in ModeMaster.
+	Master int
+
+	// Tolerance is the maximal difference between the timestamps of
+	// a frame and the timestamp of its set; if zero, then a half of
+	// the shortest frame interval of the cameras is used.
+	Tolerance time.Duration
+
+	// MaxPending is the maximal amount of the frames of a camera waiting
+	// for the frames of the other cameras; the oldest frames above
+	// the limit are dropped (in ModeMaster a set is emitted without
+	// the lagging cameras instead of dropping a master frame).
+	MaxPending int
+
+	// OnError (if set) is called on the failures which do not stop
+	// the synchronization (like failing to release a frame).
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults(minFrameDuration time.Duration) Config {
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = minFrameDuration / 2
+	}
+	if cfg.MaxPending == 0 {
+		cfg.MaxPending = DefaultMaxPending
+	}
+	return cfg
+}
@@ -0,0 +1,58 @@
+package multicam
+
+import (
+	"time"
+)
+
+// CameraStats are the statistics of a camera of a Synchronizer. A skew is
+// the difference between the timestamp of a frame and the timestamp
+// of its set (positive if the frame is late).
+type CameraStats struct {
+	// Frames is the amount of the received frames.
+	Frames uint64
+
+	// Matched is the amount of the frames emitted in the sets.
+	Matched uint64
+
+	// Drops is the amount of the frames dropped without a match.
+	Drops uint64
+
+	// Missing is the amount of the sets emitted without a frame
+	// of the camera (only in ModeMaster).
+	Missing uint64
+
+	// Skipped is the amount of the frames skipped by the camera itself
+	// (see camera.FrameSkipCounter).
+	Skipped uint64
+
+	LastSkew time.Duration
+
+	// MaxSkew is the maximal absolute skew.
+	MaxSkew time.Duration
+
+	skewSum time.Duration
+}
+
+// MeanSkew returns the average skew, e.g. to find out the phase
+// difference of the cameras.
+func (s CameraStats) MeanSkew() time.Duration {
+	if s.Matched == 0 {
+		return 0
+	}
+	return s.skewSum / time.Duration(s.Matched)
+}
+
+func (s *CameraStats) addSkew(skew time.Duration) {
+	s.Matched++
+	s.LastSkew = skew
+	s.skewSum += skew
+	s.MaxSkew = max(s.MaxSkew, skew.Abs())
+}
+
+type Stats struct {
+	// Sets is the amount of the emitted frame sets.
+	Sets uint64
+
+	// Cameras are indexed the same way as Synchronizer.Cameras.
+	Cameras []CameraStats
+}
@@ -0,0 +1,429 @@
+// Package multicam captures from multiple cameras at once and groups the
+// frames with close timestamps (as reported by the drivers) into frame
+// sets, e.g. for stereo vision or a multi-angle recording.
+//
+// Without a hardware trigger the sensors are free-running, so the
+// frames never coincide exactly: the skew of each frame relative to
+// its set is reported together with the amount of dropped frames.
+package multicam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// FrameSet is a group of the frames captured at about the same time,
+// indexed the same way as Synchronizer.Cameras.
+type FrameSet struct {
+	// Timestamp is the timestamp of the master frame in ModeMaster,
+	// or the average timestamp of the frames otherwise.
+	Timestamp time.Time
+
+	// Frames may contain nil in ModeMaster (see ModeMaster).
+	Frames []camera.Frame
+
+	Timestamps []time.Time
+
+	// Skews are the differences between Timestamps and Timestamp.
+	Skews []time.Duration
+
+	cameras []camera.Camera
+}
+
+// Release returns the frames to the cameras; it should be called
+// as soon as the frames are no longer needed.
+func (s *FrameSet) Release() error {
+	var errs []error
+	for idx, frame := range s.Frames {
+		if frame == nil {
+			continue
+		}
+		if err := s.cameras[idx].ReleaseFrame(frame); err != nil {
+			errs = append(errs, fmt.Errorf("unable to release the frame of camera #%d: %w", idx, err))
+		}
+		s.Frames[idx] = nil
+	}
+	return errors.Join(errs...)
+}
+
+type pendingFrame struct {
+	Frame     camera.Frame
+	Timestamp time.Time
+}
+
+type arrival struct {
+	CameraIdx int
+	Frame     camera.Frame
+	Err       error
+}
+
+// Synchronizer receives the frames of all the cameras and
+// groups them into frame sets.
+type Synchronizer struct {
+	Cameras []camera.Camera
+	Config  Config
+
+	statsLocker sync.Mutex
+	stats       Stats
+
+	// pending are only accessed by Run
+	pending [][]pendingFrame
+}
+
+// New returns a synchronizer of the cameras; the cameras should
+// be streaming, and they are closed on Close.
+func New(cams []camera.Camera, cfg Config) (*Synchronizer, error) {
+	if len(cams) == 0 {
+		return nil, fmt.Errorf("no cameras")
+	}
+	if cfg.Mode == ModeMaster && (cfg.Master < 0 || cfg.Master >= len(cams)) {
+		return nil, fmt.Errorf("the master camera #%d is out of the range [0, %d)", cfg.Master, len(cams))
+	}
+
+	// the shortest frame interval among the cameras reporting the FPS
+	var minFrameDuration time.Duration
+	for _, cam := range cams {
+		fps := cam.GetFormat().FPS
+		if fps.Denominator == 0 || fps.Numerator == 0 {
+			continue
+		}
+		d := time.Duration(float64(time.Second) / fps.Float64())
+		if minFrameDuration == 0 || d < minFrameDuration {
+			minFrameDuration = d
+		}
+	}
+	if minFrameDuration == 0 {
+		minFrameDuration = time.Second / defaultFPS
+	}
+
+	return &Synchronizer{
+		Cameras: cams,
+		Config:  cfg.withDefaults(minFrameDuration),
+		stats: Stats{
+			Cameras: make([]CameraStats, len(cams)),
+		},
+		pending: make([][]pendingFrame, len(cams)),
+	}, nil
+}
+
+// Open opens the devices in the same format, starts streaming and
+// returns a synchronizer of them.
+func Open(
+	devices []camera.DevicePathAndPlatform,
+	format camera.Format,
+	cfg Config,
+) (_ *Synchronizer, _err error) {
+	var cams []camera.Camera
+	defer func() {
+		if _err != nil {
+			for _, cam := range cams {
+				cam.Close()
+			}
+		}
+	}()
+	for _, dev := range devices {
+		cam, err := dev.OpenCamera(format)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open the camera '%s': %w", dev.DevicePath, err)
+		}
+		cams = append(cams, cam)
+	}
+	// starting at once, to begin with the sets as complete as possible
+	for idx, cam := range cams {
+		if err := cam.StartStreaming(); err != nil {
+			return nil, fmt.Errorf("unable to start streaming of '%s': %w", devices[idx].DevicePath, err)
+		}
+	}
+	return New(cams, cfg)
+}
+
+// Close closes the cameras; it should not be called while Run is running.
+func (s *Synchronizer) Close() error {
+	var errs []error
+	for idx, cam := range s.Cameras {
+		if err := cam.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to close camera #%d: %w", idx, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns a copy of the statistics.
+func (s *Synchronizer) Stats() Stats {
+	s.statsLocker.Lock()
+	defer s.statsLocker.Unlock()
+	stats := s.stats
+	stats.Cameras = slices.Clone(s.stats.Cameras)
+	return stats
+}
+
+func (s *Synchronizer) reportError(err error) {
+	if s.Config.OnError != nil {
+		s.Config.OnError(err)
+	}
+}
+
+// Run emits the frame sets until the context is done or a camera fails;
+// the receiver of the sets should Release them.
+func (s *Synchronizer) Run(ctx context.Context, sets chan<- *FrameSet) error {
+	ctx, cancelFn := context.WithCancel(ctx)
+	arrivals := make(chan arrival)
+	var wg sync.WaitGroup
+	defer func() {
+		cancelFn()
+		wg.Wait()
+		s.releasePending()
+	}()
+	for idx, cam := range s.Cameras {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.receive(ctx, idx, cam, arrivals)
+		}()
+	}
+
+	for {
+		var a arrival
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case a = <-arrivals:
+		}
+		if a.Err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("unable to get a frame of camera #%d: %w", a.CameraIdx, a.Err)
+		}
+		s.push(a.CameraIdx, a.Frame)
+
+		for {
+			set := s.match()
+			if set == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				s.release(set)
+				return ctx.Err()
+			case sets <- set:
+			}
+		}
+	}
+}
+
+// receive passes the frames of the camera to Run until the context
+// is done or the camera fails.
+func (s *Synchronizer) receive(
+	ctx context.Context,
+	idx int,
+	cam camera.Camera,
+	arrivals chan<- arrival,
+) {
+	for {
+		frame, err := cam.GetFrame(ctx)
+		select {
+		case <-ctx.Done():
+			if frame != nil {
+				if err := cam.ReleaseFrame(frame); err != nil {
+					s.reportError(fmt.Errorf("unable to release a frame of camera #%d: %w", idx, err))
+				}
+			}
+			return
+		case arrivals <- arrival{CameraIdx: idx, Frame: frame, Err: err}:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Synchronizer) push(idx int, frame camera.Frame) {
+	s.statsLocker.Lock()
+	s.stats.Cameras[idx].Frames++
+	if skipCounter, ok := frame.(camera.FrameSkipCounter); ok {
+		s.stats.Cameras[idx].Skipped += skipCounter.SkippedFrames()
+	}
+	s.statsLocker.Unlock()
+
+	s.pending[idx] = append(s.pending[idx], pendingFrame{
+		Frame:     frame,
+		Timestamp: camera.FrameTimestamp(frame),
+	})
+	if s.Config.Mode == ModeMaster && idx == s.Config.Master {
+		// the lagging cameras are handled by match
+		return
+	}
+	for len(s.pending[idx]) > s.Config.MaxPending {
+		s.drop(idx)
+	}
+}
+
+// drop discards the oldest pending frame of the camera.
+func (s *Synchronizer) drop(idx int) {
+	s.releaseFrame(idx, s.pending[idx][0].Frame)
+	s.pending[idx] = s.pending[idx][1:]
+
+	s.statsLocker.Lock()
+	s.stats.Cameras[idx].Drops++
+	s.statsLocker.Unlock()
+}
+
+func (s *Synchronizer) releaseFrame(idx int, frame camera.Frame) {
+	if err := s.Cameras[idx].ReleaseFrame(frame); err != nil {
+		s.reportError(fmt.Errorf("unable to release a frame of camera #%d: %w", idx, err))
+	}
+}
+
+func (s *Synchronizer) release(set *FrameSet) {
+	if err := set.Release(); err != nil {
+		s.reportError(err)
+	}
+}
+
+func (s *Synchronizer) releasePending() {
+	for idx, pending := range s.pending {
+		for _, p := range pending {
+			s.releaseFrame(idx, p.Frame)
+		}
+		s.pending[idx] = nil
+	}
+}
+
+// match returns the next frame set if it is already known,
+// or nil if more frames are needed.
+func (s *Synchronizer) match() *FrameSet {
+	if s.Config.Mode == ModeMaster {
+		return s.matchMaster()
+	}
+	return s.matchAll()
+}
+
+func (s *Synchronizer) matchAll() *FrameSet {
+	for {
+		var newest time.Time
+		for _, pending := range s.pending {
+			if len(pending) == 0 {
+				return nil
+			}
+			if ts := pending[0].Timestamp; ts.After(newest) {
+				newest = ts
+			}
+		}
+
+		// the frames too old for the newest one have no chance for
+		// a match, since the following frames are even newer
+		dropped := false
+		oldestAllowed := newest.Add(-s.Config.Tolerance)
+		for idx := range s.pending {
+			for len(s.pending[idx]) > 0 && s.pending[idx][0].Timestamp.Before(oldestAllowed) {
+				s.drop(idx)
+				dropped = true
+			}
+		}
+		if dropped {
+			continue
+		}
+
+		picks := make([]int, len(s.pending))
+		return s.emit(picks, time.Time{})
+	}
+}
+
+func (s *Synchronizer) matchMaster() *FrameSet {
+	master := s.Config.Master
+	if len(s.pending[master]) == 0 {
+		return nil
+	}
+	ref := s.pending[master][0].Timestamp
+	// waiting for the lagging cameras no longer
+	force := len(s.pending[master]) > s.Config.MaxPending
+
+	picks := make([]int, len(s.pending))
+	for idx := range s.pending {
+		if idx == master {
+			continue
+		}
+		for len(s.pending[idx]) > 0 && s.pending[idx][0].Timestamp.Before(ref.Add(-s.Config.Tolerance)) {
+			s.drop(idx)
+		}
+
+		picks[idx] = -1
+		var bestDiff time.Duration
+		for i, p := range s.pending[idx] {
+			diff := p.Timestamp.Sub(ref).Abs()
+			if diff > s.Config.Tolerance {
+				break
+			}
+			if picks[idx] < 0 || diff < bestDiff {
+				picks[idx], bestDiff = i, diff
+			}
+		}
+		if picks[idx] < 0 && len(s.pending[idx]) == 0 && !force {
+			return nil
+		}
+	}
+	for idx, pick := range picks {
+		// the frames before the picked one are worse matches
+		for i := 0; i < pick; i++ {
+			s.drop(idx)
+		}
+		if pick > 0 {
+			picks[idx] = 0
+		}
+	}
+	return s.emit(picks, ref)
+}
+
+// emit pops the picked pending frames (the heads of the queues,
+// or none if the pick is negative) into a set; if ref is zero, then
+// the average timestamp is used as the timestamp of the set.
+func (s *Synchronizer) emit(picks []int, ref time.Time) *FrameSet {
+	n := len(s.pending)
+	set := &FrameSet{
+		Frames:     make([]camera.Frame, n),
+		Timestamps: make([]time.Time, n),
+		Skews:      make([]time.Duration, n),
+		cameras:    s.Cameras,
+	}
+	var first time.Time
+	var sum time.Duration
+	count := 0
+	for idx, pick := range picks {
+		if pick < 0 {
+			continue
+		}
+		p := s.pending[idx][0]
+		s.pending[idx] = s.pending[idx][1:]
+		set.Frames[idx] = p.Frame
+		set.Timestamps[idx] = p.Timestamp
+		if count == 0 {
+			first = p.Timestamp
+		}
+		sum += p.Timestamp.Sub(first)
+		count++
+	}
+	set.Timestamp = ref
+	if ref.IsZero() {
+		set.Timestamp = first.Add(sum / time.Duration(count))
+	}
+
+	s.statsLocker.Lock()
+	defer s.statsLocker.Unlock()
+	s.stats.Sets++
+	for idx, frame := range set.Frames {
+		if frame == nil {
+			s.stats.Cameras[idx].Missing++
+			continue
+		}
+		set.Skews[idx] = set.Timestamps[idx].Sub(set.Timestamp)
+		s.stats.Cameras[idx].addSkew(set.Skews[idx])
+	}
+	return set
+}
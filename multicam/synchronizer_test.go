@@ -0,0 +1,194 @@
+package multicam
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/platform/synthetic"
+)
+
+func testFormat(fps uint) camera.Format {
+	return camera.Format{
+		Width:       64,
+		Height:      48,
+		PixelFormat: camera.PixelFormatNV12,
+		FPS:         camera.Fraction{Numerator: fps, Denominator: 1},
+	}
+}
+
+func newTestCameras(t *testing.T, formats []camera.Format, cfgs []synthetic.CameraConfig) []camera.Camera {
+	t.Helper()
+	var cams []camera.Camera
+	for idx, format := range formats {
+		var cfg synthetic.CameraConfig
+		if idx < len(cfgs) {
+			cfg = cfgs[idx]
+		}
+		cam, err := synthetic.NewCamera(format, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cam.StartStreaming(); err != nil {
+			t.Fatal(err)
+		}
+		cams = append(cams, cam)
+	}
+	return cams
+}
+
+// collect runs the synchronizer until count sets are received;
+// the sets are released.
+func collect(t *testing.T, s *Synchronizer, count int) []*FrameSet {
+	t.Helper()
+	ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+
+	sets := make(chan *FrameSet)
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(ctx, sets) }()
+
+	var result []*FrameSet
+	for len(result) < count {
+		select {
+		case set := <-sets:
+			result = append(result, set)
+			if err := set.Release(); err != nil {
+				t.Error(err)
+			}
+		case err := <-runErr:
+			t.Fatalf("Run ended after %d sets: %v", len(result), err)
+		}
+	}
+	cancelFn()
+	if err := <-runErr; err != context.Canceled {
+		t.Fatalf("unexpected error of Run: %v", err)
+	}
+	return result
+}
+
+func TestNewDefaultTolerance(t *testing.T) {
+	for _, tc := range []struct {
+		Name      string
+		FPS       []uint
+		Tolerance time.Duration
+	}{
+		{"fast_first", []uint{30, 15}, time.Second / 60},
+		{"slow_first", []uint{15, 30}, time.Second / 60},
+		{"unknown_first", []uint{0, 15}, time.Second / 30},
+		{"unknown_only", []uint{0, 0}, time.Second / defaultFPS / 2},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var formats []camera.Format
+			for _, fps := range tc.FPS {
+				formats = append(formats, testFormat(fps))
+			}
+			s, err := New(newTestCameras(t, formats, nil), Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if s.Config.Tolerance != tc.Tolerance {
+				t.Errorf("expected the tolerance %v, got %v", tc.Tolerance, s.Config.Tolerance)
+			}
+		})
+	}
+}
+
+func TestModeAll(t *testing.T) {
+	const offset = 3 * time.Millisecond
+	plat := synthetic.NewPlatform(synthetic.Config{
+		Cameras:       2,
+		CameraConfigs: []synthetic.CameraConfig{{}, {Offset: offset}},
+	})
+	var devices []camera.DevicePathAndPlatform
+	for idx := 0; idx < 2; idx++ {
+		devices = append(devices, camera.DevicePathAndPlatform{
+			DevicePath: synthetic.DevicePath(idx),
+			Platform:   plat,
+		})
+	}
+	s, err := Open(devices, testFormat(30), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	sets := collect(t, s, 10)
+	for _, set := range sets {
+		if skew := set.Timestamps[1].Sub(set.Timestamps[0]); skew != offset {
+			t.Errorf("expected the frames %v apart, got %v", offset, skew)
+		}
+		for idx, skew := range set.Skews {
+			if skew.Abs() > s.Config.Tolerance {
+				t.Errorf("the skew of camera #%d is %v, which is above the tolerance %v", idx, skew, s.Config.Tolerance)
+			}
+		}
+	}
+	stats := s.Stats()
+	if stats.Sets < 10 {
+		t.Errorf("expected at least 10 sets in the stats, got %d", stats.Sets)
+	}
+	if mean := stats.Cameras[1].MeanSkew() - stats.Cameras[0].MeanSkew(); mean != offset {
+		t.Errorf("expected the mean skews %v apart, got %v", offset, mean)
+	}
+}
+
+func TestModeAllDropsUnmatched(t *testing.T) {
+	// every frame of the second camera is half of an interval off
+	cams := newTestCameras(t, []camera.Format{testFormat(30), testFormat(30)}, []synthetic.CameraConfig{
+		{},
+		{Offset: time.Second / 60},
+	})
+	s, err := New(cams, Config{Tolerance: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancelFn()
+	sets := make(chan *FrameSet, 1)
+	if err := s.Run(ctx, sets); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error of Run: %v", err)
+	}
+	if len(sets) != 0 {
+		t.Errorf("expected no sets")
+	}
+	stats := s.Stats()
+	if stats.Cameras[0].Drops+stats.Cameras[1].Drops == 0 {
+		t.Errorf("expected the unmatched frames to be dropped")
+	}
+}
+
+func TestModeMaster(t *testing.T) {
+	// the second camera is twice slower, so it has no frame
+	// for every other frame of the master
+	cams := newTestCameras(t, []camera.Format{testFormat(30), testFormat(15)}, nil)
+	s, err := New(cams, Config{Mode: ModeMaster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	sets := collect(t, s, 10)
+	var missing int
+	for _, set := range sets {
+		if set.Frames[0] != nil {
+			t.Errorf("the frames are not set to nil on release")
+		}
+		if set.Timestamps[0] != set.Timestamp {
+			t.Errorf("the set timestamp %v is not the master one %v", set.Timestamp, set.Timestamps[0])
+		}
+		if set.Timestamps[1].IsZero() {
+			missing++
+		}
+	}
+	if missing < 4 || missing > 6 {
+		t.Errorf("expected about a half of the sets without the second camera, got %d of %d", missing, len(sets))
+	}
+	if stats := s.Stats(); stats.Cameras[1].Missing == 0 {
+		t.Errorf("the missing frames are not counted")
+	}
+}
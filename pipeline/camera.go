@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// Camera returns the frames of a stage of the pipeline (see
+// Pipeline.AddCamera); the frames are *Frame.
+type Camera struct {
+	Pipeline *Pipeline
+
+	node *Node
+}
+
+var _ camera.Camera = (*Camera)(nil)
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	r := c.Pipeline.currentRun()
+	if r == nil {
+		return nil, fmt.Errorf("the pipeline is not running: %w", camera.ErrNoFrame)
+	}
+	select {
+	case frame := <-c.node.input:
+		c.node.frames.Add(1)
+		return frame, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-r.ctx.Done():
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("the pipeline is stopped: %w", camera.ErrNoFrame)
+	}
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	f, ok := frame.(*Frame)
+	if !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	f.Release()
+	return nil
+}
+
+func (c *Camera) GetFormat() camera.Format {
+	return c.node.format
+}
+
+func (c *Camera) StartStreaming() error {
+	return c.Pipeline.Start()
+}
+
+func (c *Camera) StopStreaming() error {
+	return c.Pipeline.Stop()
+}
+
+func (c *Camera) Close() error {
+	return c.Pipeline.Close()
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+const (
+	// DefaultQueueSize is small, since the queued frames of a source
+	// camera hold its driver buffers.
+	DefaultQueueSize = 2
+)
+
+// Backpressure defines what happens when a stage is slower than
+// the stage feeding it.
+type Backpressure int
+
+const (
+	// BackpressureBlock makes the producer wait for the queue of the
+	// consumer; a slow stage slows down the whole branch up to the source.
+	BackpressureBlock = Backpressure(iota)
+
+	// BackpressureDropOldest drops the oldest queued frame of the
+	// consumer, so the consumer gets the most recent frames and the
+	// other branches are not affected.
+	BackpressureDropOldest
+)
+
+func (b Backpressure) String() string {
+	switch b {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDropOldest:
+		return "drop-oldest"
+	}
+	return "unknown"
+}
+
+type Config struct {
+	// QueueSize is the amount of frames which may wait at the input
+	// of each stage.
+	QueueSize int
+
+	Backpressure Backpressure
+
+	// OnError (if set) is called on the failures of the transforms and
+	// the sinks; the failed frame is dropped, but the pipeline goes on.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	return cfg
+}
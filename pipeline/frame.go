@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"image"
+	"sync/atomic"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// Frame is a frame flowing through a pipeline; it is reference counted,
+// since the same frame may be passed to several stages at once. The image
+// should not be modified by the stages (except by the stage which
+// created the frame, before emitting it).
+type Frame struct {
+	camera.ImageFrame
+
+	// Seq is the sequence number of the frame reported by the source
+	// camera (see camera.FrameSequencer), or counted by the pipeline.
+	Seq uint64
+
+	refs    atomic.Int32
+	release func()
+}
+
+var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
+var _ camera.FrameTimestamper = (*Frame)(nil)
+var _ camera.FrameSequencer = (*Frame)(nil)
+
+// NewFrame returns a frame with a single reference; release (if not nil)
+// is called when the last reference is released.
+func NewFrame(img image.Image, release func()) *Frame {
+	f := &Frame{
+		ImageFrame: camera.ImageFrame{
+			Img:       img,
+			CaptureTS: time.Now(),
+		},
+		release: release,
+	}
+	f.refs.Store(1)
+	return f
+}
+
+// Derive returns a new frame of the image with the metadata of this
+// frame (see NewFrame).
+func (f *Frame) Derive(img image.Image, release func()) *Frame {
+	result := NewFrame(img, release)
+	result.Seq = f.Seq
+	result.Skipped = f.Skipped
+	result.CaptureTS = f.CaptureTS
+	return result
+}
+
+func (f *Frame) Sequence() uint64 {
+	return f.Seq
+}
+
+// Retain adds a reference to the frame.
+func (f *Frame) Retain() *Frame {
+	if f.refs.Add(1) <= 1 {
+		panic("retaining a released frame")
+	}
+	return f
+}
+
+// Release drops a reference to the frame.
+func (f *Frame) Release() {
+	switch refs := f.refs.Add(-1); {
+	case refs > 0:
+	case refs == 0:
+		if f.release != nil {
+			f.release()
+		}
+	default:
+		panic("releasing a released frame")
+	}
+}
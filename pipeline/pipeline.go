@@ -0,0 +1,475 @@
+// Package pipeline connects frame-processing stages into a graph: the
+// sources (cameras) feed the transforms (scaling, color conversion,
+// overlays, analytics), which feed other transforms and the sinks.
+//
+// Each stage runs in its own goroutine with a bounded input queue, and
+// a frame may be passed to several stages at once (it is reference
+// counted). The output of a stage may also be consumed as an ordinary
+// camera.Camera (see Pipeline.AddCamera).
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type nodeKind int
+
+const (
+	nodeKindSource = nodeKind(iota)
+	nodeKindTransform
+	nodeKindSink
+	nodeKindCamera
+)
+
+// Node is a stage of a pipeline.
+type Node struct {
+	Name string
+
+	kind      nodeKind
+	format    camera.Format
+	source    camera.Camera
+	transform Transform
+	sink      Sink
+	input     chan *Frame
+	outputs   []*Node
+
+	frames atomic.Uint64
+	drops  atomic.Uint64
+	errors atomic.Uint64
+	busy   atomic.Int64
+}
+
+// Format returns the format of the output frames of the stage
+// (of the input frames for a sink).
+func (n *Node) Format() camera.Format {
+	return n.format
+}
+
+// StageStats are the statistics of a stage.
+type StageStats struct {
+	Name string
+
+	// Frames is the amount of the frames emitted (or consumed by a sink).
+	Frames uint64
+
+	// Drops is the amount of the frames dropped from the input queue
+	// (see BackpressureDropOldest).
+	Drops uint64
+
+	Errors uint64
+
+	// Queued is the current amount of the frames in the input queue.
+	Queued int
+
+	// Busy is the total time spent in the stage.
+	Busy time.Duration
+}
+
+type run struct {
+	ctx      context.Context
+	cancelFn context.CancelFunc
+	wg       sync.WaitGroup
+
+	errLocker sync.Mutex
+	err       error
+}
+
+func (r *run) fail(err error) {
+	r.errLocker.Lock()
+	defer r.errLocker.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.cancelFn()
+}
+
+func (r *run) Err() error {
+	r.errLocker.Lock()
+	defer r.errLocker.Unlock()
+	return r.err
+}
+
+// Pipeline is a graph of the stages; the stages are added before the
+// pipeline is started and cannot be removed.
+type Pipeline struct {
+	Config Config
+
+	locker  sync.Mutex
+	nodes   []*Node
+	running *run
+}
+
+func New(cfg Config) *Pipeline {
+	return &Pipeline{
+		Config: cfg.withDefaults(),
+	}
+}
+
+func (p *Pipeline) reportError(err error) {
+	if p.Config.OnError != nil {
+		p.Config.OnError(err)
+	}
+}
+
+func (p *Pipeline) addNode(n *Node, input *Node) (*Node, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if p.running != nil {
+		return nil, fmt.Errorf("unable to add stage '%s' to a running pipeline", n.Name)
+	}
+	for _, other := range p.nodes {
+		if other.Name == n.Name {
+			return nil, fmt.Errorf("stage '%s' already exists", n.Name)
+		}
+	}
+	if input != nil {
+		n.input = make(chan *Frame, p.Config.QueueSize)
+		input.outputs = append(input.outputs, n)
+	}
+	p.nodes = append(p.nodes, n)
+	return n, nil
+}
+
+func (p *Pipeline) checkInput(name string, input *Node) error {
+	if input == nil {
+		return fmt.Errorf("stage '%s' has no input", name)
+	}
+	switch input.kind {
+	case nodeKindSink, nodeKindCamera:
+		return fmt.Errorf("stage '%s' cannot be connected to the sink '%s'", name, input.Name)
+	}
+	return nil
+}
+
+// AddSource adds the camera as a source; the camera should not be
+// streaming: it is started and stopped together with the pipeline
+// and closed on Close.
+func (p *Pipeline) AddSource(name string, cam camera.Camera) (*Node, error) {
+	return p.addNode(&Node{
+		Name:   name,
+		kind:   nodeKindSource,
+		format: cam.GetFormat(),
+		source: cam,
+	}, nil)
+}
+
+// AddTransform adds the transform of the frames of the input stage.
+func (p *Pipeline) AddTransform(name string, input *Node, t Transform) (*Node, error) {
+	if err := p.checkInput(name, input); err != nil {
+		return nil, err
+	}
+	format, err := t.Init(input.format)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize stage '%s' with the input format %s %dx%d: %w", name, input.format.PixelFormat, input.format.Width, input.format.Height, err)
+	}
+	return p.addNode(&Node{
+		Name:      name,
+		kind:      nodeKindTransform,
+		format:    format,
+		transform: t,
+	}, input)
+}
+
+// AddSink adds the sink of the frames of the input stage.
+func (p *Pipeline) AddSink(name string, input *Node, s Sink) (*Node, error) {
+	if err := p.checkInput(name, input); err != nil {
+		return nil, err
+	}
+	if err := s.Init(input.format); err != nil {
+		return nil, fmt.Errorf("unable to initialize stage '%s' with the input format %s %dx%d: %w", name, input.format.PixelFormat, input.format.Width, input.format.Height, err)
+	}
+	return p.addNode(&Node{
+		Name:   name,
+		kind:   nodeKindSink,
+		format: input.format,
+		sink:   s,
+	}, input)
+}
+
+// AddCamera adds a sink returning the frames of the input stage via
+// camera.Camera; the camera controls the whole pipeline: StartStreaming
+// starts it, StopStreaming stops it and Close closes it.
+func (p *Pipeline) AddCamera(name string, input *Node) (*Camera, error) {
+	if err := p.checkInput(name, input); err != nil {
+		return nil, err
+	}
+	n, err := p.addNode(&Node{
+		Name:   name,
+		kind:   nodeKindCamera,
+		format: input.format,
+	}, input)
+	if err != nil {
+		return nil, err
+	}
+	return &Camera{
+		Pipeline: p,
+		node:     n,
+	}, nil
+}
+
+// Stats returns the statistics of the stages in the order
+// they were added.
+func (p *Pipeline) Stats() []StageStats {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	result := make([]StageStats, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		result = append(result, StageStats{
+			Name:   n.Name,
+			Frames: n.frames.Load(),
+			Drops:  n.drops.Load(),
+			Errors: n.errors.Load(),
+			Queued: len(n.input),
+			Busy:   time.Duration(n.busy.Load()),
+		})
+	}
+	return result
+}
+
+func (p *Pipeline) currentRun() *run {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return p.running
+}
+
+// Start starts streaming of the sources and the goroutines of the stages;
+// it does nothing if the pipeline is already running.
+func (p *Pipeline) Start() (_err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if p.running != nil {
+		return nil
+	}
+
+	var started []*Node
+	defer func() {
+		if _err != nil {
+			for _, n := range started {
+				n.source.StopStreaming()
+			}
+		}
+	}()
+	for _, n := range p.nodes {
+		if n.kind != nodeKindSource {
+			continue
+		}
+		if err := n.source.StartStreaming(); err != nil {
+			return fmt.Errorf("unable to start streaming of source '%s': %w", n.Name, err)
+		}
+		started = append(started, n)
+	}
+
+	r := &run{}
+	r.ctx, r.cancelFn = context.WithCancel(context.Background())
+	for _, n := range p.nodes {
+		var loop func(context.Context, *run, *Node)
+		switch n.kind {
+		case nodeKindSource:
+			loop = p.runSource
+		case nodeKindTransform, nodeKindSink:
+			loop = p.runStage
+		default:
+			// the frames are pulled by the consumer of the camera
+			continue
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			loop(r.ctx, r, n)
+		}()
+	}
+	p.running = r
+	return nil
+}
+
+// Stop stops the goroutines of the stages and streaming of the sources;
+// the queued frames are released.
+func (p *Pipeline) Stop() error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	r := p.running
+	if r == nil {
+		return nil
+	}
+	p.running = nil
+	r.cancelFn()
+	r.wg.Wait()
+
+	var errs []error
+	for _, n := range p.nodes {
+		for len(n.input) > 0 {
+			(<-n.input).Release()
+		}
+		if n.kind != nodeKindSource {
+			continue
+		}
+		if err := n.source.StopStreaming(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to stop streaming of source '%s': %w", n.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts the pipeline and waits until the context is done or
+// a source fails; the pipeline is stopped on return.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if err := p.Start(); err != nil {
+		return err
+	}
+	r := p.currentRun()
+	select {
+	case <-ctx.Done():
+	case <-r.ctx.Done():
+	}
+	stopErr := p.Stop()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(r.Err(), stopErr)
+}
+
+// Close stops the pipeline and closes the sources, and the transforms
+// and the sinks implementing io.Closer.
+func (p *Pipeline) Close() error {
+	errs := []error{p.Stop()}
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	for _, n := range p.nodes {
+		var closer io.Closer
+		switch n.kind {
+		case nodeKindSource:
+			closer = n.source
+		case nodeKindTransform:
+			closer, _ = n.transform.(io.Closer)
+		case nodeKindSink:
+			closer, _ = n.sink.(io.Closer)
+		}
+		if closer == nil {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to close stage '%s': %w", n.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pipeline) runSource(ctx context.Context, r *run, n *Node) {
+	cam := n.source
+	for seq := uint64(0); ; seq++ {
+		startTS := time.Now()
+		frame, err := cam.GetFrame(ctx)
+		if ctx.Err() != nil {
+			if frame != nil {
+				if err := cam.ReleaseFrame(frame); err != nil {
+					p.reportError(fmt.Errorf("unable to release a frame of source '%s': %w", n.Name, err))
+				}
+			}
+			return
+		}
+		if err != nil {
+			r.fail(fmt.Errorf("unable to get a frame of source '%s': %w", n.Name, err))
+			return
+		}
+		n.busy.Add(int64(time.Since(startTS)))
+
+		f := NewFrame(frame.Image(), func() {
+			if err := cam.ReleaseFrame(frame); err != nil {
+				p.reportError(fmt.Errorf("unable to release a frame of source '%s': %w", n.Name, err))
+			}
+		})
+		f.Seq = seq
+		if sequencer, ok := frame.(camera.FrameSequencer); ok {
+			f.Seq = sequencer.Sequence()
+		}
+		f.CaptureTS = camera.FrameTimestamp(frame)
+		if skipCounter, ok := frame.(camera.FrameSkipCounter); ok {
+			f.Skipped = skipCounter.SkippedFrames()
+		}
+		n.frames.Add(1)
+		p.emit(ctx, n, f)
+	}
+}
+
+func (p *Pipeline) runStage(ctx context.Context, _ *run, n *Node) {
+	for {
+		var frame *Frame
+		select {
+		case <-ctx.Done():
+			return
+		case frame = <-n.input:
+		}
+
+		startTS := time.Now()
+		var (
+			result *Frame
+			err    error
+		)
+		if n.kind == nodeKindSink {
+			err = n.sink.WriteFrame(ctx, frame)
+		} else {
+			result, err = n.transform.Process(ctx, frame)
+		}
+		frame.Release()
+		n.busy.Add(int64(time.Since(startTS)))
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			n.errors.Add(1)
+			p.reportError(fmt.Errorf("stage '%s' failed: %w", n.Name, err))
+			continue
+		}
+		if n.kind == nodeKindSink {
+			n.frames.Add(1)
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		n.frames.Add(1)
+		p.emit(ctx, n, result)
+	}
+}
+
+// emit passes the frame to the consumers of the stage and
+// releases the reference of the stage.
+func (p *Pipeline) emit(ctx context.Context, n *Node, frame *Frame) {
+	defer frame.Release()
+	for _, out := range n.outputs {
+		p.push(ctx, out, frame.Retain())
+	}
+}
+
+func (p *Pipeline) push(ctx context.Context, n *Node, frame *Frame) {
+	if p.Config.Backpressure == BackpressureBlock {
+		select {
+		case n.input <- frame:
+		case <-ctx.Done():
+			frame.Release()
+		}
+		return
+	}
+
+	for {
+		select {
+		case n.input <- frame:
+			return
+		default:
+		}
+		select {
+		case old := <-n.input:
+			old.Release()
+			n.drops.Add(1)
+		default:
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+var testFormat = camera.Format{
+	Width:       16,
+	Height:      8,
+	PixelFormat: camera.PixelFormatNV12,
+	FPS:         camera.Fraction{Numerator: 1000, Denominator: 1},
+}
+
+type testFrame struct {
+	img image.Image
+	seq uint64
+}
+
+func (f *testFrame) Image() image.Image {
+	return f.img
+}
+
+func (f *testFrame) Sequence() uint64 {
+	return f.seq
+}
+
+// testSource returns up to Limit frames (unlimited if zero) and then
+// blocks; it tracks how many times each frame is released.
+type testSource struct {
+	Limit uint64
+
+	locker    sync.Mutex
+	taken     uint64
+	released  map[uint64]int
+	streaming bool
+	closed    bool
+}
+
+var _ camera.Camera = (*testSource)(nil)
+
+func (c *testSource) Close() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *testSource) StartStreaming() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.streaming = true
+	return nil
+}
+
+func (c *testSource) StopStreaming() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.streaming = false
+	return nil
+}
+
+func (c *testSource) GetFormat() camera.Format {
+	return testFormat
+}
+
+func (c *testSource) GetFrame(ctx context.Context) (camera.Frame, error) {
+	c.locker.Lock()
+	if c.Limit > 0 && c.taken >= c.Limit {
+		c.locker.Unlock()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	c.taken++
+	seq := c.taken
+	c.locker.Unlock()
+	return &testFrame{
+		img: ximage.NewNV12(image.Rect(0, 0, int(testFormat.Width), int(testFormat.Height))),
+		seq: seq,
+	}, nil
+}
+
+func (c *testSource) ReleaseFrame(frame camera.Frame) error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.released == nil {
+		c.released = map[uint64]int{}
+	}
+	c.released[frame.(*testFrame).seq]++
+	return nil
+}
+
+func (c *testSource) Taken() uint64 {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.taken
+}
+
+// checkReleased checks that every taken frame is released exactly once.
+func (c *testSource) checkReleased(t *testing.T) {
+	t.Helper()
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	for seq := uint64(1); seq <= c.taken; seq++ {
+		if count := c.released[seq]; count != 1 {
+			t.Errorf("frame %d is released %d times", seq, count)
+		}
+	}
+	if len(c.released) != int(c.taken) {
+		t.Errorf("released %d frames, but %d were taken", len(c.released), c.taken)
+	}
+}
+
+func waitFor(t *testing.T, description string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func stageStats(p *Pipeline, name string) StageStats {
+	for _, stats := range p.Stats() {
+		if stats.Name == name {
+			return stats
+		}
+	}
+	return StageStats{}
+}
+
+func TestFrameRefs(t *testing.T) {
+	released := 0
+	f := NewFrame(nil, func() {
+		released++
+	})
+	f.Retain()
+	f.Release()
+	if released != 0 {
+		t.Errorf("released while retained")
+	}
+	f.Release()
+	if released != 1 {
+		t.Errorf("expected to be released once, got %d", released)
+	}
+
+	for _, tc := range []struct {
+		name string
+		fn   func()
+	}{
+		{"release", func() {
+			f.Release()
+		}},
+		{"retain", func() {
+			f.Retain()
+		}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic on %s of a released frame", tc.name)
+				}
+			}()
+			tc.fn()
+		}()
+	}
+	if released != 1 {
+		t.Errorf("expected to be released once, got %d", released)
+	}
+}
+
+func TestBackpressureBlock(t *testing.T) {
+	src := &testSource{}
+	p := New(Config{QueueSize: 2, Backpressure: BackpressureBlock})
+	srcNode, err := p.AddSource("source", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unblock := make(chan struct{})
+	var locker sync.Mutex
+	var seqs []uint64
+	if _, err := p.AddSink("slow", srcNode, WriteFunc(func(ctx context.Context, frame *Frame) error {
+		select {
+		case <-unblock:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		locker.Lock()
+		defer locker.Unlock()
+		seqs = append(seqs, frame.Seq)
+		return nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the source waits for the sink: a frame in the sink,
+	// 2 in the queue and a frame being pushed
+	waitFor(t, "the queue to fill", func() bool {
+		return stageStats(p, "slow").Queued == 2
+	})
+	time.Sleep(20 * time.Millisecond)
+	if taken := src.Taken(); taken > 4 {
+		t.Errorf("expected the source to be blocked, but it returned %d frames", taken)
+	}
+
+	close(unblock)
+	waitFor(t, "the frames to flow", func() bool {
+		return stageStats(p, "slow").Frames >= 100
+	})
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if drops := stageStats(p, "slow").Drops; drops != 0 {
+		t.Errorf("expected no drops, got %d", drops)
+	}
+	locker.Lock()
+	defer locker.Unlock()
+	for idx, seq := range seqs {
+		if seq != uint64(idx+1) {
+			t.Fatalf("expected all the frames in order, got %v", seqs)
+		}
+	}
+	src.checkReleased(t)
+	if !src.closed || src.streaming {
+		t.Errorf("expected the source to be stopped and closed")
+	}
+}
+
+func TestBackpressureDropOldest(t *testing.T) {
+	src := &testSource{}
+	p := New(Config{QueueSize: 2, Backpressure: BackpressureDropOldest})
+	srcNode, err := p.AddSource("source", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unblock := make(chan struct{})
+	if _, err := p.AddSink("slow", srcNode, WriteFunc(func(ctx context.Context, frame *Frame) error {
+		select {
+		case <-unblock:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddSink("fast", srcNode, WriteFunc(func(ctx context.Context, frame *Frame) error {
+		return nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the slow branch does not slow down the fast one
+	waitFor(t, "the fast sink", func() bool {
+		return stageStats(p, "fast").Frames >= 100
+	})
+	slow := stageStats(p, "slow")
+	if slow.Frames != 0 || slow.Drops == 0 || slow.Queued != 2 {
+		t.Errorf("expected the slow sink to drop the frames, got %+v", slow)
+	}
+	close(unblock)
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// each taken frame is either consumed or dropped by each sink
+	// (or released on the stop)
+	slow = stageStats(p, "slow")
+	fast := stageStats(p, "fast")
+	taken := src.Taken()
+	for _, stats := range []StageStats{slow, fast} {
+		if stats.Frames+stats.Drops > taken || stats.Queued != 0 {
+			t.Errorf("unexpected statistics of %d taken frames: %+v", taken, stats)
+		}
+	}
+	src.checkReleased(t)
+}
+
+func TestTransform(t *testing.T) {
+	src := &testSource{Limit: 10}
+	p := New(Config{})
+	srcNode, err := p.AddSource("source", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("odd frame")
+	var errs []error
+	p.Config.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+	pool, err := NewPool(testFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transform, err := p.AddTransform("even", srcNode, ProcessFunc(func(ctx context.Context, frame *Frame) (*Frame, error) {
+		switch {
+		case frame.Seq%4 == 1:
+			return nil, nil
+		case frame.Seq%4 == 3:
+			return nil, failed
+		}
+		return pool.NewFrame(frame), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cam, err := p.AddCamera("camera", transform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cam.GetFormat() != testFormat {
+		t.Errorf("expected the format %v, got %v", testFormat, cam.GetFormat())
+	}
+	if err := cam.StartStreaming(); err != nil {
+		t.Fatal(err)
+	}
+	for _, expectedSeq := range []uint64{2, 4, 6, 8, 10} {
+		frame, err := cam.GetFrame(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq := frame.(*Frame).Seq; seq != expectedSeq {
+			t.Errorf("expected the frame %d, got %d", expectedSeq, seq)
+		}
+		if err := cam.ReleaseFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cam.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the frames 3 and 7
+	if len(errs) != 2 || !errors.Is(errs[0], failed) {
+		t.Errorf("expected 2 failures, got %v", errs)
+	}
+	if stats := stageStats(p, "even"); stats.Frames != 5 || stats.Errors != 2 {
+		t.Errorf("unexpected statistics of the transform: %+v", stats)
+	}
+	// at most a frame in the transform, 2 queued and one being read
+	if pool.Allocated() > 4 {
+		t.Errorf("expected the images to be reused, but %d were allocated", pool.Allocated())
+	}
+	src.checkReleased(t)
+}
+
+// testWrapper passes the frames through or replaces them
+// with its own ones.
+type testWrapper struct {
+	camera.Camera
+	Replace bool
+
+	locker   sync.Mutex
+	own      int
+	released int
+	closed   bool
+}
+
+func (w *testWrapper) GetFrame(ctx context.Context) (camera.Frame, error) {
+	frame, err := w.Camera.GetFrame(ctx)
+	if err != nil || !w.Replace {
+		return frame, err
+	}
+	img := frame.Image()
+	if err := w.Camera.ReleaseFrame(frame); err != nil {
+		return nil, err
+	}
+	w.locker.Lock()
+	defer w.locker.Unlock()
+	w.own++
+	return camera.FrameFromImage(img), nil
+}
+
+func (w *testWrapper) ReleaseFrame(frame camera.Frame) error {
+	if _, ok := frame.(*Frame); ok {
+		return w.Camera.ReleaseFrame(frame)
+	}
+	w.locker.Lock()
+	defer w.locker.Unlock()
+	w.released++
+	return nil
+}
+
+func (w *testWrapper) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestWrap(t *testing.T) {
+	for _, replace := range []bool{false, true} {
+		src := &testSource{Limit: 5}
+		wrapper := &testWrapper{Replace: replace}
+		p := New(Config{})
+		srcNode, err := p.AddSource("source", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrapNode, err := p.AddTransform("wrap", srcNode, Wrap(func(cam camera.Camera) (camera.Camera, error) {
+			wrapper.Camera = cam
+			return wrapper, nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var locker sync.Mutex
+		var passedThrough []bool
+		if _, err := p.AddSink("sink", wrapNode, WriteFunc(func(ctx context.Context, frame *Frame) error {
+			_, isOriginal := frame.Img.(*ximage.NV12)
+			locker.Lock()
+			defer locker.Unlock()
+			passedThrough = append(passedThrough, isOriginal && frame.release != nil)
+			return nil
+		})); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Start(); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the frames", func() bool {
+			return stageStats(p, "sink").Frames == 5
+		})
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !wrapper.closed {
+			t.Errorf("replace=%v: expected the wrapper to be closed", replace)
+		}
+		if wrapper.own != wrapper.released {
+			t.Errorf("replace=%v: the wrapper returned %d frames, but %d were released", replace, wrapper.own, wrapper.released)
+		}
+		if replace && wrapper.own != 5 {
+			t.Errorf("expected the frames of the wrapper, got %d", wrapper.own)
+		}
+		src.checkReleased(t)
+	}
+}
+
+func TestConfiguration(t *testing.T) {
+	p := New(Config{})
+	src, err := p.AddSource("source", &testSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddSource("source", &testSource{}); err == nil {
+		t.Errorf("expected an error on a duplicate stage")
+	}
+	sink, err := p.AddSink("sink", src, WriteFunc(func(context.Context, *Frame) error {
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddTransform("transform", sink, Convert(camera.PixelFormatYUYV)); err == nil {
+		t.Errorf("expected an error on connecting to a sink")
+	}
+	if _, err := p.AddTransform("convert", src, Convert(camera.PixelFormatMJPEG)); !errors.Is(err, camera.ErrNotSupported) {
+		t.Errorf("expected the conversion to MJPEG to be not supported, got %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, err := p.AddSink("other", src, WriteFunc(nil)); err == nil {
+		t.Errorf("expected an error on adding a stage to a running pipeline")
+	}
+}
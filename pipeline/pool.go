@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+// Pool recycles the images of a raw format, so that the stages do
+// not allocate an image per frame.
+type Pool struct {
+	Format camera.Format
+
+	pool      sync.Pool
+	allocated atomic.Uint64
+}
+
+// NewPool returns a pool of the images of the format; the pixel format
+// should be NV12 or YUYV.
+func NewPool(format camera.Format) (*Pool, error) {
+	switch format.PixelFormat {
+	case camera.PixelFormatNV12, camera.PixelFormatYUYV:
+	default:
+		return nil, fmt.Errorf("%w: pixel format %s", camera.ErrNotSupported, format.PixelFormat)
+	}
+	if format.Width == 0 || format.Height == 0 || format.Width%2 != 0 || format.Height%2 != 0 {
+		return nil, fmt.Errorf("the resolution %dx%d is not positive and even", format.Width, format.Height)
+	}
+	return &Pool{
+		Format: format,
+	}, nil
+}
+
+// Get returns an image of the format (with arbitrary content).
+func (p *Pool) Get() image.Image {
+	if img, ok := p.pool.Get().(image.Image); ok {
+		return img
+	}
+	p.allocated.Add(1)
+	r := image.Rect(0, 0, int(p.Format.Width), int(p.Format.Height))
+	if p.Format.PixelFormat == camera.PixelFormatYUYV {
+		return ximage.NewYUYV(r)
+	}
+	return ximage.NewNV12(r)
+}
+
+// Put returns the image into the pool.
+func (p *Pool) Put(img image.Image) {
+	p.pool.Put(img)
+}
+
+// Allocated returns the amount of images allocated by the pool.
+func (p *Pool) Allocated() uint64 {
+	return p.allocated.Load()
+}
+
+// NewFrame returns a frame derived from src with an image of the pool;
+// the image is returned into the pool when the frame is released.
+func (p *Pool) NewFrame(src *Frame) *Frame {
+	img := p.Get()
+	return src.Derive(img, func() { p.Put(img) })
+}
@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+// Transform makes the output frames of a stage from its input frames.
+//
+// If it implements io.Closer, then it is closed on Pipeline.Close.
+type Transform interface {
+	// Init is called once when the transform is added to a pipeline
+	// with the format of the input frames; it returns the format
+	// of the output frames.
+	Init(input camera.Format) (camera.Format, error)
+
+	// Process returns the frame made of the input one (or the input
+	// one retained), or nil to drop the frame; the input frame is
+	// released after the call.
+	Process(ctx context.Context, frame *Frame) (*Frame, error)
+}
+
+// Sink consumes the frames at the end of a branch.
+//
+// If it implements io.Closer, then it is closed on Pipeline.Close.
+type Sink interface {
+	// Init is called once when the sink is added to a pipeline with
+	// the format of the input frames; the format may be rejected.
+	Init(input camera.Format) error
+
+	// WriteFrame consumes the frame; the frame is released after the
+	// call (it should be retained to be kept).
+	WriteFrame(ctx context.Context, frame *Frame) error
+}
+
+// ProcessFunc is a Transform keeping the format; e.g. an analytics
+// stage may inspect the frame and return it retained.
+type ProcessFunc func(ctx context.Context, frame *Frame) (*Frame, error)
+
+var _ Transform = ProcessFunc(nil)
+
+func (fn ProcessFunc) Init(input camera.Format) (camera.Format, error) {
+	return input, nil
+}
+
+func (fn ProcessFunc) Process(ctx context.Context, frame *Frame) (*Frame, error) {
+	return fn(ctx, frame)
+}
+
+// WriteFunc is a Sink accepting any format.
+type WriteFunc func(ctx context.Context, frame *Frame) error
+
+var _ Sink = WriteFunc(nil)
+
+func (fn WriteFunc) Init(camera.Format) error {
+	return nil
+}
+
+func (fn WriteFunc) WriteFrame(ctx context.Context, frame *Frame) error {
+	return fn(ctx, frame)
+}
+
+type cameraSink struct {
+	camera.CameraSink
+}
+
+// CameraSink adapts a camera.CameraSink (which converts the frames
+// to its format itself).
+func CameraSink(sink camera.CameraSink) Sink {
+	return cameraSink{CameraSink: sink}
+}
+
+func (s cameraSink) Init(camera.Format) error {
+	return nil
+}
+
+func (s cameraSink) WriteFrame(_ context.Context, frame *Frame) error {
+	return s.CameraSink.WriteFrame(frame)
+}
+
+type convert struct {
+	pixFmt camera.PixelFormat
+	format camera.Format
+	pool   *Pool
+	buf    []byte
+}
+
+// Convert returns a transform converting the frames to the raw pixel
+// format (NV12 or YUYV) without scaling.
+func Convert(pixFmt camera.PixelFormat) Transform {
+	return &convert{pixFmt: pixFmt}
+}
+
+func (c *convert) Init(input camera.Format) (camera.Format, error) {
+	c.format = input
+	c.format.PixelFormat = c.pixFmt
+	pool, err := NewPool(c.format)
+	if err != nil {
+		return camera.Format{}, fmt.Errorf("unable to convert to %s: %w", c.pixFmt, err)
+	}
+	c.pool = pool
+	return c.format, nil
+}
+
+func (c *convert) Process(_ context.Context, frame *Frame) (*Frame, error) {
+	switch frame.Img.(type) {
+	case *ximage.NV12:
+		if c.pixFmt == camera.PixelFormatNV12 {
+			return frame.Retain(), nil
+		}
+	case *ximage.YUYV:
+		if c.pixFmt == camera.PixelFormatYUYV {
+			return frame.Retain(), nil
+		}
+	}
+
+	var err error
+	c.buf, err = rawimage.AppendBytes(c.buf[:0], &c.format, frame.Img)
+	if err != nil {
+		return nil, err
+	}
+	result := c.pool.NewFrame(frame)
+	switch img := result.Img.(type) {
+	case *ximage.NV12:
+		n := copy(img.Y, c.buf)
+		copy(img.CbCrBytes(), c.buf[n:])
+	case *ximage.YUYV:
+		copy(img.Y0CbY1CrBytes(), c.buf)
+	}
+	return result, nil
+}
+
+type wrap struct {
+	newWrapper func(camera.Camera) (camera.Camera, error)
+	feed       *feedCamera
+	wrapper    camera.Camera
+}
+
+// Wrap adapts a wrapper of camera.Camera (like ptz.NewCamera) into
+// a transform: the wrapper gets a camera returning the input frames
+// of the stage, and its frames are the output frames.
+func Wrap(newWrapper func(camera.Camera) (camera.Camera, error)) Transform {
+	return &wrap{newWrapper: newWrapper}
+}
+
+func (w *wrap) Init(input camera.Format) (camera.Format, error) {
+	w.feed = &feedCamera{format: input}
+	wrapper, err := w.newWrapper(w.feed)
+	if err != nil {
+		return camera.Format{}, err
+	}
+	w.wrapper = wrapper
+	return wrapper.GetFormat(), nil
+}
+
+func (w *wrap) Process(ctx context.Context, frame *Frame) (*Frame, error) {
+	w.feed.frame = frame.Retain()
+	defer func() {
+		// the wrapper could have skipped the frame with an error
+		if w.feed.frame != nil {
+			w.feed.frame.Release()
+			w.feed.frame = nil
+		}
+	}()
+	wrapped, err := w.wrapper.GetFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := wrapped.(*Frame); ok && f == frame {
+		// the wrapper passed the frame through
+		return f, nil
+	}
+	return frame.Derive(wrapped.Image(), func() {
+		// the wrappers fail to release only the frames of the other cameras
+		_ = w.wrapper.ReleaseFrame(wrapped)
+	}), nil
+}
+
+func (w *wrap) Close() error {
+	if w.wrapper == nil {
+		return nil
+	}
+	return w.wrapper.Close()
+}
+
+// feedCamera returns the current input frame of a Wrap transform.
+type feedCamera struct {
+	format camera.Format
+	frame  *Frame
+}
+
+var _ camera.Camera = (*feedCamera)(nil)
+
+func (c *feedCamera) GetFrame(context.Context) (camera.Frame, error) {
+	if c.frame == nil {
+		return nil, camera.ErrNoFrame
+	}
+	frame := c.frame
+	c.frame = nil
+	return frame, nil
+}
+
+func (c *feedCamera) ReleaseFrame(frame camera.Frame) error {
+	f, ok := frame.(*Frame)
+	if !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	f.Release()
+	return nil
+}
+
+func (c *feedCamera) GetFormat() camera.Format {
+	return c.format
+}
+
+func (c *feedCamera) StartStreaming() error { return nil }
+func (c *feedCamera) StopStreaming() error  { return nil }
+func (c *feedCamera) Close() error          { return nil }
@@ -25,3 +25,34 @@ type Platform interface {
 func ListCameras() ([]DevicePathAndPlatform, error) {
 	return DefaultRegistry().ListCameras()
 }
+
+// DeviceIdentifier may be implemented by a Platform to report an identity
+// of a device, so that the same device listed by multiple platforms
+// (or under different paths) could be recognized as one.
+type DeviceIdentifier interface {
+	DeviceIdentity(DevicePath) (string, error)
+}
+
+func deviceIdentity(plat Platform, devicePath DevicePath) string {
+	identifier, ok := plat.(DeviceIdentifier)
+	if !ok {
+		return devicePath
+	}
+	id, err := identifier.DeviceIdentity(devicePath)
+	if err != nil {
+		return devicePath
+	}
+	return id
+}
+
+// DeviceDescriptor is a human-readable description of a device.
+type DeviceDescriptor struct {
+	Name    string
+	Driver  string
+	BusInfo string
+}
+
+// DeviceDescriber may be implemented by a Platform to describe a device.
+type DeviceDescriber interface {
+	DescribeDevice(DevicePath) (DeviceDescriptor, error)
+}
@@ -0,0 +1,265 @@
+package camerad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/camerad"
+	"github.com/xaionaro-go/camera/rawimage"
+	"golang.org/x/sys/unix"
+)
+
+// frameQueueSize is more than the daemon lets a client hold, so
+// the queue never blocks the reception of the replies.
+const frameQueueSize = 64
+
+// Camera is a subscription to a camera of the daemon; the frames
+// are *Frame, and they must be released before Close.
+type Camera struct {
+	conn   *camerad.Conn
+	format camera.Format
+
+	requestLocker sync.Mutex
+	replies       chan *camerad.Message
+	frames        chan *Frame
+	streaming     atomic.Bool
+
+	// failure is set before failedCh is closed
+	failure    error
+	failedCh   chan struct{}
+	readerDone chan struct{}
+	closing    chan struct{}
+	closeOnce  sync.Once
+	closeErr   error
+
+	slotsLocker sync.Mutex
+	slots       map[uint64][]byte
+}
+
+var _ camera.Camera = (*Camera)(nil)
+var _ camera.Controls = (*Camera)(nil)
+
+func newCamera(conn *camerad.Conn, format camera.Format) *Camera {
+	c := &Camera{
+		conn:       conn,
+		format:     format,
+		replies:    make(chan *camerad.Message, 1),
+		frames:     make(chan *Frame, frameQueueSize),
+		failedCh:   make(chan struct{}),
+		readerDone: make(chan struct{}),
+		closing:    make(chan struct{}),
+		slots:      map[uint64][]byte{},
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *Camera) fail(err error) {
+	c.failure = err
+	close(c.failedCh)
+}
+
+func (c *Camera) readLoop() {
+	defer close(c.readerDone)
+	for {
+		msg, fd, err := c.conn.Receive()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				err = fmt.Errorf("disconnected from the daemon: %w", camera.ErrDeviceGone)
+			}
+			c.fail(err)
+			return
+		}
+		switch msg.Type {
+		case camerad.MessageTypeReply:
+			c.replies <- msg
+		case camerad.MessageTypeFrame:
+			// the memfd is owned by newFrame
+			frame, err := c.newFrame(msg.Frame, fd)
+			fd = -1
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			select {
+			case c.frames <- frame:
+			case <-c.closing:
+				c.fail(net.ErrClosed)
+				return
+			}
+		case camerad.MessageTypeFailure:
+			c.fail(fmt.Errorf("%w: %w", camera.ErrDeviceGone, msg.Error.Err()))
+			return
+		}
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+	}
+}
+
+// newFrame maps the memory of the slot if it is a new one (then fd
+// is its memfd, which is closed after mapping).
+func (c *Camera) newFrame(info *camerad.FrameInfo, fd int) (*Frame, error) {
+	if info == nil {
+		return nil, fmt.Errorf("a frame message without the frame")
+	}
+	c.slotsLocker.Lock()
+	defer c.slotsLocker.Unlock()
+	mem, ok := c.slots[info.Slot]
+	if !ok {
+		if fd < 0 {
+			return nil, fmt.Errorf("no memory received for slot %d", info.Slot)
+		}
+		var err error
+		mem, err = unix.Mmap(fd, 0, info.Size, unix.PROT_READ, unix.MAP_SHARED)
+		unix.Close(fd)
+		if err != nil {
+			return nil, fmt.Errorf("unable to map slot %d: %w", info.Slot, err)
+		}
+		c.slots[info.Slot] = mem
+	} else if fd >= 0 {
+		unix.Close(fd)
+	}
+
+	img, err := rawimage.NewRawImage(&c.format, mem)
+	if err != nil {
+		return nil, fmt.Errorf("unable to interpret slot %d: %w", info.Slot, err)
+	}
+	return &Frame{
+		Slot:      info.Slot,
+		Frame:     img,
+		Seq:       info.Seq,
+		Skipped:   info.Skipped,
+		CaptureTS: info.CaptureTS,
+	}, nil
+}
+
+func (c *Camera) request(req *camerad.Message) (*camerad.Message, error) {
+	c.requestLocker.Lock()
+	defer c.requestLocker.Unlock()
+	if err := c.conn.Send(req, -1); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-c.replies:
+		return reply, reply.Error.Err()
+	case <-c.failedCh:
+		return nil, c.failure
+	}
+}
+
+func (c *Camera) GetFormat() camera.Format {
+	return c.format
+}
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	if !c.streaming.Load() {
+		return nil, fmt.Errorf("the camera is not streaming: %w", camera.ErrNoFrame)
+	}
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.failedCh:
+		return nil, c.failure
+	}
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	f, ok := frame.(*Frame)
+	if !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	return c.conn.Send(&camerad.Message{
+		Type:  camerad.MessageTypeRelease,
+		Frame: &camerad.FrameInfo{Slot: f.Slot},
+	}, -1)
+}
+
+// releaseQueued releases the frames received, but not taken by GetFrame.
+func (c *Camera) releaseQueued() error {
+	for {
+		select {
+		case frame := <-c.frames:
+			if err := c.ReleaseFrame(frame); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Camera) StartStreaming() error {
+	// the frames sent after the previous stop are stale
+	if err := c.releaseQueued(); err != nil {
+		return err
+	}
+	if _, err := c.request(&camerad.Message{Type: camerad.MessageTypeStart}); err != nil {
+		return err
+	}
+	c.streaming.Store(true)
+	return nil
+}
+
+func (c *Camera) StopStreaming() error {
+	c.streaming.Store(false)
+	if _, err := c.request(&camerad.Message{Type: camerad.MessageTypeStop}); err != nil {
+		return err
+	}
+	return c.releaseQueued()
+}
+
+func (c *Camera) ListControls() ([]camera.Control, error) {
+	reply, err := c.request(&camerad.Message{Type: camerad.MessageTypeListControls})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Controls, nil
+}
+
+func (c *Camera) GetControl(id camera.ControlID) (int32, error) {
+	reply, err := c.request(&camerad.Message{
+		Type:      camerad.MessageTypeGetControl,
+		ControlID: id,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.ControlValue, nil
+}
+
+func (c *Camera) SetControl(id camera.ControlID, value int32) error {
+	_, err := c.request(&camerad.Message{
+		Type:         camerad.MessageTypeSetControl,
+		ControlID:    id,
+		ControlValue: value,
+	})
+	return err
+}
+
+// Close unsubscribes from the camera (the daemon releases the frames
+// held by this client) and unmaps the memory of the frames.
+func (c *Camera) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		err := c.conn.Close()
+		<-c.readerDone
+		c.slotsLocker.Lock()
+		defer c.slotsLocker.Unlock()
+		for id, mem := range c.slots {
+			if unmapErr := unix.Munmap(mem); unmapErr != nil && err == nil {
+				err = unmapErr
+			}
+			delete(c.slots, id)
+		}
+		c.closeErr = err
+	})
+	return c.closeErr
+}
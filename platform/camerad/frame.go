@@ -0,0 +1,39 @@
+package camerad
+
+import (
+	"image"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// Frame is an image in the memory shared with the daemon; the memory
+// is reused by the daemon once the frame is released.
+type Frame struct {
+	Slot      uint64
+	Frame     image.Image
+	Seq       uint64
+	Skipped   uint64
+	CaptureTS time.Time
+}
+
+var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
+var _ camera.FrameTimestamper = (*Frame)(nil)
+var _ camera.FrameSequencer = (*Frame)(nil)
+
+func (f *Frame) Image() image.Image {
+	return f.Frame
+}
+
+func (f *Frame) SkippedFrames() uint64 {
+	return f.Skipped
+}
+
+func (f *Frame) Timestamp() time.Time {
+	return f.CaptureTS
+}
+
+func (f *Frame) Sequence() uint64 {
+	return f.Seq
+}
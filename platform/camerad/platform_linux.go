@@ -0,0 +1,178 @@
+// Package camerad implements a camera.Platform of the cameras shared
+// by the daemon (see package camerad and cmd/camerad), so that the code
+// using the registry transparently talks to the daemon when it runs,
+// and many processes can stream the same device at once.
+package camerad
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/camerad"
+)
+
+type Platform struct {
+	// SocketPath is the socket of the daemon;
+	// camerad.DefaultSocketPath() is used if empty.
+	SocketPath string
+}
+
+var _ camera.Platform = Platform{}
+var _ camera.DeviceIdentifier = Platform{}
+var _ camera.DeviceDescriber = Platform{}
+
+func NewPlatform(socketPath string) Platform {
+	return Platform{
+		SocketPath: socketPath,
+	}
+}
+
+func (p Platform) socketPath() string {
+	if p.SocketPath != "" {
+		return p.SocketPath
+	}
+	return camerad.DefaultSocketPath()
+}
+
+func (p Platform) dial() (*camerad.Conn, error) {
+	return camerad.Dial(p.socketPath())
+}
+
+// isNotRunning returns true if the error of dial means
+// there is no daemon listening.
+func isNotRunning(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// query sends a one-shot request on a new connection.
+func (p Platform) query(req *camerad.Message) (*camerad.Message, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return request(conn, req)
+}
+
+func request(conn *camerad.Conn, req *camerad.Message) (*camerad.Message, error) {
+	if err := conn.Send(req, -1); err != nil {
+		return nil, err
+	}
+	reply, fd, err := conn.Receive()
+	if fd >= 0 {
+		syscall.Close(fd)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to receive the reply: %w", err)
+	}
+	return reply, reply.Error.Err()
+}
+
+func (p Platform) listDevices() ([]camerad.Device, error) {
+	reply, err := p.query(&camerad.Message{Type: camerad.MessageTypeListCameras})
+	if reply == nil {
+		return nil, err
+	}
+	return reply.Devices, err
+}
+
+func (p Platform) findDevice(devicePath camera.DevicePath) (camerad.Device, error) {
+	devices, err := p.listDevices()
+	for _, dev := range devices {
+		if dev.DevicePath == devicePath {
+			return dev, nil
+		}
+	}
+	if err != nil {
+		return camerad.Device{}, err
+	}
+	return camerad.Device{}, fmt.Errorf("the daemon has no camera '%s': %w", devicePath, camera.ErrNotFound)
+}
+
+// ListCameras returns the cameras available via the daemon;
+// if the daemon is not running, then there are none.
+func (p Platform) ListCameras() ([]camera.DevicePath, error) {
+	devices, err := p.listDevices()
+	if err != nil && isNotRunning(err) {
+		return nil, nil
+	}
+	result := make([]camera.DevicePath, 0, len(devices))
+	for _, dev := range devices {
+		result = append(result, dev.DevicePath)
+	}
+	return result, err
+}
+
+// DeviceIdentity implements camera.DeviceIdentifier; the identity is
+// the one reported by the platform of the daemon, so that the device is
+// not listed twice (via the daemon and directly).
+func (p Platform) DeviceIdentity(devicePath camera.DevicePath) (string, error) {
+	dev, err := p.findDevice(devicePath)
+	if err != nil {
+		return "", err
+	}
+	if dev.Identity == "" {
+		return devicePath, nil
+	}
+	return dev.Identity, nil
+}
+
+// DescribeDevice implements camera.DeviceDescriber.
+func (p Platform) DescribeDevice(devicePath camera.DevicePath) (camera.DeviceDescriptor, error) {
+	dev, err := p.findDevice(devicePath)
+	if err != nil {
+		return camera.DeviceDescriptor{}, err
+	}
+	return dev.Descriptor, nil
+}
+
+// ListFormats returns the formats of the frames as delivered by the daemon
+// (only NV12 and YUYV, the others are converted by the daemon).
+func (p Platform) ListFormats(devicePath camera.DevicePath) (camera.Formats, error) {
+	reply, err := p.query(&camerad.Message{
+		Type:       camerad.MessageTypeListFormats,
+		DevicePath: devicePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Formats, nil
+}
+
+// OpenCamera subscribes to the camera; if it is already opened by the
+// daemon for other clients, then the format should be the same (or zero
+// to accept any), otherwise camera.ErrDeviceBusy is returned.
+func (p Platform) OpenCamera(
+	devicePath camera.DevicePath,
+	format camera.Format,
+) (_ camera.Camera, _err error) {
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _err != nil {
+			conn.Close()
+		}
+	}()
+	reply, err := request(conn, &camerad.Message{
+		Type:       camerad.MessageTypeOpen,
+		DevicePath: devicePath,
+		Format:     format,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open camera '%s': %w", devicePath, err)
+	}
+	return newCamera(conn, reply.Format), nil
+}
+
+func (Platform) OpenCameraCompressed(
+	devicePath camera.DevicePath,
+	format camera.Format,
+	compression camera.Compression,
+	compressionQuality camera.CompressionQuality,
+) (camera.CameraCompressed, error) {
+	return nil, fmt.Errorf("the daemon shares only raw frames: %w", camera.ErrNotSupported)
+}
@@ -0,0 +1,217 @@
+package camerad
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/camerad"
+	"github.com/xaionaro-go/camera/platform/synthetic"
+)
+
+const testMaxInFlight = 2
+
+var testFormat = camera.Format{
+	Width:       64,
+	Height:      48,
+	PixelFormat: camera.PixelFormatNV12,
+	FPS:         camera.Fraction{Numerator: 30, Denominator: 1},
+}
+
+// testPlatform is the synthetic platform with the cameras failing
+// on demand (like an unplugged device).
+type testPlatform struct {
+	*synthetic.Platform
+	opens atomic.Int32
+	fail  atomic.Bool
+}
+
+func (p *testPlatform) OpenCamera(devicePath camera.DevicePath, format camera.Format) (camera.Camera, error) {
+	cam, err := p.Platform.OpenCamera(devicePath, format)
+	if err != nil {
+		return nil, err
+	}
+	p.opens.Add(1)
+	return &testCamera{Camera: cam, platform: p}, nil
+}
+
+type testCamera struct {
+	camera.Camera
+	platform *testPlatform
+}
+
+func (c *testCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	if c.platform.fail.CompareAndSwap(true, false) {
+		return nil, errors.New("the device is unplugged")
+	}
+	return c.Camera.GetFrame(ctx)
+}
+
+// startServer runs the daemon on a socket in a temporary directory
+// and returns the path of the socket.
+func startServer(t *testing.T, plat *testPlatform) string {
+	t.Helper()
+	registry := camera.NewRegistry()
+	registry.RegisterPlatformWithPriority("test", plat, 0)
+	srv := camerad.New(camerad.Config{
+		Registry:    registry,
+		MaxInFlight: testMaxInFlight,
+		OnError: func(err error) {
+			t.Logf("server: %v", err)
+		},
+	})
+
+	socketPath := filepath.Join(t.TempDir(), camerad.DefaultSocketName)
+	l, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: socketPath, Net: "unixpacket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ctx, l)
+	}()
+	t.Cleanup(func() {
+		cancelFn()
+		<-errCh
+	})
+	return socketPath
+}
+
+// testClient receives the frames and checks that the sequence numbers
+// agree with the reported amounts of the skipped frames.
+type testClient struct {
+	t      *testing.T
+	name   string
+	cam    camera.Camera
+	frames int
+	seq    uint64
+	slots  map[uint64]struct{}
+}
+
+func openClient(t *testing.T, p Platform, name string) *testClient {
+	t.Helper()
+	cam, err := p.OpenCamera(synthetic.DevicePath(0), testFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cam.Close()
+	})
+	if err := cam.StartStreaming(); err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{t: t, name: name, cam: cam, slots: map[uint64]struct{}{}}
+}
+
+func (c *testClient) getFrame() *Frame {
+	c.t.Helper()
+	ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	frame, err := c.cam.GetFrame(ctx)
+	if err != nil {
+		c.t.Fatalf("%s: %v", c.name, err)
+	}
+	f := frame.(*Frame)
+	if size := f.Image().Bounds().Size(); size.X != 64 || size.Y != 48 {
+		c.t.Errorf("%s: unexpected size of the frame: %v", c.name, size)
+	}
+	if c.frames > 0 && f.Seq != c.seq+1+f.Skipped {
+		c.t.Errorf("%s: the frame %d with %d skipped ones follows the frame %d", c.name, f.Seq, f.Skipped, c.seq)
+	}
+	c.frames++
+	c.seq = f.Seq
+	c.slots[f.Slot] = struct{}{}
+	return f
+}
+
+func (c *testClient) release(f *Frame) {
+	c.t.Helper()
+	if err := c.cam.ReleaseFrame(f); err != nil {
+		c.t.Fatalf("%s: %v", c.name, err)
+	}
+}
+
+// waitFailure releases the queued frames until the failure is reported.
+func (c *testClient) waitFailure() error {
+	c.t.Helper()
+	ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	for {
+		frame, err := c.cam.GetFrame(ctx)
+		if err != nil {
+			return err
+		}
+		c.release(frame.(*Frame))
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	plat := &testPlatform{
+		Platform: synthetic.NewPlatform(synthetic.Config{
+			Formats: camera.Formats{testFormat},
+		}),
+	}
+	p := NewPlatform(startServer(t, plat))
+
+	cameras, err := p.ListCameras()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cameras) != 1 || cameras[0] != synthetic.DevicePath(0) {
+		t.Fatalf("expected the cameras [%s], got %v", synthetic.DevicePath(0), cameras)
+	}
+	if _, err := p.DescribeDevice(synthetic.DevicePath(1)); !errors.Is(err, camera.ErrNotFound) {
+		t.Errorf("expected camera.ErrNotFound, got %v", err)
+	}
+
+	fast := openClient(t, p, "fast")
+	slow := openClient(t, p, "slow")
+	if opens := plat.opens.Load(); opens != 1 {
+		t.Fatalf("expected the camera to be opened once, got %d", opens)
+	}
+
+	// the slow client holds as many frames as it may,
+	// which does not stop the frames of the fast one
+	var held []*Frame
+	for len(held) < testMaxInFlight {
+		held = append(held, slow.getFrame())
+	}
+	for idx := 0; idx < 10; idx++ {
+		fast.release(fast.getFrame())
+	}
+	for _, f := range held {
+		slow.release(f)
+	}
+	f := slow.getFrame()
+	if f.Skipped == 0 {
+		t.Errorf("expected the frames to be skipped for the slow client")
+	}
+	slow.release(f)
+	// the released slots are reused: at most the frames held by both
+	// clients and the one being written are allocated
+	if len(fast.slots) > 2*testMaxInFlight+1 {
+		t.Errorf("expected the slots to be reused, got %d slots", len(fast.slots))
+	}
+
+	plat.fail.Store(true)
+	for _, c := range []*testClient{fast, slow} {
+		if err := c.waitFailure(); !errors.Is(err, camera.ErrDeviceGone) {
+			t.Errorf("%s: expected camera.ErrDeviceGone, got %v", c.name, err)
+		}
+	}
+
+	// the failed camera is forgotten, so the next client reopens it
+	reopened := openClient(t, p, "reopened")
+	for idx := 0; idx < 3; idx++ {
+		reopened.release(reopened.getFrame())
+	}
+	if opens := plat.opens.Load(); opens != 2 {
+		t.Errorf("expected the camera to be reopened, got %d opens", opens)
+	}
+}
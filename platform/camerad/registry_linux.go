@@ -0,0 +1,17 @@
+package camerad
+
+import (
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	PlatformID = camera.PlatformID("camerad")
+
+	// Priority is higher than of v4l2, so that the devices shared by
+	// the daemon are opened via it (since the daemon keeps them busy).
+	Priority = 200
+)
+
+func init() {
+	camera.DefaultRegistry().RegisterPlatformWithPriority(PlatformID, Platform{}, Priority)
+}
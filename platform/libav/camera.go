@@ -3,19 +3,27 @@ package libav
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/asticode/go-astiav"
 	"github.com/asticode/go-astikit"
 	"github.com/xaionaro-go/camera"
 )
 
+// maxDrainedPackets limits the amount of the packets read at once in
+// the latest-frame-only mode; libav does not tell how many packets are
+// queued, so it is about the amount of the buffers of a capture device.
+const maxDrainedPackets = 32
+
 type Camera struct {
 	*astikit.Closer
-	Input  *Input
-	Format camera.Format
+	Input           *Input
+	Format          camera.Format
+	LatestFrameOnly bool
 }
 
 var _ camera.Camera = (*Camera)(nil)
+var _ camera.LatestFrameOnlySetter = (*Camera)(nil)
 
 func (c *Camera) StartStreaming() error {
 	return nil
@@ -29,27 +37,94 @@ func (c *Camera) GetFormat() camera.Format {
 	return c.Format
 }
 
+func (c *Camera) SetLatestFrameOnly(v bool) {
+	c.LatestFrameOnly = v
+}
+
 func (c *Camera) GetFrame(
 	ctx context.Context,
 ) (camera.Frame, error) {
+	startTS := time.Now()
+	packet, err := c.readPacket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var skipped uint64
+	if c.LatestFrameOnly && !c.isFresh(time.Since(startTS)) {
+		packet, skipped, err = c.readLatestPacket(ctx, packet)
+		if err != nil {
+			return nil, fmt.Errorf("unable to drain the queue of frames: %w", err)
+		}
+	}
+
+	return &Frame{
+		Packet:  packet,
+		Camera:  c,
+		Skipped: skipped,
+	}, nil
+}
+
+func (c *Camera) readPacket(
+	ctx context.Context,
+) (_ *astiav.Packet, _err error) {
 	packet := astiav.AllocPacket()
-	for tryCount := 0; tryCount < 10*int(c.Format.FPS.Float64()); tryCount++ {
+	defer func() {
+		if _err != nil {
+			packet.Free()
+		}
+	}()
+	for {
+		if err := camera.ContextErr(ctx); err != nil {
+			return nil, err
+		}
 		err := c.Input.FormatContext.ReadFrame(packet)
 		if err != nil {
-			return nil, fmt.Errorf("unable to read a frame: %w", err)
+			return nil, fmt.Errorf("unable to read a frame: %w", wrapAVError(err))
 		}
 		if len(packet.Data()) != 0 {
-			break
+			return packet, nil
 		}
+		packet.Unref()
 	}
-	if len(packet.Data()) == 0 {
-		return nil, fmt.Errorf("the packet is empty")
+}
+
+// isFresh returns true if reading a packet took that long that it was
+// apparently waiting for the device to capture a new frame, instead of
+// just taking an already queued one.
+func (c *Camera) isFresh(readDuration time.Duration) bool {
+	fps := c.Format.FPS.Float64()
+	if fps <= 0 {
+		return true
 	}
+	return readDuration >= time.Duration(float64(time.Second)/fps/2)
+}
 
-	return &Frame{
-		Packet: packet,
-		Camera: c,
-	}, nil
+// readLatestPacket reads packets until it meets one that was not queued
+// yet, because libav does not provide a way to find out how many
+// packets are queued.
+func (c *Camera) readLatestPacket(
+	ctx context.Context,
+	latest *astiav.Packet,
+) (*astiav.Packet, uint64, error) {
+	var skipped uint64
+	// the amount of iterations is limited to make sure we won't chase
+	// a source that is faster than us forever
+	for range maxDrainedPackets {
+		startTS := time.Now()
+		packet, err := c.readPacket(ctx)
+		if err != nil {
+			latest.Free()
+			return nil, skipped, err
+		}
+		latest.Free()
+		latest = packet
+		skipped++
+		if c.isFresh(time.Since(startTS)) {
+			return latest, skipped, nil
+		}
+	}
+	return latest, skipped, nil
 }
 
 func (c *Camera) ReleaseFrame(frame camera.Frame) error {
@@ -0,0 +1,93 @@
+package libav
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/asticode/go-astiav"
+	"github.com/asticode/go-astikit"
+	"github.com/xaionaro-go/camera"
+)
+
+// Decoder decodes the packets of a compressed stream (like H.264
+// received from a network camera) into images.
+type Decoder struct {
+	*astikit.Closer
+	CodecContext *astiav.CodecContext
+
+	frame *astiav.Frame
+}
+
+func NewDecoder(stream *astiav.Stream) (_ *Decoder, _err error) {
+	d := &Decoder{
+		Closer: astikit.NewCloser(),
+	}
+	defer func() {
+		if _err != nil {
+			d.Closer.Close()
+		}
+	}()
+
+	codecID := stream.CodecParameters().CodecID()
+	codec := astiav.FindDecoder(codecID)
+	if codec == nil {
+		return nil, fmt.Errorf("decoder for codec '%s' not found: %w", codecID, camera.ErrNotSupported)
+	}
+
+	d.CodecContext = astiav.AllocCodecContext(codec)
+	if d.CodecContext == nil {
+		return nil, fmt.Errorf("unable to allocate a codec context")
+	}
+	d.Closer.Add(d.CodecContext.Free)
+
+	if err := stream.CodecParameters().ToCodecContext(d.CodecContext); err != nil {
+		return nil, fmt.Errorf("unable to copy the codec parameters: %w", err)
+	}
+	if err := d.CodecContext.Open(codec, nil); err != nil {
+		return nil, fmt.Errorf("unable to open the decoder: %w", wrapAVError(err))
+	}
+
+	d.frame = astiav.AllocFrame()
+	d.Closer.Add(d.frame.Free)
+	return d, nil
+}
+
+// Decode passes the packet to the decoder and returns all the images
+// it is able to decode so far (they do not refer to the memory of libav).
+//
+// An error wrapping camera.ErrNoFrame is returned if the decoder
+// needs more packets to produce an image.
+func (d *Decoder) Decode(packet *astiav.Packet) ([]image.Image, error) {
+	if err := d.CodecContext.SendPacket(packet); err != nil {
+		return nil, fmt.Errorf("unable to send a packet to the decoder: %w", wrapAVError(err))
+	}
+
+	var result []image.Image
+	for {
+		img, err := d.receiveImage()
+		if errors.Is(err, camera.ErrNoFrame) && len(result) > 0 {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, img)
+	}
+}
+
+func (d *Decoder) receiveImage() (image.Image, error) {
+	if err := d.CodecContext.ReceiveFrame(d.frame); err != nil {
+		return nil, fmt.Errorf("unable to receive a frame from the decoder: %w", wrapAVError(err))
+	}
+	defer d.frame.Unref()
+
+	img, err := d.frame.Data().GuessImageFormat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert the frame into an image: %w: %w", camera.ErrNotSupported, err)
+	}
+	if err := d.frame.Data().ToImage(img); err != nil {
+		return nil, fmt.Errorf("unable to copy the frame into an image: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,252 @@
+package libav
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/asticode/go-astiav"
+	"github.com/asticode/go-astikit"
+	"github.com/xaionaro-go/camera"
+)
+
+// LowLatencyEncoderOptions are the options (per encoder) suitable for
+// real-time streaming: no frame reordering or lookahead, and the
+// H.264 profile supported by all the browsers.
+var LowLatencyEncoderOptions = map[string]map[string]string{
+	"libvpx": {
+		"deadline":      "realtime",
+		"cpu-used":      "8",
+		"lag-in-frames": "0",
+	},
+	"libx264": {
+		"preset":  "ultrafast",
+		"tune":    "zerolatency",
+		"profile": "baseline",
+	},
+}
+
+// reconfigurableBitrateEncoders are the encoders applying a new bitrate
+// of an opened codec context; the others are reopened to change it.
+var reconfigurableBitrateEncoders = map[string]struct{}{
+	"libx264": {},
+}
+
+// minReopenBitrateChange is the minimal relative change of the bitrate
+// which makes SetBitrate reopen the encoder (see reconfigurableBitrateEncoders),
+// since each reopening produces a key frame.
+const minReopenBitrateChange = 0.2
+
+// Encoder compresses images via a libav encoder (like "libvpx" for VP8
+// or "libx264" for H.264). H.264 is produced in the Annex B format
+// with the parameter sets before each key frame.
+type Encoder struct {
+	*astikit.Closer
+	CodecContext *astiav.CodecContext
+
+	codec   *astiav.Codec
+	format  camera.Format
+	options map[string]string
+	bitrate uint64
+
+	frame      *astiav.Frame
+	packet     *astiav.Packet
+	frameIndex int64
+}
+
+func NewEncoder(
+	codecName string,
+	format camera.Format,
+	bitrate uint64,
+	options map[string]string,
+) (_ *Encoder, _err error) {
+	e := &Encoder{
+		Closer:  astikit.NewCloser(),
+		format:  format,
+		options: options,
+	}
+	defer func() {
+		if _err != nil {
+			e.Closer.Close()
+		}
+	}()
+
+	e.codec = astiav.FindEncoderByName(codecName)
+	if e.codec == nil {
+		return nil, fmt.Errorf("encoder '%s' not found: %w", codecName, camera.ErrNotSupported)
+	}
+
+	e.Closer.Add(func() {
+		if e.CodecContext != nil {
+			e.CodecContext.Free()
+		}
+	})
+	if err := e.open(bitrate); err != nil {
+		return nil, err
+	}
+
+	e.frame = astiav.AllocFrame()
+	e.Closer.Add(e.frame.Free)
+	e.packet = astiav.AllocPacket()
+	e.Closer.Add(e.packet.Free)
+	return e, nil
+}
+
+// open (re)opens the codec context with the given bitrate.
+func (e *Encoder) open(bitrate uint64) error {
+	codecCtx := astiav.AllocCodecContext(e.codec)
+	if codecCtx == nil {
+		return fmt.Errorf("unable to allocate a codec context")
+	}
+
+	fps := e.format.FPS
+	if fps.Numerator == 0 || fps.Denominator == 0 {
+		fps = camera.Fraction{Numerator: 30, Denominator: 1}
+	}
+	codecCtx.SetWidth(int(e.format.Width))
+	codecCtx.SetHeight(int(e.format.Height))
+	codecCtx.SetPixelFormat(astiav.PixelFormatYuv420P)
+	codecCtx.SetTimeBase(astiav.NewRational(int(fps.Denominator), int(fps.Numerator)))
+	codecCtx.SetFramerate(astiav.NewRational(int(fps.Numerator), int(fps.Denominator)))
+	codecCtx.SetBitRate(int64(bitrate))
+	// a key frame every few seconds, so that the lost ones are recovered
+	// even if the receiver does not request a key frame
+	codecCtx.SetGopSize(int(fps.Float64() * 5))
+
+	dict := astiav.NewDictionary()
+	defer dict.Free()
+	for key, value := range e.options {
+		if err := dict.Set(key, value, 0); err != nil {
+			codecCtx.Free()
+			return fmt.Errorf("unable to set the %s in the dictionary: %w", key, err)
+		}
+	}
+	if err := codecCtx.Open(e.codec, dict); err != nil {
+		codecCtx.Free()
+		return fmt.Errorf("unable to open the encoder '%s': %w", e.codec.Name(), wrapAVError(err))
+	}
+
+	if e.CodecContext != nil {
+		e.CodecContext.Free()
+	}
+	e.CodecContext = codecCtx
+	e.bitrate = bitrate
+	return nil
+}
+
+// SetBitrate changes the target bitrate (in bits per second). The
+// encoders which do not apply it on the fly (like "libvpx") are reopened,
+// but only if the bitrate changes significantly (see minReopenBitrateChange),
+// and the next frame is a key frame then. It should not be called
+// concurrently with Encode.
+func (e *Encoder) SetBitrate(bitrate uint64) error {
+	if _, ok := reconfigurableBitrateEncoders[e.codec.Name()]; ok {
+		e.CodecContext.SetBitRate(int64(bitrate))
+		e.bitrate = bitrate
+		return nil
+	}
+	change := math.Abs(float64(bitrate)/float64(e.bitrate) - 1)
+	if e.bitrate != 0 && change < minReopenBitrateChange {
+		return nil
+	}
+	if err := e.open(bitrate); err != nil {
+		return fmt.Errorf("unable to reopen the encoder with bitrate %d: %w", bitrate, err)
+	}
+	return nil
+}
+
+// Encode compresses the image, which should have the dimensions
+// of the format given to NewEncoder.
+//
+// An error wrapping camera.ErrNoFrame is returned if the encoder
+// needs more images to produce a frame.
+func (e *Encoder) Encode(img image.Image, keyFrame bool) ([]byte, error) {
+	width, height := e.CodecContext.Width(), e.CodecContext.Height()
+	size := img.Bounds().Size()
+	if size.X != width || size.Y != height {
+		return nil, fmt.Errorf("the image is %dx%d, but the encoder is configured for %dx%d", size.X, size.Y, width, height)
+	}
+
+	// the encoder may still refer to the previous buffer, so allocating a new one
+	e.frame.Unref()
+	e.frame.SetWidth(width)
+	e.frame.SetHeight(height)
+	e.frame.SetPixelFormat(astiav.PixelFormatYuv420P)
+	if err := e.frame.AllocBuffer(0); err != nil {
+		return nil, fmt.Errorf("unable to allocate a frame buffer: %w", err)
+	}
+	e.fillFrame(img)
+	e.frame.SetPts(e.frameIndex)
+	e.frameIndex++
+	if keyFrame {
+		e.frame.SetPictureType(astiav.PictureTypeI)
+	} else {
+		e.frame.SetPictureType(astiav.PictureTypeNone)
+	}
+
+	if err := e.CodecContext.SendFrame(e.frame); err != nil {
+		return nil, fmt.Errorf("unable to send a frame to the encoder: %w", wrapAVError(err))
+	}
+
+	var result []byte
+	for {
+		err := e.CodecContext.ReceivePacket(e.packet)
+		if errors.Is(err, astiav.ErrEagain) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to receive a packet from the encoder: %w", wrapAVError(err))
+		}
+		result = append(result, e.packet.Data()...)
+		e.packet.Unref()
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("the encoder buffered the frame: %w", camera.ErrNoFrame)
+	}
+	return result, nil
+}
+
+type yCbCrImage interface {
+	YCbCrAt(x, y int) color.YCbCr
+}
+
+// fillFrame converts the image into the planar YUV 4:2:0 frame.
+func (e *Encoder) fillFrame(img image.Image) {
+	width, height := e.CodecContext.Width(), e.CodecContext.Height()
+	yPlane, yStride := framePlane(e.frame, 0, height)
+	cbPlane, cbStride := framePlane(e.frame, 1, (height+1)/2)
+	crPlane, crStride := framePlane(e.frame, 2, (height+1)/2)
+
+	if src, ok := img.(*image.YCbCr); ok && src.SubsampleRatio == image.YCbCrSubsampleRatio420 {
+		min := src.Rect.Min
+		for y := 0; y < height; y++ {
+			copy(yPlane[y*yStride:y*yStride+width], src.Y[src.YOffset(min.X, min.Y+y):])
+		}
+		for y := 0; y < (height+1)/2; y++ {
+			cOffset := src.COffset(min.X, min.Y+y*2)
+			copy(cbPlane[y*cbStride:y*cbStride+(width+1)/2], src.Cb[cOffset:])
+			copy(crPlane[y*crStride:y*crStride+(width+1)/2], src.Cr[cOffset:])
+		}
+		return
+	}
+
+	min := img.Bounds().Min
+	at := func(x, y int) color.YCbCr {
+		if src, ok := img.(yCbCrImage); ok {
+			return src.YCbCrAt(min.X+x, min.Y+y)
+		}
+		return color.YCbCrModel.Convert(img.At(min.X+x, min.Y+y)).(color.YCbCr)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := at(x, y)
+			yPlane[y*yStride+x] = c.Y
+			if x%2 == 0 && y%2 == 0 {
+				cbPlane[y/2*cbStride+x/2] = c.Cb
+				crPlane[y/2*crStride+x/2] = c.Cr
+			}
+		}
+	}
+}
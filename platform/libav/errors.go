@@ -0,0 +1,43 @@
+package libav
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/asticode/go-astiav"
+	"github.com/xaionaro-go/camera"
+)
+
+func avErrno(errno syscall.Errno) astiav.Error {
+	return astiav.Error(-int(errno))
+}
+
+// wrapAVError wraps the error with the camera error matching the libav
+// error found in the error chain.
+func wrapAVError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var avErr astiav.Error
+	if !errors.As(err, &avErr) {
+		return err
+	}
+
+	switch avErr {
+	case astiav.ErrEagain:
+		return fmt.Errorf("%w: %w", camera.ErrNoFrame, err)
+	case astiav.ErrEtimedout:
+		return fmt.Errorf("%w: %w", camera.ErrTimeout, err)
+	case avErrno(syscall.EBUSY):
+		return fmt.Errorf("%w: %w", camera.ErrDeviceBusy, err)
+	case avErrno(syscall.ENOENT):
+		return fmt.Errorf("%w: %w", camera.ErrNotFound, err)
+	case astiav.ErrEof, astiav.ErrEio, avErrno(syscall.ENODEV), avErrno(syscall.ENXIO):
+		return fmt.Errorf("%w: %w", camera.ErrDeviceGone, err)
+	case astiav.ErrDemuxerNotFound, astiav.ErrProtocolNotFound, astiav.ErrPatchwelcome, avErrno(syscall.ENOSYS):
+		return fmt.Errorf("%w: %w", camera.ErrNotSupported, err)
+	}
+	return err
+}
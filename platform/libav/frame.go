@@ -10,11 +10,13 @@ import (
 )
 
 type Frame struct {
-	Packet *astiav.Packet
-	Camera *Camera
+	Packet  *astiav.Packet
+	Camera  *Camera
+	Skipped uint64
 }
 
 var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
 
 func (f *Frame) Image() image.Image {
 	frameBytes := f.Packet.Data()
@@ -29,3 +31,23 @@ func (f *Frame) Close() error {
 	f.Packet.Free()
 	return nil
 }
+
+func (f *Frame) SkippedFrames() uint64 {
+	return f.Skipped
+}
+
+// PacketFrames are the compressed frames of a packet.
+type PacketFrames struct {
+	Packet *astiav.Packet
+}
+
+var _ camera.FramesCompressed = (*PacketFrames)(nil)
+
+func (f *PacketFrames) Bytes() []byte {
+	return f.Packet.Data()
+}
+
+func (f *PacketFrames) Close() error {
+	f.Packet.Free()
+	return nil
+}
@@ -0,0 +1,20 @@
+package libav
+
+//#cgo pkg-config: libavutil
+//#include <libavutil/frame.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/asticode/go-astiav"
+)
+
+// framePlane returns the memory of the plane of the frame (with its
+// line size), which allows filling the frame from Go; the frame
+// buffer should be allocated and writable.
+func framePlane(frame *astiav.Frame, plane int, height int) ([]byte, int) {
+	f := (*C.AVFrame)(frame.UnsafePointer())
+	lineSize := int(f.linesize[plane])
+	return unsafe.Slice((*byte)(unsafe.Pointer(f.data[plane])), lineSize*height), lineSize
+}
@@ -1,7 +1,9 @@
 package libav
 
 import (
+	"errors"
 	"fmt"
+	"syscall"
 
 	"github.com/asticode/go-astiav"
 	"github.com/asticode/go-astikit"
@@ -15,12 +17,30 @@ func init() {
 type Input struct {
 	*astikit.Closer
 	*astiav.FormatContext
+
+	// Interrupter aborts the blocking operations (like reading a frame)
+	// of the input; it should be resumed before the next operation.
+	Interrupter astiav.IOInterrupter
 }
 
 func NewInput(
 	formatString string,
 	inputString string,
 	frameFormat camera.Format,
+) (*Input, error) {
+	return NewInputWithOptions(formatString, inputString, map[string]string{
+		"video_size":   fmt.Sprintf("%dx%d", frameFormat.Width, frameFormat.Height),
+		"pixel_format": PixelFormatToLibAV(frameFormat.PixelFormat),
+		"framerate":    fmt.Sprintf("%f", frameFormat.FPS.Float64()),
+	})
+}
+
+// NewInputWithOptions opens the input passing the options to the demuxer.
+// If formatString is empty, then the format is detected by libav.
+func NewInputWithOptions(
+	formatString string,
+	inputString string,
+	options map[string]string,
 ) (_ *Input, _err error) {
 	input := &Input{
 		Closer: astikit.NewCloser(),
@@ -31,9 +51,12 @@ func NewInput(
 		}
 	}()
 
-	inputFormat := astiav.FindInputFormat(formatString)
-	if inputFormat == nil {
-		return nil, fmt.Errorf("format '%s' not found", formatString)
+	var inputFormat *astiav.InputFormat
+	if formatString != "" {
+		inputFormat = astiav.FindInputFormat(formatString)
+		if inputFormat == nil {
+			return nil, fmt.Errorf("format '%s' not found: %w", formatString, camera.ErrNotSupported)
+		}
 	}
 
 	input.FormatContext = astiav.AllocFormatContext()
@@ -42,27 +65,38 @@ func NewInput(
 		return nil, fmt.Errorf("unable to allocate a format context")
 	}
 	input.Closer.Add(input.FormatContext.Free)
+	input.Interrupter = input.FormatContext.SetInterruptCallback()
 
 	dict := astiav.NewDictionary()
 	input.Closer.Add(dict.Free)
 
-	if err := dict.Set("video_size", fmt.Sprintf("%dx%d", frameFormat.Width, frameFormat.Height), 0); err != nil {
-		return nil, fmt.Errorf("unable to set the video_size in the dictionary: %w", err)
-	}
-	if err := dict.Set("pixel_format", PixelFormatToLibAV(frameFormat.PixelFormat), 0); err != nil {
-		return nil, fmt.Errorf("unable to set the pixel_format in the dictionary: %w", err)
-	}
-	if err := dict.Set("framerate", fmt.Sprintf("%f", frameFormat.FPS.Float64()), 0); err != nil {
-		return nil, fmt.Errorf("unable to set the framerate in the dictionary: %w", err)
+	for key, value := range options {
+		if err := dict.Set(key, value, 0); err != nil {
+			return nil, fmt.Errorf("unable to set the %s in the dictionary: %w", key, err)
+		}
 	}
 
 	if err := input.FormatContext.OpenInput(inputString, inputFormat, dict); err != nil {
-		return nil, fmt.Errorf("unable to open input '%s':'%s': %w", formatString, inputString, err)
+		if errors.Is(err, avErrno(syscall.EINVAL)) {
+			// this is how the demuxers report that the device does not accept the parameters
+			err = fmt.Errorf("%w: %w", camera.ErrFormatRejected, err)
+		}
+		return nil, fmt.Errorf("unable to open input '%s':'%s': %w", formatString, inputString, wrapAVError(err))
 	}
 	input.Closer.Add(input.FormatContext.CloseInput)
 
 	if err := input.FormatContext.FindStreamInfo(nil); err != nil {
-		return nil, fmt.Errorf("unable to get stream info: %w", err)
+		return nil, fmt.Errorf("unable to get stream info: %w", wrapAVError(err))
 	}
 	return input, nil
 }
+
+// VideoStream returns the first video stream of the input.
+func (input *Input) VideoStream() (*astiav.Stream, error) {
+	for _, stream := range input.FormatContext.Streams() {
+		if stream.CodecParameters().MediaType() == astiav.MediaTypeVideo {
+			return stream, nil
+		}
+	}
+	return nil, fmt.Errorf("the input has no video streams")
+}
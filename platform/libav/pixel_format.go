@@ -3,9 +3,38 @@ package libav
 import (
 	"strings"
 
+	"github.com/asticode/go-astiav"
 	"github.com/xaionaro-go/camera"
 )
 
 func PixelFormatToLibAV(pixFmt camera.PixelFormat) string {
 	return strings.ToLower(string(pixFmt))
 }
+
+// PixelFormatFromCodecID returns the pixel format describing a compressed
+// stream of the given codec.
+func PixelFormatFromCodecID(codecID astiav.CodecID) camera.PixelFormat {
+	switch codecID {
+	case astiav.CodecIDMjpeg:
+		return camera.PixelFormatMJPEG
+	case astiav.CodecIDH264:
+		return camera.PixelFormatH264
+	case astiav.CodecIDHevc:
+		return camera.PixelFormatHEVC
+	}
+	return camera.PixelFormat(strings.ToUpper(codecID.Name()))
+}
+
+// PixelFormatFromLibAV returns the pixel format of the images decoded
+// from the frames of the given libav pixel format.
+func PixelFormatFromLibAV(pixFmt astiav.PixelFormat) camera.PixelFormat {
+	switch pixFmt {
+	case astiav.PixelFormatYuv420P, astiav.PixelFormatYuvj420P:
+		return camera.PixelFormatYU12
+	case astiav.PixelFormatNv12:
+		return camera.PixelFormatNV12
+	case astiav.PixelFormatYuyv422:
+		return camera.PixelFormatYUYV
+	}
+	return camera.PixelFormat(strings.ToUpper(pixFmt.Name()))
+}
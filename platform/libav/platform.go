@@ -19,7 +19,7 @@ func (Platform) OpenCameraCompressed(
 	compression camera.Compression,
 	compressionQuality camera.CompressionQuality,
 ) (camera.CameraCompressed, error) {
-	return nil, fmt.Errorf("not supported")
+	return nil, fmt.Errorf("compressed streams are %w", camera.ErrNotSupported)
 }
 
 func (Platform) OpenCamera(
@@ -37,6 +37,17 @@ func (Platform) ListCameras() ([]camera.DevicePath, error) {
 	return []camera.DevicePath{DevicePathBack, DevicePathFront}, nil
 }
 
+// DescribeDevice implements camera.DeviceDescriber.
+func (Platform) DescribeDevice(devicePath camera.DevicePath) (camera.DeviceDescriptor, error) {
+	switch devicePath {
+	case DevicePathBack:
+		return camera.DeviceDescriptor{Name: "back camera", Driver: InputFormat}, nil
+	case DevicePathFront:
+		return camera.DeviceDescriptor{Name: "front camera", Driver: InputFormat}, nil
+	}
+	return camera.DeviceDescriptor{}, fmt.Errorf("invalid device path: '%s'", devicePath)
+}
+
 func (Platform) ListFormats(
 	devicePath string,
 ) (camera.Formats, error) {
@@ -20,6 +20,26 @@ func (Platform) ListCameras() ([]camera.DevicePath, error) {
 	return v4l2.NewPlatform().ListCameras()
 }
 
+// DeviceIdentity implements camera.DeviceIdentifier.
+func (Platform) DeviceIdentity(devicePath camera.DevicePath) (string, error) {
+	return v4l2.NewPlatform().DeviceIdentity(devicePath)
+}
+
+// DescribeDevice implements camera.DeviceDescriber.
+func (Platform) DescribeDevice(devicePath camera.DevicePath) (camera.DeviceDescriptor, error) {
+	return v4l2.NewPlatform().DescribeDevice(devicePath)
+}
+
+// OpenControls implements camera.ControlsOpener.
+func (Platform) OpenControls(devicePath camera.DevicePath) (camera.ControlsCloser, error) {
+	return v4l2.NewPlatform().OpenControls(devicePath)
+}
+
+// DiagnoseCameras implements camera.DiagnosticsProvider.
+func (Platform) DiagnoseCameras() ([]camera.DeviceDiagnostics, error) {
+	return v4l2.NewPlatform().DiagnoseCameras()
+}
+
 func (Platform) ListFormats(
 	devicePath string,
 ) (camera.Formats, error) {
@@ -4,6 +4,11 @@ import (
 	"github.com/xaionaro-go/camera"
 )
 
+const (
+	PlatformID = camera.PlatformID("libav")
+	Priority   = 50
+)
+
 func init() {
-	camera.DefaultRegistry().RegisterPlatform(Platform{})
+	camera.DefaultRegistry().RegisterPlatformWithPriority(PlatformID, Platform{}, Priority)
 }
@@ -0,0 +1,215 @@
+package libav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/asticode/go-astiav"
+	"github.com/asticode/go-astikit"
+	"github.com/xaionaro-go/camera"
+)
+
+// StreamCamera is a camera receiving a compressed video stream (e.g. from
+// a network camera), which is decoded via libav.
+//
+// The format of the stream is defined by its source, so the camera
+// cannot be configured. The packets could be received as is via
+// Compressed.
+type StreamCamera struct {
+	*astikit.Closer
+	Input   *Input
+	Stream  *astiav.Stream
+	Decoder *Decoder
+
+	// Format is of the decoded images, and CompressedFormat is of the
+	// packets of the stream (the pixel format is the codec).
+	Format           camera.Format
+	CompressedFormat camera.Format
+
+	// FrameTimeout limits waiting for a frame; unlimited if zero.
+	FrameTimeout time.Duration
+
+	// decoded are the images decoded from the last packet,
+	// but not returned by GetFrame yet.
+	decoded []image.Image
+}
+
+var _ camera.Camera = (*StreamCamera)(nil)
+
+// OpenStream opens the input (like an "rtsp://" URL) and prepares
+// the decoding of its first video stream. The options are passed
+// to the demuxer (see "ffmpeg -h demuxer=rtsp").
+func OpenStream(
+	inputString string,
+	options map[string]string,
+) (_ *StreamCamera, _err error) {
+	input, err := NewInputWithOptions("", inputString, options)
+	if err != nil {
+		return nil, err
+	}
+	c := &StreamCamera{
+		Closer: astikit.NewCloser(),
+		Input:  input,
+	}
+	c.Closer.AddWithError(input.Close)
+	defer func() {
+		if _err != nil {
+			c.Closer.Close()
+		}
+	}()
+
+	c.Stream, err = input.VideoStream()
+	if err != nil {
+		return nil, err
+	}
+	codecParams := c.Stream.CodecParameters()
+
+	c.Decoder, err = NewDecoder(c.Stream)
+	if err != nil {
+		return nil, err
+	}
+	c.Closer.AddWithError(c.Decoder.Close)
+
+	c.Format = camera.Format{
+		Width:       uint64(codecParams.Width()),
+		Height:      uint64(codecParams.Height()),
+		PixelFormat: PixelFormatFromLibAV(codecParams.PixelFormat()),
+		FPS:         streamFPS(c.Stream),
+	}
+	c.CompressedFormat = c.Format
+	c.CompressedFormat.PixelFormat = PixelFormatFromCodecID(codecParams.CodecID())
+	return c, nil
+}
+
+// streamFPS returns the frame rate of the stream, or zero if it is unknown.
+func streamFPS(stream *astiav.Stream) camera.Fraction {
+	for _, fps := range []astiav.Rational{stream.AvgFrameRate(), stream.RFrameRate()} {
+		if fps.Num() > 0 && fps.Den() > 0 {
+			return camera.Fraction{
+				Numerator:   uint(fps.Num()),
+				Denominator: uint(fps.Den()),
+			}
+		}
+	}
+	return camera.Fraction{Numerator: 0, Denominator: 1}
+}
+
+func (c *StreamCamera) StartStreaming() error {
+	return nil
+}
+
+func (c *StreamCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *StreamCamera) GetFormat() camera.Format {
+	return c.Format
+}
+
+// readPacket returns the next packet of the video stream.
+func (c *StreamCamera) readPacket(
+	ctx context.Context,
+) (_ *astiav.Packet, _err error) {
+	if c.FrameTimeout > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, c.FrameTimeout)
+		defer cancelFn()
+	}
+	if err := camera.ContextErr(ctx); err != nil {
+		return nil, err
+	}
+
+	// a network read may block for long, so interrupting it on cancellation:
+	c.Input.Interrupter.Resume()
+	stop := context.AfterFunc(ctx, c.Input.Interrupter.Interrupt)
+	defer stop()
+
+	packet := astiav.AllocPacket()
+	defer func() {
+		if _err != nil {
+			packet.Free()
+		}
+	}()
+	for {
+		err := c.Input.FormatContext.ReadFrame(packet)
+		if err != nil {
+			if ctx.Err() != nil && errors.Is(err, astiav.ErrExit) {
+				return nil, camera.ContextErr(ctx)
+			}
+			return nil, fmt.Errorf("unable to read a packet: %w", wrapAVError(err))
+		}
+		if packet.StreamIndex() == c.Stream.Index() && len(packet.Data()) != 0 {
+			return packet, nil
+		}
+		packet.Unref()
+	}
+}
+
+// GetFrame returns the next decoded frame. Frames are never skipped,
+// since most codecs cannot decode a frame without the previous ones
+// (if a packet is decoded into multiple frames, then they are
+// returned one by one).
+func (c *StreamCamera) GetFrame(
+	ctx context.Context,
+) (camera.Frame, error) {
+	for len(c.decoded) == 0 {
+		packet, err := c.readPacket(ctx)
+		if err != nil {
+			return nil, err
+		}
+		images, err := c.Decoder.Decode(packet)
+		packet.Free()
+		if errors.Is(err, camera.ErrNoFrame) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.decoded = images
+	}
+	img := c.decoded[0]
+	c.decoded[0] = nil
+	c.decoded = c.decoded[1:]
+	return camera.FrameFromImage(img), nil
+}
+
+func (c *StreamCamera) ReleaseFrame(frame camera.Frame) error {
+	return nil
+}
+
+// Compressed returns the camera providing the packets of the stream
+// as is, without decoding; it shares the stream with c, so only one
+// of them should be used, and closing either closes both.
+func (c *StreamCamera) Compressed() *StreamCameraCompressed {
+	return &StreamCameraCompressed{StreamCamera: c}
+}
+
+// StreamCameraCompressed is a StreamCamera providing the packets
+// of the stream as is (see StreamCamera.Compressed).
+type StreamCameraCompressed struct {
+	*StreamCamera
+}
+
+var _ camera.CameraCompressed = (*StreamCameraCompressed)(nil)
+
+func (c *StreamCameraCompressed) GetFormat() camera.Format {
+	return c.CompressedFormat
+}
+
+// GetCompressedFrames returns the next packet of the stream.
+func (c *StreamCameraCompressed) GetCompressedFrames(
+	ctx context.Context,
+) (camera.FramesCompressed, error) {
+	packet, err := c.readPacket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &PacketFrames{Packet: packet}, nil
+}
+
+func (c *StreamCameraCompressed) ReleaseFrames(frames camera.FramesCompressed) error {
+	return frames.(*PacketFrames).Close()
+}
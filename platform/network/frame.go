@@ -0,0 +1,32 @@
+package network
+
+import (
+	"image"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type Frame struct {
+	Img     image.Image
+	Skipped uint64
+}
+
+var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
+
+func (f *Frame) Image() image.Image {
+	return f.Img
+}
+
+func (f *Frame) SkippedFrames() uint64 {
+	return f.Skipped
+}
+
+// FramesCompressed is a frame as it was received from the camera.
+type FramesCompressed []byte
+
+var _ camera.FramesCompressed = FramesCompressed(nil)
+
+func (f FramesCompressed) Bytes() []byte {
+	return f
+}
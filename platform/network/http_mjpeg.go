@@ -0,0 +1,357 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-mjpeg"
+	"github.com/xaionaro-go/camera"
+)
+
+// frameQueueSize is how many received frames may wait for GetFrame
+// before the receiving stops (and the camera is slowed down by TCP).
+const frameQueueSize = 4
+
+// httpMJPEGCamera receives an HTTP multipart stream of JPEGs;
+// the frames are decoded, see also Compressed.
+type httpMJPEGCamera struct {
+	url     string
+	format  camera.Format
+	timeout time.Duration
+
+	cancelFn        context.CancelFunc
+	frames          chan []byte
+	readErr         error
+	wg              sync.WaitGroup
+	latestFrameOnly atomic.Bool
+	closeOnce       sync.Once
+}
+
+var _ camera.Camera = (*httpMJPEGCamera)(nil)
+var _ camera.LatestFrameOnlySetter = (*httpMJPEGCamera)(nil)
+
+// connectHTTPMJPEG sends the request and receives the first frame.
+func connectHTTPMJPEG(
+	ctx context.Context,
+	cfg Config,
+	devicePath camera.DevicePath,
+) (_ *mjpeg.Decoder, _ []byte, _err error) {
+	// the context should live as long as the stream, so the timeout
+	// is enforced by a timer instead of context.WithTimeout:
+	ctx, cancelFn := context.WithCancel(ctx)
+	timer := time.AfterFunc(cfg.Timeout, cancelFn)
+	defer timer.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, devicePath, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to build the request: %w", err)
+	}
+
+	resp, err := cfg.HTTPClient.Do(req)
+	if err != nil {
+		if !timer.Stop() {
+			err = fmt.Errorf("%w: %w", camera.ErrTimeout, err)
+		}
+		return nil, nil, fmt.Errorf("unable to connect: %w: %w", camera.ErrDeviceGone, err)
+	}
+	defer func() {
+		if _err != nil {
+			resp.Body.Close()
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected HTTP status '%s'", resp.Status)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse the content type: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, nil, fmt.Errorf("the content type is '%s', but an MJPEG stream (multipart/x-mixed-replace) is expected: %w", mediaType, camera.ErrNotSupported)
+	}
+	dec, err := mjpeg.NewDecoderFromResponse(resp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to initialize the MJPEG decoder: %w", err)
+	}
+
+	firstFrame, err := dec.DecodeRaw()
+	if err != nil {
+		if !timer.Stop() {
+			err = fmt.Errorf("%w: %w", camera.ErrTimeout, err)
+		}
+		return nil, nil, fmt.Errorf("unable to receive the first frame: %w", err)
+	}
+	if !timer.Stop() {
+		return nil, nil, fmt.Errorf("unable to receive the first frame in time: %w", camera.ErrTimeout)
+	}
+	return dec, firstFrame, nil
+}
+
+// decodedPixelFormat returns the pixel format of the image decoded
+// from a JPEG; the formats without a constant are named like in libav.
+func decodedPixelFormat(img image.Image) camera.PixelFormat {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		switch img.SubsampleRatio {
+		case image.YCbCrSubsampleRatio420:
+			return camera.PixelFormatYU12
+		case image.YCbCrSubsampleRatio422:
+			return camera.PixelFormat("YUVJ422P")
+		case image.YCbCrSubsampleRatio444:
+			return camera.PixelFormat("YUVJ444P")
+		case image.YCbCrSubsampleRatio440:
+			return camera.PixelFormat("YUVJ440P")
+		case image.YCbCrSubsampleRatio411:
+			return camera.PixelFormat("YUVJ411P")
+		}
+	case *image.Gray:
+		return camera.PixelFormat("GRAY8")
+	case *image.CMYK:
+		return camera.PixelFormat("CMYK")
+	}
+	return camera.PixelFormatUndefined
+}
+
+// jpegFormat returns the format of the images decoded from the frame
+// (as they are returned by GetFrame); the FPS is unknown.
+func jpegFormat(frame []byte) (camera.Format, error) {
+	img, err := jpeg.Decode(bytes.NewReader(frame))
+	if err != nil {
+		return camera.Format{}, fmt.Errorf("unable to decode the JPEG: %w", err)
+	}
+	size := img.Bounds().Size()
+	return camera.Format{
+		Width:       uint64(size.X),
+		Height:      uint64(size.Y),
+		PixelFormat: decodedPixelFormat(img),
+		FPS:         camera.Fraction{Numerator: 0, Denominator: 1},
+	}, nil
+}
+
+// probeHTTPMJPEG receives a few frames to find out the format of the stream.
+func probeHTTPMJPEG(
+	cfg Config,
+	devicePath camera.DevicePath,
+) (camera.Format, error) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	dec, firstFrame, err := connectHTTPMJPEG(ctx, cfg, devicePath)
+	if err != nil {
+		return camera.Format{}, fmt.Errorf("unable to probe '%s': %w", redactURL(devicePath), err)
+	}
+	format, err := jpegFormat(firstFrame)
+	if err != nil {
+		return camera.Format{}, err
+	}
+
+	timer := time.AfterFunc(cfg.Timeout, cancelFn)
+	defer timer.Stop()
+	startTS := time.Now()
+	for i := 1; i < probeFrameCount; i++ {
+		if _, err := dec.DecodeRaw(); err != nil {
+			// the FPS remains unknown, but the format is still valid
+			return format, nil
+		}
+	}
+	fps := float64(probeFrameCount-1) / time.Since(startTS).Seconds()
+	format.FPS = camera.Fraction{
+		Numerator:   uint(math.Round(fps * 1000)),
+		Denominator: 1000,
+	}
+	return format, nil
+}
+
+// openHTTPMJPEG connects to the camera; the FPS cannot be configured
+// and is not measured, so the given one is just reported by GetFormat.
+func openHTTPMJPEG(
+	cfg Config,
+	devicePath camera.DevicePath,
+	fps camera.Fraction,
+) (*httpMJPEGCamera, error) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	dec, firstFrame, err := connectHTTPMJPEG(ctx, cfg, devicePath)
+	if err != nil {
+		cancelFn()
+		return nil, fmt.Errorf("unable to open '%s': %w", redactURL(devicePath), err)
+	}
+	format, err := jpegFormat(firstFrame)
+	if err != nil {
+		cancelFn()
+		return nil, err
+	}
+	if fps.Denominator != 0 {
+		format.FPS = fps
+	}
+
+	c := &httpMJPEGCamera{
+		url:      devicePath,
+		format:   format,
+		timeout:  cfg.Timeout,
+		cancelFn: cancelFn,
+		frames:   make(chan []byte, frameQueueSize),
+	}
+	c.frames <- firstFrame
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.receiveLoop(ctx, dec)
+	}()
+	return c, nil
+}
+
+func (c *httpMJPEGCamera) receiveLoop(
+	ctx context.Context,
+	dec *mjpeg.Decoder,
+) {
+	// c.readErr is read only after c.frames is closed
+	defer close(c.frames)
+	for {
+		frame, err := dec.DecodeRaw()
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		select {
+		case c.frames <- frame:
+		case <-ctx.Done():
+			c.readErr = ctx.Err()
+			return
+		}
+	}
+}
+
+func (c *httpMJPEGCamera) Close() error {
+	c.closeOnce.Do(func() {
+		c.cancelFn()
+		c.wg.Wait()
+	})
+	return nil
+}
+
+func (c *httpMJPEGCamera) StartStreaming() error {
+	return nil
+}
+
+func (c *httpMJPEGCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *httpMJPEGCamera) GetFormat() camera.Format {
+	return c.format
+}
+
+func (c *httpMJPEGCamera) SetLatestFrameOnly(v bool) {
+	c.latestFrameOnly.Store(v)
+}
+
+// nextFrame returns the next received JPEG and
+// the amount of the skipped ones.
+func (c *httpMJPEGCamera) nextFrame(
+	ctx context.Context,
+) ([]byte, uint64, error) {
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+
+	var frame []byte
+	var ok bool
+	select {
+	case <-ctx.Done():
+		return nil, 0, camera.ContextErr(ctx)
+	case <-timer.C:
+		return nil, 0, fmt.Errorf("no frames received from '%s' in %v: %w", redactURL(c.url), c.timeout, camera.ErrTimeout)
+	case frame, ok = <-c.frames:
+	}
+	if !ok {
+		return nil, 0, c.streamError()
+	}
+
+	var skipped uint64
+	if c.latestFrameOnly.Load() {
+		for len(c.frames) > 0 {
+			newer, ok := <-c.frames
+			if !ok {
+				break
+			}
+			frame = newer
+			skipped++
+		}
+	}
+	return frame, skipped, nil
+}
+
+func (c *httpMJPEGCamera) streamError() error {
+	err := c.readErr
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("the camera is closed")
+	}
+	return fmt.Errorf("the stream from '%s' broke: %w: %w", redactURL(c.url), camera.ErrDeviceGone, err)
+}
+
+func (c *httpMJPEGCamera) GetFrame(
+	ctx context.Context,
+) (camera.Frame, error) {
+	frame, skipped, err := c.nextFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the JPEG: %w", err)
+	}
+	return &Frame{
+		Img:     img,
+		Skipped: skipped,
+	}, nil
+}
+
+func (c *httpMJPEGCamera) ReleaseFrame(camera.Frame) error {
+	return nil
+}
+
+// Compressed returns the camera providing the received JPEGs as is;
+// it shares the stream with c, so only one of them should be used,
+// and closing either closes both.
+func (c *httpMJPEGCamera) Compressed() *httpMJPEGCameraCompressed {
+	return &httpMJPEGCameraCompressed{httpMJPEGCamera: c}
+}
+
+// httpMJPEGCameraCompressed is an httpMJPEGCamera providing
+// the received JPEGs as is (see httpMJPEGCamera.Compressed).
+type httpMJPEGCameraCompressed struct {
+	*httpMJPEGCamera
+}
+
+var _ camera.CameraCompressed = (*httpMJPEGCameraCompressed)(nil)
+
+func (c *httpMJPEGCameraCompressed) GetFormat() camera.Format {
+	format := c.format
+	format.PixelFormat = camera.PixelFormatMJPEG
+	return format
+}
+
+func (c *httpMJPEGCameraCompressed) GetCompressedFrames(
+	ctx context.Context,
+) (camera.FramesCompressed, error) {
+	frame, _, err := c.nextFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return FramesCompressed(frame), nil
+}
+
+func (c *httpMJPEGCameraCompressed) ReleaseFrames(camera.FramesCompressed) error {
+	return nil
+}
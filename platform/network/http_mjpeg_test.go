@@ -0,0 +1,216 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+func newTestJPEG(t *testing.T, seq int) []byte {
+	t.Helper()
+	img := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i + seq*16)
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 128, 128
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestServer serves an MJPEG stream of frameCount frames (endless
+// if negative) and then breaks the stream.
+func newTestServer(t *testing.T, frameCount int) *httptest.Server {
+	t.Helper()
+	frames := [][]byte{newTestJPEG(t, 0), newTestJPEG(t, 1)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+		w.WriteHeader(http.StatusOK)
+		for seq := 0; frameCount < 0 || seq < frameCount; seq++ {
+			part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/jpeg"}})
+			if err != nil {
+				return
+			}
+			if _, err := part.Write(frames[seq%len(frames)]); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestPlatform(t *testing.T, url string) *Platform {
+	t.Helper()
+	p, err := NewPlatform(Config{Timeout: 5 * time.Second}, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestHTTPMJPEG(t *testing.T) {
+	srv := newTestServer(t, -1)
+	p := newTestPlatform(t, srv.URL)
+
+	cameras, err := p.ListCameras()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cameras) != 1 || cameras[0] != srv.URL {
+		t.Fatalf("expected the cameras [%s], got %v", srv.URL, cameras)
+	}
+	formats, err := p.ListFormats(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(formats) != 1 {
+		t.Fatalf("expected a single format, got %v", formats)
+	}
+	format := formats[0]
+	if format.Width != 64 || format.Height != 48 || format.PixelFormat != camera.PixelFormatYU12 {
+		t.Errorf("expected the format 64x48 %s, got %v", camera.PixelFormatYU12, format)
+	}
+	if fps := format.FPS.Float64(); fps <= 0 || fps > 200 {
+		t.Errorf("unexpected FPS %v", fps)
+	}
+
+	t.Run("decoded", func(t *testing.T) {
+		cam, err := p.OpenCamera(srv.URL, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cam.Close()
+		if err := cam.StartStreaming(); err != nil {
+			t.Fatal(err)
+		}
+		if got := cam.GetFormat(); got != format {
+			t.Errorf("expected the format %v, got %v", format, got)
+		}
+		for i := 0; i < 3; i++ {
+			frame, err := cam.GetFrame(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, ok := frame.Image().(*image.YCbCr)
+			if !ok || img.SubsampleRatio != image.YCbCrSubsampleRatio420 || img.Bounds() != image.Rect(0, 0, 64, 48) {
+				t.Errorf("the image does not match the format: %T %v", frame.Image(), frame.Image().Bounds())
+			}
+			if err := cam.ReleaseFrame(frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		cam, err := p.OpenCameraCompressed(srv.URL, format, camera.CompressionMJPEG, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cam.Close()
+		if pixFmt := cam.GetFormat().PixelFormat; pixFmt != camera.PixelFormatMJPEG {
+			t.Errorf("expected the pixel format %s, got %s", camera.PixelFormatMJPEG, pixFmt)
+		}
+		frames, err := cam.GetCompressedFrames(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(frames.Bytes())); err != nil {
+			t.Errorf("unable to decode the frame: %v", err)
+		}
+		if err := cam.ReleaseFrames(frames); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("format_rejected", func(t *testing.T) {
+		_, err := p.OpenCamera(srv.URL, camera.Format{Width: 32, Height: 24})
+		if !errors.Is(err, camera.ErrFormatRejected) {
+			t.Errorf("expected the format to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestHTTPMJPEGBrokenStream(t *testing.T) {
+	srv := newTestServer(t, 3)
+	p := newTestPlatform(t, srv.URL)
+	cam, err := p.OpenCamera(srv.URL, camera.Format{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cam.Close()
+
+	for i := 0; ; i++ {
+		frame, err := cam.GetFrame(context.Background())
+		if err != nil {
+			// the last part is not terminated by a boundary,
+			// so it may be lost
+			if i < 2 {
+				t.Errorf("expected at least 2 frames before the error, got %d", i)
+			}
+			if !errors.Is(err, camera.ErrDeviceGone) {
+				t.Errorf("expected the device to be gone, got %v", err)
+			}
+			break
+		}
+		if err := cam.ReleaseFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+		if i >= 3 {
+			t.Fatalf("expected the stream to break")
+		}
+	}
+}
+
+func TestHTTPMJPEGNoFrames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	p, err := NewPlatform(Config{Timeout: 100 * time.Millisecond}, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.OpenCamera(srv.URL, camera.Format{})
+	if !errors.Is(err, camera.ErrTimeout) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestHTTPNotMJPEG(t *testing.T) {
+	jpegFrame := newTestJPEG(t, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpegFrame)
+	}))
+	defer srv.Close()
+	p := newTestPlatform(t, srv.URL)
+	_, err := p.OpenCamera(srv.URL, camera.Format{})
+	if !errors.Is(err, camera.ErrNotSupported) {
+		t.Errorf("expected a still image to be not supported, got %v", err)
+	}
+}
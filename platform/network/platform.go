@@ -0,0 +1,303 @@
+// Package network implements a camera.Platform for IP cameras, where
+// the device path is the URL of the stream:
+//   - "rtsp://" (and "rtsps://") streams are received and decoded via libav;
+//   - "http://" (and "https://") streams are expected to be MJPEG
+//     (multipart/x-mixed-replace), as served by most IP cameras
+//     and tools like mjpg-streamer.
+//
+// Network cameras cannot be discovered, so ListCameras returns
+// the URLs added via AddCamera.
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/platform/libav"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+
+	// probeFrameCount is how many frames are received
+	// to estimate the FPS of an HTTP stream.
+	probeFrameCount = 5
+)
+
+type Config struct {
+	// Timeout limits connecting to a camera and waiting
+	// for a frame; DefaultTimeout is used if zero.
+	Timeout time.Duration
+
+	// RTSPTransport is "tcp" or "udp"; if empty, then libav
+	// tries UDP first and falls back to TCP.
+	RTSPTransport string
+
+	// HTTPClient is used to connect to HTTP cameras;
+	// http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return cfg
+}
+
+type streamKind int
+
+const (
+	streamKindUndefined = streamKind(iota)
+	streamKindRTSP
+	streamKindHTTPMJPEG
+)
+
+func parseStreamURL(devicePath camera.DevicePath) (streamKind, error) {
+	u, err := url.Parse(devicePath)
+	if err != nil {
+		return streamKindUndefined, fmt.Errorf("unable to parse the URL: %w", err)
+	}
+	switch u.Scheme {
+	case "rtsp", "rtsps":
+		return streamKindRTSP, nil
+	case "http", "https":
+		return streamKindHTTPMJPEG, nil
+	}
+	return streamKindUndefined, fmt.Errorf("URL scheme '%s': %w", u.Scheme, camera.ErrNotSupported)
+}
+
+// IsStreamURL returns true if the device path is a URL
+// which could be opened by this platform.
+func IsStreamURL(devicePath camera.DevicePath) bool {
+	_, err := parseStreamURL(devicePath)
+	return err == nil
+}
+
+// redactURL hides the password (if any), to not leak it into logs.
+func redactURL(devicePath camera.DevicePath) string {
+	u, err := url.Parse(devicePath)
+	if err != nil {
+		return devicePath
+	}
+	return u.Redacted()
+}
+
+type Platform struct {
+	Config Config
+
+	locker sync.Mutex
+	urls   []camera.DevicePath
+}
+
+var _ camera.Platform = (*Platform)(nil)
+
+func NewPlatform(cfg Config, urls ...camera.DevicePath) (*Platform, error) {
+	p := &Platform{
+		Config: cfg,
+	}
+	for _, u := range urls {
+		if err := p.AddCamera(u); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// AddCamera makes the camera listed by ListCameras.
+func (p *Platform) AddCamera(devicePath camera.DevicePath) error {
+	if _, err := parseStreamURL(devicePath); err != nil {
+		return fmt.Errorf("invalid camera URL '%s': %w", redactURL(devicePath), err)
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if !slices.Contains(p.urls, devicePath) {
+		p.urls = append(p.urls, devicePath)
+	}
+	return nil
+}
+
+func (p *Platform) RemoveCamera(devicePath camera.DevicePath) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.urls = slices.DeleteFunc(p.urls, func(item camera.DevicePath) bool { return item == devicePath })
+}
+
+func (p *Platform) ListCameras() ([]camera.DevicePath, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return slices.Clone(p.urls), nil
+}
+
+// DescribeDevice implements camera.DeviceDescriber.
+func (p *Platform) DescribeDevice(devicePath camera.DevicePath) (camera.DeviceDescriptor, error) {
+	kind, err := parseStreamURL(devicePath)
+	if err != nil {
+		return camera.DeviceDescriptor{}, err
+	}
+	u, _ := url.Parse(devicePath)
+	driver := "rtsp"
+	if kind == streamKindHTTPMJPEG {
+		driver = "http-mjpeg"
+	}
+	return camera.DeviceDescriptor{
+		Name:    u.Host,
+		Driver:  driver,
+		BusInfo: redactURL(devicePath),
+	}, nil
+}
+
+// ListFormats connects to the camera to find out the format of
+// the stream; there is always a single format, since the format
+// is defined by the camera. It is the format of the decoded frames
+// (as returned by OpenCamera); OpenCameraCompressed accepts it as well.
+func (p *Platform) ListFormats(
+	devicePath string,
+) (camera.Formats, error) {
+	kind, err := parseStreamURL(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	cfg := p.Config.withDefaults()
+
+	switch kind {
+	case streamKindRTSP:
+		c, err := openRTSP(cfg, devicePath)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		return camera.Formats{c.GetFormat()}, nil
+	case streamKindHTTPMJPEG:
+		format, err := probeHTTPMJPEG(cfg, devicePath)
+		if err != nil {
+			return nil, err
+		}
+		return camera.Formats{format}, nil
+	}
+	return nil, fmt.Errorf("unexpected stream kind %d", kind)
+}
+
+// openStream connects to the camera; the FPS cannot be configured,
+// so for HTTP cameras the given one is just reported by GetFormat.
+func (p *Platform) openStream(
+	devicePath camera.DevicePath,
+	fps camera.Fraction,
+) (camera.Camera, error) {
+	kind, err := parseStreamURL(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	cfg := p.Config.withDefaults()
+
+	switch kind {
+	case streamKindRTSP:
+		return openRTSP(cfg, devicePath)
+	case streamKindHTTPMJPEG:
+		return openHTTPMJPEG(cfg, devicePath, fps)
+	}
+	return nil, fmt.Errorf("unexpected stream kind %d", kind)
+}
+
+// OpenCamera opens the camera providing the decoded frames, so the
+// requested pixel format is compared to the format of the decoded
+// frames (see ListFormats).
+func (p *Platform) OpenCamera(
+	devicePath string,
+	format camera.Format,
+) (camera.Camera, error) {
+	cam, err := p.openStream(devicePath, format.FPS)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFormat(format, cam.GetFormat()); err != nil {
+		cam.Close()
+		return nil, err
+	}
+	return cam, nil
+}
+
+// OpenCameraCompressed returns the frames as they are received, so only
+// the MJPEG compression is supported, and only if the camera sends MJPEG.
+func (p *Platform) OpenCameraCompressed(
+	devicePath camera.DevicePath,
+	format camera.Format,
+	compression camera.Compression,
+	compressionQuality camera.CompressionQuality,
+) (camera.CameraCompressed, error) {
+	if compression != camera.CompressionMJPEG && compression != camera.CompressionAuto {
+		return nil, fmt.Errorf("compression '%s' (re-encoding is not implemented): %w", compression, camera.ErrNotSupported)
+	}
+
+	cam, err := p.openStream(devicePath, format.FPS)
+	if err != nil {
+		return nil, err
+	}
+	var camCompressed camera.CameraCompressed
+	switch cam := cam.(type) {
+	case *libav.StreamCamera:
+		camCompressed = cam.Compressed()
+	case *httpMJPEGCamera:
+		camCompressed = cam.Compressed()
+	default:
+		cam.Close()
+		return nil, fmt.Errorf("camera %T does not provide compressed frames: %w", cam, camera.ErrNotSupported)
+	}
+	actual := camCompressed.GetFormat()
+	if actual.PixelFormat != camera.PixelFormatMJPEG {
+		camCompressed.Close()
+		return nil, fmt.Errorf("the camera sends %s instead of MJPEG (re-encoding is not implemented): %w", actual.PixelFormat, camera.ErrNotSupported)
+	}
+	if format.PixelFormat == cam.GetFormat().PixelFormat {
+		// the listed format is the one of the decoded frames
+		format.PixelFormat = camera.PixelFormatAuto
+	}
+	if err := checkFormat(format, actual); err != nil {
+		camCompressed.Close()
+		return nil, err
+	}
+	return camCompressed, nil
+}
+
+func openRTSP(cfg Config, devicePath camera.DevicePath) (*libav.StreamCamera, error) {
+	options := map[string]string{
+		// in microseconds
+		"timeout": strconv.FormatInt(cfg.Timeout.Microseconds(), 10),
+	}
+	if cfg.RTSPTransport != "" {
+		options["rtsp_transport"] = cfg.RTSPTransport
+	}
+	c, err := libav.OpenStream(devicePath, options)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the stream '%s': %w", redactURL(devicePath), err)
+	}
+	c.FrameTimeout = cfg.Timeout
+	return c, nil
+}
+
+// checkFormat returns an error if the requested format cannot be
+// satisfied by the stream. Empty fields mean "any".
+func checkFormat(requested, actual camera.Format) error {
+	if requested.Width != 0 && requested.Width != actual.Width ||
+		requested.Height != 0 && requested.Height != actual.Height {
+		return fmt.Errorf("requested resolution %dx%d, but the stream is %dx%d: %w",
+			requested.Width, requested.Height, actual.Width, actual.Height, camera.ErrFormatRejected)
+	}
+	switch requested.PixelFormat {
+	case camera.PixelFormatUndefined, camera.PixelFormatAuto, actual.PixelFormat:
+	default:
+		return fmt.Errorf("requested pixel format %s, but the stream is %s: %w",
+			requested.PixelFormat, actual.PixelFormat, camera.ErrFormatRejected)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package network
+
+import (
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	PlatformID = camera.PlatformID("network")
+
+	// Priority is the lowest, since the device paths (URLs)
+	// never collide with the ones of the other platforms.
+	Priority = 10
+)
+
+var defaultPlatform = &Platform{}
+
+// DefaultPlatform returns the platform registered in the default
+// registry; use AddCamera to make a camera available via the registry.
+func DefaultPlatform() *Platform {
+	return defaultPlatform
+}
+
+func init() {
+	camera.DefaultRegistry().RegisterPlatformWithPriority(PlatformID, defaultPlatform, Priority)
+}
@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+)
+
+// Camera delivers the frames of a remote camera; the frames are
+// decompressed locally if MJPEG was negotiated (see Config.Compression).
+type Camera struct {
+	*session
+
+	// decode is nil for the raw frames.
+	decode func([]byte) (image.Image, error)
+}
+
+var _ camera.Camera = (*Camera)(nil)
+var _ camera.Controls = (*Camera)(nil)
+
+func newCamera(s *session) *Camera {
+	c := &Camera{session: s}
+	if s.encoding.GetCompression() != "" {
+		// it is MJPEG, as it is the only compression requested by OpenCamera
+		c.decode = func(b []byte) (image.Image, error) {
+			return jpeg.Decode(bytes.NewReader(b))
+		}
+	}
+	return c
+}
+
+// GetFormat returns the format of the raw frames (also if they
+// are compressed for the transfer).
+func (c *Camera) GetFormat() camera.Format {
+	return rawimage.RawFormat(c.session.GetFormat())
+}
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	frame, err := c.getFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var img image.Image
+	if c.decode != nil {
+		img, err = c.decode(frame.GetData())
+	} else {
+		img, err = rawimage.NewRawImage(&c.format, frame.GetData())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the frame: %w", err)
+	}
+	return &Frame{
+		Frame:     img,
+		Seq:       frame.GetSeq(),
+		Skipped:   frame.GetSkipped(),
+		CaptureTS: captureTS(frame),
+	}, nil
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	if _, ok := frame.(*Frame); !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	return nil
+}
+
+// CameraCompressed delivers the compressed frames of a remote camera.
+type CameraCompressed struct {
+	*session
+}
+
+var _ camera.CameraCompressed = (*CameraCompressed)(nil)
+var _ camera.Controls = (*CameraCompressed)(nil)
+
+func (c *CameraCompressed) GetCompressedFrames(ctx context.Context) (camera.FramesCompressed, error) {
+	frame, err := c.getFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &FramesCompressed{
+		Data:      frame.GetData(),
+		Seq:       frame.GetSeq(),
+		Skipped:   frame.GetSkipped(),
+		CaptureTS: captureTS(frame),
+	}, nil
+}
+
+func (c *CameraCompressed) ReleaseFrames(frames camera.FramesCompressed) error {
+	if _, ok := frames.(*FramesCompressed); !ok {
+		return fmt.Errorf("unexpected frames type %T", frames)
+	}
+	return nil
+}
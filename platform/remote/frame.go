@@ -0,0 +1,64 @@
+package remote
+
+import (
+	"image"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type Frame struct {
+	Frame     image.Image
+	Seq       uint64
+	Skipped   uint64
+	CaptureTS time.Time
+}
+
+var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
+var _ camera.FrameTimestamper = (*Frame)(nil)
+var _ camera.FrameSequencer = (*Frame)(nil)
+
+func (f *Frame) Image() image.Image {
+	return f.Frame
+}
+
+func (f *Frame) SkippedFrames() uint64 {
+	return f.Skipped
+}
+
+func (f *Frame) Timestamp() time.Time {
+	return f.CaptureTS
+}
+
+func (f *Frame) Sequence() uint64 {
+	return f.Seq
+}
+
+type FramesCompressed struct {
+	Data      []byte
+	Seq       uint64
+	Skipped   uint64
+	CaptureTS time.Time
+}
+
+var _ camera.FramesCompressed = (*FramesCompressed)(nil)
+var _ camera.FrameSkipCounter = (*FramesCompressed)(nil)
+var _ camera.FrameTimestamper = (*FramesCompressed)(nil)
+var _ camera.FrameSequencer = (*FramesCompressed)(nil)
+
+func (f *FramesCompressed) Bytes() []byte {
+	return f.Data
+}
+
+func (f *FramesCompressed) SkippedFrames() uint64 {
+	return f.Skipped
+}
+
+func (f *FramesCompressed) Timestamp() time.Time {
+	return f.CaptureTS
+}
+
+func (f *FramesCompressed) Sequence() uint64 {
+	return f.Seq
+}
@@ -0,0 +1,404 @@
+// Package remote implements a camera.Platform of the cameras attached
+// to other machines, served by package remote (e.g. via "camera grpc").
+//
+// The device path of a remote camera is "remote://ADDRESS/DEVICE", where
+// ADDRESS is the address of the server and DEVICE is the device path on
+// that machine, e.g. "remote://10.0.0.2:9000//dev/video0". The servers
+// cannot be discovered, so they should be added via AddServer (or by
+// opening a device path with the address).
+//
+// The connections use TLS unless Config.Insecure is set.
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/remote"
+	"github.com/xaionaro-go/camera/remote/remotepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	DevicePathPrefix = "remote://"
+
+	DefaultTimeout = 10 * time.Second
+)
+
+type Config struct {
+	// Timeout limits the calls to the server (except the frames
+	// streaming); DefaultTimeout is used if zero.
+	Timeout time.Duration
+
+	// TLSConfig is used to connect to the servers (e.g. with the
+	// certificate authority of a server); if nil, then the servers
+	// are verified with the system certificate authorities.
+	TLSConfig *tls.Config
+
+	// Insecure makes the connections unencrypted (e.g. within
+	// a trusted network); TLSConfig is ignored then.
+	Insecure bool
+
+	// Token (if set) is sent to the servers requiring it
+	// (see remote.Config.Token); it is only sent over TLS,
+	// unless Insecure is set.
+	Token string
+
+	// DialOptions are used to connect to the servers after the
+	// options derived from the fields above, so they may override them.
+	DialOptions []grpc.DialOption
+
+	// Compression (if set) is preferred by OpenCamera to reduce the
+	// traffic (falling back to the raw frames if the server cannot
+	// provide it); the frames are decompressed locally, so only MJPEG
+	// is supported.
+	Compression        camera.Compression
+	CompressionQuality camera.CompressionQuality
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return cfg
+}
+
+func (cfg Config) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if cfg.Insecure {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(cfg.TLSConfig)))
+	}
+	if cfg.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(remote.TokenCredentials(cfg.Token, cfg.Insecure)))
+	}
+	return append(opts, cfg.DialOptions...)
+}
+
+// LoadConfig returns the configuration of the connections with the
+// certificate authority and the token read from the files (if the
+// paths are not empty), e.g. for the flags of the commands.
+func LoadConfig(insecure bool, caFile, tokenFile string) (Config, error) {
+	cfg := Config{
+		Insecure: insecure,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return Config{}, fmt.Errorf("unable to read the certificate authority: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return Config{}, fmt.Errorf("no certificates found in '%s'", caFile)
+		}
+		cfg.TLSConfig = &tls.Config{RootCAs: pool}
+	}
+	if tokenFile != "" {
+		token, err := remote.ReadTokenFile(tokenFile)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Token = token
+	}
+	return cfg, nil
+}
+
+type server struct {
+	Address string
+	Conn    *grpc.ClientConn
+	Client  remotepb.CameraClient
+}
+
+type Platform struct {
+	Config Config
+
+	locker  sync.Mutex
+	servers []*server
+}
+
+var _ camera.Platform = (*Platform)(nil)
+var _ camera.DeviceIdentifier = (*Platform)(nil)
+var _ camera.DeviceDescriber = (*Platform)(nil)
+
+func NewPlatform(cfg Config) *Platform {
+	return &Platform{
+		Config: cfg.withDefaults(),
+	}
+}
+
+// SetConfig changes the configuration of the platform (e.g. of
+// DefaultPlatform); it should be called before the platform is used,
+// since the servers added before keep their connections.
+func (p *Platform) SetConfig(cfg Config) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.Config = cfg.withDefaults()
+}
+
+// IsDeviceURL returns true if the device path refers to a remote camera.
+func IsDeviceURL(devicePath camera.DevicePath) bool {
+	return strings.HasPrefix(devicePath, DevicePathPrefix)
+}
+
+// DevicePath returns the device path of the camera of the server.
+func DevicePath(address string, remoteDevicePath camera.DevicePath) camera.DevicePath {
+	return DevicePathPrefix + address + "/" + remoteDevicePath
+}
+
+// ParseDevicePath returns the address of the server and the device
+// path on the server.
+func ParseDevicePath(devicePath camera.DevicePath) (string, camera.DevicePath, error) {
+	rest, ok := strings.CutPrefix(devicePath, DevicePathPrefix)
+	if !ok {
+		return "", "", fmt.Errorf("the device path '%s' has no prefix '%s'", devicePath, DevicePathPrefix)
+	}
+	address, remoteDevicePath, ok := strings.Cut(rest, "/")
+	if !ok || address == "" || remoteDevicePath == "" {
+		return "", "", fmt.Errorf("the device path '%s' is not in form '%sADDRESS/DEVICE'", devicePath, DevicePathPrefix)
+	}
+	return address, remoteDevicePath, nil
+}
+
+// AddServer makes the cameras of the server available
+// (it does nothing if the server is already added).
+func (p *Platform) AddServer(address string) error {
+	_, err := p.getServer(address)
+	return err
+}
+
+func (p *Platform) getServer(address string) (*server, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	for _, s := range p.servers {
+		if s.Address == address {
+			return s, nil
+		}
+	}
+	// the connection is established lazily, on the first call
+	conn, err := grpc.NewClient(address, p.Config.dialOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize a connection to '%s': %w", address, err)
+	}
+	s := &server{
+		Address: address,
+		Conn:    conn,
+		Client:  remotepb.NewCameraClient(conn),
+	}
+	p.servers = append(p.servers, s)
+	return s, nil
+}
+
+// RemoveServer closes the connection to the server, so that
+// its cameras are not listed anymore.
+func (p *Platform) RemoveServer(address string) error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	for idx, s := range p.servers {
+		if s.Address == address {
+			p.servers = append(p.servers[:idx], p.servers[idx+1:]...)
+			return s.Conn.Close()
+		}
+	}
+	return nil
+}
+
+func (p *Platform) serverOf(devicePath camera.DevicePath) (*server, camera.DevicePath, error) {
+	address, remoteDevicePath, err := ParseDevicePath(devicePath)
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := p.getServer(address)
+	if err != nil {
+		return nil, "", err
+	}
+	return s, remoteDevicePath, nil
+}
+
+func (p *Platform) listDevices(s *server) ([]*remotepb.Device, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), p.Config.Timeout)
+	defer cancelFn()
+	reply, err := s.Client.ListCameras(ctx, &remotepb.ListCamerasRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the cameras of '%s': %w", s.Address, remote.ErrorFromStatus(err))
+	}
+	if reply.GetError() != "" {
+		err = fmt.Errorf("unable to list some cameras of '%s': %s", s.Address, reply.GetError())
+	}
+	return reply.GetDevices(), err
+}
+
+func (p *Platform) findDevice(devicePath camera.DevicePath) (*server, *remotepb.Device, error) {
+	s, remoteDevicePath, err := p.serverOf(devicePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	devices, err := p.listDevices(s)
+	for _, dev := range devices {
+		if dev.GetDevicePath() == remoteDevicePath {
+			return s, dev, nil
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, fmt.Errorf("'%s' has no camera '%s': %w", s.Address, remoteDevicePath, camera.ErrNotFound)
+}
+
+// ListCameras returns the cameras of all the added servers; if some
+// servers are not available, then they are reported in the error.
+func (p *Platform) ListCameras() ([]camera.DevicePath, error) {
+	p.locker.Lock()
+	servers := append([]*server(nil), p.servers...)
+	p.locker.Unlock()
+
+	var result []camera.DevicePath
+	var errs []error
+	for _, s := range servers {
+		devices, err := p.listDevices(s)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, dev := range devices {
+			result = append(result, DevicePath(s.Address, dev.GetDevicePath()))
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// DeviceIdentity implements camera.DeviceIdentifier; the identity is
+// the one reported by the server, prefixed with its address.
+func (p *Platform) DeviceIdentity(devicePath camera.DevicePath) (string, error) {
+	s, dev, err := p.findDevice(devicePath)
+	if err != nil {
+		return "", err
+	}
+	if dev.GetIdentity() == "" {
+		return devicePath, nil
+	}
+	return DevicePath(s.Address, dev.GetIdentity()), nil
+}
+
+// DescribeDevice implements camera.DeviceDescriber.
+func (p *Platform) DescribeDevice(devicePath camera.DevicePath) (camera.DeviceDescriptor, error) {
+	_, dev, err := p.findDevice(devicePath)
+	if err != nil {
+		return camera.DeviceDescriptor{}, err
+	}
+	return remote.DeviceDescriptorFromProto(dev.GetDeviceDescriptor()), nil
+}
+
+// ListFormats returns the formats of the raw frames (NV12 or YUYV);
+// the same formats are used to open the camera with compression.
+func (p *Platform) ListFormats(devicePath camera.DevicePath) (camera.Formats, error) {
+	s, remoteDevicePath, err := p.serverOf(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), p.Config.Timeout)
+	defer cancelFn()
+	reply, err := s.Client.ListFormats(ctx, &remotepb.ListFormatsRequest{
+		DevicePath: remoteDevicePath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the formats of '%s': %w", devicePath, remote.ErrorFromStatus(err))
+	}
+	return remote.FormatsFromProto(reply.GetFormats()), nil
+}
+
+// OpenCamera opens the camera with the raw frames, or with
+// Config.Compression (if the server is able to provide it).
+func (p *Platform) OpenCamera(
+	devicePath camera.DevicePath,
+	format camera.Format,
+) (camera.Camera, error) {
+	var encodings []*remotepb.Encoding
+	if p.Config.Compression == camera.CompressionMJPEG {
+		encodings = append(encodings, &remotepb.Encoding{
+			Compression: string(p.Config.Compression),
+			Quality:     int64(p.Config.CompressionQuality),
+		})
+	}
+	encodings = append(encodings, &remotepb.Encoding{})
+	sess, err := p.openSession(devicePath, format, encodings)
+	if err != nil {
+		return nil, err
+	}
+	return newCamera(sess), nil
+}
+
+// OpenCameraCompressed opens the camera with the compressed frames;
+// MJPEG is always supported (the server compresses the frames if the
+// camera cannot).
+func (p *Platform) OpenCameraCompressed(
+	devicePath camera.DevicePath,
+	format camera.Format,
+	compression camera.Compression,
+	compressionQuality camera.CompressionQuality,
+) (camera.CameraCompressed, error) {
+	if compression == camera.CompressionUndefined || compression == camera.CompressionAuto {
+		compression = camera.CompressionMJPEG
+	}
+	sess, err := p.openSession(devicePath, format, []*remotepb.Encoding{{
+		Compression: string(compression),
+		Quality:     int64(compressionQuality),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return &CameraCompressed{session: sess}, nil
+}
+
+func (p *Platform) openSession(
+	devicePath camera.DevicePath,
+	format camera.Format,
+	encodings []*remotepb.Encoding,
+) (_ *session, _err error) {
+	s, remoteDevicePath, err := p.serverOf(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer func() {
+		if _err != nil {
+			cancelFn()
+		}
+	}()
+
+	req := &remotepb.OpenCameraRequest{
+		DevicePath: remoteDevicePath,
+		Encodings:  encodings,
+	}
+	if format != (camera.Format{}) {
+		req.Format = remote.FormatToProto(format)
+	}
+	stream, err := s.Client.OpenCamera(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open camera '%s': %w", devicePath, remote.ErrorFromStatus(err))
+	}
+
+	// the stream is not limited by the timeout, only waiting for the reply is
+	timer := time.AfterFunc(p.Config.Timeout, cancelFn)
+	reply, err := stream.Recv()
+	if !timer.Stop() {
+		return nil, fmt.Errorf("unable to open camera '%s': %w", devicePath, camera.ErrTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open camera '%s': %w", devicePath, remote.ErrorFromStatus(err))
+	}
+	opened := reply.GetOpened()
+	if opened == nil {
+		return nil, fmt.Errorf("unable to open camera '%s': the server replied with a frame instead of the session", devicePath)
+	}
+	return newSession(s.Client, p.Config.Timeout, opened, stream, cancelFn), nil
+}
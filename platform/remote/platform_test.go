@@ -0,0 +1,249 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"image/jpeg"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/platform/synthetic"
+	"github.com/xaionaro-go/camera/remote"
+	"github.com/xaionaro-go/camera/remote/remotepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const testToken = "secret"
+
+var testFormat = camera.Format{
+	Width:       64,
+	Height:      48,
+	PixelFormat: camera.PixelFormatNV12,
+	FPS:         camera.Fraction{Numerator: 30, Denominator: 1},
+}
+
+// newTestCertificate returns a self-signed certificate of 127.0.0.1
+// and the pool trusting it.
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// startServer serves a synthetic camera on the loopback
+// and returns the address of the server.
+func startServer(t *testing.T, cfg remote.Config, opts ...grpc.ServerOption) string {
+	t.Helper()
+	cfg.Registry = camera.NewRegistry()
+	cfg.Registry.RegisterPlatformWithPriority("synthetic", synthetic.NewPlatform(synthetic.Config{
+		Formats: camera.Formats{testFormat},
+	}), 0)
+	cfg.OnError = func(err error) {
+		t.Logf("server: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer(opts...)
+	remote.New(cfg).Register(grpcServer)
+	go grpcServer.Serve(l)
+	t.Cleanup(grpcServer.Stop)
+	return l.Addr().String()
+}
+
+func TestLoopback(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	address := startServer(t, remote.Config{Token: testToken},
+		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
+	)
+	p := NewPlatform(Config{
+		TLSConfig: &tls.Config{RootCAs: pool},
+		Token:     testToken,
+	})
+	if err := p.AddServer(address); err != nil {
+		t.Fatal(err)
+	}
+	defer p.RemoveServer(address)
+
+	devicePath := DevicePath(address, synthetic.DevicePath(0))
+	cameras, err := p.ListCameras()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cameras) != 1 || cameras[0] != devicePath {
+		t.Fatalf("expected the cameras [%s], got %v", devicePath, cameras)
+	}
+	formats, err := p.ListFormats(devicePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(formats) != 1 || formats[0] != testFormat {
+		t.Fatalf("expected the formats [%v], got %v", testFormat, formats)
+	}
+	unknownPath := DevicePath(address, synthetic.DevicePath(1))
+	if _, err := p.DescribeDevice(unknownPath); !errors.Is(err, camera.ErrNotFound) {
+		t.Errorf("expected camera.ErrNotFound, got %v", err)
+	}
+	if _, err := p.OpenCamera(unknownPath, testFormat); !errors.Is(err, camera.ErrNotFound) {
+		t.Errorf("expected camera.ErrNotFound from the server, got %v", err)
+	}
+
+	t.Run("raw", func(t *testing.T) {
+		cam, err := p.OpenCamera(devicePath, testFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cam.Close()
+		if err := cam.StartStreaming(); err != nil {
+			t.Fatal(err)
+		}
+		var lastSeq uint64
+		for idx := 0; idx < 3; idx++ {
+			frame, err := cam.GetFrame(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := frame.Image().Bounds().Size(); size.X != 64 || size.Y != 48 {
+				t.Errorf("unexpected size of the frame: %v", size)
+			}
+			seq := frame.(camera.FrameSequencer).Sequence()
+			if idx > 0 && seq <= lastSeq {
+				t.Errorf("the sequence number %d does not follow %d", seq, lastSeq)
+			}
+			lastSeq = seq
+			if err := cam.ReleaseFrame(frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := cam.StopStreaming(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("mjpeg", func(t *testing.T) {
+		cam, err := p.OpenCameraCompressed(devicePath, testFormat, camera.CompressionMJPEG, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cam.Close()
+		if err := cam.StartStreaming(); err != nil {
+			t.Fatal(err)
+		}
+		frames, err := cam.GetCompressedFrames(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(frames.Bytes())); err != nil {
+			t.Errorf("unable to decode the frame: %v", err)
+		}
+		if err := cam.ReleaseFrames(frames); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestUnauthenticated(t *testing.T) {
+	address := startServer(t, remote.Config{Token: testToken})
+	for _, token := range []string{"", "wrong"} {
+		p := NewPlatform(Config{Insecure: true, Token: token})
+		if err := p.AddServer(address); err != nil {
+			t.Fatal(err)
+		}
+		_, err := p.ListCameras()
+		if !errors.Is(err, remote.ErrUnauthenticated) {
+			t.Errorf("expected an unauthenticated error with the token '%s', got %v", token, err)
+		}
+		_, err = p.OpenCamera(DevicePath(address, synthetic.DevicePath(0)), testFormat)
+		if !errors.Is(err, remote.ErrUnauthenticated) {
+			t.Errorf("expected an unauthenticated error with the token '%s', got %v", token, err)
+		}
+		p.RemoveServer(address)
+	}
+}
+
+func TestTLSByDefault(t *testing.T) {
+	address := startServer(t, remote.Config{})
+	p := NewPlatform(Config{Timeout: time.Second})
+	if err := p.AddServer(address); err != nil {
+		t.Fatal(err)
+	}
+	defer p.RemoveServer(address)
+	if _, err := p.ListCameras(); err == nil {
+		t.Errorf("expected the unencrypted server to be refused")
+	}
+}
+
+func TestForeignSession(t *testing.T) {
+	address := startServer(t, remote.Config{})
+	p := NewPlatform(Config{Insecure: true})
+	if err := p.AddServer(address); err != nil {
+		t.Fatal(err)
+	}
+	defer p.RemoveServer(address)
+	cam, err := p.OpenCamera(DevicePath(address, synthetic.DevicePath(0)), testFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cam.Close()
+	id := cam.(*Camera).id
+	if len(id) != 16 {
+		t.Errorf("expected a 128-bit session ID, got %d bytes", len(id))
+	}
+
+	// another client guessing a session
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := remotepb.NewCameraClient(conn)
+	ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	for _, guess := range [][]byte{nil, {1}, make([]byte, 16)} {
+		_, err := client.StartStreaming(ctx, &remotepb.SessionRequest{Session: guess})
+		if !errors.Is(remote.ErrorFromStatus(err), camera.ErrDeviceGone) {
+			t.Errorf("expected no session %x, got %v", guess, err)
+		}
+		_, err = client.SetControl(ctx, &remotepb.SetControlRequest{Session: guess, Id: 1})
+		if !errors.Is(remote.ErrorFromStatus(err), camera.ErrDeviceGone) {
+			t.Errorf("expected no session %x, got %v", guess, err)
+		}
+	}
+	if _, err := client.StartStreaming(ctx, &remotepb.SessionRequest{Session: id}); err != nil {
+		t.Errorf("unable to start streaming of the session: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package remote
+
+import (
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	PlatformID = camera.PlatformID("remote")
+
+	// Priority is the lowest, since the device paths
+	// never collide with the ones of the other platforms.
+	Priority = 10
+)
+
+var defaultPlatform = NewPlatform(Config{})
+
+// DefaultPlatform returns the platform registered in the default
+// registry; use AddServer to make the cameras of a server available
+// via the registry (and SetConfig to connect to the servers without
+// TLS or with a token).
+func DefaultPlatform() *Platform {
+	return defaultPlatform
+}
+
+func init() {
+	camera.DefaultRegistry().RegisterPlatformWithPriority(PlatformID, defaultPlatform, Priority)
+}
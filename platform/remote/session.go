@@ -0,0 +1,190 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/remote"
+	"github.com/xaionaro-go/camera/remote/remotepb"
+	"google.golang.org/grpc"
+)
+
+// session is a camera opened on the server; it is kept opened
+// while the stream of the frames is not cancelled.
+type session struct {
+	client  remotepb.CameraClient
+	timeout time.Duration
+	id      []byte
+
+	// format and encoding are of the frames sent by the server.
+	format   camera.Format
+	encoding *remotepb.Encoding
+
+	cancelFn  context.CancelFunc
+	frames    chan *remotepb.Frame
+	streaming atomic.Bool
+
+	// failure is set before failedCh is closed
+	failure    error
+	failedCh   chan struct{}
+	readerDone chan struct{}
+}
+
+func newSession(
+	client remotepb.CameraClient,
+	timeout time.Duration,
+	opened *remotepb.Opened,
+	stream grpc.ServerStreamingClient[remotepb.OpenCameraReply],
+	cancelFn context.CancelFunc,
+) *session {
+	s := &session{
+		client:     client,
+		timeout:    timeout,
+		id:         opened.GetSession(),
+		format:     remote.FormatFromProto(opened.GetFormat()),
+		encoding:   opened.GetEncoding(),
+		cancelFn:   cancelFn,
+		frames:     make(chan *remotepb.Frame, 1),
+		failedCh:   make(chan struct{}),
+		readerDone: make(chan struct{}),
+	}
+	go s.readLoop(stream)
+	return s
+}
+
+func (s *session) readLoop(stream grpc.ServerStreamingClient[remotepb.OpenCameraReply]) {
+	defer close(s.readerDone)
+	for {
+		reply, err := stream.Recv()
+		if err != nil {
+			s.failure = fmt.Errorf("the stream of the frames ended: %w", remote.ErrorFromStatus(err))
+			close(s.failedCh)
+			return
+		}
+		frame := reply.GetFrame()
+		if frame == nil {
+			continue
+		}
+		select {
+		case s.frames <- frame:
+		case <-stream.Context().Done():
+		}
+	}
+}
+
+func (s *session) getFrame(ctx context.Context) (*remotepb.Frame, error) {
+	if !s.streaming.Load() {
+		return nil, fmt.Errorf("the camera is not streaming: %w", camera.ErrNoFrame)
+	}
+	select {
+	case frame := <-s.frames:
+		return frame, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.failedCh:
+		return nil, s.failure
+	}
+}
+
+func (s *session) call(fn func(ctx context.Context) error) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), s.timeout)
+	defer cancelFn()
+	return remote.ErrorFromStatus(fn(ctx))
+}
+
+func (s *session) sessionRequest() *remotepb.SessionRequest {
+	return &remotepb.SessionRequest{Session: s.id}
+}
+
+func (s *session) GetFormat() camera.Format {
+	return s.format
+}
+
+func (s *session) StartStreaming() error {
+	err := s.call(func(ctx context.Context) error {
+		_, err := s.client.StartStreaming(ctx, s.sessionRequest())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to start streaming: %w", err)
+	}
+	s.streaming.Store(true)
+	return nil
+}
+
+func (s *session) StopStreaming() error {
+	s.streaming.Store(false)
+	err := s.call(func(ctx context.Context) error {
+		_, err := s.client.StopStreaming(ctx, s.sessionRequest())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to stop streaming: %w", err)
+	}
+	// the frame received before stopping is stale
+	select {
+	case <-s.frames:
+	default:
+	}
+	return nil
+}
+
+func (s *session) ListControls() ([]camera.Control, error) {
+	var reply *remotepb.ListControlsReply
+	err := s.call(func(ctx context.Context) (err error) {
+		reply, err = s.client.ListControls(ctx, s.sessionRequest())
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]camera.Control, 0, len(reply.GetControls()))
+	for _, ctrl := range reply.GetControls() {
+		result = append(result, remote.ControlFromProto(ctrl))
+	}
+	return result, nil
+}
+
+func (s *session) GetControl(id camera.ControlID) (int32, error) {
+	var reply *remotepb.GetControlReply
+	err := s.call(func(ctx context.Context) (err error) {
+		reply, err = s.client.GetControl(ctx, &remotepb.GetControlRequest{
+			Session: s.id,
+			Id:      uint32(id),
+		})
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.GetValue(), nil
+}
+
+func (s *session) SetControl(id camera.ControlID, value int32) error {
+	return s.call(func(ctx context.Context) error {
+		_, err := s.client.SetControl(ctx, &remotepb.SetControlRequest{
+			Session: s.id,
+			Id:      uint32(id),
+			Value:   value,
+		})
+		return err
+	})
+}
+
+// Close cancels the stream, so that the server closes the camera.
+func (s *session) Close() error {
+	s.cancelFn()
+	<-s.readerDone
+	return nil
+}
+
+func captureTS(frame *remotepb.Frame) time.Time {
+	ts := frame.GetCaptureUnixNano()
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ts)
+}
@@ -0,0 +1,189 @@
+package synthetic
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+type CameraConfig struct {
+	// Offset shifts the capture times of the frames, like the phase
+	// of a free-running sensor; the capture times of the cameras
+	// with the same FPS and no offset coincide.
+	Offset time.Duration
+
+	// Jitter is the maximal random error of the timestamps.
+	Jitter time.Duration
+
+	// DropRate is the probability (within [0, 1]) of a frame
+	// to be lost (like on a USB bandwidth hiccup).
+	DropRate float64
+
+	// Seed initializes the random generator of the jitter and the drops.
+	Seed int64
+}
+
+// Camera produces the frames in real time: GetFrame waits for the
+// capture time of the next frame, and if the consumer is late, then the
+// missed frames are skipped (as reported by Frame.SkippedFrames).
+type Camera struct {
+	Format camera.Format
+	Config CameraConfig
+
+	locker    sync.Mutex
+	rand      *rand.Rand
+	streaming bool
+	startTS   time.Time
+	nextSeq   uint64
+}
+
+var _ camera.Camera = (*Camera)(nil)
+
+func NewCamera(format camera.Format, cfg CameraConfig) (*Camera, error) {
+	switch format.PixelFormat {
+	case camera.PixelFormatNV12, camera.PixelFormatYUYV:
+	default:
+		return nil, fmt.Errorf("%w: pixel format %s", camera.ErrFormatRejected, format.PixelFormat)
+	}
+	if format.Width == 0 || format.Height == 0 || format.Width%2 != 0 || format.Height%2 != 0 {
+		return nil, fmt.Errorf("%w: resolution %dx%d", camera.ErrFormatRejected, format.Width, format.Height)
+	}
+	return &Camera{
+		Format: format,
+		Config: cfg,
+		rand:   rand.New(rand.NewSource(cfg.Seed)),
+	}, nil
+}
+
+func (c *Camera) GetFormat() camera.Format {
+	return c.Format
+}
+
+func (c *Camera) StartStreaming() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.streaming {
+		return nil
+	}
+	c.streaming = true
+	// aligning to a common grid, so that the cameras started
+	// at different moments are still in phase
+	c.startTS = time.Now().Truncate(frameDuration(c.Format)).Add(c.Config.Offset)
+	c.nextSeq = 0
+	return nil
+}
+
+func (c *Camera) StopStreaming() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.streaming = false
+	return nil
+}
+
+func (c *Camera) Close() error {
+	return c.StopStreaming()
+}
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	seq, captureTS, skipped, err := c.nextFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(time.Until(captureTS))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	c.locker.Lock()
+	ts := captureTS
+	if c.Config.Jitter > 0 {
+		ts = ts.Add(time.Duration(c.rand.Int63n(2*int64(c.Config.Jitter)+1)) - c.Config.Jitter)
+	}
+	c.locker.Unlock()
+
+	return &Frame{
+		ImageFrame: camera.ImageFrame{
+			Img:       c.render(seq),
+			Skipped:   skipped,
+			CaptureTS: ts,
+		},
+		Seq: seq,
+	}, nil
+}
+
+// nextFrame returns the sequence number and the capture time of the next
+// frame and how many frames were skipped (missed or dropped) before it.
+func (c *Camera) nextFrame() (uint64, time.Time, uint64, error) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if !c.streaming {
+		return 0, time.Time{}, 0, fmt.Errorf("the camera is not streaming")
+	}
+
+	period := frameDuration(c.Format)
+	seq := c.nextSeq
+	if elapsed := time.Since(c.startTS); elapsed > 0 {
+		// the frames captured while nobody was waiting are lost
+		seq = max(seq, uint64(elapsed/period))
+	}
+	for c.Config.DropRate > 0 && c.rand.Float64() < c.Config.DropRate {
+		seq++
+	}
+	skipped := seq - c.nextSeq
+	c.nextSeq = seq + 1
+	return seq, c.startTS.Add(time.Duration(seq) * period), skipped, nil
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	if _, ok := frame.(*Frame); !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	return nil
+}
+
+// render draws diagonal stripes moving with the sequence number and
+// a bright vertical bar crossing the picture.
+func (c *Camera) render(seq uint64) image.Image {
+	w, h := int(c.Format.Width), int(c.Format.Height)
+	rect := image.Rect(0, 0, w, h)
+	barX := int(seq*8) % w
+	luma := func(x, y int) uint8 {
+		if x >= barX && x < barX+8 {
+			return 235
+		}
+		return uint8(x + y + int(seq)*4)
+	}
+
+	if c.Format.PixelFormat == camera.PixelFormatYUYV {
+		img := ximage.NewYUYV(rect)
+		for y := 0; y < h; y++ {
+			row := img.Y0CbY1Cr[y*img.YStride/2:]
+			for x := 0; x < w; x += 2 {
+				row[x/2] = ximage.Y0CbY1Cr{Y0: luma(x, y), Cb: 128, Y1: luma(x+1, y), Cr: 128}
+			}
+		}
+		return img
+	}
+
+	img := ximage.NewNV12(rect)
+	for y := 0; y < h; y++ {
+		row := img.Y[y*img.YStride:]
+		for x := 0; x < w; x++ {
+			row[x] = luma(x, y)
+		}
+	}
+	for i := range img.CbCr {
+		img.CbCr[i] = ximage.CbCr{Cb: 128, Cr: 128}
+	}
+	return img
+}
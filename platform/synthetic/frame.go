@@ -0,0 +1,19 @@
+package synthetic
+
+import (
+	"github.com/xaionaro-go/camera"
+)
+
+type Frame struct {
+	camera.ImageFrame
+	Seq uint64
+}
+
+var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
+var _ camera.FrameTimestamper = (*Frame)(nil)
+var _ camera.FrameSequencer = (*Frame)(nil)
+
+func (f *Frame) Sequence() uint64 {
+	return f.Seq
+}
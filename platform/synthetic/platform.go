@@ -0,0 +1,143 @@
+// Package synthetic implements a camera.Platform of virtual cameras
+// producing a moving test pattern with the timestamps of a perfect
+// clock (optionally shifted and jittered), e.g. to test the pipelines
+// without any hardware.
+//
+// The platform is not registered in the default registry, to not
+// list fake cameras next to the real ones; use NewPlatform instead.
+package synthetic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// DevicePathPrefix is the prefix of the device paths, followed
+// by the number of the camera, e.g. "synthetic:0".
+const DevicePathPrefix = "synthetic:"
+
+// DefaultFormats are the formats of the cameras if Config.Formats is empty.
+var DefaultFormats = camera.Formats{
+	{Width: 640, Height: 480, PixelFormat: camera.PixelFormatNV12, FPS: camera.Fraction{Numerator: 30, Denominator: 1}},
+	{Width: 640, Height: 480, PixelFormat: camera.PixelFormatYUYV, FPS: camera.Fraction{Numerator: 30, Denominator: 1}},
+	{Width: 1280, Height: 720, PixelFormat: camera.PixelFormatNV12, FPS: camera.Fraction{Numerator: 30, Denominator: 1}},
+}
+
+type Config struct {
+	// Cameras is the amount of the cameras; 1 is used if zero.
+	Cameras int
+
+	// Formats are supported by every camera; DefaultFormats
+	// are used if empty. Only NV12 and YUYV are supported.
+	Formats camera.Formats
+
+	// CameraConfigs (if set) are the per-camera settings,
+	// indexed by the number of the camera.
+	CameraConfigs []CameraConfig
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Cameras == 0 {
+		cfg.Cameras = 1
+	}
+	if len(cfg.Formats) == 0 {
+		cfg.Formats = DefaultFormats
+	}
+	return cfg
+}
+
+type Platform struct {
+	Config Config
+}
+
+var _ camera.Platform = (*Platform)(nil)
+
+func NewPlatform(cfg Config) *Platform {
+	return &Platform{
+		Config: cfg.withDefaults(),
+	}
+}
+
+// DevicePath returns the device path of the camera number idx.
+func DevicePath(idx int) camera.DevicePath {
+	return DevicePathPrefix + strconv.Itoa(idx)
+}
+
+func (p *Platform) parseDevicePath(devicePath camera.DevicePath) (int, error) {
+	idxStr, ok := strings.CutPrefix(devicePath, DevicePathPrefix)
+	if !ok {
+		return 0, fmt.Errorf("the device path '%s' has no prefix '%s'", devicePath, DevicePathPrefix)
+	}
+	idx, err := strconv.Atoi(idxStr)
+	if err != nil || idx < 0 || idx >= p.Config.Cameras {
+		return 0, fmt.Errorf("there is no synthetic camera '%s'", devicePath)
+	}
+	return idx, nil
+}
+
+func (p *Platform) ListCameras() ([]camera.DevicePath, error) {
+	result := make([]camera.DevicePath, 0, p.Config.Cameras)
+	for idx := 0; idx < p.Config.Cameras; idx++ {
+		result = append(result, DevicePath(idx))
+	}
+	return result, nil
+}
+
+// DescribeDevice implements camera.DeviceDescriber.
+func (p *Platform) DescribeDevice(devicePath camera.DevicePath) (camera.DeviceDescriptor, error) {
+	if _, err := p.parseDevicePath(devicePath); err != nil {
+		return camera.DeviceDescriptor{}, err
+	}
+	return camera.DeviceDescriptor{
+		Name:    "Synthetic camera " + strings.TrimPrefix(devicePath, DevicePathPrefix),
+		Driver:  "synthetic",
+		BusInfo: devicePath,
+	}, nil
+}
+
+func (p *Platform) ListFormats(devicePath string) (camera.Formats, error) {
+	if _, err := p.parseDevicePath(devicePath); err != nil {
+		return nil, err
+	}
+	return p.Config.Formats, nil
+}
+
+func (p *Platform) OpenCamera(
+	devicePath string,
+	format camera.Format,
+) (camera.Camera, error) {
+	idx, err := p.parseDevicePath(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	var camCfg CameraConfig
+	if idx < len(p.Config.CameraConfigs) {
+		camCfg = p.Config.CameraConfigs[idx]
+	}
+	if camCfg.Seed == 0 {
+		camCfg.Seed = int64(idx) + 1
+	}
+	return NewCamera(format, camCfg)
+}
+
+func (p *Platform) OpenCameraCompressed(
+	devicePath camera.DevicePath,
+	format camera.Format,
+	compression camera.Compression,
+	compressionQuality camera.CompressionQuality,
+) (camera.CameraCompressed, error) {
+	return nil, fmt.Errorf("synthetic cameras produce no compressed frames: %w", camera.ErrNotSupported)
+}
+
+// frameDuration returns the interval between the frames of the format.
+func frameDuration(format camera.Format) time.Duration {
+	fps := format.FPS.Float64()
+	if format.FPS.Denominator == 0 || fps <= 0 {
+		fps = 30
+	}
+	return time.Duration(float64(time.Second) / fps)
+}
@@ -0,0 +1,311 @@
+package v4l2
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+type MemoryType uint32
+
+const (
+	MemoryTypeUndefined = MemoryType(0)
+	MemoryTypeMMAP      = MemoryType(1) // V4L2_MEMORY_MMAP
+	MemoryTypeUserPtr   = MemoryType(2) // V4L2_MEMORY_USERPTR
+)
+
+func (t MemoryType) String() string {
+	switch t {
+	case MemoryTypeUndefined:
+		return "<undefined>"
+	case MemoryTypeMMAP:
+		return "MMAP"
+	case MemoryTypeUserPtr:
+		return "USERPTR"
+	default:
+		return fmt.Sprintf("<unknown:%d>", uint32(t))
+	}
+}
+
+const (
+	DefaultBufferCount = 4
+	DefaultMemoryType  = MemoryTypeMMAP
+)
+
+type StreamingConfig struct {
+	// BufferCount is the amount of buffers to request from the driver;
+	// the driver may adjust it. Zero means DefaultBufferCount.
+	BufferCount uint32
+
+	// MemoryType is the V4L2 streaming I/O method.
+	// MemoryTypeUndefined means DefaultMemoryType.
+	MemoryType MemoryType
+
+	// Allocator provides the buffers for MemoryTypeUserPtr;
+	// nil means DefaultBufferPool.
+	Allocator BufferAllocator
+}
+
+func (cfg StreamingConfig) withDefaults() StreamingConfig {
+	if cfg.BufferCount == 0 {
+		cfg.BufferCount = DefaultBufferCount
+	}
+	if cfg.MemoryType == MemoryTypeUndefined {
+		cfg.MemoryType = DefaultMemoryType
+	}
+	if cfg.Allocator == nil {
+		cfg.Allocator = DefaultBufferPool()
+	}
+	return cfg
+}
+
+type BufferAllocator interface {
+	AllocBuffer(size uint) ([]byte, error)
+	FreeBuffer([]byte)
+}
+
+// MmapAllocator allocates page-aligned anonymous memory,
+// as USERPTR buffers are expected to be page-aligned by many drivers.
+type MmapAllocator struct{}
+
+var _ BufferAllocator = MmapAllocator{}
+
+func (MmapAllocator) AllocBuffer(size uint) ([]byte, error) {
+	pageSize := uint(os.Getpagesize())
+	size = (size + pageSize - 1) / pageSize * pageSize
+	b, err := unix.Mmap(-1, 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANONYMOUS|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to allocate %d bytes: %w", size, err)
+	}
+	return b, nil
+}
+
+func (MmapAllocator) FreeBuffer(b []byte) {
+	_ = unix.Munmap(b[:cap(b)])
+}
+
+// BufferPool keeps freed buffers for reuse, so that re-opening a camera
+// or restarting streaming does not have to allocate the memory again.
+type BufferPool struct {
+	Allocator BufferAllocator
+
+	locker sync.Mutex
+	free   map[uint][][]byte
+}
+
+var _ BufferAllocator = (*BufferPool)(nil)
+
+func NewBufferPool(allocator BufferAllocator) *BufferPool {
+	return &BufferPool{
+		Allocator: allocator,
+		free:      map[uint][][]byte{},
+	}
+}
+
+var defaultBufferPool = NewBufferPool(MmapAllocator{})
+
+func DefaultBufferPool() *BufferPool {
+	return defaultBufferPool
+}
+
+func (p *BufferPool) AllocBuffer(size uint) ([]byte, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if bufs := p.free[size]; len(bufs) > 0 {
+		b := bufs[len(bufs)-1]
+		p.free[size] = bufs[:len(bufs)-1]
+		return b, nil
+	}
+	b, err := p.Allocator.AllocBuffer(size)
+	if err != nil {
+		return nil, err
+	}
+	return b[:size], nil
+}
+
+func (p *BufferPool) FreeBuffer(b []byte) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.free[uint(len(b))] = append(p.free[uint(len(b))], b)
+}
+
+// Purge returns all the cached buffers back to the underlying allocator.
+func (p *BufferPool) Purge() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	for size, bufs := range p.free {
+		for _, b := range bufs {
+			p.Allocator.FreeBuffer(b)
+		}
+		delete(p.free, size)
+	}
+}
+
+type streamBuffers struct {
+	FD         uintptr
+	MemoryType MemoryType
+	Allocator  BufferAllocator
+	Buffers    [][]byte
+
+	locker sync.Mutex
+	// lent are the buffers dequeued as frames and not released yet;
+	// the memory is freed only after all of them are released.
+	lent    map[uint32]struct{}
+	stopped bool
+	// fdClosed means the buffers outlived the device (see detach).
+	fdClosed bool
+}
+
+func newStreamBuffers(
+	fd uintptr,
+	cfg StreamingConfig,
+) (_ *streamBuffers, _err error) {
+	count, err := requestBuffers(fd, cfg.MemoryType, cfg.BufferCount)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request %d %s buffers: %w", cfg.BufferCount, cfg.MemoryType, err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("the driver allocated zero %s buffers", cfg.MemoryType)
+	}
+
+	s := &streamBuffers{
+		FD:         fd,
+		MemoryType: cfg.MemoryType,
+		Allocator:  cfg.Allocator,
+		lent:       map[uint32]struct{}{},
+	}
+	defer func() {
+		if _err != nil {
+			s.free()
+		}
+	}()
+
+	var sizeImage uint32
+	if cfg.MemoryType == MemoryTypeUserPtr {
+		pixFmt, err := getPixFormat(fd)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the image size: %w", err)
+		}
+		sizeImage = pixFmt.SizeImage
+	}
+
+	for index := uint32(0); index < count; index++ {
+		var b []byte
+		switch cfg.MemoryType {
+		case MemoryTypeMMAP:
+			buf, err := queryBuffer(fd, cfg.MemoryType, index)
+			if err != nil {
+				return nil, fmt.Errorf("unable to query buffer %d: %w", index, err)
+			}
+			b, err = unix.Mmap(int(fd), int64(buf.M), int(buf.Length), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+			if err != nil {
+				return nil, fmt.Errorf("unable to mmap buffer %d: %w", index, err)
+			}
+		case MemoryTypeUserPtr:
+			b, err = cfg.Allocator.AllocBuffer(uint(sizeImage))
+			if err != nil {
+				return nil, fmt.Errorf("unable to allocate buffer %d: %w", index, err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported memory type %s", cfg.MemoryType)
+		}
+		s.Buffers = append(s.Buffers, b)
+	}
+
+	for index := range s.Buffers {
+		if err := s.queue(uint32(index)); err != nil {
+			return nil, fmt.Errorf("unable to queue buffer %d: %w", index, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *streamBuffers) queue(index uint32) error {
+	return queueBuffer(s.FD, s.MemoryType, index, s.Buffers[index])
+}
+
+func (s *streamBuffers) dequeue() (*v4l2Buffer, error) {
+	return dequeueBuffer(s.FD, s.MemoryType)
+}
+
+// lend marks the buffer as used by a frame.
+func (s *streamBuffers) lend(index uint32) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.lent[index] = struct{}{}
+}
+
+// giveBack requeues the buffer of a released frame; if the streaming is
+// stopped, then the buffers are freed after the last one is given back.
+func (s *streamBuffers) giveBack(index uint32) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if _, ok := s.lent[index]; !ok {
+		return fmt.Errorf("buffer %d is not used by a frame", index)
+	}
+	delete(s.lent, index)
+	if !s.stopped {
+		return s.queue(index)
+	}
+	if len(s.lent) > 0 {
+		return nil
+	}
+	return s.freeLocked()
+}
+
+// pending returns true if the buffers are stopped, but not
+// freed yet since some frames are not released.
+func (s *streamBuffers) pending() bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.stopped && s.Buffers != nil
+}
+
+// detach is called when the device is closed while some frames are
+// not released; the memory is still freed after they are released.
+func (s *streamBuffers) detach() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.fdClosed = true
+}
+
+// free frees the buffers, or defers it until all the frames
+// using the buffers are released; the streaming should be off.
+func (s *streamBuffers) free() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.stopped = true
+	if len(s.lent) > 0 {
+		return nil
+	}
+	return s.freeLocked()
+}
+
+func (s *streamBuffers) freeLocked() error {
+	// MMAP buffers have to be unmapped before the driver may release them,
+	// while USERPTR buffers may be reused only after the driver released them.
+	if s.MemoryType == MemoryTypeMMAP {
+		for _, b := range s.Buffers {
+			_ = unix.Munmap(b)
+		}
+	}
+	var err error
+	if !s.fdClosed {
+		// otherwise the driver released them on close
+		_, err = requestBuffers(s.FD, s.MemoryType, 0)
+	}
+	if s.MemoryType == MemoryTypeUserPtr {
+		for _, b := range s.Buffers {
+			s.Allocator.FreeBuffer(b)
+		}
+	}
+	s.Buffers = nil
+	if err != nil {
+		return fmt.Errorf("unable to release the buffers: %w", err)
+	}
+	return nil
+}
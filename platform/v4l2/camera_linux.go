@@ -2,90 +2,237 @@ package v4l2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/blackjack/webcam"
 	"github.com/xaionaro-go/camera"
 	"github.com/xaionaro-go/camera/rawimage"
+	"golang.org/x/sys/unix"
 )
 
 type Camera struct {
-	Camera *webcam.Webcam
-	Format camera.Format
+	Camera          *webcam.Webcam
+	Format          camera.Format
+	StreamingConfig StreamingConfig
+	LatestFrameOnly bool
+
+	// fd is the device opened by OpenCamera for the streaming
+	// (zero if the Camera is not opened by OpenCamera).
+	fd       uintptr
+	canceler *canceler
+	buffers  *streamBuffers
+
+	// stopped are the buffers of the previous streaming,
+	// kept until all of their frames are released.
+	stopped *streamBuffers
 }
 
 var _ camera.Camera = (*Camera)(nil)
+var _ camera.LatestFrameOnlySetter = (*Camera)(nil)
+var _ camera.Controls = (*Camera)(nil)
 
-func (c *Camera) StartStreaming() error {
-	return c.Camera.StartStreaming()
+func (c *Camera) StartStreaming() (_err error) {
+	if c.buffers != nil {
+		return fmt.Errorf("already streaming")
+	}
+	if c.stopped != nil {
+		if c.stopped.pending() {
+			return fmt.Errorf("the frames of the previous streaming are not released: %w", camera.ErrDeviceBusy)
+		}
+		c.stopped = nil
+	}
+
+	buffers, err := newStreamBuffers(c.fd, c.StreamingConfig.withDefaults())
+	if err != nil {
+		return fmt.Errorf("unable to initialize the buffers: %w", wrapErrno(err, nil))
+	}
+	defer func() {
+		if _err != nil {
+			buffers.free()
+		}
+	}()
+
+	if err := streamOn(c.fd); err != nil {
+		return fmt.Errorf("unable to start streaming: %w", wrapErrno(err, nil))
+	}
+
+	c.buffers = buffers
+	return nil
 }
 
 func (c *Camera) StopStreaming() error {
-	return c.Camera.StopStreaming()
+	if c.buffers == nil {
+		return fmt.Errorf("not streaming")
+	}
+
+	err := streamOff(c.fd)
+	if freeErr := c.buffers.free(); freeErr != nil && err == nil {
+		err = freeErr
+	}
+	if c.buffers.pending() {
+		c.stopped = c.buffers
+	}
+	c.buffers = nil
+	if err != nil {
+		return fmt.Errorf("unable to stop streaming: %w", err)
+	}
+	return nil
 }
 
+// Close closes the device; the memory of the frames which are not
+// released yet is freed when they are released.
 func (c *Camera) Close() error {
-	return c.Camera.Close()
+	var errs []error
+	if c.buffers != nil {
+		errs = append(errs, c.StopStreaming())
+	}
+	if c.stopped != nil {
+		c.stopped.detach()
+		c.stopped = nil
+	}
+	if c.canceler != nil {
+		c.canceler.Close()
+	}
+	if c.fd != 0 {
+		errs = append(errs, unix.Close(int(c.fd)))
+	}
+	errs = append(errs, c.Camera.Close())
+	return errors.Join(errs...)
+}
+
+func (c *Camera) SetLatestFrameOnly(v bool) {
+	c.LatestFrameOnly = v
 }
 
 func (c *Camera) GetFormat() camera.Format {
 	return c.Format
 }
 
+// BufferCount returns the amount of buffers actually allocated by the driver,
+// or the requested amount if the streaming is not started.
+func (c *Camera) BufferCount() uint32 {
+	if c.buffers != nil {
+		return uint32(len(c.buffers.Buffers))
+	}
+	return c.StreamingConfig.withDefaults().BufferCount
+}
+
+// QueueLatency returns the maximal age of a frame that may be returned
+// by GetFrame due to the depth of the buffer queue.
+func (c *Camera) QueueLatency() time.Duration {
+	fps := c.Format.FPS.Float64()
+	if fps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(c.BufferCount()) * float64(time.Second) / fps)
+}
+
 func (c *Camera) GetFrame(
 	ctx context.Context,
 ) (camera.Frame, error) {
-	for tryCount := 0; tryCount < 10*int(c.Format.FPS.Float64()); tryCount++ {
+	if c.buffers == nil {
+		return nil, fmt.Errorf("not streaming")
+	}
+
+	for {
 		if err := c.WaitForFrame(ctx); err != nil {
 			return nil, fmt.Errorf("unable to wait for a frame: %w", err)
 		}
 
-		b, frameID, err := c.Camera.GetFrame()
+		buf, err := c.buffers.dequeue()
+		if errors.Is(err, unix.EAGAIN) {
+			continue
+		}
 		if err != nil {
-			return nil, fmt.Errorf("unable to read a frame: %w", err)
+			return nil, fmt.Errorf("unable to read a frame: %w", wrapErrno(err, nil))
 		}
 
-		if len(b) != 0 {
-			img, err := rawimage.NewRawImage(&c.Format, b)
-			if err != nil {
-				return nil, fmt.Errorf("unable to parse the image: %w", err)
+		if !buf.isUsable() {
+			if err := c.buffers.queue(buf.Index); err != nil {
+				return nil, fmt.Errorf("cannot release an allocated frame (%d): %w", buf.Index, err)
 			}
+			continue
+		}
 
-			return &Frame{
-				FrameID: frameID,
-				Frame:   img,
-			}, nil
+		var skipped uint64
+		if c.LatestFrameOnly {
+			buf, skipped, err = c.dequeueLatest(buf)
+			if err != nil {
+				return nil, fmt.Errorf("unable to drain the queue of frames: %w", wrapErrno(err, nil))
+			}
 		}
-		if err := c.Camera.ReleaseFrame(frameID); err != nil {
-			return nil, fmt.Errorf("cannot release an allocated frame (%d): %w", frameID, err)
+
+		frameID := buf.Index
+		img, err := rawimage.NewRawImage(&c.Format, c.buffers.Buffers[frameID][:buf.BytesUsed])
+		if err != nil {
+			c.buffers.queue(frameID)
+			return nil, fmt.Errorf("unable to parse the image: %w", err)
 		}
 
-		time.Sleep(time.Duration(float64(time.Second) / c.Format.FPS.Float64()))
+		buffers := c.buffers
+		buffers.lend(frameID)
+		return &Frame{
+			FrameID:   frameID,
+			Frame:     img,
+			Skipped:   skipped,
+			CaptureTS: buf.captureTime(),
+			Seq:       buf.Sequence,
+			release: func() error {
+				return buffers.giveBack(frameID)
+			},
+		}, nil
 	}
+}
 
-	return nil, fmt.Errorf("internal error: we always get a zero-sized frame")
+// dequeueLatest dequeues all the frames already captured by the device,
+// requeues all of them except the most recent one and returns it
+// together with the amount of the requeued (skipped) frames.
+func (c *Camera) dequeueLatest(
+	latest *v4l2Buffer,
+) (*v4l2Buffer, uint64, error) {
+	var skipped uint64
+	// the amount of iterations is limited to make sure we won't chase
+	// a device that is faster than us forever
+	for range c.buffers.Buffers {
+		buf, err := c.buffers.dequeue()
+		if errors.Is(err, unix.EAGAIN) {
+			return latest, skipped, nil
+		}
+		if err != nil {
+			c.buffers.queue(latest.Index)
+			return nil, skipped, err
+		}
+
+		if !buf.isUsable() {
+			if err := c.buffers.queue(buf.Index); err != nil {
+				c.buffers.queue(latest.Index)
+				return nil, skipped, fmt.Errorf("cannot release an allocated frame (%d): %w", buf.Index, err)
+			}
+			continue
+		}
+
+		if err := c.buffers.queue(latest.Index); err != nil {
+			c.buffers.queue(buf.Index)
+			return nil, skipped, fmt.Errorf("cannot release an allocated frame (%d): %w", latest.Index, err)
+		}
+		latest = buf
+		skipped++
+	}
+	return latest, skipped, nil
 }
 
+// ReleaseFrame returns the buffer of the frame to the driver; the frames
+// may be released also after StopStreaming and Close.
 func (c *Camera) ReleaseFrame(frame camera.Frame) error {
-	return c.Camera.ReleaseFrame(frame.(*Frame).FrameID)
+	f, ok := frame.(*Frame)
+	if !ok || f.release == nil {
+		return fmt.Errorf("unexpected frame %T", frame)
+	}
+	return f.release()
 }
 
 func (c *Camera) WaitForFrame(ctx context.Context) error {
-	for {
-		err := c.Camera.WaitForFrame(1)
-		switch err.(type) {
-		case *webcam.Timeout:
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-				continue
-			}
-		case nil:
-			return nil
-		default:
-			return err
-		}
-	}
+	return waitReadable(ctx, c.fd, c.canceler)
 }
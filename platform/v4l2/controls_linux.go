@@ -0,0 +1,110 @@
+package v4l2
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blackjack/webcam"
+	"github.com/xaionaro-go/camera"
+)
+
+// see enum v4l2_ctrl_type
+const (
+	v4l2CtrlTypeInteger     = 1
+	v4l2CtrlTypeBoolean     = 2
+	v4l2CtrlTypeMenu        = 3
+	v4l2CtrlTypeButton      = 4
+	v4l2CtrlTypeIntegerMenu = 9
+)
+
+func controlTypeFromV4L2(t int32) camera.ControlType {
+	switch t {
+	case v4l2CtrlTypeInteger:
+		return camera.ControlTypeInteger
+	case v4l2CtrlTypeBoolean:
+		return camera.ControlTypeBoolean
+	case v4l2CtrlTypeMenu, v4l2CtrlTypeIntegerMenu:
+		return camera.ControlTypeMenu
+	case v4l2CtrlTypeButton:
+		return camera.ControlTypeButton
+	}
+	return camera.ControlTypeOther
+}
+
+func listControls(w *webcam.Webcam) []camera.Control {
+	var result []camera.Control
+	for id, c := range w.GetControls() {
+		result = append(result, camera.Control{
+			ID:   camera.ControlID(id),
+			Name: c.Name,
+			Type: controlTypeFromV4L2(c.Type),
+			Min:  c.Min,
+			Max:  c.Max,
+			Step: c.Step,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+func getControl(w *webcam.Webcam, id camera.ControlID) (int32, error) {
+	v, err := w.GetControl(webcam.ControlID(id))
+	if err != nil {
+		return 0, fmt.Errorf("unable to get control 0x%08X: %w", id, wrapErrno(err, nil))
+	}
+	return v, nil
+}
+
+func setControl(w *webcam.Webcam, id camera.ControlID, value int32) error {
+	if err := w.SetControl(webcam.ControlID(id), value); err != nil {
+		return fmt.Errorf("unable to set control 0x%08X to %d: %w", id, value, wrapErrno(err, nil))
+	}
+	return nil
+}
+
+// DeviceControls gives access to the controls of a device
+// which is not opened as a camera.
+type DeviceControls struct {
+	Camera *webcam.Webcam
+}
+
+var _ camera.ControlsCloser = (*DeviceControls)(nil)
+
+func (c *DeviceControls) ListControls() ([]camera.Control, error) {
+	return listControls(c.Camera), nil
+}
+
+func (c *DeviceControls) GetControl(id camera.ControlID) (int32, error) {
+	return getControl(c.Camera, id)
+}
+
+func (c *DeviceControls) SetControl(id camera.ControlID, value int32) error {
+	return setControl(c.Camera, id, value)
+}
+
+func (c *DeviceControls) Close() error {
+	return c.Camera.Close()
+}
+
+// OpenControls implements camera.ControlsOpener.
+func (Platform) OpenControls(devicePath camera.DevicePath) (camera.ControlsCloser, error) {
+	webCam, err := webcam.Open(devicePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open '%s' as V4L2 camera: %w", devicePath, wrapErrno(err, nil))
+	}
+	return &DeviceControls{Camera: webCam}, nil
+}
+
+func (c *Camera) ListControls() ([]camera.Control, error) {
+	return listControls(c.Camera), nil
+}
+
+func (c *Camera) GetControl(id camera.ControlID) (int32, error) {
+	return getControl(c.Camera, id)
+}
+
+func (c *Camera) SetControl(id camera.ControlID, value int32) error {
+	return setControl(c.Camera, id, value)
+}
@@ -0,0 +1,103 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/xaionaro-go/camera"
+	"golang.org/x/sys/unix"
+)
+
+const devDir = "/dev/"
+
+func listVideoNodes() ([]camera.DevicePath, error) {
+	entries, err := os.ReadDir(devDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable list the available devices: %w", err)
+	}
+
+	var result []camera.DevicePath
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), "video") {
+			result = append(result, path.Join(devDir, entry.Name()))
+		}
+	}
+	return result, nil
+}
+
+type deviceKind struct {
+	Name         string
+	RequiredCaps uint32
+}
+
+var (
+	deviceKindCapture = deviceKind{
+		Name:         "video capture device",
+		RequiredCaps: v4l2CapVideoCapture | v4l2CapStreaming,
+	}
+	deviceKindOutput = deviceKind{
+		Name:         "video output device",
+		RequiredCaps: v4l2CapVideoOutput | v4l2CapReadWrite,
+	}
+)
+
+// probeDevice returns nil if the node is a usable device of the given kind,
+// otherwise it returns the reason why it is not.
+//
+// Checking if the device is busy requires to touch its capture buffer queue,
+// so it is done only if checkBusy is true.
+func probeDevice(devicePath camera.DevicePath, kind deviceKind, checkBusy bool) error {
+	fd, err := unix.Open(devicePath, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open: %w", wrapErrno(err, nil))
+	}
+	defer unix.Close(fd)
+
+	caps, err := queryCapability(uintptr(fd))
+	if err != nil {
+		return fmt.Errorf("not a V4L2 device: %w", wrapErrno(err, nil))
+	}
+	devCaps := caps.deviceCapabilities()
+	if devCaps&kind.RequiredCaps != kind.RequiredCaps {
+		return fmt.Errorf("not a %s (capabilities: 0x%08X): %w", kind.Name, devCaps, camera.ErrNotSupported)
+	}
+
+	if checkBusy {
+		// releasing zero buffers fails with EBUSY if the queue
+		// is owned by another file handle:
+		if _, err := requestBuffers(uintptr(fd), MemoryTypeMMAP, 0); err != nil {
+			return fmt.Errorf("the buffer queue is not available: %w", wrapErrno(err, nil))
+		}
+	}
+	return nil
+}
+
+// DiagnoseCameras implements camera.DiagnosticsProvider.
+func (Platform) DiagnoseCameras() ([]camera.DeviceDiagnostics, error) {
+	nodes, err := listVideoNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]camera.DeviceDiagnostics, 0, len(nodes))
+	for _, devicePath := range nodes {
+		result = append(result, camera.DeviceDiagnostics{
+			DevicePath: devicePath,
+			Problem:    probeDevice(devicePath, deviceKindCapture, true),
+		})
+	}
+	return result, nil
+}
+
+// isAccessProblem returns true if the node is likely a camera, which
+// just cannot be used by the current user.
+func isAccessProblem(err error) bool {
+	return errors.Is(err, fs.ErrPermission)
+}
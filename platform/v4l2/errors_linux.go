@@ -0,0 +1,39 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xaionaro-go/camera"
+	"golang.org/x/sys/unix"
+)
+
+// wrapErrno wraps the error with the camera error matching the errno found
+// in the error chain. If there is no matching camera error then
+// the fallback is used (unless it is nil).
+func wrapErrno(err error, fallback error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errno unix.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case unix.EBUSY:
+			return fmt.Errorf("%w: %w", camera.ErrDeviceBusy, err)
+		case unix.ENOENT:
+			return fmt.Errorf("%w: %w", camera.ErrNotFound, err)
+		case unix.ENODEV, unix.ENXIO, unix.EIO:
+			return fmt.Errorf("%w: %w", camera.ErrDeviceGone, err)
+		case unix.ETIMEDOUT:
+			return fmt.Errorf("%w: %w", camera.ErrTimeout, err)
+		case unix.ENOTTY:
+			return fmt.Errorf("%w: %w", camera.ErrNotSupported, err)
+		}
+	}
+
+	if fallback != nil {
+		return fmt.Errorf("%w: %w", fallback, err)
+	}
+	return err
+}
@@ -2,17 +2,42 @@ package v4l2
 
 import (
 	"image"
+	"time"
 
 	"github.com/xaionaro-go/camera"
 )
 
 type Frame struct {
-	FrameID uint32
-	Frame   image.Image
+	FrameID   uint32
+	Frame     image.Image
+	Skipped   uint64
+	CaptureTS time.Time
+
+	// Seq is the sequence number of the frame as counted by the driver.
+	Seq uint32
+
+	// release returns the buffer of the frame to the streaming
+	// it was captured by (which may be stopped already).
+	release func() error
 }
 
 var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
+var _ camera.FrameTimestamper = (*Frame)(nil)
+var _ camera.FrameSequencer = (*Frame)(nil)
 
 func (f *Frame) Image() image.Image {
 	return f.Frame
 }
+
+func (f *Frame) SkippedFrames() uint64 {
+	return f.Skipped
+}
+
+func (f *Frame) Timestamp() time.Time {
+	return f.CaptureTS
+}
+
+func (f *Frame) Sequence() uint64 {
+	return uint64(f.Seq)
+}
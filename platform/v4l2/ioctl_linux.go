@@ -0,0 +1,282 @@
+package v4l2
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/blackjack/webcam/ioctl"
+	"golang.org/x/sys/unix"
+)
+
+// see https://www.kernel.org/doc/html/latest/userspace-api/media/v4l/videodev.html#videodev2-h
+
+const (
+	v4l2BufTypeVideoCapture = uint32(1)
+	v4l2BufTypeVideoOutput  = uint32(2)
+	v4l2BufFlagError        = uint32(0x00000040)
+
+	v4l2BufFlagTimestampMask      = uint32(0x0000e000)
+	v4l2BufFlagTimestampMonotonic = uint32(0x00002000)
+
+	v4l2FieldNone = uint32(1)
+
+	v4l2CapVideoCapture = uint32(0x00000001)
+	v4l2CapVideoOutput  = uint32(0x00000002)
+	v4l2CapReadWrite    = uint32(0x01000000)
+	v4l2CapStreaming    = uint32(0x04000000)
+	v4l2CapDeviceCaps   = uint32(0x80000000)
+)
+
+type v4l2Capability struct {
+	Driver       [16]uint8
+	Card         [32]uint8
+	BusInfo      [32]uint8
+	Version      uint32
+	Capabilities uint32
+	DeviceCaps   uint32
+	Reserved     [3]uint32
+}
+
+// deviceCapabilities returns the capabilities of the opened node
+// (rather than of the whole physical device) if the driver reports them.
+func (c *v4l2Capability) deviceCapabilities() uint32 {
+	if c.Capabilities&v4l2CapDeviceCaps != 0 {
+		return c.DeviceCaps
+	}
+	return c.Capabilities
+}
+
+type v4l2RequestBuffers struct {
+	Count        uint32
+	Type         uint32
+	Memory       uint32
+	Capabilities uint32
+	Flags        uint8
+	Reserved     [3]uint8
+}
+
+type v4l2Timecode struct {
+	Type     uint32
+	Flags    uint32
+	Frames   uint8
+	Seconds  uint8
+	Minutes  uint8
+	Hours    uint8
+	Userbits [4]uint8
+}
+
+type v4l2Buffer struct {
+	Index     uint32
+	Type      uint32
+	BytesUsed uint32
+	Flags     uint32
+	Field     uint32
+	Timestamp unix.Timeval
+	Timecode  v4l2Timecode
+	Sequence  uint32
+	Memory    uint32
+	M         uintptr // union { __u32 offset; unsigned long userptr; ... }
+	Length    uint32
+	Reserved2 uint32
+	RequestFD int32
+}
+
+// isUsable returns false if the buffer has no data or the data is
+// known to be corrupted; such buffers should be just requeued.
+func (buf *v4l2Buffer) isUsable() bool {
+	return buf.BytesUsed != 0 && buf.Flags&v4l2BufFlagError == 0
+}
+
+// captureTime returns the time when the frame was captured, converting
+// the monotonic timestamp of the driver into the wall clock; the current
+// time is returned if the driver does not provide a monotonic timestamp.
+func (buf *v4l2Buffer) captureTime() time.Time {
+	now := time.Now()
+	if buf.Flags&v4l2BufFlagTimestampMask != v4l2BufFlagTimestampMonotonic {
+		return now
+	}
+	var monotonicNow unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &monotonicNow); err != nil {
+		return now
+	}
+	age := time.Duration(monotonicNow.Nano() - buf.Timestamp.Nano())
+	if age < 0 {
+		return now
+	}
+	return now.Add(-age)
+}
+
+type v4l2PixFormat struct {
+	Width        uint32
+	Height       uint32
+	PixelFormat  uint32
+	Field        uint32
+	BytesPerLine uint32
+	SizeImage    uint32
+	Colorspace   uint32
+	Priv         uint32
+	Flags        uint32
+	YCbCrEnc     uint32
+	Quantization uint32
+	XferFunc     uint32
+}
+
+type v4l2Format struct {
+	Type uint32
+	Fmt  struct {
+		_    [0]uint64 // the alignment of the union (it has pointers in C)
+		Data [200]byte
+	}
+}
+
+type v4l2Fract struct {
+	Numerator   uint32
+	Denominator uint32
+}
+
+type v4l2OutputParm struct {
+	Capability   uint32
+	OutputMode   uint32
+	TimePerFrame v4l2Fract
+	ExtendedMode uint32
+	WriteBuffers uint32
+	Reserved     [4]uint32
+}
+
+type v4l2StreamParm struct {
+	Type uint32
+	Parm [200]byte
+}
+
+var (
+	vidiocQueryCap  = ioctl.IoR('V', 0, unsafe.Sizeof(v4l2Capability{}))
+	vidiocGFmt      = ioctl.IoRW('V', 4, unsafe.Sizeof(v4l2Format{}))
+	vidiocSFmt      = ioctl.IoRW('V', 5, unsafe.Sizeof(v4l2Format{}))
+	vidiocSParm     = ioctl.IoRW('V', 22, unsafe.Sizeof(v4l2StreamParm{}))
+	vidiocReqBufs   = ioctl.IoRW('V', 8, unsafe.Sizeof(v4l2RequestBuffers{}))
+	vidiocQueryBuf  = ioctl.IoRW('V', 9, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocQBuf      = ioctl.IoRW('V', 15, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocDQBuf     = ioctl.IoRW('V', 17, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocStreamOn  = ioctl.IoW('V', 18, 4)
+	vidiocStreamOff = ioctl.IoW('V', 19, 4)
+)
+
+func ioctlPtr[T any](fd uintptr, op uintptr, arg *T) error {
+	for {
+		err := ioctl.Ioctl(fd, op, uintptr(unsafe.Pointer(arg)))
+		if err == unix.EINTR {
+			continue
+		}
+		return err
+	}
+}
+
+func queryCapability(fd uintptr) (*v4l2Capability, error) {
+	c := &v4l2Capability{}
+	if err := ioctlPtr(fd, vidiocQueryCap, c); err != nil {
+		return nil, fmt.Errorf("VIDIOC_QUERYCAP: %w", err)
+	}
+	return c, nil
+}
+
+func getPixFormat(fd uintptr) (*v4l2PixFormat, error) {
+	return getPixFormatOfType(fd, v4l2BufTypeVideoCapture)
+}
+
+func getPixFormatOfType(fd uintptr, bufType uint32) (*v4l2PixFormat, error) {
+	f := &v4l2Format{Type: bufType}
+	if err := ioctlPtr(fd, vidiocGFmt, f); err != nil {
+		return nil, fmt.Errorf("VIDIOC_G_FMT: %w", err)
+	}
+	pixFmt := *(*v4l2PixFormat)(unsafe.Pointer(&f.Fmt))
+	return &pixFmt, nil
+}
+
+// setPixFormat requests the format and returns the format
+// actually set by the driver.
+func setPixFormat(fd uintptr, bufType uint32, pixFmt v4l2PixFormat) (*v4l2PixFormat, error) {
+	f := &v4l2Format{Type: bufType}
+	*(*v4l2PixFormat)(unsafe.Pointer(&f.Fmt)) = pixFmt
+	if err := ioctlPtr(fd, vidiocSFmt, f); err != nil {
+		return nil, fmt.Errorf("VIDIOC_S_FMT: %w", err)
+	}
+	result := *(*v4l2PixFormat)(unsafe.Pointer(&f.Fmt))
+	return &result, nil
+}
+
+func setOutputTimePerFrame(fd uintptr, timePerFrame v4l2Fract) error {
+	p := &v4l2StreamParm{Type: v4l2BufTypeVideoOutput}
+	(*v4l2OutputParm)(unsafe.Pointer(&p.Parm)).TimePerFrame = timePerFrame
+	if err := ioctlPtr(fd, vidiocSParm, p); err != nil {
+		return fmt.Errorf("VIDIOC_S_PARM: %w", err)
+	}
+	return nil
+}
+
+func requestBuffers(fd uintptr, memory MemoryType, count uint32) (uint32, error) {
+	req := &v4l2RequestBuffers{
+		Count:  count,
+		Type:   v4l2BufTypeVideoCapture,
+		Memory: uint32(memory),
+	}
+	if err := ioctlPtr(fd, vidiocReqBufs, req); err != nil {
+		return 0, fmt.Errorf("VIDIOC_REQBUFS: %w", err)
+	}
+	return req.Count, nil
+}
+
+func queryBuffer(fd uintptr, memory MemoryType, index uint32) (*v4l2Buffer, error) {
+	buf := &v4l2Buffer{
+		Index:  index,
+		Type:   v4l2BufTypeVideoCapture,
+		Memory: uint32(memory),
+	}
+	if err := ioctlPtr(fd, vidiocQueryBuf, buf); err != nil {
+		return nil, fmt.Errorf("VIDIOC_QUERYBUF: %w", err)
+	}
+	return buf, nil
+}
+
+func queueBuffer(fd uintptr, memory MemoryType, index uint32, userPtr []byte) error {
+	buf := &v4l2Buffer{
+		Index:  index,
+		Type:   v4l2BufTypeVideoCapture,
+		Memory: uint32(memory),
+	}
+	if memory == MemoryTypeUserPtr {
+		buf.M = uintptr(unsafe.Pointer(unsafe.SliceData(userPtr)))
+		buf.Length = uint32(len(userPtr))
+	}
+	if err := ioctlPtr(fd, vidiocQBuf, buf); err != nil {
+		return fmt.Errorf("VIDIOC_QBUF: %w", err)
+	}
+	return nil
+}
+
+func dequeueBuffer(fd uintptr, memory MemoryType) (*v4l2Buffer, error) {
+	buf := &v4l2Buffer{
+		Type:   v4l2BufTypeVideoCapture,
+		Memory: uint32(memory),
+	}
+	if err := ioctlPtr(fd, vidiocDQBuf, buf); err != nil {
+		return nil, fmt.Errorf("VIDIOC_DQBUF: %w", err)
+	}
+	return buf, nil
+}
+
+func streamOn(fd uintptr) error {
+	bufType := v4l2BufTypeVideoCapture
+	if err := ioctlPtr(fd, vidiocStreamOn, &bufType); err != nil {
+		return fmt.Errorf("VIDIOC_STREAMON: %w", err)
+	}
+	return nil
+}
+
+func streamOff(fd uintptr) error {
+	bufType := v4l2BufTypeVideoCapture
+	if err := ioctlPtr(fd, vidiocStreamOff, &bufType); err != nil {
+		return fmt.Errorf("VIDIOC_STREAMOFF: %w", err)
+	}
+	return nil
+}
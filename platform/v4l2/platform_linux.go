@@ -1,46 +1,110 @@
 package v4l2
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/blackjack/webcam"
 	"github.com/xaionaro-go/camera"
+	"golang.org/x/sys/unix"
 )
 
-type Platform struct{}
+type Platform struct {
+	StreamingConfig StreamingConfig
+}
 
 func NewPlatform() Platform {
 	return Platform{}
 }
 
+func NewPlatformWithStreamingConfig(cfg StreamingConfig) Platform {
+	return Platform{
+		StreamingConfig: cfg,
+	}
+}
+
+// ListCameras returns the video capture devices. The nodes which are not
+// capture devices (like metadata nodes) are skipped; the nodes which are not
+// accessible are skipped too, but are reported in the error
+// (see DiagnoseCameras for details on every node).
 func (Platform) ListCameras() ([]camera.DevicePath, error) {
-	const devDir = "/dev/"
-	entries, err := os.ReadDir(devDir)
+	nodes, err := listVideoNodes()
 	if err != nil {
-		return nil, fmt.Errorf("unable list the available devices: %w", err)
+		return nil, err
 	}
 
 	var result []camera.DevicePath
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		if strings.HasPrefix(entry.Name(), "video") {
-			result = append(result, path.Join(devDir, entry.Name()))
+	var errs []error
+	for _, devicePath := range nodes {
+		err := probeDevice(devicePath, deviceKindCapture, false)
+		switch {
+		case err == nil:
+			result = append(result, devicePath)
+		case isAccessProblem(err):
+			errs = append(errs, fmt.Errorf("'%s': %w", devicePath, err))
 		}
 	}
-
+	if len(errs) > 0 {
+		return result, fmt.Errorf("some devices are not accessible: %w", errors.Join(errs...))
+	}
 	return result, nil
 }
+
+// DeviceIdentity implements camera.DeviceIdentifier. The identity is the
+// sysfs device of the node (e.g. the USB interface of a UVC camera)
+// together with the name of the node, so that the nodes of one device (like
+// the capture and the metadata nodes of a UVC camera) and the symlinks to
+// them (like /dev/v4l/by-id/*) are recognized as one camera. If sysfs
+// is not available, then the resolved path is the identity.
+func (Platform) DeviceIdentity(devicePath camera.DevicePath) (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(devicePath, &stat); err != nil {
+		return "", fmt.Errorf("unable to stat '%s': %w", devicePath, wrapErrno(err, nil))
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFCHR {
+		return "", fmt.Errorf("'%s' is not a character device", devicePath)
+	}
+
+	sysPath := fmt.Sprintf("/sys/dev/char/%d:%d", unix.Major(stat.Rdev), unix.Minor(stat.Rdev))
+	device, err := filepath.EvalSymlinks(filepath.Join(sysPath, "device"))
+	if err != nil {
+		return filepath.EvalSymlinks(devicePath)
+	}
+	name, err := os.ReadFile(filepath.Join(sysPath, "name"))
+	if err != nil {
+		return filepath.EvalSymlinks(devicePath)
+	}
+	return "v4l2:" + device + ":" + strings.TrimSpace(string(name)), nil
+}
+
+// DescribeDevice implements camera.DeviceDescriber.
+func (Platform) DescribeDevice(devicePath camera.DevicePath) (camera.DeviceDescriptor, error) {
+	fd, err := unix.Open(devicePath, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return camera.DeviceDescriptor{}, fmt.Errorf("unable to open '%s': %w", devicePath, wrapErrno(err, nil))
+	}
+	defer unix.Close(fd)
+
+	caps, err := queryCapability(uintptr(fd))
+	if err != nil {
+		return camera.DeviceDescriptor{}, fmt.Errorf("unable to query the capabilities of '%s': %w", devicePath, wrapErrno(err, nil))
+	}
+	return camera.DeviceDescriptor{
+		Name:    unix.ByteSliceToString(caps.Card[:]),
+		Driver:  unix.ByteSliceToString(caps.Driver[:]),
+		BusInfo: unix.ByteSliceToString(caps.BusInfo[:]),
+	}, nil
+}
+
 func (Platform) ListFormats(
 	devicePath string,
 ) (camera.Formats, error) {
 	webCam, err := webcam.Open(devicePath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open '%s' as V4L2 camera: %w", devicePath, err)
+		return nil, fmt.Errorf("unable to open '%s' as V4L2 camera: %w", devicePath, wrapErrno(err, nil))
 	}
 	defer webCam.Close()
 
@@ -72,39 +136,76 @@ func (Platform) OpenCameraCompressed(
 	compression camera.Compression,
 	compressionQuality camera.CompressionQuality,
 ) (camera.CameraCompressed, error) {
-	return nil, fmt.Errorf("not supported")
+	return nil, fmt.Errorf("compressed streams are %w", camera.ErrNotSupported)
 }
 
-func (Platform) OpenCamera(
+func (p Platform) OpenCamera(
 	devicePath string,
 	format camera.Format,
-) (camera.Camera, error) {
+) (_ camera.Camera, _err error) {
 	webCam, err := webcam.Open(devicePath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open '%s' as V4L2 camera: %w", devicePath, err)
+		return nil, fmt.Errorf("unable to open '%s' as V4L2 camera: %w", devicePath, wrapErrno(err, nil))
+	}
+	defer func() {
+		if _err != nil {
+			webCam.Close()
+		}
+	}()
+
+	// package webcam does not expose its descriptor, so the device is
+	// opened once more for the streaming (the buffers belong to the
+	// descriptor which requested them)
+	devFD, err := unix.Open(devicePath, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open '%s': %w", devicePath, wrapErrno(err, nil))
 	}
+	defer func() {
+		if _err != nil {
+			unix.Close(devFD)
+		}
+	}()
+	fd := uintptr(devFD)
 
-	pixFmt, width, height, err := webCam.SetImageFormat(
+	_, _, _, err = webCam.SetImageFormat(
 		PixelFormatToV4L2(format.PixelFormat),
 		uint32(format.Width),
 		uint32(format.Height),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("unable to configure the image format: %w", err)
+		return nil, fmt.Errorf("unable to configure the image format: %w", wrapErrno(err, camera.ErrFormatRejected))
+	}
+
+	// the driver adjusts the format instead of failing, so checking what we got:
+	actualFmt, err := getPixFormat(fd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the image format: %w", wrapErrno(err, nil))
+	}
+	pixFmt := PixelFormatFromV4L2(webcam.PixelFormat(actualFmt.PixelFormat))
+	if pixFmt != format.PixelFormat {
+		return nil, fmt.Errorf("requested pixel format %s, but the driver set %s: %w", format.PixelFormat, pixFmt, camera.ErrFormatRejected)
 	}
 
 	err = webCam.SetFramerate(format.FPS.Float32())
 	if err != nil {
-		return nil, fmt.Errorf("unable to configure the frame rate: %w", err)
+		return nil, fmt.Errorf("unable to configure the frame rate: %w", wrapErrno(err, camera.ErrFormatRejected))
+	}
+
+	canceler, err := newCanceler()
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize a canceler: %w", err)
 	}
 
 	return &Camera{
 		Camera: webCam,
 		Format: camera.Format{
-			Width:       uint64(width),
-			Height:      uint64(height),
-			PixelFormat: PixelFormatFromV4L2(pixFmt),
+			Width:       uint64(actualFmt.Width),
+			Height:      uint64(actualFmt.Height),
+			PixelFormat: pixFmt,
 			FPS:         format.FPS,
 		},
+		StreamingConfig: p.StreamingConfig,
+		fd:              fd,
+		canceler:        canceler,
 	}, nil
 }
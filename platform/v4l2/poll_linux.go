@@ -0,0 +1,96 @@
+package v4l2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xaionaro-go/camera"
+	"golang.org/x/sys/unix"
+)
+
+// canceler is an eventfd used to interrupt a poll(2) once
+// the context is cancelled.
+type canceler struct {
+	fd int
+}
+
+func newCanceler() (*canceler, error) {
+	fd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create an eventfd: %w", err)
+	}
+	return &canceler{fd: fd}, nil
+}
+
+func (c *canceler) cancel() {
+	var one = [8]byte{1}
+	_, _ = unix.Write(c.fd, one[:])
+}
+
+func (c *canceler) reset() {
+	var buf [8]byte
+	for {
+		_, err := unix.Read(c.fd, buf[:])
+		if err != unix.EINTR {
+			return
+		}
+	}
+}
+
+func (c *canceler) Close() error {
+	return unix.Close(c.fd)
+}
+
+// waitReadable blocks until the device has a frame to dequeue
+// or until the context is cancelled.
+func waitReadable(
+	ctx context.Context,
+	fd uintptr,
+	canceler *canceler,
+) error {
+	if err := camera.ContextErr(ctx); err != nil {
+		return err
+	}
+
+	canceler.reset()
+	stop := context.AfterFunc(ctx, canceler.cancel)
+	defer stop()
+
+	pollFDs := []unix.PollFd{
+		{Fd: int32(fd), Events: unix.POLLIN},
+		{Fd: int32(canceler.fd), Events: unix.POLLIN},
+	}
+	for {
+		_, err := unix.Poll(pollFDs, -1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to poll: %w", wrapErrno(err, nil))
+		}
+
+		if pollFDs[1].Revents != 0 {
+			if err := camera.ContextErr(ctx); err != nil {
+				return err
+			}
+			// a late cancellation of a previous wait
+			canceler.reset()
+		}
+
+		devEvents := pollFDs[0].Revents
+		switch {
+		case devEvents&unix.POLLIN != 0:
+			return nil
+		case devEvents&(unix.POLLHUP|unix.POLLNVAL) != 0:
+			return fmt.Errorf("poll events 0x%X: %w", devEvents, camera.ErrDeviceGone)
+		case devEvents&unix.POLLERR != 0:
+			// POLLERR is also returned if there are no queued buffers,
+			// so checking if the device is still alive:
+			if _, err := getPixFormat(fd); err != nil {
+				return fmt.Errorf("the device reported an error: %w", wrapErrno(err, camera.ErrDeviceGone))
+			}
+			return fmt.Errorf("the device reported an error; is it streaming and is there at least one queued buffer?")
+		}
+	}
+}
@@ -4,6 +4,14 @@ import (
 	"github.com/xaionaro-go/camera"
 )
 
+const (
+	PlatformID = camera.PlatformID("v4l2")
+
+	// Priority is higher than of libav, since this platform
+	// works with the devices directly.
+	Priority = 100
+)
+
 func init() {
-	camera.DefaultRegistry().RegisterPlatform(Platform{})
+	camera.DefaultRegistry().RegisterPlatformWithPriority(PlatformID, Platform{}, Priority)
 }
@@ -0,0 +1,206 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+	"golang.org/x/sys/unix"
+)
+
+// Sink writes frames into a V4L2 output device (like v4l2loopback),
+// so that other applications could use it as a camera.
+type Sink struct {
+	Format camera.Format
+
+	locker sync.Mutex
+	fd     int
+	buf    []byte
+	padded []byte
+
+	// bytesPerLine and sizeImage are the layout of the frames
+	// as set by the driver (the rows may be padded).
+	bytesPerLine int
+	sizeImage    int
+}
+
+var _ camera.CameraSink = (*Sink)(nil)
+
+// ListSinks implements camera.SinkOpener.
+func (Platform) ListSinks() ([]camera.DevicePath, error) {
+	nodes, err := listVideoNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []camera.DevicePath
+	for _, devicePath := range nodes {
+		if probeDevice(devicePath, deviceKindOutput, false) == nil {
+			result = append(result, devicePath)
+		}
+	}
+	return result, nil
+}
+
+// maxFrameSize returns the size of a frame, or an upper bound
+// of it for compressed formats.
+func maxFrameSize(format camera.Format) (bytesPerLine, sizeImage uint32, _ error) {
+	w, h := uint32(format.Width), uint32(format.Height)
+	switch format.PixelFormat {
+	case camera.PixelFormatNV12:
+		return w, w * h * 3 / 2, nil
+	case camera.PixelFormatYUYV:
+		return w * 2, w * h * 2, nil
+	case camera.PixelFormatMJPEG:
+		return 0, w * h * 2, nil
+	}
+	return 0, 0, fmt.Errorf("pixel format %s: %w", format.PixelFormat, camera.ErrNotSupported)
+}
+
+// OpenSink implements camera.SinkOpener.
+//
+// Similar to OpenCamera, the driver may adjust the resolution, so the frames
+// should match the format returned by GetFormat.
+func (Platform) OpenSink(
+	devicePath camera.DevicePath,
+	format camera.Format,
+) (_ camera.CameraSink, _err error) {
+	bytesPerLine, sizeImage, err := maxFrameSize(format)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.Open(devicePath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open '%s': %w", devicePath, wrapErrno(err, nil))
+	}
+	defer func() {
+		if _err != nil {
+			unix.Close(fd)
+		}
+	}()
+
+	caps, err := queryCapability(uintptr(fd))
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a V4L2 device: %w", devicePath, wrapErrno(err, nil))
+	}
+	devCaps := caps.deviceCapabilities()
+	if devCaps&deviceKindOutput.RequiredCaps != deviceKindOutput.RequiredCaps {
+		return nil, fmt.Errorf("'%s' is not a %s (capabilities: 0x%08X): %w", devicePath, deviceKindOutput.Name, devCaps, camera.ErrNotSupported)
+	}
+
+	actualFmt, err := setPixFormat(uintptr(fd), v4l2BufTypeVideoOutput, v4l2PixFormat{
+		Width:        uint32(format.Width),
+		Height:       uint32(format.Height),
+		PixelFormat:  uint32(PixelFormatToV4L2(format.PixelFormat)),
+		Field:        v4l2FieldNone,
+		BytesPerLine: bytesPerLine,
+		SizeImage:    sizeImage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure the image format: %w", wrapErrno(err, camera.ErrFormatRejected))
+	}
+	pixFmt := camera.PixelFormatFromUint32(actualFmt.PixelFormat)
+	if pixFmt != format.PixelFormat {
+		return nil, fmt.Errorf("requested pixel format %s, but the driver set %s: %w", format.PixelFormat, pixFmt, camera.ErrFormatRejected)
+	}
+
+	if format.FPS.Numerator != 0 {
+		err := setOutputTimePerFrame(uintptr(fd), v4l2Fract{
+			Numerator:   uint32(format.FPS.Denominator),
+			Denominator: uint32(format.FPS.Numerator),
+		})
+		err = wrapErrno(err, camera.ErrFormatRejected)
+		if err != nil && !errors.Is(err, camera.ErrNotSupported) {
+			return nil, fmt.Errorf("unable to configure the frame rate: %w", err)
+		}
+	}
+
+	return &Sink{
+		Format: camera.Format{
+			Width:       uint64(actualFmt.Width),
+			Height:      uint64(actualFmt.Height),
+			PixelFormat: pixFmt,
+			FPS:         format.FPS,
+		},
+		fd:           fd,
+		bytesPerLine: int(actualFmt.BytesPerLine),
+		sizeImage:    int(actualFmt.SizeImage),
+	}, nil
+}
+
+func (s *Sink) GetFormat() camera.Format {
+	return s.Format
+}
+
+func (s *Sink) WriteFrame(frame camera.Frame) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.fd < 0 {
+		return fmt.Errorf("the sink is closed")
+	}
+
+	var err error
+	s.buf, err = rawimage.AppendBytes(s.buf[:0], &s.Format, frame.Image())
+	if err != nil {
+		return fmt.Errorf("unable to convert the frame: %w", err)
+	}
+
+	// the frame is consumed by a single write(2), so not
+	// expecting partial writes except for interruptions:
+	for b := s.pad(s.buf); len(b) > 0; {
+		n, err := unix.Write(s.fd, b)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to write the frame: %w", wrapErrno(err, nil))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// pad returns the raw frame with the rows aligned to the stride
+// (and the size) expected by the driver.
+func (s *Sink) pad(frame []byte) []byte {
+	var rowSize, rows int
+	w, h := int(s.Format.Width), int(s.Format.Height)
+	switch s.Format.PixelFormat {
+	case camera.PixelFormatNV12:
+		// the chroma rows have the same stride as the luma ones
+		rowSize, rows = w, h+h/2
+	case camera.PixelFormatYUYV:
+		rowSize, rows = w*2, h
+	default:
+		return frame
+	}
+	stride := max(s.bytesPerLine, rowSize)
+	size := max(s.sizeImage, stride*rows)
+	if size <= len(frame) {
+		return frame
+	}
+
+	if cap(s.padded) < size {
+		// the padding bytes are never written, so they stay zero
+		s.padded = make([]byte, size)
+	}
+	s.padded = s.padded[:size]
+	for row := 0; row < rows; row++ {
+		copy(s.padded[row*stride:row*stride+rowSize], frame[row*rowSize:])
+	}
+	return s.padded
+}
+
+func (s *Sink) Close() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.fd < 0 {
+		return nil
+	}
+	err := unix.Close(s.fd)
+	s.fd = -1
+	return err
+}
@@ -0,0 +1,310 @@
+package ptz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+// The IDs are the ones of V4L2 (V4L2_CID_PAN_ABSOLUTE and so on), so
+// the controls shadow the mechanical ones of the source (if any).
+const (
+	ControlIDPan  = camera.ControlID(0x009a0908)
+	ControlIDTilt = camera.ControlID(0x009a0909)
+	ControlIDZoom = camera.ControlID(0x009a090d)
+)
+
+// Position is the state of the virtual pan-tilt-zoom: Pan and Tilt are
+// within [-1, 1] (positive values move to the right and up), Zoom is
+// the magnification relative to the whole source.
+type Position struct {
+	Pan  float64
+	Tilt float64
+	Zoom float64
+}
+
+// Camera crops a movable region of interest of the wrapped camera and
+// scales it to the output format; the frames of the wrapped camera are
+// released right after the scaling.
+type Camera struct {
+	camera.Camera
+	Config Config
+
+	format  camera.Format
+	maxZoom float64
+	pool    sync.Pool
+
+	locker   sync.Mutex
+	from     Position
+	to       Position
+	startTS  time.Time
+	duration time.Duration
+}
+
+var _ camera.Camera = (*Camera)(nil)
+var _ camera.Controls = (*Camera)(nil)
+
+// NewCamera wraps the camera; the output pixel format could be NV12
+// (the default) or YUYV, and if the output FPS is not set, then
+// the FPS of the camera is used.
+func NewCamera(cam camera.Camera, output camera.Format, cfg Config) (*Camera, error) {
+	cfg = cfg.withDefaults()
+	source := cam.GetFormat()
+
+	switch output.PixelFormat {
+	case camera.PixelFormatUndefined, camera.PixelFormatAuto:
+		output.PixelFormat = camera.PixelFormatNV12
+	case camera.PixelFormatNV12, camera.PixelFormatYUYV:
+	default:
+		return nil, fmt.Errorf("%w: output pixel format %s", camera.ErrNotSupported, output.PixelFormat)
+	}
+	if output.Width == 0 || output.Height == 0 || output.Width%2 != 0 || output.Height%2 != 0 {
+		return nil, fmt.Errorf("the output resolution %dx%d is not positive and even", output.Width, output.Height)
+	}
+	if output.FPS.Numerator == 0 || output.FPS.Denominator == 0 {
+		output.FPS = source.FPS
+	}
+
+	maxZoom := cfg.MaxZoom
+	if maxZoom == 0 && source.Width != 0 && source.Height != 0 {
+		baseW, _ := baseSize(float64(source.Width), float64(source.Height), output)
+		maxZoom = baseW / float64(output.Width)
+	}
+	maxZoom = max(1, maxZoom)
+
+	home := Position{Zoom: 1}
+	return &Camera{
+		Camera:  cam,
+		Config:  cfg,
+		format:  output,
+		maxZoom: maxZoom,
+		from:    home,
+		to:      home,
+	}, nil
+}
+
+// GetFormat returns the output format.
+func (c *Camera) GetFormat() camera.Format {
+	return c.format
+}
+
+// MaxZoom returns the maximal zoom factor.
+func (c *Camera) MaxZoom() float64 {
+	return c.maxZoom
+}
+
+// Position returns the current (possibly still moving) position.
+func (c *Camera) Position() Position {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.positionAt(time.Now())
+}
+
+// Target returns the position the camera moves to.
+func (c *Camera) Target() Position {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.to
+}
+
+// SetPosition starts moving from the current position to the given one
+// during the duration (zero moves instantly); the position is clamped
+// to the valid ranges.
+func (c *Camera) SetPosition(pos Position, duration time.Duration) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.setPositionLocked(pos, duration)
+}
+
+func (c *Camera) setPositionLocked(pos Position, duration time.Duration) {
+	now := time.Now()
+	c.from = c.positionAt(now)
+	c.to = Position{
+		Pan:  max(-1, min(1, pos.Pan)),
+		Tilt: max(-1, min(1, pos.Tilt)),
+		Zoom: max(1, min(c.maxZoom, pos.Zoom)),
+	}
+	c.startTS = now
+	c.duration = max(0, duration)
+}
+
+func (c *Camera) positionAt(ts time.Time) Position {
+	if c.duration <= 0 || !ts.Before(c.startTS.Add(c.duration)) {
+		return c.to
+	}
+	t := max(0, float64(ts.Sub(c.startTS))/float64(c.duration))
+	// ease-in-out, so the movement starts and stops smoothly
+	t = t * t * (3 - 2*t)
+	return Position{
+		Pan:  c.from.Pan + (c.to.Pan-c.from.Pan)*t,
+		Tilt: c.from.Tilt + (c.to.Tilt-c.from.Tilt)*t,
+		// interpolating in the log space makes the zooming
+		// look uniform
+		Zoom: math.Exp(math.Log(c.from.Zoom) + (math.Log(c.to.Zoom)-math.Log(c.from.Zoom))*t),
+	}
+}
+
+// baseSize returns the size of the largest region of the source with
+// the aspect ratio of the output.
+func baseSize(width, height float64, output camera.Format) (float64, float64) {
+	aspect := float64(output.Width) / float64(output.Height)
+	if width/height > aspect {
+		return height * aspect, height
+	}
+	return width, width / aspect
+}
+
+// region returns the region of interest of a source of the given size.
+func (c *Camera) region(width, height int, pos Position) rect {
+	baseW, baseH := baseSize(float64(width), float64(height), c.format)
+	w, h := baseW/pos.Zoom, baseH/pos.Zoom
+	cx := float64(width)/2 + pos.Pan*(float64(width)-w)/2
+	cy := float64(height)/2 - pos.Tilt*(float64(height)-h)/2
+	return rect{X: cx - w/2, Y: cy - h/2, W: w, H: h}
+}
+
+// ROI returns the current region of interest in the coordinates of
+// the source frames.
+func (c *Camera) ROI() image.Rectangle {
+	source := c.Camera.GetFormat()
+	r := c.region(int(source.Width), int(source.Height), c.Position())
+	return image.Rect(
+		int(math.Round(r.X)), int(math.Round(r.Y)),
+		int(math.Round(r.X+r.W)), int(math.Round(r.Y+r.H)),
+	)
+}
+
+func (c *Camera) newImage() image.Image {
+	r := image.Rect(0, 0, int(c.format.Width), int(c.format.Height))
+	if c.format.PixelFormat == camera.PixelFormatYUYV {
+		return ximage.NewYUYV(r)
+	}
+	return ximage.NewNV12(r)
+}
+
+func (c *Camera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	frame, err := c.Camera.GetFrame(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &camera.ImageFrame{
+		CaptureTS: camera.FrameTimestamp(frame),
+	}
+	if skipCounter, ok := frame.(camera.FrameSkipCounter); ok {
+		result.Skipped = skipCounter.SkippedFrames()
+	}
+
+	src := frame.Image()
+	dst, _ := c.pool.Get().(image.Image)
+	if dst == nil {
+		dst = c.newImage()
+	}
+	size := src.Bounds().Size()
+	err = scaleRegion(dst, src, c.region(size.X, size.Y, c.Position()))
+	if releaseErr := c.Camera.ReleaseFrame(frame); releaseErr != nil {
+		err = errors.Join(err, fmt.Errorf("unable to release a frame: %w", releaseErr))
+	}
+	if err != nil {
+		c.pool.Put(dst)
+		return nil, fmt.Errorf("unable to scale a frame: %w", err)
+	}
+	result.Img = dst
+	return result, nil
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	f, ok := frame.(*camera.ImageFrame)
+	if !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	c.pool.Put(f.Img)
+	return nil
+}
+
+func (c *Camera) ownControls() []camera.Control {
+	return []camera.Control{
+		{ID: ControlIDPan, Name: "Pan, Absolute", Type: camera.ControlTypeInteger, Min: -PanTiltRange, Max: PanTiltRange, Step: 1},
+		{ID: ControlIDTilt, Name: "Tilt, Absolute", Type: camera.ControlTypeInteger, Min: -PanTiltRange, Max: PanTiltRange, Step: 1},
+		{ID: ControlIDZoom, Name: "Zoom, Absolute", Type: camera.ControlTypeInteger, Min: ZoomUnit, Max: int32(math.Round(c.maxZoom * ZoomUnit)), Step: 1},
+	}
+}
+
+// ListControls returns the pan, tilt and zoom controls followed by
+// the controls of the wrapped camera (if it has any).
+func (c *Camera) ListControls() ([]camera.Control, error) {
+	own := c.ownControls()
+	result := own
+	ctrls, ok := c.Camera.(camera.Controls)
+	if !ok {
+		return result, nil
+	}
+	sourceControls, err := ctrls.ListControls()
+	if err != nil {
+		return nil, err
+	}
+	for _, ctrl := range sourceControls {
+		if _, shadowed := camera.FindControl(own, ctrl.Key()); shadowed || isOwnControl(ctrl.ID) {
+			continue
+		}
+		result = append(result, ctrl)
+	}
+	return result, nil
+}
+
+func isOwnControl(id camera.ControlID) bool {
+	return id == ControlIDPan || id == ControlIDTilt || id == ControlIDZoom
+}
+
+// GetControl returns the target value of the pan, tilt and zoom (not
+// the intermediate one during a transition).
+func (c *Camera) GetControl(id camera.ControlID) (int32, error) {
+	if !isOwnControl(id) {
+		ctrls, ok := c.Camera.(camera.Controls)
+		if !ok {
+			return 0, fmt.Errorf("%w: control %#x", camera.ErrNotSupported, id)
+		}
+		return ctrls.GetControl(id)
+	}
+	target := c.Target()
+	switch id {
+	case ControlIDPan:
+		return int32(math.Round(target.Pan * PanTiltRange)), nil
+	case ControlIDTilt:
+		return int32(math.Round(target.Tilt * PanTiltRange)), nil
+	default:
+		return int32(math.Round(target.Zoom * ZoomUnit)), nil
+	}
+}
+
+// SetControl starts a transition of Config.TransitionDuration to the new
+// pan, tilt or zoom.
+func (c *Camera) SetControl(id camera.ControlID, value int32) error {
+	if !isOwnControl(id) {
+		ctrls, ok := c.Camera.(camera.Controls)
+		if !ok {
+			return fmt.Errorf("%w: control %#x", camera.ErrNotSupported, id)
+		}
+		return ctrls.SetControl(id, value)
+	}
+
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	target := c.to
+	switch id {
+	case ControlIDPan:
+		target.Pan = float64(value) / PanTiltRange
+	case ControlIDTilt:
+		target.Tilt = float64(value) / PanTiltRange
+	case ControlIDZoom:
+		target.Zoom = float64(value) / ZoomUnit
+	}
+	c.setPositionLocked(target, c.Config.TransitionDuration)
+	return nil
+}
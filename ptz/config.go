@@ -0,0 +1,40 @@
+package ptz
+
+import (
+	"time"
+)
+
+const (
+	DefaultTransitionDuration = time.Second
+
+	// PanTiltRange is the maximal absolute value of the pan and
+	// the tilt: -PanTiltRange moves the region of interest to the left
+	// (bottom) edge of the source and PanTiltRange to the right (top) one.
+	PanTiltRange = 1000
+
+	// ZoomUnit is the zoom value of the whole source (the zoom is
+	// in percents).
+	ZoomUnit = 100
+)
+
+type Config struct {
+	// MaxZoom is the maximal zoom factor; if zero, then it is the zoom
+	// at which a source pixel maps to an output pixel (so the image
+	// is never upscaled), but at least 1.
+	MaxZoom float64
+
+	// TransitionDuration is how long it takes to move to the pan,
+	// tilt and zoom set via SetControl; if negative, then the changes
+	// are applied instantly.
+	TransitionDuration time.Duration
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.TransitionDuration == 0 {
+		cfg.TransitionDuration = DefaultTransitionDuration
+	}
+	if cfg.TransitionDuration < 0 {
+		cfg.TransitionDuration = 0
+	}
+	return cfg
+}
@@ -0,0 +1,252 @@
+package ptz
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+// weightBits is the precision of the fixed-point filter weights.
+const weightBits = 14
+
+// plane is a plane of 8-bit samples: the sample (x, y) is
+// Pix[y*Stride+x*Step]; SubX and SubY are the subsampling
+// relative to the full resolution.
+type plane struct {
+	Pix        []byte
+	Stride     int
+	Step       int
+	Width      int
+	Height     int
+	SubX, SubY int
+}
+
+// yuvPlanes are the planes of an image; Cb and Cr are nil
+// for a gray image.
+type yuvPlanes struct {
+	Y, Cb, Cr *plane
+}
+
+func planesOf(img image.Image) (yuvPlanes, error) {
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+	if r.Min.X%2 != 0 || r.Min.Y%2 != 0 {
+		return yuvPlanes{}, fmt.Errorf("the image starts at odd coordinates %v", r.Min)
+	}
+	switch img := img.(type) {
+	case *ximage.NV12:
+		cbcr := img.CbCrBytes()[2*img.COffset(r.Min.X, r.Min.Y):]
+		cw, ch := (w+1)/2, (h+1)/2
+		return yuvPlanes{
+			Y:  &plane{Pix: img.Y[img.YOffset(r.Min.X, r.Min.Y):], Stride: img.YStride, Step: 1, Width: w, Height: h, SubX: 1, SubY: 1},
+			Cb: &plane{Pix: cbcr, Stride: img.YStride, Step: 2, Width: cw, Height: ch, SubX: 2, SubY: 2},
+			Cr: &plane{Pix: cbcr[1:], Stride: img.YStride, Step: 2, Width: cw, Height: ch, SubX: 2, SubY: 2},
+		}, nil
+	case *ximage.YUYV:
+		b := img.Y0CbY1CrBytes()[4*img.Y0CbY1CrOffset(r.Min.X, r.Min.Y):]
+		stride := img.YStride * 2
+		cw := (w + 1) / 2
+		return yuvPlanes{
+			Y:  &plane{Pix: b, Stride: stride, Step: 2, Width: w, Height: h, SubX: 1, SubY: 1},
+			Cb: &plane{Pix: b[1:], Stride: stride, Step: 4, Width: cw, Height: h, SubX: 2, SubY: 1},
+			Cr: &plane{Pix: b[3:], Stride: stride, Step: 4, Width: cw, Height: h, SubX: 2, SubY: 1},
+		}, nil
+	case *image.YCbCr:
+		subX, subY := chromaSubsampling(img.SubsampleRatio)
+		if subX == 0 {
+			return yuvPlanes{}, fmt.Errorf("unsupported subsampling %v", img.SubsampleRatio)
+		}
+		cOffset := img.COffset(r.Min.X, r.Min.Y)
+		cw, ch := (w+subX-1)/subX, (h+subY-1)/subY
+		return yuvPlanes{
+			Y:  &plane{Pix: img.Y[img.YOffset(r.Min.X, r.Min.Y):], Stride: img.YStride, Step: 1, Width: w, Height: h, SubX: 1, SubY: 1},
+			Cb: &plane{Pix: img.Cb[cOffset:], Stride: img.CStride, Step: 1, Width: cw, Height: ch, SubX: subX, SubY: subY},
+			Cr: &plane{Pix: img.Cr[cOffset:], Stride: img.CStride, Step: 1, Width: cw, Height: ch, SubX: subX, SubY: subY},
+		}, nil
+	case *image.Gray:
+		return yuvPlanes{
+			Y: &plane{Pix: img.Pix[img.PixOffset(r.Min.X, r.Min.Y):], Stride: img.Stride, Step: 1, Width: w, Height: h, SubX: 1, SubY: 1},
+		}, nil
+	}
+	return yuvPlanes{}, fmt.Errorf("unsupported image type %T", img)
+}
+
+func chromaSubsampling(ratio image.YCbCrSubsampleRatio) (int, int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio444:
+		return 1, 1
+	case image.YCbCrSubsampleRatio422:
+		return 2, 1
+	case image.YCbCrSubsampleRatio420:
+		return 2, 2
+	case image.YCbCrSubsampleRatio440:
+		return 1, 2
+	case image.YCbCrSubsampleRatio411:
+		return 4, 1
+	case image.YCbCrSubsampleRatio410:
+		return 4, 2
+	}
+	return 0, 0
+}
+
+// toYCbCr converts an image of an unsupported type (slowly).
+func toYCbCr(img image.Image) *image.YCbCr {
+	r := img.Bounds()
+	result := image.NewYCbCr(image.Rect(0, 0, r.Dx(), r.Dy()), image.YCbCrSubsampleRatio444)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.YCbCrModel.Convert(img.At(x, y)).(color.YCbCr)
+			offset := (y-r.Min.Y)*result.YStride + (x - r.Min.X)
+			result.Y[offset], result.Cb[offset], result.Cr[offset] = c.Y, c.Cb, c.Cr
+		}
+	}
+	return result
+}
+
+// axisFilter is a resampling filter along an axis: the output sample i
+// is the weighted sum of Taps source samples starting from Start[i].
+type axisFilter struct {
+	Taps    int
+	Start   []int
+	Weights []int32
+}
+
+// newAxisFilter maps the output samples [0, n) onto the source range
+// [from, from+length) (in the source samples) of a plane of the
+// given size; when downscaling more than twice, several bilinear
+// samples are averaged to avoid aliasing.
+func newAxisFilter(n int, from, length float64, size int) axisFilter {
+	ratio := length / float64(n)
+	subSamples := max(1, int(math.Ceil(ratio/2)))
+	// the sub-samples span (subSamples-1)*ratio/subSamples, plus
+	// the neighbors of the bilinear interpolation
+	taps := min(size, int(math.Ceil(float64(subSamples-1)*ratio/float64(subSamples)))+2)
+	f := axisFilter{
+		Taps:    taps,
+		Start:   make([]int, n),
+		Weights: make([]int32, n*taps),
+	}
+	weights := make([]float64, taps)
+	for i := 0; i < n; i++ {
+		center := from + (float64(i)+0.5)*ratio - 0.5
+		lo := center - ratio/2 + ratio/float64(2*subSamples)
+		start := int(math.Floor(max(lo, 0)))
+		start = max(0, min(start, size-taps))
+		clear(weights)
+		for s := 0; s < subSamples; s++ {
+			pos := lo + float64(s)*ratio/float64(subSamples)
+			pos = max(0, min(float64(size-1), pos))
+			i0 := min(int(pos), size-1)
+			frac := pos - float64(i0)
+			addWeight(weights, i0-start, (1-frac)/float64(subSamples))
+			if frac > 0 {
+				addWeight(weights, i0+1-start, frac/float64(subSamples))
+			}
+		}
+		f.Start[i] = start
+		// rounding the weights so that they sum exactly to one
+		total := int32(0)
+		maxIdx := 0
+		for t, w := range weights {
+			fixed := int32(math.Round(w * (1 << weightBits)))
+			f.Weights[i*taps+t] = fixed
+			total += fixed
+			if w > weights[maxIdx] {
+				maxIdx = t
+			}
+		}
+		f.Weights[i*taps+maxIdx] += 1<<weightBits - total
+	}
+	return f
+}
+
+func addWeight(weights []float64, idx int, w float64) {
+	idx = max(0, min(len(weights)-1, idx))
+	weights[idx] += w
+}
+
+// resample scales the region of src (in the full-resolution
+// coordinates) into dst.
+func resample(dst, src *plane, roi rect) {
+	xf := newAxisFilter(dst.Width, roi.X/float64(src.SubX), roi.W/float64(src.SubX), src.Width)
+	yf := newAxisFilter(dst.Height, roi.Y/float64(src.SubY), roi.H/float64(src.SubY), src.Height)
+	row := make([]int64, dst.Width)
+	for j := 0; j < dst.Height; j++ {
+		clear(row)
+		for ty := 0; ty < yf.Taps; ty++ {
+			wy := int64(yf.Weights[j*yf.Taps+ty])
+			if wy == 0 {
+				continue
+			}
+			srcRow := src.Pix[(yf.Start[j]+ty)*src.Stride:]
+			for i := range row {
+				sum := int64(0)
+				base := xf.Start[i]
+				weights := xf.Weights[i*xf.Taps : (i+1)*xf.Taps]
+				for tx, wx := range weights {
+					sum += int64(wx) * int64(srcRow[(base+tx)*src.Step])
+				}
+				row[i] += sum * wy
+			}
+		}
+		dstRow := dst.Pix[j*dst.Stride:]
+		for i, v := range row {
+			v = (v + 1<<(2*weightBits-1)) >> (2 * weightBits)
+			dstRow[i*dst.Step] = uint8(max(0, min(255, v)))
+		}
+	}
+}
+
+func fill(dst *plane, value uint8) {
+	for j := 0; j < dst.Height; j++ {
+		row := dst.Pix[j*dst.Stride:]
+		for i := 0; i < dst.Width; i++ {
+			row[i*dst.Step] = value
+		}
+	}
+}
+
+// rect is a region in the full-resolution coordinates of the source.
+type rect struct {
+	X, Y, W, H float64
+}
+
+// scaleRegion crops the region of src and scales it into dst.
+func scaleRegion(dst, src image.Image, roi rect) error {
+	srcPlanes, err := planesOf(src)
+	if err != nil {
+		src = toYCbCr(src)
+		if srcPlanes, err = planesOf(src); err != nil {
+			return err
+		}
+	}
+	dstPlanes, err := planesOf(dst)
+	if err != nil {
+		return err
+	}
+
+	resample(dstPlanes.Y, srcPlanes.Y, roi)
+	for _, p := range [][2]*plane{{dstPlanes.Cb, srcPlanes.Cb}, {dstPlanes.Cr, srcPlanes.Cr}} {
+		dstPlane, srcPlane := p[0], p[1]
+		switch {
+		case dstPlane == nil:
+		case srcPlane == nil:
+			fill(dstPlane, 128)
+		default:
+			// the chroma samples are mapped via the full resolution, since
+			// the subsampling of the source and the output may differ
+			scaleX := roi.W / float64(dstPlanes.Y.Width)
+			scaleY := roi.H / float64(dstPlanes.Y.Height)
+			resample(dstPlane, srcPlane, rect{
+				X: roi.X,
+				Y: roi.Y,
+				W: scaleX * float64(dstPlane.Width*dstPlane.SubX),
+				H: scaleY * float64(dstPlane.Height*dstPlane.SubY),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package rawimage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/ximage"
+)
+
+// DefaultJPEGQuality is the quality used by AppendBytes for MJPEG.
+const DefaultJPEGQuality = 85
+
+// AppendBytes appends the image encoded in the pixel format of the
+// given format to dst. This is the reverse of NewRawImage, except that
+// it also supports MJPEG (each frame is a JPEG image).
+//
+// The image dimensions should match the format, there is no scaling.
+func AppendBytes(
+	dst []byte,
+	format *camera.Format,
+	img image.Image,
+) (_ret []byte, _err error) {
+	defer func() {
+		if _err != nil {
+			_err = fmt.Errorf("pixel format %v: %w", format.PixelFormat, _err)
+		}
+	}()
+
+	size := img.Bounds().Size()
+	if uint64(size.X) != format.Width || uint64(size.Y) != format.Height {
+		return dst, fmt.Errorf("the image is %dx%d, but the format is %dx%d", size.X, size.Y, format.Width, format.Height)
+	}
+
+	switch format.PixelFormat {
+	case camera.PixelFormatNV12:
+		return appendNV12(dst, img), nil
+	case camera.PixelFormatYUYV:
+		return appendYUYV(dst, img), nil
+	case camera.PixelFormatMJPEG:
+		return AppendJPEG(dst, img, DefaultJPEGQuality)
+	default:
+		return dst, fmt.Errorf("unexpected pixel format: %w", camera.ErrNotSupported)
+	}
+}
+
+// AppendJPEG appends the image encoded as JPEG with the given quality
+// (within [1, 100]) to dst.
+func AppendJPEG(dst []byte, img image.Image, quality int) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return dst, fmt.Errorf("unable to encode JPEG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+type yCbCrImage interface {
+	YCbCrAt(x, y int) color.YCbCr
+}
+
+func yCbCrAt(img image.Image, x, y int) color.YCbCr {
+	if img, ok := img.(yCbCrImage); ok {
+		return img.YCbCrAt(x, y)
+	}
+	return color.YCbCrModel.Convert(img.At(x, y)).(color.YCbCr)
+}
+
+func appendNV12(dst []byte, img image.Image) []byte {
+	if img, ok := img.(*ximage.NV12); ok && img.YStride == img.Rect.Dx() {
+		dst = append(dst, img.Y...)
+		return append(dst, img.CbCrBytes()...)
+	}
+
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			dst = append(dst, yCbCrAt(img, x, y).Y)
+		}
+	}
+	for y := r.Min.Y; y < r.Max.Y; y += 2 {
+		for x := r.Min.X; x < r.Max.X; x += 2 {
+			c := yCbCrAt(img, x, y)
+			dst = append(dst, c.Cb, c.Cr)
+		}
+	}
+	return dst
+}
+
+func appendYUYV(dst []byte, img image.Image) []byte {
+	if img, ok := img.(*ximage.YUYV); ok && img.YStride == img.Rect.Dx() {
+		return append(dst, img.Y0CbY1CrBytes()...)
+	}
+
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x += 2 {
+			c0 := yCbCrAt(img, x, y)
+			c1 := c0
+			if x+1 < r.Max.X {
+				c1 = yCbCrAt(img, x+1, y)
+			}
+			dst = append(dst, c0.Y, c0.Cb, c1.Y, c0.Cr)
+		}
+	}
+	return dst
+}
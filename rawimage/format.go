@@ -0,0 +1,45 @@
+package rawimage
+
+import (
+	"slices"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// RawFormat returns the format of the frames of a camera in the given
+// format when passed as raw bytes (see AppendBytes and NewRawImage):
+// NV12 and YUYV are kept as is, the other pixel formats become NV12.
+func RawFormat(format camera.Format) camera.Format {
+	switch format.PixelFormat {
+	case camera.PixelFormatNV12, camera.PixelFormatYUYV:
+	default:
+		format.PixelFormat = camera.PixelFormatNV12
+	}
+	return format
+}
+
+// RawFormats returns the distinct RawFormat of the formats.
+func RawFormats(formats camera.Formats) camera.Formats {
+	var result camera.Formats
+	for _, f := range formats {
+		f = RawFormat(f)
+		if !slices.Contains(result, f) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// SourceFormat returns the format of the camera delivering the frames
+// in the given raw format (preferring the exact match).
+func SourceFormat(formats camera.Formats, raw camera.Format) (camera.Format, bool) {
+	if slices.Contains(formats, raw) {
+		return raw, true
+	}
+	for _, f := range formats {
+		if RawFormat(f) == raw {
+			return f, true
+		}
+	}
+	return camera.Format{}, false
+}
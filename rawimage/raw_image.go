@@ -25,7 +25,7 @@ func NewRawImage(
 	case camera.PixelFormatNV12:
 		return NewRawImageNV12(frameBytes, uint(format.Width), uint(format.Height))
 	default:
-		return nil, fmt.Errorf("unexpected pixel")
+		return nil, fmt.Errorf("unexpected pixel format: %w", camera.ErrNotSupported)
 	}
 }
 
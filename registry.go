@@ -3,13 +3,26 @@ package camera
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 )
 
+type PlatformID string
+
+type RegisteredPlatform struct {
+	ID       PlatformID
+	Platform Platform
+
+	// Priority defines which platform is preferred if the same device
+	// is available via multiple platforms; the higher the better.
+	Priority int
+	Enabled  bool
+}
+
 type Registry struct {
-	locker            sync.Mutex
-	platforms         []Platform
-	alreadyRegistered map[reflect.Type]struct{}
+	locker    sync.Mutex
+	platforms []*RegisteredPlatform
 }
 
 var defaultRegistry = NewRegistry()
@@ -20,30 +33,143 @@ func DefaultRegistry() *Registry {
 
 func NewRegistry() *Registry {
 	return &Registry{
-		locker:            sync.Mutex{},
-		platforms:         []Platform{},
-		alreadyRegistered: map[reflect.Type]struct{}{},
+		locker:    sync.Mutex{},
+		platforms: []*RegisteredPlatform{},
 	}
 }
 
-func (r *Registry) RegisterPlatform(plat Platform) {
-	r.locker.Lock()
-	defer r.locker.Unlock()
+// DefaultPlatformPriority is the priority of the platforms registered
+// via RegisterPlatform.
+const DefaultPlatformPriority = 0
 
+// RegisterPlatform registers the platform with DefaultPlatformPriority;
+// the ID is derived from the type of the platform (e.g.
+// "github.com/xaionaro-go/camera/platform/v4l2.Platform").
+func (r *Registry) RegisterPlatform(plat Platform) {
 	t := reflect.TypeOf(plat)
 	if t.Kind() == reflect.Pointer {
 		t = t.Elem()
 	}
-	if _, ok := r.alreadyRegistered[t]; ok {
-		panic(fmt.Errorf("type '%T' is already registered", t))
+	r.RegisterPlatformWithPriority(PlatformID(t.PkgPath()+"."+t.Name()), plat, DefaultPlatformPriority)
+}
+
+func (r *Registry) RegisterPlatformWithPriority(
+	id PlatformID,
+	plat Platform,
+	priority int,
+) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	for _, p := range r.platforms {
+		if p.ID == id {
+			panic(fmt.Errorf("platform '%s' is already registered", id))
+		}
+	}
+
+	r.platforms = append(r.platforms, &RegisteredPlatform{
+		ID:       id,
+		Platform: plat,
+		Priority: priority,
+		Enabled:  true,
+	})
+}
+
+func (r *Registry) getPlatform(id PlatformID) (*RegisteredPlatform, error) {
+	for _, p := range r.platforms {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("platform '%s' is not registered", id)
+}
+
+func (r *Registry) SetPlatformEnabled(id PlatformID, enabled bool) error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	p, err := r.getPlatform(id)
+	if err != nil {
+		return err
+	}
+	p.Enabled = enabled
+	return nil
+}
+
+func (r *Registry) SetPlatformPriority(id PlatformID, priority int) error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	p, err := r.getPlatform(id)
+	if err != nil {
+		return err
+	}
+	p.Priority = priority
+	return nil
+}
+
+// Platforms returns all the registered platforms ordered by priority
+// (from the most preferred).
+func (r *Registry) Platforms() []RegisteredPlatform {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	result := make([]RegisteredPlatform, 0, len(r.platforms))
+	for _, p := range r.platforms {
+		result = append(result, *p)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Priority > result[j].Priority
+	})
+	return result
+}
+
+func (r *Registry) enabledPlatforms() []RegisteredPlatform {
+	var result []RegisteredPlatform
+	for _, p := range r.Platforms() {
+		if p.Enabled {
+			result = append(result, p)
+		}
 	}
+	return result
+}
 
-	r.platforms = append(r.platforms, plat)
+type PlatformError struct {
+	PlatformID PlatformID
+	Err        error
+}
+
+func (e *PlatformError) Error() string {
+	return fmt.Sprintf("platform '%s': %v", e.PlatformID, e.Err)
+}
+
+func (e *PlatformError) Unwrap() error {
+	return e.Err
+}
+
+// PlatformErrors is a multi-error with an error per failed platform.
+type PlatformErrors []*PlatformError
+
+func (s PlatformErrors) Error() string {
+	var result []string
+	for _, err := range s {
+		result = append(result, err.Error())
+	}
+	return strings.Join(result, "; ")
+}
+
+func (s PlatformErrors) Unwrap() []error {
+	result := make([]error, 0, len(s))
+	for _, err := range s {
+		result = append(result, err)
+	}
+	return result
 }
 
 type DevicePathAndPlatform struct {
 	DevicePath DevicePath
 	Platform   Platform
+	PlatformID PlatformID
 }
 
 func (d DevicePathAndPlatform) ListFormats() (Formats, error) {
@@ -54,19 +180,94 @@ func (d DevicePathAndPlatform) OpenCamera(format Format) (Camera, error) {
 	return d.Platform.OpenCamera(d.DevicePath, format)
 }
 
-func (r *Registry) ListCameras() ([]DevicePathAndPlatform, error) {
-	r.locker.Lock()
-	defer r.locker.Unlock()
+// Identity returns the identity of the device as reported by
+// the platform (see DeviceIdentifier), or the device path.
+func (d DevicePathAndPlatform) Identity() string {
+	return deviceIdentity(d.Platform, d.DevicePath)
+}
 
+// ListCameras returns the cameras of all the enabled platforms. If the same
+// device is available via multiple platforms, then only the entry of
+// the most preferred platform is returned.
+//
+// If some platforms failed, then the cameras of the other platforms are
+// still returned, together with PlatformErrors.
+func (r *Registry) ListCameras() ([]DevicePathAndPlatform, error) {
 	var result []DevicePathAndPlatform
-	for _, plat := range r.platforms {
-		cameras, _ := plat.ListCameras()
+	var errs PlatformErrors
+	seen := map[string]struct{}{}
+	for _, p := range r.enabledPlatforms() {
+		cameras, err := p.Platform.ListCameras()
+		if err != nil {
+			errs = append(errs, &PlatformError{PlatformID: p.ID, Err: err})
+		}
 		for _, devicePath := range cameras {
+			deviceID := deviceIdentity(p.Platform, devicePath)
+			if _, ok := seen[deviceID]; ok {
+				continue
+			}
+			seen[deviceID] = struct{}{}
 			result = append(result, DevicePathAndPlatform{
 				DevicePath: devicePath,
-				Platform:   plat,
+				Platform:   p.Platform,
+				PlatformID: p.ID,
 			})
 		}
 	}
+	if len(errs) > 0 {
+		return result, errs
+	}
 	return result, nil
 }
+
+// findDevice returns the path of the device as it is listed by the platform.
+func findDevice(plat Platform, devicePath DevicePath) (DevicePath, bool) {
+	// the listing may be partial in case of an error, so not checking it
+	cameras, _ := plat.ListCameras()
+	deviceID := deviceIdentity(plat, devicePath)
+	for _, c := range cameras {
+		if c == devicePath || deviceIdentity(plat, c) == deviceID {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// FindCamera returns the camera with the given device path
+// from the most preferred enabled platform which has it.
+func (r *Registry) FindCamera(devicePath DevicePath) (DevicePathAndPlatform, error) {
+	for _, p := range r.enabledPlatforms() {
+		if listedPath, ok := findDevice(p.Platform, devicePath); ok {
+			return DevicePathAndPlatform{
+				DevicePath: listedPath,
+				Platform:   p.Platform,
+				PlatformID: p.ID,
+			}, nil
+		}
+	}
+	return DevicePathAndPlatform{}, fmt.Errorf("camera with path '%s' is not found: %w", devicePath, ErrNotFound)
+}
+
+// OpenCamera opens the device using the most preferred enabled platform
+// which has it, and falls back to the next platforms if it fails.
+func (r *Registry) OpenCamera(
+	devicePath DevicePath,
+	format Format,
+) (Camera, error) {
+	var errs PlatformErrors
+	for _, p := range r.enabledPlatforms() {
+		listedPath, ok := findDevice(p.Platform, devicePath)
+		if !ok {
+			continue
+		}
+		cam, err := p.Platform.OpenCamera(listedPath, format)
+		if err == nil {
+			return cam, nil
+		}
+		errs = append(errs, &PlatformError{PlatformID: p.ID, Err: err})
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("camera with path '%s' is not found: %w", devicePath, ErrNotFound)
+	}
+	return nil, fmt.Errorf("unable to open camera '%s': %w", devicePath, errs)
+}
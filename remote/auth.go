@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	authorizationKey    = "authorization"
+	authorizationScheme = "Bearer "
+
+	// sessionIDSize is 128 bits, so that the sessions of
+	// the other clients cannot be guessed.
+	sessionIDSize = 16
+)
+
+func newSessionID() ([]byte, error) {
+	id := make([]byte, sessionIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("unable to generate a session ID: %w", err)
+	}
+	return id, nil
+}
+
+// authorize checks the token of the call (see Config.Token).
+func (s *Server) authorize(ctx context.Context) error {
+	if s.Config.Token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(authorizationKey) {
+		token, ok := strings.CutPrefix(value, authorizationScheme)
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.Config.Token)) == 1 {
+			return nil
+		}
+	}
+	return StatusError(fmt.Errorf("no valid token: %w", ErrUnauthenticated))
+}
+
+// TokenCredentials returns the credentials sending the token to
+// the server (see Config.Token); unless allowInsecure is true, they
+// are refused to be sent over an unencrypted connection.
+func TokenCredentials(token string, allowInsecure bool) credentials.PerRPCCredentials {
+	return tokenCredentials{
+		token:         token,
+		allowInsecure: allowInsecure,
+	}
+}
+
+type tokenCredentials struct {
+	token         string
+	allowInsecure bool
+}
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		authorizationKey: authorizationScheme + c.token,
+	}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return !c.allowInsecure
+}
+
+// ReadTokenFile reads the token from the file (ignoring
+// the surrounding whitespace).
+func ReadTokenFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the token: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("the token file '%s' is empty", path)
+	}
+	return token, nil
+}
@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/remote/remotepb"
+)
+
+func FormatToProto(format camera.Format) *remotepb.Format {
+	return &remotepb.Format{
+		Width:       format.Width,
+		Height:      format.Height,
+		PixelFormat: string(format.PixelFormat),
+		Fps: &remotepb.Fraction{
+			Numerator:   uint64(format.FPS.Numerator),
+			Denominator: uint64(format.FPS.Denominator),
+		},
+	}
+}
+
+func FormatFromProto(format *remotepb.Format) camera.Format {
+	return camera.Format{
+		Width:       format.GetWidth(),
+		Height:      format.GetHeight(),
+		PixelFormat: camera.PixelFormat(format.GetPixelFormat()),
+		FPS: camera.Fraction{
+			Numerator:   uint(format.GetFps().GetNumerator()),
+			Denominator: uint(format.GetFps().GetDenominator()),
+		},
+	}
+}
+
+func FormatsToProto(formats camera.Formats) []*remotepb.Format {
+	result := make([]*remotepb.Format, 0, len(formats))
+	for _, f := range formats {
+		result = append(result, FormatToProto(f))
+	}
+	return result
+}
+
+func FormatsFromProto(formats []*remotepb.Format) camera.Formats {
+	result := make(camera.Formats, 0, len(formats))
+	for _, f := range formats {
+		result = append(result, FormatFromProto(f))
+	}
+	return result
+}
+
+func DeviceDescriptorToProto(desc camera.DeviceDescriptor) *remotepb.DeviceDescriptor {
+	return &remotepb.DeviceDescriptor{
+		Name:    desc.Name,
+		Driver:  desc.Driver,
+		BusInfo: desc.BusInfo,
+	}
+}
+
+func DeviceDescriptorFromProto(desc *remotepb.DeviceDescriptor) camera.DeviceDescriptor {
+	return camera.DeviceDescriptor{
+		Name:    desc.GetName(),
+		Driver:  desc.GetDriver(),
+		BusInfo: desc.GetBusInfo(),
+	}
+}
+
+func ControlToProto(ctrl camera.Control) *remotepb.Control {
+	return &remotepb.Control{
+		Id:   uint32(ctrl.ID),
+		Name: ctrl.Name,
+		Type: uint32(ctrl.Type),
+		Min:  ctrl.Min,
+		Max:  ctrl.Max,
+		Step: ctrl.Step,
+	}
+}
+
+func ControlFromProto(ctrl *remotepb.Control) camera.Control {
+	return camera.Control{
+		ID:   camera.ControlID(ctrl.GetId()),
+		Name: ctrl.GetName(),
+		Type: camera.ControlType(ctrl.GetType()),
+		Min:  ctrl.GetMin(),
+		Max:  ctrl.GetMax(),
+		Step: ctrl.GetStep(),
+	}
+}
@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xaionaro-go/camera"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUnauthenticated means the client did not provide
+// the token required by the server (see Config.Token).
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// errorCodes preserve the error sentinels of the camera package
+// across the network.
+var errorCodes = []struct {
+	Code codes.Code
+	Err  error
+}{
+	{codes.Unimplemented, camera.ErrNotSupported},
+	{codes.NotFound, camera.ErrNotFound},
+	{codes.ResourceExhausted, camera.ErrDeviceBusy},
+	{codes.Unavailable, camera.ErrDeviceGone},
+	{codes.InvalidArgument, camera.ErrFormatRejected},
+	{codes.DeadlineExceeded, camera.ErrTimeout},
+	{codes.OutOfRange, camera.ErrNoFrame},
+	{codes.Unauthenticated, ErrUnauthenticated},
+}
+
+// StatusError converts the error to a gRPC status error; it returns
+// nil if err is nil.
+func StatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.Err) {
+			return status.Error(c.Code, err.Error())
+		}
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// ErrorFromStatus converts a gRPC status error back (wrapping
+// the sentinel of its code); it returns nil if err is nil.
+func ErrorFromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch s.Code() {
+	case codes.Canceled:
+		return &remoteError{message: s.Message(), sentinel: context.Canceled}
+	}
+	for _, c := range errorCodes {
+		if c.Code == s.Code() {
+			return &remoteError{message: s.Message(), sentinel: c.Err}
+		}
+	}
+	return &remoteError{message: s.Message()}
+}
+
+type remoteError struct {
+	message  string
+	sentinel error
+}
+
+func (e *remoteError) Error() string {
+	return "remote: " + e.message
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.sentinel
+}
@@ -0,0 +1,410 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: remote.proto
+
+package remotepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Camera_ListCameras_FullMethodName    = "/camera.remote.Camera/ListCameras"
+	Camera_ListFormats_FullMethodName    = "/camera.remote.Camera/ListFormats"
+	Camera_OpenCamera_FullMethodName     = "/camera.remote.Camera/OpenCamera"
+	Camera_StartStreaming_FullMethodName = "/camera.remote.Camera/StartStreaming"
+	Camera_StopStreaming_FullMethodName  = "/camera.remote.Camera/StopStreaming"
+	Camera_ListControls_FullMethodName   = "/camera.remote.Camera/ListControls"
+	Camera_GetControl_FullMethodName     = "/camera.remote.Camera/GetControl"
+	Camera_SetControl_FullMethodName     = "/camera.remote.Camera/SetControl"
+)
+
+// CameraClient is the client API for Camera service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Camera exposes the cameras of a host (see package remote).
+type CameraClient interface {
+	ListCameras(ctx context.Context, in *ListCamerasRequest, opts ...grpc.CallOption) (*ListCamerasReply, error)
+	ListFormats(ctx context.Context, in *ListFormatsRequest, opts ...grpc.CallOption) (*ListFormatsReply, error)
+	// OpenCamera keeps the camera opened for the lifetime of the call. The
+	// first reply is Opened (with the negotiated encoding and the session
+	// to refer to the camera in the other calls), the next ones are the
+	// frames, sent while the camera is streaming.
+	//
+	// The session is a random token, so it is only known to the client
+	// which opened the camera.
+	OpenCamera(ctx context.Context, in *OpenCameraRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OpenCameraReply], error)
+	StartStreaming(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	StopStreaming(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ListControls(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*ListControlsReply, error)
+	GetControl(ctx context.Context, in *GetControlRequest, opts ...grpc.CallOption) (*GetControlReply, error)
+	SetControl(ctx context.Context, in *SetControlRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type cameraClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCameraClient(cc grpc.ClientConnInterface) CameraClient {
+	return &cameraClient{cc}
+}
+
+func (c *cameraClient) ListCameras(ctx context.Context, in *ListCamerasRequest, opts ...grpc.CallOption) (*ListCamerasReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListCamerasReply)
+	err := c.cc.Invoke(ctx, Camera_ListCameras_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cameraClient) ListFormats(ctx context.Context, in *ListFormatsRequest, opts ...grpc.CallOption) (*ListFormatsReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFormatsReply)
+	err := c.cc.Invoke(ctx, Camera_ListFormats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cameraClient) OpenCamera(ctx context.Context, in *OpenCameraRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OpenCameraReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Camera_ServiceDesc.Streams[0], Camera_OpenCamera_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[OpenCameraRequest, OpenCameraReply]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Camera_OpenCameraClient = grpc.ServerStreamingClient[OpenCameraReply]
+
+func (c *cameraClient) StartStreaming(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Camera_StartStreaming_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cameraClient) StopStreaming(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Camera_StopStreaming_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cameraClient) ListControls(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*ListControlsReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListControlsReply)
+	err := c.cc.Invoke(ctx, Camera_ListControls_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cameraClient) GetControl(ctx context.Context, in *GetControlRequest, opts ...grpc.CallOption) (*GetControlReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetControlReply)
+	err := c.cc.Invoke(ctx, Camera_GetControl_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cameraClient) SetControl(ctx context.Context, in *SetControlRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Camera_SetControl_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CameraServer is the server API for Camera service.
+// All implementations must embed UnimplementedCameraServer
+// for forward compatibility.
+//
+// Camera exposes the cameras of a host (see package remote).
+type CameraServer interface {
+	ListCameras(context.Context, *ListCamerasRequest) (*ListCamerasReply, error)
+	ListFormats(context.Context, *ListFormatsRequest) (*ListFormatsReply, error)
+	// OpenCamera keeps the camera opened for the lifetime of the call. The
+	// first reply is Opened (with the negotiated encoding and the session
+	// to refer to the camera in the other calls), the next ones are the
+	// frames, sent while the camera is streaming.
+	//
+	// The session is a random token, so it is only known to the client
+	// which opened the camera.
+	OpenCamera(*OpenCameraRequest, grpc.ServerStreamingServer[OpenCameraReply]) error
+	StartStreaming(context.Context, *SessionRequest) (*emptypb.Empty, error)
+	StopStreaming(context.Context, *SessionRequest) (*emptypb.Empty, error)
+	ListControls(context.Context, *SessionRequest) (*ListControlsReply, error)
+	GetControl(context.Context, *GetControlRequest) (*GetControlReply, error)
+	SetControl(context.Context, *SetControlRequest) (*emptypb.Empty, error)
+	mustEmbedUnimplementedCameraServer()
+}
+
+// UnimplementedCameraServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCameraServer struct{}
+
+func (UnimplementedCameraServer) ListCameras(context.Context, *ListCamerasRequest) (*ListCamerasReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCameras not implemented")
+}
+func (UnimplementedCameraServer) ListFormats(context.Context, *ListFormatsRequest) (*ListFormatsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFormats not implemented")
+}
+func (UnimplementedCameraServer) OpenCamera(*OpenCameraRequest, grpc.ServerStreamingServer[OpenCameraReply]) error {
+	return status.Errorf(codes.Unimplemented, "method OpenCamera not implemented")
+}
+func (UnimplementedCameraServer) StartStreaming(context.Context, *SessionRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartStreaming not implemented")
+}
+func (UnimplementedCameraServer) StopStreaming(context.Context, *SessionRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopStreaming not implemented")
+}
+func (UnimplementedCameraServer) ListControls(context.Context, *SessionRequest) (*ListControlsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListControls not implemented")
+}
+func (UnimplementedCameraServer) GetControl(context.Context, *GetControlRequest) (*GetControlReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetControl not implemented")
+}
+func (UnimplementedCameraServer) SetControl(context.Context, *SetControlRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetControl not implemented")
+}
+func (UnimplementedCameraServer) mustEmbedUnimplementedCameraServer() {}
+func (UnimplementedCameraServer) testEmbeddedByValue()                {}
+
+// UnsafeCameraServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CameraServer will
+// result in compilation errors.
+type UnsafeCameraServer interface {
+	mustEmbedUnimplementedCameraServer()
+}
+
+func RegisterCameraServer(s grpc.ServiceRegistrar, srv CameraServer) {
+	// If the following call pancis, it indicates UnimplementedCameraServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Camera_ServiceDesc, srv)
+}
+
+func _Camera_ListCameras_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCamerasRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CameraServer).ListCameras(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Camera_ListCameras_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CameraServer).ListCameras(ctx, req.(*ListCamerasRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Camera_ListFormats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFormatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CameraServer).ListFormats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Camera_ListFormats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CameraServer).ListFormats(ctx, req.(*ListFormatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Camera_OpenCamera_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(OpenCameraRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CameraServer).OpenCamera(m, &grpc.GenericServerStream[OpenCameraRequest, OpenCameraReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Camera_OpenCameraServer = grpc.ServerStreamingServer[OpenCameraReply]
+
+func _Camera_StartStreaming_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CameraServer).StartStreaming(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Camera_StartStreaming_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CameraServer).StartStreaming(ctx, req.(*SessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Camera_StopStreaming_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CameraServer).StopStreaming(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Camera_StopStreaming_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CameraServer).StopStreaming(ctx, req.(*SessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Camera_ListControls_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CameraServer).ListControls(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Camera_ListControls_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CameraServer).ListControls(ctx, req.(*SessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Camera_GetControl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetControlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CameraServer).GetControl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Camera_GetControl_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CameraServer).GetControl(ctx, req.(*GetControlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Camera_SetControl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetControlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CameraServer).SetControl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Camera_SetControl_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CameraServer).SetControl(ctx, req.(*SetControlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Camera_ServiceDesc is the grpc.ServiceDesc for Camera service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Camera_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "camera.remote.Camera",
+	HandlerType: (*CameraServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListCameras",
+			Handler:    _Camera_ListCameras_Handler,
+		},
+		{
+			MethodName: "ListFormats",
+			Handler:    _Camera_ListFormats_Handler,
+		},
+		{
+			MethodName: "StartStreaming",
+			Handler:    _Camera_StartStreaming_Handler,
+		},
+		{
+			MethodName: "StopStreaming",
+			Handler:    _Camera_StopStreaming_Handler,
+		},
+		{
+			MethodName: "ListControls",
+			Handler:    _Camera_ListControls_Handler,
+		},
+		{
+			MethodName: "GetControl",
+			Handler:    _Camera_GetControl_Handler,
+		},
+		{
+			MethodName: "SetControl",
+			Handler:    _Camera_SetControl_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "OpenCamera",
+			Handler:       _Camera_OpenCamera_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "remote.proto",
+}
@@ -0,0 +1,315 @@
+// Package remote implements a gRPC service exposing the cameras of the
+// host (see remotepb/remote.proto), so that they could be used from other
+// machines via the camera.Platform implemented by platform/remote.
+//
+// The frames are sent either raw (NV12 or YUYV) or compressed; the client
+// lists the acceptable encodings in the order of preference, and the
+// first one the camera is able to deliver is used. MJPEG is always
+// available: if the platform cannot compress the frames, then the server
+// encodes them.
+//
+// The service has no access control by itself: it should be served
+// with TLS (see grpc.Creds) and with Config.Token if the network
+// is not trusted.
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+	"github.com/xaionaro-go/camera/remote/remotepb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type Config struct {
+	// Registry provides the cameras; camera.DefaultRegistry() if nil.
+	Registry *camera.Registry
+
+	// Token (if set) is required from the clients, as
+	// "authorization: Bearer TOKEN" in the metadata of the calls
+	// (see TokenCredentials).
+	Token string
+
+	// OnError is called on errors which cannot be returned to a client.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Registry == nil {
+		cfg.Registry = camera.DefaultRegistry()
+	}
+	return cfg
+}
+
+type Server struct {
+	remotepb.UnimplementedCameraServer
+
+	Config Config
+
+	locker sync.Mutex
+	// sessions are indexed by the session IDs as strings
+	sessions map[string]*session
+}
+
+var _ remotepb.CameraServer = (*Server)(nil)
+
+func New(cfg Config) *Server {
+	return &Server{
+		Config:   cfg.withDefaults(),
+		sessions: map[string]*session{},
+	}
+}
+
+func (s *Server) reportError(err error) {
+	if s.Config.OnError != nil {
+		s.Config.OnError(err)
+	}
+}
+
+// Register registers the service in the gRPC server
+// (e.g. to serve it next to other services).
+func (s *Server) Register(grpcServer *grpc.Server) {
+	remotepb.RegisterCameraServer(grpcServer, s)
+}
+
+// ListenAndServe serves the service on the TCP address until
+// the context is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string, opts ...grpc.ServerOption) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen at '%s': %w", addr, err)
+	}
+	grpcServer := grpc.NewServer(opts...)
+	s.Register(grpcServer)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- grpcServer.Serve(l)
+	}()
+	select {
+	case <-ctx.Done():
+		// not GracefulStop, since the frame streams never end by themselves
+		grpcServer.Stop()
+		<-errCh
+		return ctx.Err()
+	case err := <-errCh:
+		return err
+	}
+}
+
+func (s *Server) ListCameras(
+	ctx context.Context,
+	req *remotepb.ListCamerasRequest,
+) (*remotepb.ListCamerasReply, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	cameras, err := s.Config.Registry.ListCameras()
+	reply := &remotepb.ListCamerasReply{}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	for _, c := range cameras {
+		dev := &remotepb.Device{
+			DevicePath: c.DevicePath,
+			PlatformId: string(c.PlatformID),
+			Identity:   c.Identity(),
+		}
+		if describer, ok := c.Platform.(camera.DeviceDescriber); ok {
+			desc, _ := describer.DescribeDevice(c.DevicePath)
+			dev.DeviceDescriptor = DeviceDescriptorToProto(desc)
+		}
+		reply.Devices = append(reply.Devices, dev)
+	}
+	return reply, nil
+}
+
+// ListFormats returns the formats of the raw frames (see rawimage.RawFormat);
+// the same formats are used to request the compressed frames.
+func (s *Server) ListFormats(
+	ctx context.Context,
+	req *remotepb.ListFormatsRequest,
+) (*remotepb.ListFormatsReply, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	dev, err := s.Config.Registry.FindCamera(req.GetDevicePath())
+	if err != nil {
+		return nil, StatusError(err)
+	}
+	formats, err := dev.ListFormats()
+	if err != nil {
+		return nil, StatusError(fmt.Errorf("unable to list the formats of '%s': %w", dev.DevicePath, err))
+	}
+	return &remotepb.ListFormatsReply{
+		Formats: FormatsToProto(rawimage.RawFormats(formats)),
+	}, nil
+}
+
+func (s *Server) OpenCamera(
+	req *remotepb.OpenCameraRequest,
+	stream grpc.ServerStreamingServer[remotepb.OpenCameraReply],
+) error {
+	if err := s.authorize(stream.Context()); err != nil {
+		return err
+	}
+	sess, err := s.openSession(req)
+	if err != nil {
+		return StatusError(err)
+	}
+	defer s.closeSession(sess)
+
+	err = stream.Send(&remotepb.OpenCameraReply{
+		Reply: &remotepb.OpenCameraReply_Opened{
+			Opened: &remotepb.Opened{
+				Session:  sess.ID,
+				Format:   FormatToProto(sess.Format),
+				Encoding: sess.Encoding,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return StatusError(sess.serve(stream))
+}
+
+func (s *Server) openSession(req *remotepb.OpenCameraRequest) (*session, error) {
+	dev, err := s.Config.Registry.FindCamera(req.GetDevicePath())
+	if err != nil {
+		return nil, err
+	}
+	formats, err := dev.ListFormats()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the formats of '%s': %w", dev.DevicePath, err)
+	}
+	format := FormatFromProto(req.GetFormat())
+	if format == (camera.Format{}) {
+		if len(formats) == 0 {
+			return nil, fmt.Errorf("camera '%s' has no formats: %w", dev.DevicePath, camera.ErrFormatRejected)
+		}
+		format = rawimage.RawFormat(formats[0])
+	}
+	srcFormat, ok := rawimage.SourceFormat(formats, format)
+	if !ok {
+		return nil, fmt.Errorf("camera '%s' does not support format %v: %w", dev.DevicePath, format, camera.ErrFormatRejected)
+	}
+
+	encodings := req.GetEncodings()
+	if len(encodings) == 0 {
+		encodings = []*remotepb.Encoding{{}}
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, encoding := range encodings {
+		sess, err := newSession(s, dev, srcFormat, format, encoding)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sess.ID = id
+		s.locker.Lock()
+		s.sessions[string(sess.ID)] = sess
+		s.locker.Unlock()
+		return sess, nil
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("unable to open camera '%s' in any of the encodings: %w", dev.DevicePath, errors.Join(errs...))
+}
+
+func (s *Server) closeSession(sess *session) {
+	s.locker.Lock()
+	delete(s.sessions, string(sess.ID))
+	s.locker.Unlock()
+	if err := sess.close(); err != nil {
+		s.reportError(fmt.Errorf("unable to close camera '%s': %w", sess.Device.DevicePath, err))
+	}
+}
+
+func (s *Server) getSession(ctx context.Context, id []byte) (*session, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	sess, ok := s.sessions[string(id)]
+	if !ok {
+		return nil, StatusError(fmt.Errorf("there is no such session: %w", camera.ErrDeviceGone))
+	}
+	return sess, nil
+}
+
+func (s *Server) StartStreaming(ctx context.Context, req *remotepb.SessionRequest) (*emptypb.Empty, error) {
+	sess, err := s.getSession(ctx, req.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, StatusError(sess.start())
+}
+
+func (s *Server) StopStreaming(ctx context.Context, req *remotepb.SessionRequest) (*emptypb.Empty, error) {
+	sess, err := s.getSession(ctx, req.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, StatusError(sess.stop())
+}
+
+func (s *Server) controls(ctx context.Context, id []byte) (camera.Controls, error) {
+	sess, err := s.getSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ctrls, ok := sess.Camera.(camera.Controls)
+	if !ok {
+		return nil, StatusError(fmt.Errorf("the camera has no controls: %w", camera.ErrNotSupported))
+	}
+	return ctrls, nil
+}
+
+func (s *Server) ListControls(ctx context.Context, req *remotepb.SessionRequest) (*remotepb.ListControlsReply, error) {
+	ctrls, err := s.controls(ctx, req.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	list, err := ctrls.ListControls()
+	if err != nil {
+		return nil, StatusError(err)
+	}
+	reply := &remotepb.ListControlsReply{}
+	for _, ctrl := range list {
+		reply.Controls = append(reply.Controls, ControlToProto(ctrl))
+	}
+	return reply, nil
+}
+
+func (s *Server) GetControl(ctx context.Context, req *remotepb.GetControlRequest) (*remotepb.GetControlReply, error) {
+	ctrls, err := s.controls(ctx, req.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	value, err := ctrls.GetControl(camera.ControlID(req.GetId()))
+	if err != nil {
+		return nil, StatusError(err)
+	}
+	return &remotepb.GetControlReply{Value: value}, nil
+}
+
+func (s *Server) SetControl(ctx context.Context, req *remotepb.SetControlRequest) (*emptypb.Empty, error) {
+	ctrls, err := s.controls(ctx, req.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, StatusError(ctrls.SetControl(camera.ControlID(req.GetId()), req.GetValue()))
+}
@@ -0,0 +1,281 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/rawimage"
+	"github.com/xaionaro-go/camera/remote/remotepb"
+	"google.golang.org/grpc"
+)
+
+// session is a camera opened for a client.
+type session struct {
+	ID     []byte
+	Server *Server
+	Device camera.DevicePathAndPlatform
+
+	// Format and Encoding are of the frames sent to the client.
+	Format   camera.Format
+	Encoding *remotepb.Encoding
+
+	Camera camera.CameraCommon
+
+	// grab returns the next frame of the camera as sent to the client.
+	grab func(ctx context.Context) (*remotepb.Frame, error)
+
+	streamLocker sync.Mutex
+	cancelFn     context.CancelFunc
+	done         chan struct{}
+
+	// frames keeps the latest frame only, the older ones are dropped
+	// if the client is too slow.
+	frames   chan *remotepb.Frame
+	failOnce sync.Once
+	failure  error
+	failedCh chan struct{}
+	seq      uint64
+}
+
+// newSession opens the camera: the raw frames are delivered in format
+// (as converted from srcFormat of the device), the compressed ones
+// are produced by the platform, or encoded here if it is MJPEG.
+func newSession(
+	srv *Server,
+	dev camera.DevicePathAndPlatform,
+	srcFormat camera.Format,
+	format camera.Format,
+	encoding *remotepb.Encoding,
+) (_ *session, _err error) {
+	s := &session{
+		Server:   srv,
+		Device:   dev,
+		Format:   format,
+		Encoding: encoding,
+		frames:   make(chan *remotepb.Frame, 1),
+		failedCh: make(chan struct{}),
+	}
+	defer func() {
+		if _err != nil && s.Camera != nil {
+			s.Camera.Close()
+		}
+	}()
+
+	compression := camera.Compression(encoding.GetCompression())
+	if compression == camera.CompressionUndefined {
+		cam, err := dev.OpenCamera(srcFormat)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open camera '%s': %w", dev.DevicePath, err)
+		}
+		s.Camera = cam
+		s.grab = s.grabRaw(cam)
+		return s, nil
+	}
+
+	camCompressed, err := dev.Platform.OpenCameraCompressed(
+		dev.DevicePath,
+		srcFormat,
+		compression,
+		camera.CompressionQuality(encoding.GetQuality()),
+	)
+	switch {
+	case err == nil:
+		s.Camera = camCompressed
+		s.Format = camCompressed.GetFormat()
+		s.grab = s.grabCompressed(camCompressed)
+		return s, nil
+	case !errors.Is(err, camera.ErrNotSupported) || compression != camera.CompressionMJPEG:
+		return nil, fmt.Errorf("unable to open camera '%s' with compression '%s': %w", dev.DevicePath, compression, err)
+	}
+
+	cam, err := dev.OpenCamera(srcFormat)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open camera '%s': %w", dev.DevicePath, err)
+	}
+	s.Camera = cam
+	s.Format.PixelFormat = camera.PixelFormatMJPEG
+	quality := int(encoding.GetQuality())
+	if quality <= 0 || quality > 100 {
+		quality = rawimage.DefaultJPEGQuality
+	}
+	s.grab = s.grabJPEG(cam, quality)
+	return s, nil
+}
+
+// newFrame fills the metadata of the frame (a camera.Frame or
+// camera.FramesCompressed).
+func (s *session) newFrame(frame any, data []byte) *remotepb.Frame {
+	result := &remotepb.Frame{
+		Seq:             s.seq,
+		CaptureUnixNano: time.Now().UnixNano(),
+		Data:            data,
+	}
+	s.seq++
+	if sequencer, ok := frame.(camera.FrameSequencer); ok {
+		result.Seq = sequencer.Sequence()
+	}
+	if skipCounter, ok := frame.(camera.FrameSkipCounter); ok {
+		result.Skipped = skipCounter.SkippedFrames()
+	}
+	if timestamper, ok := frame.(camera.FrameTimestamper); ok {
+		if ts := timestamper.Timestamp(); !ts.IsZero() {
+			result.CaptureUnixNano = ts.UnixNano()
+		}
+	}
+	return result
+}
+
+func (s *session) grabRaw(cam camera.Camera) func(ctx context.Context) (*remotepb.Frame, error) {
+	return s.grabImage(cam, func(frame camera.Frame) ([]byte, error) {
+		return rawimage.AppendBytes(nil, &s.Format, frame.Image())
+	})
+}
+
+func (s *session) grabJPEG(cam camera.Camera, quality int) func(ctx context.Context) (*remotepb.Frame, error) {
+	return s.grabImage(cam, func(frame camera.Frame) ([]byte, error) {
+		return rawimage.AppendJPEG(nil, frame.Image(), quality)
+	})
+}
+
+func (s *session) grabImage(
+	cam camera.Camera,
+	encode func(camera.Frame) ([]byte, error),
+) func(ctx context.Context) (*remotepb.Frame, error) {
+	return func(ctx context.Context) (*remotepb.Frame, error) {
+		frame, err := cam.GetFrame(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := cam.ReleaseFrame(frame); err != nil {
+				s.Server.reportError(fmt.Errorf("unable to release a frame of '%s': %w", s.Device.DevicePath, err))
+			}
+		}()
+		data, err := encode(frame)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode a frame of '%s': %w", s.Device.DevicePath, err)
+		}
+		return s.newFrame(frame, data), nil
+	}
+}
+
+func (s *session) grabCompressed(cam camera.CameraCompressed) func(ctx context.Context) (*remotepb.Frame, error) {
+	return func(ctx context.Context) (*remotepb.Frame, error) {
+		frames, err := cam.GetCompressedFrames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := cam.ReleaseFrames(frames); err != nil {
+				s.Server.reportError(fmt.Errorf("unable to release the frames of '%s': %w", s.Device.DevicePath, err))
+			}
+		}()
+		return s.newFrame(frames, bytes.Clone(frames.Bytes())), nil
+	}
+}
+
+func (s *session) fail(err error) {
+	s.failOnce.Do(func() {
+		s.failure = err
+		close(s.failedCh)
+	})
+}
+
+func (s *session) run(ctx context.Context) {
+	for {
+		frame, err := s.grab(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.fail(fmt.Errorf("unable to get a frame of '%s': %w", s.Device.DevicePath, err))
+			return
+		}
+		s.deliver(frame)
+	}
+}
+
+// deliver replaces the pending frame (if any) with the new one;
+// it is called by one goroutine only.
+func (s *session) deliver(frame *remotepb.Frame) {
+	select {
+	case s.frames <- frame:
+		return
+	default:
+	}
+	select {
+	case dropped := <-s.frames:
+		frame.Skipped += dropped.Skipped + 1
+	default:
+	}
+	s.frames <- frame
+}
+
+// serve sends the frames until the client disconnects
+// or the camera fails.
+func (s *session) serve(stream grpc.ServerStreamingServer[remotepb.OpenCameraReply]) error {
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.failedCh:
+			return s.failure
+		case frame := <-s.frames:
+			err := stream.Send(&remotepb.OpenCameraReply{
+				Reply: &remotepb.OpenCameraReply_Frame{Frame: frame},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *session) start() error {
+	s.streamLocker.Lock()
+	defer s.streamLocker.Unlock()
+	if s.cancelFn != nil {
+		return nil
+	}
+	if err := s.Camera.StartStreaming(); err != nil {
+		return fmt.Errorf("unable to start streaming: %w", err)
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	s.cancelFn = cancelFn
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.run(ctx)
+	}()
+	return nil
+}
+
+func (s *session) stop() error {
+	s.streamLocker.Lock()
+	defer s.streamLocker.Unlock()
+	if s.cancelFn == nil {
+		return nil
+	}
+	s.cancelFn()
+	<-s.done
+	s.cancelFn = nil
+	// the pending frame is stale
+	select {
+	case <-s.frames:
+	default:
+	}
+	if err := s.Camera.StopStreaming(); err != nil {
+		return fmt.Errorf("unable to stop streaming: %w", err)
+	}
+	return nil
+}
+
+func (s *session) close() error {
+	return errors.Join(s.stop(), s.Camera.Close())
+}
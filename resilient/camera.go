@@ -0,0 +1,392 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// backend is an opened instance of the underlying camera.
+type backend struct {
+	camera.Camera
+	Generation uint64
+
+	// outstanding is the amount of frames not released yet.
+	outstanding uint
+	// retired means the backend is not used anymore and it should be
+	// closed as soon as all its frames are released.
+	retired bool
+	closed  bool
+}
+
+// markClosedIfUnused must be called with Camera.locker locked; it returns
+// true if the backend should be closed (after unlocking).
+func (b *backend) markClosedIfUnused() bool {
+	if b.closed || !b.retired || b.outstanding > 0 {
+		return false
+	}
+	b.closed = true
+	return true
+}
+
+// Camera is a camera.Camera which reopens the device on failures.
+//
+// Frames obtained before a reopen stay valid until released: each frame
+// is released to the device handle it came from, and the replaced handle
+// is closed only after its last frame is released (including by Close).
+// Thus, if the device refuses to be reopened while busy, then it is
+// reopened only after the old frames are released.
+type Camera struct {
+	Platform   camera.Platform
+	DevicePath camera.DevicePath
+	Format     camera.Format
+	Config     Config
+
+	locker             sync.Mutex
+	reopenLocker       sync.Mutex
+	current            *backend
+	state              State
+	generation         uint64
+	reopenCount        uint64
+	streamingRequested bool
+	latestFrameOnly    bool
+}
+
+var _ camera.Camera = (*Camera)(nil)
+var _ camera.LatestFrameOnlySetter = (*Camera)(nil)
+
+// New opens the camera, retrying until success, a non-retryable error
+// or the context is done. camera.ErrNotFound is not retried here (the
+// path is probably wrong), but it is retried on reopening a device
+// which was opened before (it may be plugged back).
+func New(
+	ctx context.Context,
+	plat camera.Platform,
+	devicePath camera.DevicePath,
+	format camera.Format,
+	cfg Config,
+) (*Camera, error) {
+	c := &Camera{
+		Platform:   plat,
+		DevicePath: devicePath,
+		Format:     format,
+		Config:     cfg.withDefaults(),
+		state:      StateUndefined,
+	}
+	if _, err := c.reopen(ctx); err != nil {
+		return nil, fmt.Errorf("unable to open the camera '%s': %w", devicePath, err)
+	}
+	return c, nil
+}
+
+func (c *Camera) State() State {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.state
+}
+
+// ReopenCount returns how many times the device was reopened
+// (excluding the initial opening).
+func (c *Camera) ReopenCount() uint64 {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.reopenCount
+}
+
+// setState must be called without c.locker locked, as it calls the callback.
+func (c *Camera) setState(state State, reason error) {
+	c.locker.Lock()
+	prev := c.state
+	if prev == StateClosed {
+		c.locker.Unlock()
+		return
+	}
+	c.state = state
+	c.locker.Unlock()
+
+	if prev != state && c.Config.OnStateChange != nil {
+		c.Config.OnStateChange(prev, state, reason)
+	}
+}
+
+func (c *Camera) openBackend() (camera.Camera, error) {
+	cam, err := c.Platform.OpenCamera(c.DevicePath, c.Format)
+	if err != nil && c.Config.RenegotiateFormat && errors.Is(err, camera.ErrFormatRejected) {
+		formats, listErr := c.Platform.ListFormats(c.DevicePath)
+		if listErr != nil {
+			return nil, fmt.Errorf("unable to list formats to renegotiate: %w (the format was rejected: %w)", listErr, err)
+		}
+		format, ok := formats.Closest(c.Format)
+		if !ok {
+			return nil, fmt.Errorf("no formats available to renegotiate: %w", err)
+		}
+		cam, err = c.Platform.OpenCamera(c.DevicePath, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.locker.Lock()
+	latestFrameOnly := c.latestFrameOnly
+	streamingRequested := c.streamingRequested
+	c.locker.Unlock()
+
+	if setter, ok := cam.(camera.LatestFrameOnlySetter); ok {
+		setter.SetLatestFrameOnly(latestFrameOnly)
+	}
+	if streamingRequested {
+		if err := cam.StartStreaming(); err != nil {
+			cam.Close()
+			return nil, fmt.Errorf("unable to start streaming: %w", err)
+		}
+	}
+	return cam, nil
+}
+
+// reopen opens the device again (with exponential backoff),
+// unless another goroutine already did it.
+func (c *Camera) reopen(ctx context.Context) (*backend, error) {
+	c.reopenLocker.Lock()
+	defer c.reopenLocker.Unlock()
+
+	backoff := c.Config.InitialBackoff
+	for {
+		c.locker.Lock()
+		current, state, generation := c.current, c.state, c.generation
+		c.locker.Unlock()
+		if state == StateClosed {
+			return nil, fmt.Errorf("the camera is closed")
+		}
+		if current != nil {
+			return current, nil
+		}
+
+		cam, err := c.openBackend()
+		if err == nil {
+			return c.install(cam)
+		}
+		if errors.Is(err, camera.ErrNotSupported) {
+			return nil, err
+		}
+		if errors.Is(err, camera.ErrNotFound) && generation == 0 {
+			return nil, err
+		}
+
+		if c.Config.OnReopenError != nil {
+			c.Config.OnReopenError(err, backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (the last error: %w)", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.Config.MaxBackoff)
+	}
+}
+
+func (c *Camera) install(cam camera.Camera) (*backend, error) {
+	c.locker.Lock()
+	if c.state == StateClosed {
+		c.locker.Unlock()
+		cam.Close()
+		return nil, fmt.Errorf("the camera is closed")
+	}
+	c.generation++
+	b := &backend{
+		Camera:     cam,
+		Generation: c.generation,
+	}
+	c.current = b
+	if c.generation > 1 {
+		c.reopenCount++
+	}
+	state := StateOpened
+	if c.streamingRequested {
+		state = StateStreaming
+	}
+	c.locker.Unlock()
+
+	c.setState(state, nil)
+	return b, nil
+}
+
+// detach must be called with c.locker locked; if the backend has
+// no unreleased frames, then it is returned to be closed after unlocking.
+func (c *Camera) detach(b *backend) (bool, *backend) {
+	if b == nil || c.current != b {
+		return false, nil
+	}
+	c.current = nil
+	b.retired = true
+	if b.markClosedIfUnused() {
+		return true, b
+	}
+	return true, nil
+}
+
+// retire detaches the backend, so that the next call reopens the device.
+func (c *Camera) retire(b *backend, reason error) {
+	c.locker.Lock()
+	detached, toClose := c.detach(b)
+	c.locker.Unlock()
+
+	if toClose != nil {
+		toClose.Camera.Close()
+	}
+	if detached {
+		c.setState(StateDisconnected, reason)
+	}
+}
+
+func isDeviceLost(err error) bool {
+	return errors.Is(err, camera.ErrDeviceGone) || errors.Is(err, camera.ErrTimeout)
+}
+
+// StartStreaming starts streaming of the device. If the device is
+// disconnected (see State), then the streaming is started on reopening it
+// (by the next GetFrame). If the device is lost on starting, then the
+// error is returned, but the streaming is still requested and the device
+// is reopened and started by the next GetFrame (unless StopStreaming
+// is called).
+func (c *Camera) StartStreaming() error {
+	c.locker.Lock()
+	c.streamingRequested = true
+	b := c.current
+	c.locker.Unlock()
+	if b == nil {
+		return nil
+	}
+
+	if err := b.StartStreaming(); err != nil {
+		if isDeviceLost(err) {
+			c.retire(b, err)
+		}
+		return err
+	}
+	c.setState(StateStreaming, nil)
+	return nil
+}
+
+func (c *Camera) StopStreaming() error {
+	c.locker.Lock()
+	c.streamingRequested = false
+	b := c.current
+	c.locker.Unlock()
+	if b == nil {
+		return nil
+	}
+
+	if err := b.StopStreaming(); err != nil {
+		if isDeviceLost(err) {
+			c.retire(b, err)
+			return nil
+		}
+		return err
+	}
+	c.setState(StateOpened, nil)
+	return nil
+}
+
+// Close closes the device; the handles with unreleased frames are
+// closed on releasing their last frame.
+func (c *Camera) Close() error {
+	c.locker.Lock()
+	_, toClose := c.detach(c.current)
+	c.locker.Unlock()
+
+	c.setState(StateClosed, nil)
+	if toClose != nil {
+		return toClose.Camera.Close()
+	}
+	return nil
+}
+
+func (c *Camera) SetLatestFrameOnly(v bool) {
+	c.locker.Lock()
+	c.latestFrameOnly = v
+	b := c.current
+	c.locker.Unlock()
+	if b == nil {
+		return
+	}
+	if setter, ok := b.Camera.(camera.LatestFrameOnlySetter); ok {
+		setter.SetLatestFrameOnly(v)
+	}
+}
+
+// GetFormat returns the format of the currently opened device, which
+// may differ from the requested one if the format was renegotiated.
+func (c *Camera) GetFormat() camera.Format {
+	c.locker.Lock()
+	b := c.current
+	c.locker.Unlock()
+	if b == nil {
+		return c.Format
+	}
+	return b.GetFormat()
+}
+
+func (c *Camera) GetFrame(
+	ctx context.Context,
+) (camera.Frame, error) {
+	for {
+		b, err := c.reopen(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to reopen the camera: %w", err)
+		}
+
+		frameCtx, cancelFn := ctx, context.CancelFunc(func() {})
+		if c.Config.FrameTimeout > 0 {
+			frameCtx, cancelFn = context.WithTimeout(ctx, c.Config.FrameTimeout)
+		}
+		frame, err := b.GetFrame(frameCtx)
+		cancelFn()
+		if err == nil {
+			c.locker.Lock()
+			b.outstanding++
+			c.locker.Unlock()
+			return &Frame{
+				Frame:      frame,
+				Generation: b.Generation,
+				backend:    b,
+			}, nil
+		}
+
+		if ctx.Err() != nil || !isDeviceLost(err) {
+			return nil, err
+		}
+		c.retire(b, err)
+	}
+}
+
+func (c *Camera) ReleaseFrame(frame camera.Frame) error {
+	f, ok := frame.(*Frame)
+	if !ok {
+		return fmt.Errorf("unexpected frame type %T", frame)
+	}
+	b := f.backend
+
+	// the backend is not closed while the frame is outstanding,
+	// so it is released without holding the lock
+	err := b.ReleaseFrame(f.Frame)
+
+	c.locker.Lock()
+	if b.retired && isDeviceLost(err) {
+		// the device is already known to be lost
+		err = nil
+	}
+	b.outstanding--
+	toClose := b.markClosedIfUnused()
+	c.locker.Unlock()
+
+	if toClose {
+		if closeErr := b.Camera.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("unable to close the replaced device handle: %w", closeErr))
+		}
+	}
+	return err
+}
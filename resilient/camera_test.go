@@ -0,0 +1,368 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const testDevicePath = "test:0"
+
+var testFormat = camera.Format{
+	Width:       64,
+	Height:      48,
+	PixelFormat: camera.PixelFormatNV12,
+	FPS:         camera.Fraction{Numerator: 1000, Denominator: 1},
+}
+
+// testPlatform opens the test cameras, which fail on demand;
+// the other methods of the platform are not used.
+type testPlatform struct {
+	camera.Platform
+
+	locker sync.Mutex
+	// openErrs are returned by the next calls of OpenCamera.
+	openErrs []error
+	// exclusive makes OpenCamera fail with camera.ErrDeviceBusy
+	// while a previously opened camera is not closed.
+	exclusive bool
+	opened    []*testCamera
+}
+
+func newTestPlatform() *testPlatform {
+	return &testPlatform{}
+}
+
+func (p *testPlatform) OpenCamera(
+	devicePath camera.DevicePath,
+	format camera.Format,
+) (camera.Camera, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if len(p.openErrs) > 0 {
+		err := p.openErrs[0]
+		p.openErrs = p.openErrs[1:]
+		return nil, err
+	}
+	if p.exclusive {
+		for _, cam := range p.opened {
+			if !cam.closed {
+				return nil, fmt.Errorf("%w: camera #%d is still open", camera.ErrDeviceBusy, cam.idx)
+			}
+		}
+	}
+	result := &testCamera{platform: p, idx: len(p.opened)}
+	p.opened = append(p.opened, result)
+	return result, nil
+}
+
+func (p *testPlatform) camera(t *testing.T, idx int) *testCamera {
+	t.Helper()
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if idx >= len(p.opened) {
+		t.Fatalf("expected at least %d opened cameras, got %d", idx+1, len(p.opened))
+	}
+	return p.opened[idx]
+}
+
+func (p *testPlatform) openedCount() int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return len(p.opened)
+}
+
+type testFrame struct{}
+
+func (testFrame) Image() image.Image {
+	return image.NewGray(image.Rect(0, 0, int(testFormat.Width), int(testFormat.Height)))
+}
+
+type testCamera struct {
+	platform *testPlatform
+	idx      int
+
+	// the fields below are protected by platform.locker
+	startErr    error
+	getFrameErr error
+	taken       int
+	released    int
+	closed      bool
+}
+
+func (c *testCamera) StartStreaming() error {
+	c.platform.locker.Lock()
+	err := c.startErr
+	c.platform.locker.Unlock()
+	return err
+}
+
+func (c *testCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *testCamera) GetFormat() camera.Format {
+	return testFormat
+}
+
+func (c *testCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	c.platform.locker.Lock()
+	err := c.getFrameErr
+	c.platform.locker.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.platform.locker.Lock()
+	c.taken++
+	c.platform.locker.Unlock()
+	return testFrame{}, nil
+}
+
+func (c *testCamera) ReleaseFrame(frame camera.Frame) error {
+	c.platform.locker.Lock()
+	if c.closed {
+		c.platform.locker.Unlock()
+		return fmt.Errorf("camera #%d is already closed", c.idx)
+	}
+	c.released++
+	c.platform.locker.Unlock()
+	return nil
+}
+
+func (c *testCamera) Close() error {
+	c.platform.locker.Lock()
+	defer c.platform.locker.Unlock()
+	if c.closed {
+		return fmt.Errorf("camera #%d is closed twice", c.idx)
+	}
+	c.closed = true
+	return nil
+}
+
+func (c *testCamera) set(fn func(c *testCamera)) {
+	c.platform.locker.Lock()
+	defer c.platform.locker.Unlock()
+	fn(c)
+}
+
+// check verifies the counters of the camera.
+func (c *testCamera) check(t *testing.T, taken, released int, closed bool) {
+	t.Helper()
+	c.platform.locker.Lock()
+	defer c.platform.locker.Unlock()
+	if c.taken != taken || c.released != released || c.closed != closed {
+		t.Errorf(
+			"camera #%d: expected taken=%d released=%d closed=%v, got taken=%d released=%d closed=%v",
+			c.idx, taken, released, closed, c.taken, c.released, c.closed,
+		)
+	}
+}
+
+// stateRecorder collects the state transitions.
+type stateRecorder struct {
+	locker sync.Mutex
+	states []State
+}
+
+func (r *stateRecorder) onStateChange(prev, next State, err error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.states = append(r.states, next)
+}
+
+func (r *stateRecorder) check(t *testing.T, expected ...State) {
+	t.Helper()
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if fmt.Sprint(r.states) != fmt.Sprint(expected) {
+		t.Errorf("expected the states %v, got %v", expected, r.states)
+	}
+}
+
+func newTestCamera(t *testing.T, p *testPlatform, states *stateRecorder) *Camera {
+	t.Helper()
+	ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	c, err := New(ctx, p, testDevicePath, testFormat, Config{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		OnStateChange:  states.onStateChange,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func getFrame(t *testing.T, c *Camera) *Frame {
+	t.Helper()
+	ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	frame, err := c.GetFrame(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame.(*Frame)
+}
+
+func releaseFrame(t *testing.T, c *Camera, frame *Frame) {
+	t.Helper()
+	if err := c.ReleaseFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	p := newTestPlatform()
+	var states stateRecorder
+	c := newTestCamera(t, p, &states)
+	if err := c.StartStreaming(); err != nil {
+		t.Fatal(err)
+	}
+
+	first := getFrame(t, c)
+	p.camera(t, 0).set(func(c *testCamera) { c.getFrameErr = camera.ErrDeviceGone })
+	second := getFrame(t, c)
+	if first.Generation != 1 || second.Generation != 2 {
+		t.Errorf("expected the generations 1 and 2, got %d and %d", first.Generation, second.Generation)
+	}
+	if c.ReopenCount() != 1 {
+		t.Errorf("expected 1 reopen, got %d", c.ReopenCount())
+	}
+	states.check(t, StateOpened, StateStreaming, StateDisconnected, StateStreaming)
+
+	// the old handle is kept until its frame is released
+	p.camera(t, 0).check(t, 1, 0, false)
+	releaseFrame(t, c, first)
+	p.camera(t, 0).check(t, 1, 1, true)
+
+	releaseFrame(t, c, second)
+	p.camera(t, 1).check(t, 1, 1, false)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p.camera(t, 1).check(t, 1, 1, true)
+	states.check(t, StateOpened, StateStreaming, StateDisconnected, StateStreaming, StateClosed)
+}
+
+func TestCloseWithOutstandingFrames(t *testing.T) {
+	p := newTestPlatform()
+	var states stateRecorder
+	c := newTestCamera(t, p, &states)
+	if err := c.StartStreaming(); err != nil {
+		t.Fatal(err)
+	}
+	frames := []*Frame{getFrame(t, c), getFrame(t, c)}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p.camera(t, 0).check(t, 2, 0, false)
+	releaseFrame(t, c, frames[0])
+	p.camera(t, 0).check(t, 2, 1, false)
+	releaseFrame(t, c, frames[1])
+	p.camera(t, 0).check(t, 2, 2, true)
+
+	if _, err := c.GetFrame(context.Background()); err == nil {
+		t.Errorf("expected no frames from the closed camera")
+	}
+	if p.openedCount() != 1 {
+		t.Errorf("expected the closed camera to not be reopened, got %d opens", p.openedCount())
+	}
+}
+
+func TestReopenWhenBusy(t *testing.T) {
+	p := newTestPlatform()
+	p.exclusive = true
+	var states stateRecorder
+	c := newTestCamera(t, p, &states)
+	defer c.Close()
+	if err := c.StartStreaming(); err != nil {
+		t.Fatal(err)
+	}
+
+	first := getFrame(t, c)
+	p.camera(t, 0).set(func(c *testCamera) { c.getFrameErr = camera.ErrDeviceGone })
+	secondCh := make(chan camera.Frame)
+	go func() {
+		ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelFn()
+		frame, err := c.GetFrame(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		secondCh <- frame
+	}()
+
+	// the device cannot be reopened until the frame of the old handle is released
+	select {
+	case <-secondCh:
+		t.Fatalf("expected the reopen to wait for the release of the old frame")
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseFrame(t, c, first)
+	second, _ := (<-secondCh).(*Frame)
+	if second == nil {
+		t.FailNow()
+	}
+	if second.Generation != 2 {
+		t.Errorf("expected the generation 2, got %d", second.Generation)
+	}
+	p.camera(t, 0).check(t, 1, 1, true)
+	releaseFrame(t, c, second)
+}
+
+func TestStartStreamingDeviceLost(t *testing.T) {
+	p := newTestPlatform()
+	var states stateRecorder
+	c := newTestCamera(t, p, &states)
+	defer c.Close()
+
+	p.camera(t, 0).set(func(c *testCamera) { c.startErr = camera.ErrDeviceGone })
+	if err := c.StartStreaming(); !errors.Is(err, camera.ErrDeviceGone) {
+		t.Fatalf("expected the device to be gone, got %v", err)
+	}
+	if c.State() != StateDisconnected {
+		t.Errorf("expected the state %s, got %s", StateDisconnected, c.State())
+	}
+	p.camera(t, 0).check(t, 0, 0, true)
+
+	// the streaming is still requested, so the reopened device streams
+	releaseFrame(t, c, getFrame(t, c))
+	p.camera(t, 1).check(t, 1, 1, false)
+	states.check(t, StateOpened, StateDisconnected, StateStreaming)
+}
+
+func TestNotFound(t *testing.T) {
+	p := newTestPlatform()
+	p.openErrs = []error{camera.ErrNotFound}
+	_, err := New(context.Background(), p, testDevicePath, testFormat, Config{})
+	if !errors.Is(err, camera.ErrNotFound) {
+		t.Fatalf("expected the camera to be not found, got %v", err)
+	}
+
+	// but a device which was opened before may be plugged back
+	var states stateRecorder
+	c := newTestCamera(t, p, &states)
+	defer c.Close()
+	if err := c.StartStreaming(); err != nil {
+		t.Fatal(err)
+	}
+	p.locker.Lock()
+	p.openErrs = []error{camera.ErrNotFound, camera.ErrNotFound}
+	p.locker.Unlock()
+	p.camera(t, 0).set(func(c *testCamera) { c.getFrameErr = camera.ErrDeviceGone })
+	frame := getFrame(t, c)
+	if frame.Generation != 2 {
+		t.Errorf("expected the generation 2, got %d", frame.Generation)
+	}
+	releaseFrame(t, c, frame)
+}
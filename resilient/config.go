@@ -0,0 +1,46 @@
+package resilient
+
+import (
+	"time"
+)
+
+const (
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+)
+
+type Config struct {
+	// InitialBackoff is the delay before the second reopen attempt;
+	// each next delay is twice longer up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// FrameTimeout is the maximal time to wait for a frame before
+	// the device is considered stalled and gets reopened. Zero disables
+	// the stall detection.
+	FrameTimeout time.Duration
+
+	// RenegotiateFormat allows to reopen the device with the closest
+	// available format if the original one is rejected.
+	RenegotiateFormat bool
+
+	// OnStateChange is called on each state transition, err is the reason
+	// of the transition (if any).
+	OnStateChange func(prev, next State, err error)
+
+	// OnReopenError is called on each failed reopen attempt.
+	OnReopenError func(err error, nextAttemptIn time.Duration)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = cfg.InitialBackoff
+	}
+	return cfg
+}
@@ -0,0 +1,28 @@
+package resilient
+
+import (
+	"image"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type Frame struct {
+	Frame      camera.Frame
+	Generation uint64
+
+	backend *backend
+}
+
+var _ camera.Frame = (*Frame)(nil)
+var _ camera.FrameSkipCounter = (*Frame)(nil)
+
+func (f *Frame) Image() image.Image {
+	return f.Frame.Image()
+}
+
+func (f *Frame) SkippedFrames() uint64 {
+	if counter, ok := f.Frame.(camera.FrameSkipCounter); ok {
+		return counter.SkippedFrames()
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package resilient
+
+import (
+	"fmt"
+)
+
+type State int
+
+const (
+	StateUndefined = State(iota)
+	StateOpened
+	StateStreaming
+	StateDisconnected
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateUndefined:
+		return "undefined"
+	case StateOpened:
+		return "opened"
+	case StateStreaming:
+		return "streaming"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("unknown_state_%d", int(s))
+	}
+}
@@ -0,0 +1,160 @@
+package rtspserver
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// see RFC 2435
+const (
+	rtpPayloadTypeJPEG = 26
+
+	jpegTypeYUV422 = 0
+	jpegTypeYUV420 = 1
+
+	// jpegQDynamic is the Q value meaning that the quantization
+	// tables are sent in-band with each frame.
+	jpegQDynamic = 255
+
+	jpegHeaderSize      = 8
+	jpegQuantHeaderSize = 4
+
+	// jpegMaxDimension is the maximum width or height which
+	// could be expressed in the JPEG RTP header.
+	jpegMaxDimension = 2040
+)
+
+// jpegFrame is a baseline JPEG image split into the parts
+// required for the RTP payload.
+type jpegFrame struct {
+	Type        uint8
+	Width       int
+	Height      int
+	QuantTables []byte
+	ScanData    []byte
+}
+
+func checkJPEGDimensions(width, height uint64) error {
+	if width == 0 || height == 0 || width%8 != 0 || height%8 != 0 {
+		return fmt.Errorf("RTP/JPEG requires the dimensions to be multiples of 8, but got %dx%d: %w", width, height, camera.ErrNotSupported)
+	}
+	if width > jpegMaxDimension || height > jpegMaxDimension {
+		return fmt.Errorf("RTP/JPEG supports up to %dx%d, but got %dx%d: %w", jpegMaxDimension, jpegMaxDimension, width, height, camera.ErrNotSupported)
+	}
+	return nil
+}
+
+// parseJPEG extracts the quantization tables and the entropy-coded data
+// of a baseline JPEG image with 3 components.
+func parseJPEG(b []byte) (*jpegFrame, error) {
+	if len(b) < 4 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil, fmt.Errorf("no SOI marker")
+	}
+
+	var quantTables [4][]byte
+	var tableIDs []uint8
+	frame := &jpegFrame{}
+	pos := 2
+	for {
+		if pos+4 > len(b) {
+			return nil, fmt.Errorf("unexpected end of data at %d", pos)
+		}
+		if b[pos] != 0xff {
+			return nil, fmt.Errorf("expected a marker at %d, but got 0x%02X", pos, b[pos])
+		}
+		marker := b[pos+1]
+		if marker == 0xff { // fill byte
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(b[pos+2:]))
+		if length < 2 || pos+2+length > len(b) {
+			return nil, fmt.Errorf("invalid length %d of marker 0x%02X", length, marker)
+		}
+		segment := b[pos+4 : pos+2+length]
+
+		switch marker {
+		case 0xdb: // DQT
+			for len(segment) > 0 {
+				precision, id := segment[0]>>4, segment[0]&0x0f
+				if precision != 0 {
+					return nil, fmt.Errorf("16-bit quantization tables are %w", camera.ErrNotSupported)
+				}
+				if id >= 4 || len(segment) < 65 {
+					return nil, fmt.Errorf("invalid quantization table")
+				}
+				quantTables[id] = segment[1:65]
+				segment = segment[65:]
+			}
+		case 0xc0: // SOF0
+			if len(segment) < 15 || segment[5] != 3 {
+				return nil, fmt.Errorf("only baseline JPEG with 3 components is %w", camera.ErrNotSupported)
+			}
+			frame.Height = int(binary.BigEndian.Uint16(segment[1:]))
+			frame.Width = int(binary.BigEndian.Uint16(segment[3:]))
+			switch segment[7] {
+			case 0x21:
+				frame.Type = jpegTypeYUV422
+			case 0x22:
+				frame.Type = jpegTypeYUV420
+			default:
+				return nil, fmt.Errorf("luma sampling 0x%02X is %w", segment[7], camera.ErrNotSupported)
+			}
+			if segment[10] != 0x11 || segment[13] != 0x11 {
+				return nil, fmt.Errorf("chroma sampling is %w", camera.ErrNotSupported)
+			}
+			tableIDs = []uint8{segment[8], segment[11]}
+		case 0xc1, 0xc2, 0xc3, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf:
+			return nil, fmt.Errorf("non-baseline JPEG is %w", camera.ErrNotSupported)
+		case 0xdd: // DRI
+			if len(segment) >= 2 && binary.BigEndian.Uint16(segment) != 0 {
+				return nil, fmt.Errorf("restart markers are %w", camera.ErrNotSupported)
+			}
+		case 0xda: // SOS
+			if tableIDs == nil {
+				return nil, fmt.Errorf("no SOF0 marker before SOS")
+			}
+			scan := b[pos+2+length:]
+			if n := len(scan); n >= 2 && scan[n-2] == 0xff && scan[n-1] == 0xd9 {
+				scan = scan[:n-2]
+			}
+			frame.ScanData = scan
+			for _, id := range tableIDs {
+				if id >= 4 || quantTables[id] == nil {
+					return nil, fmt.Errorf("quantization table %d is not defined", id)
+				}
+				frame.QuantTables = append(frame.QuantTables, quantTables[id]...)
+			}
+			return frame, nil
+		}
+		pos += 2 + length
+	}
+}
+
+// payloads splits the frame into RTP payloads (without RTP headers),
+// each of at most maxSize bytes.
+func (f *jpegFrame) payloads(maxSize int) [][]byte {
+	var result [][]byte
+	for offset := 0; offset < len(f.ScanData); {
+		payload := make([]byte, 0, maxSize)
+		payload = append(payload,
+			0, // type-specific
+			byte(offset>>16), byte(offset>>8), byte(offset),
+			f.Type,
+			jpegQDynamic,
+			byte(f.Width/8), byte(f.Height/8),
+		)
+		if offset == 0 {
+			payload = append(payload, 0, 0) // MBZ, precision (8-bit tables)
+			payload = binary.BigEndian.AppendUint16(payload, uint16(len(f.QuantTables)))
+			payload = append(payload, f.QuantTables...)
+		}
+		n := min(maxSize-len(payload), len(f.ScanData)-offset)
+		payload = append(payload, f.ScanData[offset:offset+n]...)
+		result = append(result, payload)
+		offset += n
+	}
+	return result
+}
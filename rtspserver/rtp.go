@@ -0,0 +1,58 @@
+package rtspserver
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	rtpVersion     = 2
+	rtpClockRate   = 90000
+	rtpHeaderSize  = 12
+	rtcpTypeSR     = 200
+	ntpEpochOffset = 2208988800 // seconds between 1900-01-01 and 1970-01-01
+)
+
+// see RFC 3550, section 5.1
+type rtpHeader struct {
+	Marker      bool
+	PayloadType uint8
+	Sequence    uint16
+	Timestamp   uint32
+	SSRC        uint32
+}
+
+func (h rtpHeader) appendTo(b []byte) []byte {
+	marker := uint8(0)
+	if h.Marker {
+		marker = 0x80
+	}
+	b = append(b, rtpVersion<<6, marker|h.PayloadType&0x7f)
+	b = binary.BigEndian.AppendUint16(b, h.Sequence)
+	b = binary.BigEndian.AppendUint32(b, h.Timestamp)
+	b = binary.BigEndian.AppendUint32(b, h.SSRC)
+	return b
+}
+
+// appendSenderReport appends an RTCP sender report without
+// reception report blocks (see RFC 3550, section 6.4.1).
+func appendSenderReport(
+	b []byte,
+	ssrc uint32,
+	now time.Time,
+	rtpTimestamp uint32,
+	packetCount uint32,
+	octetCount uint32,
+) []byte {
+	ntpSeconds := uint64(now.Unix() + ntpEpochOffset)
+	ntpFraction := uint64(now.Nanosecond()) << 32 / uint64(time.Second)
+
+	b = append(b, rtpVersion<<6, rtcpTypeSR)
+	b = binary.BigEndian.AppendUint16(b, 6) // the length in 32-bit words minus one
+	b = binary.BigEndian.AppendUint32(b, ssrc)
+	b = binary.BigEndian.AppendUint64(b, ntpSeconds<<32|ntpFraction)
+	b = binary.BigEndian.AppendUint32(b, rtpTimestamp)
+	b = binary.BigEndian.AppendUint32(b, packetCount)
+	b = binary.BigEndian.AppendUint32(b, octetCount)
+	return b
+}
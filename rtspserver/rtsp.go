@@ -0,0 +1,182 @@
+package rtspserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const rtspVersion = "RTSP/1.0"
+
+// see RFC 2326
+type request struct {
+	Method string
+	URL    string
+	Header textproto.MIMEHeader
+	Body   []byte
+}
+
+func readRequest(r *bufio.Reader) (*request, error) {
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	method, rest, ok1 := strings.Cut(line, " ")
+	url, version, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("invalid request line '%s'", line)
+	}
+	if version != rtspVersion {
+		return nil, fmt.Errorf("unsupported protocol version '%s'", version)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the header: %w", err)
+	}
+	req := &request{
+		Method: method,
+		URL:    url,
+		Header: header,
+	}
+
+	if s := header.Get("Content-Length"); s != "" {
+		length, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-Length '%s': %w", s, err)
+		}
+		req.Body = make([]byte, length)
+		if _, err := io.ReadFull(r, req.Body); err != nil {
+			return nil, fmt.Errorf("unable to read the body: %w", err)
+		}
+	}
+	return req, nil
+}
+
+type headerField struct {
+	Key   string
+	Value string
+}
+
+type response struct {
+	StatusCode int
+	// Header is not a map to keep the order and the case of the keys,
+	// since some clients are picky.
+	Header []headerField
+	Body   []byte
+}
+
+func newResponse(statusCode int) *response {
+	return &response{
+		StatusCode: statusCode,
+	}
+}
+
+func (resp *response) AddHeader(key, value string) *response {
+	resp.Header = append(resp.Header, headerField{Key: key, Value: value})
+	return resp
+}
+
+var statusTexts = map[int]string{
+	200: "OK",
+	400: "Bad Request",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	454: "Session Not Found",
+	455: "Method Not Valid in This State",
+	459: "Aggregate Operation Not Allowed",
+	461: "Unsupported Transport",
+	500: "Internal Server Error",
+	501: "Not Implemented",
+	503: "Service Unavailable",
+}
+
+func (resp *response) appendTo(b []byte, cseq string) []byte {
+	b = fmt.Appendf(b, "%s %d %s\r\n", rtspVersion, resp.StatusCode, statusTexts[resp.StatusCode])
+	b = fmt.Appendf(b, "CSeq: %s\r\n", cseq)
+	b = fmt.Appendf(b, "Server: github.com/xaionaro-go/camera\r\n")
+	for _, field := range resp.Header {
+		b = fmt.Appendf(b, "%s: %s\r\n", field.Key, field.Value)
+	}
+	if len(resp.Body) > 0 {
+		b = fmt.Appendf(b, "Content-Length: %d\r\n", len(resp.Body))
+	}
+	b = append(b, "\r\n"...)
+	return append(b, resp.Body...)
+}
+
+// transportSpec is the client's choice of the parsed Transport header.
+type transportSpec struct {
+	TCP         bool
+	Interleaved [2]uint8
+	// HasInterleaved is false if the client left the choice
+	// of the interleaved channels to the server.
+	HasInterleaved bool
+	ClientPorts    [2]int
+}
+
+// parseTransport picks the first supported transport from the header.
+func parseTransport(header string) (transportSpec, bool) {
+	for _, option := range strings.Split(header, ",") {
+		params := strings.Split(strings.TrimSpace(option), ";")
+		var spec transportSpec
+		switch strings.ToUpper(params[0]) {
+		case "RTP/AVP", "RTP/AVP/UDP":
+		case "RTP/AVP/TCP":
+			spec.TCP = true
+		default:
+			continue
+		}
+
+		ok := true
+		hasPorts := false
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(param, "=")
+			switch strings.ToLower(key) {
+			case "multicast":
+				ok = false
+			case "client_port":
+				a, b, err := parseRange(value)
+				if err != nil {
+					ok = false
+					break
+				}
+				spec.ClientPorts = [2]int{a, b}
+				hasPorts = true
+			case "interleaved":
+				a, b, err := parseRange(value)
+				if err != nil || a > 255 || b > 255 {
+					ok = false
+					break
+				}
+				spec.Interleaved = [2]uint8{uint8(a), uint8(b)}
+				spec.HasInterleaved = true
+			}
+		}
+		if !ok || (!spec.TCP && !hasPorts) {
+			continue
+		}
+		return spec, true
+	}
+	return transportSpec{}, false
+}
+
+func parseRange(s string) (int, int, error) {
+	aString, bString, hasB := strings.Cut(s, "-")
+	a, err := strconv.ParseUint(aString, 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hasB {
+		return int(a), int(a) + 1, nil
+	}
+	b, err := strconv.ParseUint(bString, 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(a), int(b), nil
+}
@@ -0,0 +1,37 @@
+package rtspserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const trackControl = "trackID=0"
+
+// generateSDP describes the stream (see RFC 8866 and RFC 2435).
+func generateSDP(
+	format camera.Format,
+	sessionID uint64,
+	serverIP string,
+) []byte {
+	ipVersion := "IP4"
+	if strings.Contains(serverIP, ":") {
+		ipVersion = "IP6"
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "v=0\r\n")
+	fmt.Fprintf(&buf, "o=- %d 1 IN %s %s\r\n", sessionID, ipVersion, serverIP)
+	fmt.Fprintf(&buf, "s=camera\r\n")
+	fmt.Fprintf(&buf, "c=IN %s %s\r\n", ipVersion, serverIP)
+	fmt.Fprintf(&buf, "t=0 0\r\n")
+	fmt.Fprintf(&buf, "m=video 0 RTP/AVP %d\r\n", rtpPayloadTypeJPEG)
+	fmt.Fprintf(&buf, "a=rtpmap:%d JPEG/%d\r\n", rtpPayloadTypeJPEG, rtpClockRate)
+	if format.FPS.Numerator != 0 && format.FPS.Denominator != 0 {
+		fmt.Fprintf(&buf, "a=framerate:%g\r\n", format.FPS.Float64())
+	}
+	fmt.Fprintf(&buf, "a=x-dimensions:%d,%d\r\n", format.Width, format.Height)
+	fmt.Fprintf(&buf, "a=control:%s\r\n", trackControl)
+	return []byte(buf.String())
+}
@@ -0,0 +1,614 @@
+// Package rtspserver publishes a camera as an RTSP stream (RFC 2326) of
+// JPEG frames over RTP (RFC 2435), so that it could be consumed by NVRs,
+// VLC, ffmpeg and so on.
+//
+// Both UDP and TCP-interleaved transports are supported, multicast
+// and authentication are not. H.264 is not supported yet, since it
+// requires an external encoder.
+package rtspserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	DefaultJPEGQuality    = 80
+	DefaultMaxPacketSize  = 1400
+	DefaultSessionTimeout = 60 * time.Second
+)
+
+type Config struct {
+	// Path is the path of the stream in the URL, e.g. "/camera" for
+	// rtsp://host:8554/camera; any path is accepted if empty.
+	Path string
+
+	JPEGQuality int
+
+	// MaxPacketSize is the maximal size of an RTP packet (without
+	// the lower level headers); it should fit into the MTU.
+	MaxPacketSize int
+
+	// SessionTimeout is how long to keep a UDP session without
+	// any requests or RTCP packets from the client.
+	SessionTimeout time.Duration
+
+	// RTPPort is the UDP port to send RTP from (and RTPPort+1 for RTCP);
+	// it is chosen automatically if zero.
+	RTPPort int
+
+	// OnError (if set) is called on errors which do not stop the server,
+	// like failures of particular clients.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.JPEGQuality == 0 {
+		cfg.JPEGQuality = DefaultJPEGQuality
+	}
+	if cfg.MaxPacketSize == 0 {
+		cfg.MaxPacketSize = DefaultMaxPacketSize
+	}
+	if cfg.SessionTimeout == 0 {
+		cfg.SessionTimeout = DefaultSessionTimeout
+	}
+	return cfg
+}
+
+// Server serves a single camera to any amount of clients. The camera should
+// be already streaming; the server does not close it.
+type Server struct {
+	Camera camera.Camera
+	Config Config
+
+	format    camera.Format
+	sessionID uint64
+	startTS   time.Time
+
+	locker   sync.Mutex
+	sessions map[string]*session
+	rtpConn  *net.UDPConn
+	rtcpConn *net.UDPConn
+}
+
+func New(cam camera.Camera, cfg Config) (*Server, error) {
+	format := cam.GetFormat()
+	if err := checkJPEGDimensions(format.Width, format.Height); err != nil {
+		return nil, err
+	}
+	return &Server{
+		Camera:    cam,
+		Config:    cfg.withDefaults(),
+		format:    format,
+		sessionID: rand.Uint64() >> 1,
+		sessions:  map[string]*session{},
+	}, nil
+}
+
+func (s *Server) reportError(err error) {
+	if s.Config.OnError != nil {
+		s.Config.OnError(err)
+	}
+}
+
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen '%s': %w", addr, err)
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts the RTSP connections until the context is done or
+// the camera fails. The listener is closed on return.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	defer l.Close()
+
+	s.startTS = time.Now()
+	if err := s.listenUDP(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancelFn()
+		s.rtpConn.Close()
+		s.rtcpConn.Close()
+		s.closeSessions()
+		wg.Wait()
+	}()
+
+	captureErr := make(chan error, 1)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		captureErr <- s.capture(ctx)
+		cancelFn()
+	}()
+	go func() {
+		defer wg.Done()
+		s.readRTCP()
+	}()
+	go func() {
+		defer wg.Done()
+		s.expireSessions(ctx)
+	}()
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	for {
+		netConn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				select {
+				case err := <-captureErr:
+					return err
+				default:
+					return ctx.Err()
+				}
+			}
+			return fmt.Errorf("unable to accept a connection: %w", err)
+		}
+		c := newConn(s, netConn)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stop := context.AfterFunc(ctx, func() { netConn.Close() })
+			defer stop()
+			if err := c.serve(); err != nil {
+				s.reportError(fmt.Errorf("connection %s: %w", netConn.RemoteAddr(), err))
+			}
+		}()
+	}
+}
+
+// listenUDP opens a pair of adjacent UDP ports (an even one for RTP
+// and the next one for RTCP).
+func (s *Server) listenUDP() error {
+	const attempts = 100
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: s.Config.RTPPort})
+		if err != nil {
+			lastErr = err
+			if s.Config.RTPPort != 0 {
+				break
+			}
+			continue
+		}
+		port := rtpConn.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 {
+			rtpConn.Close()
+			continue
+		}
+		rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			rtpConn.Close()
+			lastErr = err
+			if s.Config.RTPPort != 0 {
+				break
+			}
+			continue
+		}
+		s.rtpConn, s.rtcpConn = rtpConn, rtcpConn
+		return nil
+	}
+	return fmt.Errorf("unable to open the RTP/RTCP UDP ports: %w", lastErr)
+}
+
+func (s *Server) rtpPort() int {
+	return s.rtpConn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// readRTCP reads the receiver reports just to keep the UDP sessions alive.
+func (s *Server) readRTCP() {
+	buf := make([]byte, 1500)
+	for {
+		_, addr, err := s.rtcpConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		s.locker.Lock()
+		for _, sess := range s.sessions {
+			if t, ok := sess.Transport.(*udpTransport); ok && t.RTCPAddr.IP.Equal(addr.IP) && t.RTCPAddr.Port == addr.Port {
+				sess.touch()
+			}
+		}
+		s.locker.Unlock()
+	}
+}
+
+func (s *Server) expireSessions(ctx context.Context) {
+	ticker := time.NewTicker(s.Config.SessionTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.locker.Lock()
+		for id, sess := range s.sessions {
+			if _, ok := sess.Transport.(*udpTransport); ok && sess.idleFor() > s.Config.SessionTimeout {
+				sess.Close()
+				delete(s.sessions, id)
+			}
+		}
+		s.locker.Unlock()
+	}
+}
+
+func (s *Server) closeSessions() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for id, sess := range s.sessions {
+		sess.Close()
+		delete(s.sessions, id)
+	}
+}
+
+func (s *Server) addSession(sess *session) {
+	s.locker.Lock()
+	s.sessions[sess.ID] = sess
+	s.locker.Unlock()
+
+	go func() {
+		if err := sess.serve(); err != nil {
+			s.reportError(fmt.Errorf("session %s: %w", sess.ID, err))
+			s.removeSession(sess.ID)
+		}
+	}()
+}
+
+func (s *Server) getSession(id string) *session {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.sessions[id]
+}
+
+func (s *Server) removeSession(id string) {
+	s.locker.Lock()
+	sess := s.sessions[id]
+	delete(s.sessions, id)
+	s.locker.Unlock()
+	if sess != nil {
+		sess.Close()
+	}
+}
+
+func (s *Server) playingSessions() []*session {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	var result []*session
+	for _, sess := range s.sessions {
+		if sess.playing.Load() {
+			result = append(result, sess)
+		}
+	}
+	return result
+}
+
+// rtpTimestamp converts the time since the server start into RTP clock
+// units (wrapping around as RTP timestamps do); the seconds and the
+// remainder are converted separately, since d*rtpClockRate would
+// overflow after about 28 hours.
+func rtpTimestamp(d time.Duration) uint32 {
+	seconds := uint64(d / time.Second)
+	remainder := uint64(d % time.Second)
+	return uint32(seconds*rtpClockRate + remainder*rtpClockRate/uint64(time.Second))
+}
+
+// capture reads the frames and passes them to the playing sessions;
+// the frames are encoded only if there is somebody to send them to.
+func (s *Server) capture(ctx context.Context) error {
+	maxPayloadSize := s.Config.MaxPacketSize - rtpHeaderSize
+	var buf bytes.Buffer
+	for {
+		frame, err := s.Camera.GetFrame(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("unable to get a frame: %w", err)
+		}
+		captureTS := time.Now()
+
+		sessions := s.playingSessions()
+		if len(sessions) == 0 {
+			if err := s.Camera.ReleaseFrame(frame); err != nil {
+				return fmt.Errorf("unable to release the frame: %w", err)
+			}
+			continue
+		}
+
+		buf.Reset()
+		err = jpeg.Encode(&buf, frame.Image(), &jpeg.Options{Quality: s.Config.JPEGQuality})
+		if releaseErr := s.Camera.ReleaseFrame(frame); releaseErr != nil {
+			return fmt.Errorf("unable to release the frame: %w", releaseErr)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to encode the frame: %w", err)
+		}
+
+		jpegFrame, err := parseJPEG(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("unable to parse the encoded frame: %w", err)
+		}
+		encoded := &encodedFrame{
+			Timestamp: rtpTimestamp(captureTS.Sub(s.startTS)),
+			Payloads:  jpegFrame.payloads(maxPayloadSize),
+		}
+		for _, sess := range sessions {
+			sess.Enqueue(encoded)
+		}
+	}
+}
+
+// conn is an RTSP connection.
+type conn struct {
+	server  *Server
+	netConn net.Conn
+	reader  *bufio.Reader
+
+	writeLocker sync.Mutex
+	// sessions are the sessions with the TCP transport over this
+	// connection, which end together with the connection.
+	sessions []string
+}
+
+func newConn(s *Server, netConn net.Conn) *conn {
+	return &conn{
+		server:  s,
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+	}
+}
+
+func (c *conn) write(chunks ...[]byte) error {
+	c.writeLocker.Lock()
+	defer c.writeLocker.Unlock()
+	bufs := net.Buffers(chunks)
+	_, err := bufs.WriteTo(c.netConn)
+	return err
+}
+
+func (c *conn) serve() error {
+	defer c.netConn.Close()
+	defer func() {
+		for _, id := range c.sessions {
+			c.server.removeSession(id)
+		}
+	}()
+
+	for {
+		b, err := c.reader.Peek(1)
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		if b[0] == '$' {
+			// interleaved RTCP from the client
+			if err := c.skipInterleaved(); err != nil {
+				return ignoreClosed(err)
+			}
+			continue
+		}
+
+		req, err := readRequest(c.reader)
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		resp := c.handle(req)
+		if err := c.write(resp.appendTo(nil, req.Header.Get("CSeq"))); err != nil {
+			return ignoreClosed(err)
+		}
+	}
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (c *conn) skipInterleaved() error {
+	var header [4]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return err
+	}
+	_, err := c.reader.Discard(int(binary.BigEndian.Uint16(header[2:])))
+	return err
+}
+
+// checkPath returns false if the URL does not point to the stream
+// (or to its track, if allowTrack is true).
+func (c *conn) checkPath(rawURL string, allowTrack bool) bool {
+	if c.server.Config.Path == "" {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	p := strings.TrimSuffix(u.Path, "/")
+	if allowTrack {
+		p = strings.TrimSuffix(strings.TrimSuffix(p, trackControl), "/")
+	}
+	return p == strings.TrimSuffix(c.server.Config.Path, "/")
+}
+
+func (c *conn) sessionFromRequest(req *request) (*session, *response) {
+	id, _, _ := strings.Cut(req.Header.Get("Session"), ";")
+	sess := c.server.getSession(strings.TrimSpace(id))
+	if sess == nil {
+		return nil, newResponse(454)
+	}
+	sess.touch()
+	return sess, nil
+}
+
+func (c *conn) handle(req *request) *response {
+	switch req.Method {
+	case "OPTIONS":
+		return newResponse(200).AddHeader("Public", "OPTIONS, DESCRIBE, SETUP, PLAY, PAUSE, TEARDOWN, GET_PARAMETER, SET_PARAMETER")
+	case "DESCRIBE":
+		return c.handleDescribe(req)
+	case "SETUP":
+		return c.handleSetup(req)
+	case "PLAY":
+		return c.handlePlay(req)
+	case "PAUSE":
+		sess, errResp := c.sessionFromRequest(req)
+		if errResp != nil {
+			return errResp
+		}
+		sess.playing.Store(false)
+		return newResponse(200).AddHeader("Session", sess.ID)
+	case "TEARDOWN":
+		sess, errResp := c.sessionFromRequest(req)
+		if errResp != nil {
+			return errResp
+		}
+		c.server.removeSession(sess.ID)
+		return newResponse(200)
+	case "GET_PARAMETER", "SET_PARAMETER":
+		// used as keep-alive
+		resp := newResponse(200)
+		if req.Header.Get("Session") != "" {
+			sess, errResp := c.sessionFromRequest(req)
+			if errResp != nil {
+				return errResp
+			}
+			resp.AddHeader("Session", sess.ID)
+		}
+		return resp
+	}
+	return newResponse(501)
+}
+
+func (c *conn) handleDescribe(req *request) *response {
+	if !c.checkPath(req.URL, false) {
+		return newResponse(404)
+	}
+	host, _, err := net.SplitHostPort(c.netConn.LocalAddr().String())
+	if err != nil {
+		return newResponse(500)
+	}
+	resp := newResponse(200)
+	resp.AddHeader("Content-Type", "application/sdp")
+	resp.AddHeader("Content-Base", strings.TrimSuffix(req.URL, "/")+"/")
+	resp.Body = generateSDP(c.server.format, c.server.sessionID, host)
+	return resp
+}
+
+func (c *conn) handleSetup(req *request) *response {
+	if !c.checkPath(req.URL, true) {
+		return newResponse(404)
+	}
+	if req.Header.Get("Session") != "" {
+		// the only track is already set up
+		return newResponse(459)
+	}
+
+	spec, ok := parseTransport(req.Header.Get("Transport"))
+	if !ok {
+		return newResponse(461)
+	}
+
+	var t transport
+	var transportHeader string
+	if spec.TCP {
+		if !spec.HasInterleaved {
+			spec.Interleaved, ok = c.freeChannels()
+			if !ok {
+				return newResponse(461)
+			}
+		}
+		t = &tcpTransport{
+			Conn:     c,
+			Channels: spec.Interleaved,
+		}
+		transportHeader = fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", spec.Interleaved[0], spec.Interleaved[1])
+	} else {
+		remoteIP := c.netConn.RemoteAddr().(*net.TCPAddr).IP
+		t = &udpTransport{
+			RTPConn:  c.server.rtpConn,
+			RTCPConn: c.server.rtcpConn,
+			RTPAddr:  &net.UDPAddr{IP: remoteIP, Port: spec.ClientPorts[0]},
+			RTCPAddr: &net.UDPAddr{IP: remoteIP, Port: spec.ClientPorts[1]},
+		}
+		transportHeader = fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d;server_port=%d-%d",
+			spec.ClientPorts[0], spec.ClientPorts[1], c.server.rtpPort(), c.server.rtpPort()+1)
+	}
+
+	sess := newSession(t)
+	transportHeader += fmt.Sprintf(";ssrc=%08X", sess.SSRC)
+	c.server.addSession(sess)
+	if spec.TCP {
+		c.sessions = append(c.sessions, sess.ID)
+	}
+
+	return newResponse(200).
+		AddHeader("Transport", transportHeader).
+		AddHeader("Session", sess.ID+";timeout="+strconv.Itoa(int(c.server.Config.SessionTimeout/time.Second)))
+}
+
+// freeChannels returns the first pair of an even and the next odd
+// interleaved channels not used by the sessions of the connection
+// (see RFC 2326, section 12.39).
+func (c *conn) freeChannels() ([2]uint8, bool) {
+	used := map[uint8]struct{}{}
+	for _, id := range c.sessions {
+		sess := c.server.getSession(id)
+		if sess == nil {
+			continue
+		}
+		if t, ok := sess.Transport.(*tcpTransport); ok {
+			used[t.Channels[0]] = struct{}{}
+			used[t.Channels[1]] = struct{}{}
+		}
+	}
+	for channel := 0; channel < 256; channel += 2 {
+		_, rtpUsed := used[uint8(channel)]
+		_, rtcpUsed := used[uint8(channel+1)]
+		if !rtpUsed && !rtcpUsed {
+			return [2]uint8{uint8(channel), uint8(channel + 1)}, true
+		}
+	}
+	return [2]uint8{}, false
+}
+
+func (c *conn) handlePlay(req *request) *response {
+	sess, errResp := c.sessionFromRequest(req)
+	if errResp != nil {
+		return errResp
+	}
+	seq, rtpTime := sess.nextRTPInfo(rtpTimestamp(time.Since(c.server.startTS)))
+	sess.playing.Store(true)
+
+	trackURL := strings.TrimSuffix(req.URL, "/")
+	if !strings.HasSuffix(trackURL, trackControl) {
+		trackURL += "/" + trackControl
+	}
+	return newResponse(200).
+		AddHeader("Session", sess.ID).
+		AddHeader("Range", "npt=0.000-").
+		AddHeader("RTP-Info", fmt.Sprintf("url=%s;seq=%d;rtptime=%d", trackURL, seq, rtpTime))
+}
@@ -0,0 +1,356 @@
+package rtspserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+type testFrame struct {
+	img image.Image
+}
+
+func (f *testFrame) Image() image.Image {
+	return f.img
+}
+
+// testCamera produces gray frames every few milliseconds.
+type testCamera struct {
+	format camera.Format
+
+	locker      sync.Mutex
+	outstanding int
+}
+
+var _ camera.Camera = (*testCamera)(nil)
+
+func (c *testCamera) Close() error {
+	return nil
+}
+
+func (c *testCamera) StartStreaming() error {
+	return nil
+}
+
+func (c *testCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *testCamera) GetFormat() camera.Format {
+	return c.format
+}
+
+func (c *testCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(5 * time.Millisecond):
+	}
+	img := image.NewYCbCr(image.Rect(0, 0, int(c.format.Width), int(c.format.Height)), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i)
+	}
+	c.locker.Lock()
+	c.outstanding++
+	c.locker.Unlock()
+	return &testFrame{img: img}, nil
+}
+
+func (c *testCamera) ReleaseFrame(frame camera.Frame) error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.outstanding--
+	return nil
+}
+
+type testResponse struct {
+	StatusCode int
+	Header     textproto.MIMEHeader
+	Body       []byte
+}
+
+type testPacket struct {
+	Channel uint8
+	Data    []byte
+}
+
+// testClient is a minimal RTSP client over TCP.
+type testClient struct {
+	t       *testing.T
+	conn    net.Conn
+	reader  *bufio.Reader
+	cseq    int
+	packets []testPacket
+}
+
+func dialTestClient(t *testing.T, addr string) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &testClient{
+		t:      t,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (c *testClient) readPacket() testPacket {
+	c.t.Helper()
+	var header [4]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[0] != '$' {
+		c.t.Fatalf("expected an interleaved packet, got 0x%02X", header[0])
+	}
+	data := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		c.t.Fatal(err)
+	}
+	return testPacket{Channel: header[1], Data: data}
+}
+
+// do sends the request and returns the response; the interleaved
+// packets received before the response are kept in c.packets.
+func (c *testClient) do(method, url string, header ...string) *testResponse {
+	c.t.Helper()
+	c.cseq++
+	req := fmt.Sprintf("%s %s RTSP/1.0\r\nCSeq: %d\r\n", method, url, c.cseq)
+	for _, field := range header {
+		req += field + "\r\n"
+	}
+	if _, err := io.WriteString(c.conn, req+"\r\n"); err != nil {
+		c.t.Fatal(err)
+	}
+
+	for {
+		b, err := c.reader.Peek(1)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if b[0] != '$' {
+			break
+		}
+		c.packets = append(c.packets, c.readPacket())
+	}
+
+	tp := textproto.NewReader(c.reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || fields[0] != rtspVersion {
+		c.t.Fatalf("invalid status line '%s'", line)
+	}
+	resp := &testResponse{}
+	resp.StatusCode, err = strconv.Atoi(fields[1])
+	if err != nil {
+		c.t.Fatalf("invalid status line '%s'", line)
+	}
+	resp.Header, err = tp.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if cseq := resp.Header.Get("CSeq"); cseq != strconv.Itoa(c.cseq) {
+		c.t.Fatalf("expected CSeq %d, got '%s'", c.cseq, cseq)
+	}
+	if s := resp.Header.Get("Content-Length"); s != "" {
+		length, err := strconv.Atoi(s)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		resp.Body = make([]byte, length)
+		if _, err := io.ReadFull(c.reader, resp.Body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func (c *testClient) setup(url, transport string) (string, string) {
+	c.t.Helper()
+	resp := c.do("SETUP", url, "Transport: "+transport)
+	if resp.StatusCode != 200 {
+		c.t.Fatalf("SETUP: expected the status 200, got %d", resp.StatusCode)
+	}
+	sessionID, _, _ := strings.Cut(resp.Header.Get("Session"), ";")
+	return sessionID, resp.Header.Get("Transport")
+}
+
+func TestLoopback(t *testing.T) {
+	cam := &testCamera{format: camera.Format{
+		Width:       64,
+		Height:      48,
+		PixelFormat: camera.PixelFormatNV12,
+		FPS:         camera.Fraction{Numerator: 30, Denominator: 1},
+	}}
+	srv, err := New(cam, Config{
+		Path:          "/camera",
+		MaxPacketSize: 500,
+		OnError: func(err error) {
+			t.Logf("server: %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ctx, l)
+	}()
+
+	url := "rtsp://" + l.Addr().String() + "/camera"
+	client := dialTestClient(t, l.Addr().String())
+
+	if resp := client.do("DESCRIBE", "rtsp://"+l.Addr().String()+"/other"); resp.StatusCode != 404 {
+		t.Errorf("DESCRIBE of another path: expected the status 404, got %d", resp.StatusCode)
+	}
+	resp := client.do("DESCRIBE", url, "Accept: application/sdp")
+	if resp.StatusCode != 200 {
+		t.Fatalf("DESCRIBE: expected the status 200, got %d", resp.StatusCode)
+	}
+	for _, line := range []string{"m=video 0 RTP/AVP 26", "a=x-dimensions:64,48", "a=control:trackID=0"} {
+		if !strings.Contains(string(resp.Body), line+"\r\n") {
+			t.Errorf("DESCRIBE: expected '%s' in the SDP:\n%s", line, resp.Body)
+		}
+	}
+	if base := resp.Header.Get("Content-Base"); base != url+"/" {
+		t.Errorf("DESCRIBE: expected the base '%s/', got '%s'", url, base)
+	}
+
+	// the server chooses the interleaved channels if the client does not
+	sessionID, transport := client.setup(url+"/trackID=0", "RTP/AVP/TCP;unicast")
+	if !strings.Contains(transport, "interleaved=0-1") {
+		t.Errorf("expected the channels 0-1, got '%s'", transport)
+	}
+	_, transport = client.setup(url+"/trackID=0", "RTP/AVP/TCP;unicast")
+	if !strings.Contains(transport, "interleaved=2-3") {
+		t.Errorf("expected the next free channels 2-3, got '%s'", transport)
+	}
+	_, transport = client.setup(url+"/trackID=0", "RTP/AVP/TCP;unicast;interleaved=6-7")
+	if !strings.Contains(transport, "interleaved=6-7") {
+		t.Errorf("expected the requested channels 6-7, got '%s'", transport)
+	}
+	_, ssrcString, _ := strings.Cut(transport, "ssrc=")
+	if ssrcString == "" {
+		t.Errorf("expected the SSRC in '%s'", transport)
+	}
+
+	resp = client.do("PLAY", url, "Session: "+sessionID)
+	if resp.StatusCode != 200 {
+		t.Fatalf("PLAY: expected the status 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Header.Get("RTP-Info"), "url="+url+"/trackID=0;") {
+		t.Errorf("PLAY: unexpected RTP-Info '%s'", resp.Header.Get("RTP-Info"))
+	}
+
+	// collecting a whole frame, starting from its first packet
+	var frameSize int
+	started := false
+	for {
+		var pkt testPacket
+		if len(client.packets) > 0 {
+			pkt, client.packets = client.packets[0], client.packets[1:]
+		} else {
+			pkt = client.readPacket()
+		}
+		if pkt.Channel != 0 {
+			continue // RTCP
+		}
+		if len(pkt.Data) < rtpHeaderSize+jpegHeaderSize || len(pkt.Data) > 500 {
+			t.Fatalf("unexpected size of an RTP packet: %d", len(pkt.Data))
+		}
+		if pt := pkt.Data[1] & 0x7f; pt != rtpPayloadTypeJPEG {
+			t.Fatalf("expected the payload type %d, got %d", rtpPayloadTypeJPEG, pt)
+		}
+		marker := pkt.Data[1]&0x80 != 0
+		payload := pkt.Data[rtpHeaderSize:]
+		offset := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+		if !started {
+			if offset != 0 {
+				continue
+			}
+			started = true
+		}
+		if offset != frameSize {
+			t.Fatalf("expected the fragment offset %d, got %d", frameSize, offset)
+		}
+		if width, height := int(payload[6])*8, int(payload[7])*8; width != 64 || height != 48 {
+			t.Fatalf("unexpected dimensions %dx%d", width, height)
+		}
+		data := payload[jpegHeaderSize:]
+		if offset == 0 {
+			if tablesSize := binary.BigEndian.Uint16(data[2:]); tablesSize != 128 {
+				t.Fatalf("expected the quantization tables of 128 bytes, got %d", tablesSize)
+			}
+			data = data[jpegQuantHeaderSize+128:]
+		}
+		frameSize += len(data)
+		if marker {
+			break
+		}
+	}
+	if frameSize == 0 {
+		t.Errorf("received an empty frame")
+	}
+
+	if resp := client.do("TEARDOWN", url, "Session: "+sessionID); resp.StatusCode != 200 {
+		t.Errorf("TEARDOWN: expected the status 200, got %d", resp.StatusCode)
+	}
+	if resp := client.do("PLAY", url, "Session: "+sessionID); resp.StatusCode != 454 {
+		t.Errorf("PLAY after TEARDOWN: expected the status 454, got %d", resp.StatusCode)
+	}
+
+	cancelFn()
+	if err := <-serveErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the server to be canceled, got %v", err)
+	}
+	cam.locker.Lock()
+	defer cam.locker.Unlock()
+	if cam.outstanding != 0 {
+		t.Errorf("expected all the frames to be released, got %d outstanding", cam.outstanding)
+	}
+}
+
+func TestParseTransport(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		ok     bool
+		spec   transportSpec
+	}{
+		{"RTP/AVP/TCP;unicast", true, transportSpec{TCP: true}},
+		{"RTP/AVP/TCP;unicast;interleaved=4-5", true, transportSpec{TCP: true, Interleaved: [2]uint8{4, 5}, HasInterleaved: true}},
+		{"RTP/AVP;unicast;client_port=5000-5001", true, transportSpec{ClientPorts: [2]int{5000, 5001}}},
+		{"RTP/AVP;multicast, RTP/AVP/TCP;interleaved=0", true, transportSpec{TCP: true, Interleaved: [2]uint8{0, 1}, HasInterleaved: true}},
+		{"RTP/AVP;unicast", false, transportSpec{}},
+		{"RTP/SAVP;unicast;client_port=5000-5001", false, transportSpec{}},
+	} {
+		spec, ok := parseTransport(tc.header)
+		if ok != tc.ok || spec != tc.spec {
+			t.Errorf("'%s': expected %+v, %v; got %+v, %v", tc.header, tc.spec, tc.ok, spec, ok)
+		}
+	}
+}
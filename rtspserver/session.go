@@ -0,0 +1,186 @@
+package rtspserver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const senderReportInterval = 5 * time.Second
+
+// encodedFrame is a frame ready to be sent, shared by all the sessions.
+type encodedFrame struct {
+	// Timestamp is in the RTP clock units.
+	Timestamp uint32
+	Payloads  [][]byte
+}
+
+type transport interface {
+	WriteRTP([]byte) error
+	WriteRTCP([]byte) error
+	String() string
+}
+
+type udpTransport struct {
+	RTPConn  *net.UDPConn
+	RTCPConn *net.UDPConn
+	RTPAddr  *net.UDPAddr
+	RTCPAddr *net.UDPAddr
+}
+
+func (t *udpTransport) WriteRTP(pkt []byte) error {
+	_, err := t.RTPConn.WriteToUDP(pkt, t.RTPAddr)
+	return err
+}
+
+func (t *udpTransport) WriteRTCP(pkt []byte) error {
+	_, err := t.RTCPConn.WriteToUDP(pkt, t.RTCPAddr)
+	return err
+}
+
+func (t *udpTransport) String() string {
+	return fmt.Sprintf("UDP %s", t.RTPAddr)
+}
+
+// tcpTransport sends the packets interleaved with the RTSP messages
+// (see RFC 2326, section 10.12).
+type tcpTransport struct {
+	Conn     *conn
+	Channels [2]uint8
+}
+
+func (t *tcpTransport) write(channel uint8, pkt []byte) error {
+	header := []byte{'$', channel}
+	header = binary.BigEndian.AppendUint16(header, uint16(len(pkt)))
+	return t.Conn.write(header, pkt)
+}
+
+func (t *tcpTransport) WriteRTP(pkt []byte) error {
+	return t.write(t.Channels[0], pkt)
+}
+
+func (t *tcpTransport) WriteRTCP(pkt []byte) error {
+	return t.write(t.Channels[1], pkt)
+}
+
+func (t *tcpTransport) String() string {
+	return fmt.Sprintf("TCP %s", t.Conn.netConn.RemoteAddr())
+}
+
+type session struct {
+	ID        string
+	Transport transport
+	SSRC      uint32
+
+	locker          sync.Mutex
+	sequence        uint16
+	timestampOffset uint32
+	packetCount     uint32
+	octetCount      uint32
+	lastSR          time.Time
+
+	playing  atomic.Bool
+	lastSeen atomic.Int64
+	frames   chan *encodedFrame
+	closed   chan struct{}
+	close    sync.Once
+}
+
+func newSession(t transport) *session {
+	s := &session{
+		ID:              fmt.Sprintf("%016X", rand.Uint64()),
+		Transport:       t,
+		SSRC:            rand.Uint32(),
+		sequence:        uint16(rand.Uint32()),
+		timestampOffset: rand.Uint32(),
+		frames:          make(chan *encodedFrame, 2),
+		closed:          make(chan struct{}),
+	}
+	s.touch()
+	return s
+}
+
+func (s *session) touch() {
+	s.lastSeen.Store(time.Now().UnixNano())
+}
+
+func (s *session) idleFor() time.Duration {
+	return time.Since(time.Unix(0, s.lastSeen.Load()))
+}
+
+// nextRTPInfo returns the sequence number and the RTP timestamp of
+// the next packet, as reported in the RTP-Info header.
+func (s *session) nextRTPInfo(now uint32) (uint16, uint32) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.sequence, now + s.timestampOffset
+}
+
+func (s *session) Close() {
+	s.close.Do(func() {
+		s.playing.Store(false)
+		close(s.closed)
+	})
+}
+
+// Enqueue passes the frame to the sending goroutine; the frame is
+// dropped for this session if the client does not keep up.
+func (s *session) Enqueue(frame *encodedFrame) {
+	if !s.playing.Load() {
+		return
+	}
+	select {
+	case s.frames <- frame:
+	default:
+	}
+}
+
+// serve sends the frames until the session is closed or fails.
+func (s *session) serve() error {
+	var pkt []byte
+	for {
+		var frame *encodedFrame
+		select {
+		case <-s.closed:
+			return nil
+		case frame = <-s.frames:
+		}
+
+		s.locker.Lock()
+		rtpTime := frame.Timestamp + s.timestampOffset
+		for idx, payload := range frame.Payloads {
+			pkt = rtpHeader{
+				Marker:      idx == len(frame.Payloads)-1,
+				PayloadType: rtpPayloadTypeJPEG,
+				Sequence:    s.sequence,
+				Timestamp:   rtpTime,
+				SSRC:        s.SSRC,
+			}.appendTo(pkt[:0])
+			pkt = append(pkt, payload...)
+			if err := s.Transport.WriteRTP(pkt); err != nil {
+				s.locker.Unlock()
+				return fmt.Errorf("unable to send an RTP packet via %s: %w", s.Transport, err)
+			}
+			s.sequence++
+			s.packetCount++
+			s.octetCount += uint32(len(payload))
+		}
+
+		var report []byte
+		if now := time.Now(); now.Sub(s.lastSR) >= senderReportInterval {
+			s.lastSR = now
+			report = appendSenderReport(nil, s.SSRC, now, rtpTime, s.packetCount, s.octetCount)
+		}
+		s.locker.Unlock()
+
+		if report != nil {
+			if err := s.Transport.WriteRTCP(report); err != nil {
+				return fmt.Errorf("unable to send an RTCP packet via %s: %w", s.Transport, err)
+			}
+		}
+	}
+}
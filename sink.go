@@ -0,0 +1,22 @@
+package camera
+
+import (
+	"io"
+)
+
+// CameraSink consumes frames, e.g. to expose them to other applications
+// as a virtual camera.
+type CameraSink interface {
+	io.Closer
+	GetFormat() Format
+
+	// WriteFrame writes the frame converting it to the Format of the sink;
+	// the frame is not used after the call, so it may be released right away.
+	WriteFrame(Frame) error
+}
+
+// SinkOpener may be implemented by a Platform which is able to output frames.
+type SinkOpener interface {
+	ListSinks() ([]DevicePath, error)
+	OpenSink(devicePath DevicePath, format Format) (CameraSink, error)
+}
@@ -0,0 +1,262 @@
+// Package timelapse captures pictures from a camera on a schedule (every
+// interval or like cron) and writes them as numbered images or as
+// a video.
+//
+// Between the captures the streaming may be stopped to save the power
+// and the USB bandwidth; after (re)starting, the frames are discarded
+// until the exposure settles.
+package timelapse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+	"github.com/xaionaro-go/camera/imagestats"
+)
+
+const (
+	DefaultWarmupFrames    = 2
+	DefaultMaxWarmupFrames = 60
+	DefaultSettleTolerance = 2
+	DefaultFrameTimeout    = 10 * time.Second
+
+	// settleSampleStep is the sampling step of the statistics used
+	// to find out if the exposure has settled.
+	settleSampleStep = 8
+)
+
+type Config struct {
+	Schedule Schedule
+
+	// Count limits the amount of the pictures (no limit if zero).
+	Count uint64
+
+	// StopStreamingBetween stops the streaming between the captures
+	// (the device stays open).
+	StopStreamingBetween bool
+
+	// WarmupFrames is the minimal amount of the frames discarded before
+	// a capture (also flushing the frames queued since the last one).
+	WarmupFrames uint
+
+	// MaxWarmupFrames is the maximal amount of the frames discarded
+	// waiting for the exposure to settle.
+	MaxWarmupFrames uint
+
+	// SettleTolerance is the change of the mean luma (within [0, 255])
+	// between consecutive frames below which the exposure
+	// is considered settled.
+	SettleTolerance float64
+
+	// FrameTimeout limits waiting for a frame.
+	FrameTimeout time.Duration
+
+	// OnError (if set) is called on the failures of particular
+	// captures (like a timeout), which do not stop the time-lapse.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.WarmupFrames == 0 {
+		cfg.WarmupFrames = DefaultWarmupFrames
+	}
+	if cfg.MaxWarmupFrames == 0 {
+		cfg.MaxWarmupFrames = DefaultMaxWarmupFrames
+	}
+	cfg.MaxWarmupFrames = max(cfg.MaxWarmupFrames, cfg.WarmupFrames)
+	if cfg.SettleTolerance == 0 {
+		cfg.SettleTolerance = DefaultSettleTolerance
+	}
+	if cfg.FrameTimeout == 0 {
+		cfg.FrameTimeout = DefaultFrameTimeout
+	}
+	return cfg
+}
+
+// Capturer opens the camera via the Platform and takes the pictures.
+type Capturer struct {
+	Platform   camera.Platform
+	DevicePath camera.DevicePath
+	Format     camera.Format
+	Config     Config
+}
+
+func New(
+	plat camera.Platform,
+	devicePath camera.DevicePath,
+	format camera.Format,
+	cfg Config,
+) (*Capturer, error) {
+	if cfg.Schedule == nil {
+		return nil, fmt.Errorf("the schedule is not set")
+	}
+	return &Capturer{
+		Platform:   plat,
+		DevicePath: devicePath,
+		Format:     format,
+		Config:     cfg.withDefaults(),
+	}, nil
+}
+
+func (c *Capturer) reportError(err error) {
+	if c.Config.OnError != nil {
+		c.Config.OnError(err)
+	}
+}
+
+// Run takes the pictures until the context is done, Count pictures
+// are taken or the camera fails; the writer is not closed.
+func (c *Capturer) Run(ctx context.Context, w Writer) (_err error) {
+	cam, err := c.Platform.OpenCamera(c.DevicePath, c.Format)
+	if err != nil {
+		return fmt.Errorf("unable to open the camera '%s': %w", c.DevicePath, err)
+	}
+	streaming := false
+	defer func() {
+		if streaming {
+			if err := cam.StopStreaming(); err != nil {
+				_err = errors.Join(_err, fmt.Errorf("unable to stop streaming: %w", err))
+			}
+		}
+		if err := cam.Close(); err != nil {
+			_err = errors.Join(_err, fmt.Errorf("unable to close the camera: %w", err))
+		}
+	}()
+
+	var index uint64
+	next := c.firstCaptureTS(time.Now())
+	if next.IsZero() {
+		return nil
+	}
+	for c.Config.Count == 0 || index < c.Config.Count {
+		// starting in advance, so the warm-up takes no
+		// time of the schedule (if the camera is fast enough)
+		if err := sleepUntil(ctx, next.Add(-c.warmupDuration())); err != nil {
+			return err
+		}
+		if !streaming {
+			if err := cam.StartStreaming(); err != nil {
+				return fmt.Errorf("unable to start streaming: %w", err)
+			}
+			streaming = true
+		}
+
+		err := c.capture(ctx, cam, next, func(frame camera.Frame) error {
+			return w.WriteFrame(index, camera.FrameTimestamp(frame), frame.Image())
+		})
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, camera.ErrTimeout):
+			c.reportError(fmt.Errorf("unable to take picture #%d: %w", index, err))
+		case err != nil:
+			return fmt.Errorf("unable to take picture #%d: %w", index, err)
+		default:
+			index++
+		}
+
+		if c.Config.StopStreamingBetween {
+			if err := cam.StopStreaming(); err != nil {
+				return fmt.Errorf("unable to stop streaming: %w", err)
+			}
+			streaming = false
+		}
+
+		// the missed captures are skipped, not taken all at once
+		for now := time.Now(); !next.After(now); {
+			next = c.Config.Schedule.Next(next)
+			if next.IsZero() {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// firstCaptureTS returns the time of the first capture: an Interval
+// starts right away, a Cron waits for the first matching time.
+func (c *Capturer) firstCaptureTS(now time.Time) time.Time {
+	if _, ok := c.Config.Schedule.(Interval); ok {
+		return now
+	}
+	return c.Config.Schedule.Next(now)
+}
+
+// warmupDuration estimates how long the warm-up takes.
+func (c *Capturer) warmupDuration() time.Duration {
+	fps := c.Format.FPS.Float64()
+	if fps <= 0 {
+		fps = 30
+	}
+	return time.Duration(float64(c.Config.WarmupFrames+1) * float64(time.Second) / fps)
+}
+
+// capture discards the frames captured before the scheduled time (but
+// they are still used to find out if the exposure has settled) and the
+// frames until the exposure settles, and passes the next frame to
+// the callback.
+func (c *Capturer) capture(
+	ctx context.Context,
+	cam camera.Camera,
+	scheduled time.Time,
+	callback func(camera.Frame) error,
+) error {
+	prevMeanY := math.NaN()
+	for i := uint(0); ; i++ {
+		frame, err := c.getFrame(ctx, cam)
+		if err != nil {
+			return err
+		}
+
+		// the limit of the warm-up is applied to the early frames as well,
+		// in case the timestamps of the camera are off
+		early := camera.FrameTimestamp(frame).Before(scheduled) && i < c.Config.MaxWarmupFrames
+		settled := i >= c.Config.MaxWarmupFrames
+		if !settled && i >= c.Config.WarmupFrames {
+			meanY := imagestats.Compute(frame.Image(), settleSampleStep).MeanY
+			settled = math.Abs(meanY-prevMeanY) < c.Config.SettleTolerance
+			prevMeanY = meanY
+		}
+		if early || !settled {
+			if err := cam.ReleaseFrame(frame); err != nil {
+				return fmt.Errorf("unable to release a frame: %w", err)
+			}
+			continue
+		}
+
+		err = callback(frame)
+		if releaseErr := cam.ReleaseFrame(frame); releaseErr != nil {
+			return errors.Join(err, fmt.Errorf("unable to release a frame: %w", releaseErr))
+		}
+		return err
+	}
+}
+
+func (c *Capturer) getFrame(ctx context.Context, cam camera.Camera) (camera.Frame, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, c.Config.FrameTimeout)
+	defer cancelFn()
+	frame, err := cam.GetFrame(ctx)
+	if errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, camera.ErrTimeout) {
+		err = fmt.Errorf("%w: %w", camera.ErrTimeout, err)
+	}
+	return frame, err
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
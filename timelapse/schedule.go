@@ -0,0 +1,200 @@
+package timelapse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule defines the times of the captures.
+type Schedule interface {
+	// Next returns the first time of a capture after the given one.
+	Next(after time.Time) time.Time
+}
+
+// Interval is a capture every Period.
+type Interval struct {
+	Period time.Duration
+}
+
+var _ Schedule = Interval{}
+
+func (s Interval) Next(after time.Time) time.Time {
+	return after.Add(s.Period)
+}
+
+// Cron is a schedule in the format of crontab(5): "MINUTE HOUR DAY MONTH
+// WEEKDAY", where each field is "*", a number, a range ("1-5"), a list
+// ("1,3,5") or any of those with a step ("*/15", "8-18/2"). As in cron,
+// if both the day of the month and the weekday are restricted, then
+// matching either of them is enough.
+type Cron struct {
+	Minutes  uint64 // bit N is set if minute N matches
+	Hours    uint64
+	Days     uint64
+	Months   uint64
+	Weekdays uint64 // 0 is Sunday
+
+	// daysRestricted and weekdaysRestricted are false if the field is "*".
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+var _ Schedule = (*Cron)(nil)
+
+// ParseSchedule parses a cron expression (see Cron) or "@every DURATION"
+// (see Interval); the shortcuts "@hourly", "@daily", "@weekly" and
+// "@monthly" are supported as well.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if period, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(period))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the period '%s': %w", period, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("the period should be positive, but it is %v", d)
+		}
+		return Interval{Period: d}, nil
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	return ParseCron(spec)
+}
+
+func ParseCron(spec string) (*Cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields (minute, hour, day, month, weekday), but got %d in '%s'", len(fields), spec)
+	}
+
+	c := &Cron{}
+	for _, f := range []struct {
+		Name     string
+		Value    string
+		Min, Max int
+		Result   *uint64
+	}{
+		{"minute", fields[0], 0, 59, &c.Minutes},
+		{"hour", fields[1], 0, 23, &c.Hours},
+		{"day", fields[2], 1, 31, &c.Days},
+		{"month", fields[3], 1, 12, &c.Months},
+		{"weekday", fields[4], 0, 7, &c.Weekdays},
+	} {
+		bits, err := parseCronField(f.Value, f.Min, f.Max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s field '%s': %w", f.Name, f.Value, err)
+		}
+		*f.Result = bits
+	}
+	if c.Weekdays&(1<<7) != 0 {
+		// 7 is Sunday as well
+		c.Weekdays |= 1
+		c.Weekdays &^= 1 << 7
+	}
+	c.daysRestricted = fields[2] != "*"
+	c.weekdaysRestricted = fields[4] != "*"
+	if !c.weekdaysRestricted && !c.hasPossibleDay() {
+		return nil, fmt.Errorf("the days '%s' never happen in the months '%s'", fields[2], fields[3])
+	}
+	return c, nil
+}
+
+// maxDaysInMonth is indexed by time.Month (February counts as leap).
+var maxDaysInMonth = [...]int{0, 31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// hasPossibleDay returns false if the days do not exist in any of
+// the months (like "30 2"), so the schedule would never match.
+func (c *Cron) hasPossibleDay() bool {
+	for month := time.January; month <= time.December; month++ {
+		if c.Months&(1<<int(month)) == 0 {
+			continue
+		}
+		if c.Days&(1<<(maxDaysInMonth[month]+1)-1) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCronField(field string, minValue, maxValue int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeStr, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", stepStr)
+			}
+		}
+
+		from, to := minValue, maxValue
+		if rangeStr != "*" {
+			fromStr, toStr, isRange := strings.Cut(rangeStr, "-")
+			var err error
+			if from, err = strconv.Atoi(fromStr); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", fromStr)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(toStr); err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", toStr)
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to the end with the step 15
+				to = maxValue
+			}
+		}
+		if from < minValue || to > maxValue || from > to {
+			return 0, fmt.Errorf("'%s' is out of the range %d-%d", rangeStr, minValue, maxValue)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dayMatches := c.Days&(1<<t.Day()) != 0
+	weekdayMatches := c.Weekdays&(1<<int(t.Weekday())) != 0
+	if c.daysRestricted && c.weekdaysRestricted {
+		return dayMatches || weekdayMatches
+	}
+	return dayMatches && weekdayMatches
+}
+
+// Next returns the zero time if there is no such time within the next
+// few years (ParseCron rejects the days which never happen, like
+// "0 0 30 2 *"). The time is advanced by whole months, days or hours
+// while they do not match.
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.Months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.Hours&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.Minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,191 @@
+package timelapse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	DefaultJPEGQuality      = 90
+	DefaultKeyFrameInterval = 30
+)
+
+// Writer receives the captured pictures.
+type Writer interface {
+	io.Closer
+
+	// WriteFrame writes the picture number index (starting from zero)
+	// captured at the given time; the image is not used after the call.
+	WriteFrame(index uint64, ts time.Time, img image.Image) error
+}
+
+// ImageFiles writes each picture into a separate file.
+type ImageFiles struct {
+	// Pattern is the path of the files with a verb (like "%05d")
+	// for the number of the picture; the extension defines the
+	// format: ".png" or ".jpg" (or ".jpeg").
+	Pattern string
+
+	JPEGQuality int
+}
+
+var _ Writer = (*ImageFiles)(nil)
+
+func NewImageFiles(pattern string, jpegQuality int) (*ImageFiles, error) {
+	if !strings.Contains(pattern, "%") {
+		return nil, fmt.Errorf("the pattern '%s' has no verb for the number of the picture (like '%%05d')", pattern)
+	}
+	switch strings.ToLower(filepath.Ext(pattern)) {
+	case ".png", ".jpg", ".jpeg":
+	default:
+		return nil, fmt.Errorf("unknown extension of '%s', expected '.png', '.jpg' or '.jpeg'", pattern)
+	}
+	if jpegQuality == 0 {
+		jpegQuality = DefaultJPEGQuality
+	}
+	return &ImageFiles{
+		Pattern:     pattern,
+		JPEGQuality: jpegQuality,
+	}, nil
+}
+
+func (w *ImageFiles) WriteFrame(index uint64, _ time.Time, img image.Image) (_err error) {
+	fileName := fmt.Sprintf(w.Pattern, index)
+	f, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("unable to create '%s': %w", fileName, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil && _err == nil {
+			_err = fmt.Errorf("unable to close '%s': %w", fileName, err)
+		}
+	}()
+
+	bufW := bufio.NewWriter(f)
+	if strings.ToLower(filepath.Ext(fileName)) == ".png" {
+		err = png.Encode(bufW, img)
+	} else {
+		err = jpeg.Encode(bufW, img, &jpeg.Options{Quality: w.JPEGQuality})
+	}
+	if err != nil {
+		return fmt.Errorf("unable to encode '%s': %w", fileName, err)
+	}
+	if err := bufW.Flush(); err != nil {
+		return fmt.Errorf("unable to write '%s': %w", fileName, err)
+	}
+	return nil
+}
+
+func (w *ImageFiles) Close() error {
+	return nil
+}
+
+// MJPEGWriter writes the pictures as concatenated JPEG images
+// (playable with 'ffplay -f mjpeg -framerate N').
+type MJPEGWriter struct {
+	JPEGQuality int
+
+	writer *bufio.Writer
+	closer io.Closer
+}
+
+var _ Writer = (*MJPEGWriter)(nil)
+
+// NewMJPEGWriter returns a writer into w; w is closed on Close.
+func NewMJPEGWriter(w io.WriteCloser, jpegQuality int) *MJPEGWriter {
+	if jpegQuality == 0 {
+		jpegQuality = DefaultJPEGQuality
+	}
+	return &MJPEGWriter{
+		JPEGQuality: jpegQuality,
+		writer:      bufio.NewWriter(w),
+		closer:      w,
+	}
+}
+
+func (w *MJPEGWriter) WriteFrame(_ uint64, _ time.Time, img image.Image) error {
+	if err := jpeg.Encode(w.writer, img, &jpeg.Options{Quality: w.JPEGQuality}); err != nil {
+		return fmt.Errorf("unable to encode JPEG: %w", err)
+	}
+	// a time-lapse is slow, so there is no use in keeping
+	// a picture in memory until the next one
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+	return nil
+}
+
+func (w *MJPEGWriter) Close() error {
+	return errors.Join(w.writer.Flush(), w.closer.Close())
+}
+
+// Encoder compresses images into a video stream, like libav.Encoder
+// producing H.264 in the Annex B format.
+type Encoder interface {
+	io.Closer
+
+	// Encode compresses the image; if keyFrame is true, then the result
+	// should be decodable without the previous frames. An error wrapping
+	// camera.ErrNoFrame means the encoder needs more images to produce
+	// a frame.
+	Encode(img image.Image, keyFrame bool) ([]byte, error)
+}
+
+// EncoderWriter writes the pictures as a video stream
+// (e.g. an ".h264" file, playable with 'ffplay -framerate N').
+type EncoderWriter struct {
+	Encoder Encoder
+
+	// KeyFrameInterval is how often (in frames) the key frames are
+	// requested, to make the video seekable.
+	KeyFrameInterval uint64
+
+	writer *bufio.Writer
+	closer io.Closer
+}
+
+var _ Writer = (*EncoderWriter)(nil)
+
+// NewEncoderWriter returns a writer into w; w and the encoder
+// are closed on Close.
+func NewEncoderWriter(w io.WriteCloser, enc Encoder) *EncoderWriter {
+	return &EncoderWriter{
+		Encoder:          enc,
+		KeyFrameInterval: DefaultKeyFrameInterval,
+		writer:           bufio.NewWriter(w),
+		closer:           w,
+	}
+}
+
+func (w *EncoderWriter) WriteFrame(index uint64, _ time.Time, img image.Image) error {
+	keyFrame := w.KeyFrameInterval == 0 || index%w.KeyFrameInterval == 0
+	data, err := w.Encoder.Encode(img, keyFrame)
+	if errors.Is(err, camera.ErrNoFrame) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to encode frame #%d: %w", index, err)
+	}
+	if _, err := w.writer.Write(data); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+	return nil
+}
+
+func (w *EncoderWriter) Close() error {
+	return errors.Join(w.writer.Flush(), w.closer.Close(), w.Encoder.Close())
+}
@@ -0,0 +1,67 @@
+package webrtcserver
+
+import (
+	"sync"
+)
+
+const (
+	// the thresholds of the loss fraction, as in the loss-based
+	// controller of GCC (draft-ietf-rmcat-gcc-02, section 6)
+	lossThresholdHigh = 0.10
+	lossThresholdLow  = 0.02
+
+	bitrateIncreaseFactor = 1.05
+)
+
+// bitrateController estimates the bitrate a peer is able to receive,
+// based on the loss reports and capped by REMB (if the peer sends it).
+type bitrateController struct {
+	locker  sync.Mutex
+	min     uint64
+	max     uint64
+	bitrate uint64
+	remb    uint64
+}
+
+func newBitrateController(cfg Config) *bitrateController {
+	return &bitrateController{
+		min:     cfg.MinBitrate,
+		max:     cfg.MaxBitrate,
+		bitrate: cfg.InitialBitrate,
+	}
+}
+
+func (c *bitrateController) clamp(bitrate float64) uint64 {
+	return min(max(uint64(bitrate), c.min), c.max)
+}
+
+// OnLoss handles the fraction of the lost packets (from 0 to 1)
+// reported by the peer.
+func (c *bitrateController) OnLoss(fraction float64) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	switch {
+	case fraction > lossThresholdHigh:
+		c.bitrate = c.clamp(float64(c.bitrate) * (1 - fraction/2))
+	case fraction < lossThresholdLow:
+		c.bitrate = c.clamp(float64(c.bitrate) * bitrateIncreaseFactor)
+	}
+	if c.remb != 0 {
+		// not growing far beyond what the peer can receive
+		c.bitrate = min(c.bitrate, c.clamp(float64(c.remb)))
+	}
+}
+
+// OnREMB handles the receiver estimated maximum bitrate.
+func (c *bitrateController) OnREMB(bitrate uint64) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.remb = bitrate
+	c.bitrate = min(c.bitrate, c.clamp(float64(bitrate)))
+}
+
+func (c *bitrateController) Bitrate() uint64 {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.bitrate
+}
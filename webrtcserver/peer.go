@@ -0,0 +1,125 @@
+package webrtcserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+type peer struct {
+	ID             string
+	PeerConnection *webrtc.PeerConnection
+	Sender         *webrtc.RTPSender
+	Bitrate        *bitrateController
+
+	connected atomic.Bool
+}
+
+func newPeerID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Errorf("unable to read random: %w", err))
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// newPeer accepts the offer and returns the answer.
+func (s *Server) newPeer(
+	ctx context.Context,
+	offer string,
+) (_ *peer, _ string, _err error) {
+	pc, err := s.api.NewPeerConnection(webrtc.Configuration{
+		ICEServers: s.Config.ICEServers,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to create a peer connection: %w", err)
+	}
+	defer func() {
+		if _err != nil {
+			pc.Close()
+		}
+	}()
+
+	sender, err := pc.AddTrack(s.track)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to add the track: %w", err)
+	}
+
+	p := &peer{
+		ID:             newPeerID(),
+		PeerConnection: pc,
+		Sender:         sender,
+		Bitrate:        newBitrateController(s.Config),
+	}
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			p.connected.Store(true)
+			// the peer cannot decode anything until a key frame
+			s.keyFrameRequested.Store(true)
+		case webrtc.PeerConnectionStateDisconnected:
+			p.connected.Store(false)
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			p.connected.Store(false)
+			// not closing the connection from its own callback
+			go s.removePeer(p.ID)
+		}
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  offer,
+	}); err != nil {
+		return nil, "", fmt.Errorf("unable to set the offer: %w", err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to create an answer: %w", err)
+	}
+	gatheringComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return nil, "", fmt.Errorf("unable to set the answer: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+		return nil, "", fmt.Errorf("unable to gather the ICE candidates: %w", ctx.Err())
+	case <-gatheringComplete:
+	}
+
+	s.addPeer(p)
+	go s.readRTCP(p)
+	return p, pc.LocalDescription().SDP, nil
+}
+
+// readRTCP handles the feedback of the peer until the connection is closed.
+func (s *Server) readRTCP(p *peer) {
+	for {
+		packets, _, err := p.Sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		bitrateChanged := false
+		for _, pkt := range packets {
+			switch pkt := pkt.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				s.keyFrameRequested.Store(true)
+			case *rtcp.ReceiverReport:
+				for _, report := range pkt.Reports {
+					p.Bitrate.OnLoss(float64(report.FractionLost) / 256)
+					bitrateChanged = true
+				}
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				p.Bitrate.OnREMB(uint64(pkt.Bitrate))
+				bitrateChanged = true
+			}
+		}
+		if bitrateChanged {
+			s.updateBitrate()
+		}
+	}
+}
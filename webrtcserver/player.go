@@ -0,0 +1,46 @@
+package webrtcserver
+
+// playerHTML requests the stream from the same URL and plays it.
+const playerHTML = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>camera</title></head>
+<body style="margin:0;background:#000">
+<video id="video" autoplay muted playsinline style="width:100vw;height:100vh;object-fit:contain"></video>
+<script>
+(async () => {
+	const pc = new RTCPeerConnection();
+	pc.addTransceiver('video', {direction: 'recvonly'});
+	pc.ontrack = (ev) => {
+		document.getElementById('video').srcObject = new MediaStream([ev.track]);
+	};
+	await pc.setLocalDescription(await pc.createOffer());
+	await new Promise((resolve) => {
+		if (pc.iceGatheringState === 'complete') {
+			return resolve();
+		}
+		pc.onicegatheringstatechange = () => {
+			if (pc.iceGatheringState === 'complete') {
+				resolve();
+			}
+		};
+	});
+	const resp = await fetch(location.pathname, {
+		method: 'POST',
+		headers: {'Content-Type': 'application/sdp'},
+		body: pc.localDescription.sdp,
+	});
+	if (!resp.ok) {
+		document.body.innerText = 'unable to connect: ' + await resp.text();
+		document.body.style.color = '#fff';
+		return;
+	}
+	const location_ = resp.headers.get('Location');
+	window.addEventListener('beforeunload', () => {
+		fetch(location_, {method: 'DELETE', keepalive: true});
+	});
+	await pc.setRemoteDescription({type: 'answer', sdp: await resp.text()});
+})();
+</script>
+</body>
+</html>
+`
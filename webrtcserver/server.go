@@ -0,0 +1,380 @@
+// Package webrtcserver publishes a camera via WebRTC, for a low-latency
+// preview in browsers without an external media server.
+//
+// The signaling is a single HTTP exchange (like in WHEP): the client POSTs
+// an SDP offer and receives the SDP answer with all the ICE candidates
+// (no trickling); DELETE on the returned Location ends the session.
+// GET returns a minimal HTML page playing the stream.
+//
+// The frames are either encoded (VP8 or H.264, by a given Encoder) or
+// forwarded as is from a camera.CameraCompressed providing H.264. When
+// encoding, the bitrate is adapted to the RTCP feedback of the peers
+// (the loss reports and REMB) and key frames are sent on requests.
+package webrtcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/xaionaro-go/camera"
+)
+
+const (
+	DefaultInitialBitrate = 1_000_000
+	DefaultMinBitrate     = 100_000
+	DefaultMaxBitrate     = 4_000_000
+
+	// maxOfferSize limits the size of the request body with the offer.
+	maxOfferSize = 1 << 20
+)
+
+// Encoder compresses images into VP8 frames or H.264 access units
+// (in the Annex B format); see libav.Encoder.
+type Encoder interface {
+	io.Closer
+
+	// Encode compresses the image; if keyFrame is true, then the result
+	// should be decodable without the previous frames. An error wrapping
+	// camera.ErrNoFrame means the encoder needs more images to produce
+	// a frame.
+	Encode(img image.Image, keyFrame bool) ([]byte, error)
+
+	// SetBitrate changes the target bitrate (in bits per second).
+	SetBitrate(bitrate uint64) error
+}
+
+type Config struct {
+	// Codec is the codec produced by the Encoder: camera.PixelFormatVP8
+	// or camera.PixelFormatH264; it is ignored when forwarding.
+	Codec camera.PixelFormat
+
+	// InitialBitrate, MinBitrate and MaxBitrate (in bits per second)
+	// define the range of the bitrate adaptation.
+	InitialBitrate uint64
+	MinBitrate     uint64
+	MaxBitrate     uint64
+
+	// ICEServers are the STUN/TURN servers; only the host candidates
+	// are used if empty, which is enough within a LAN.
+	ICEServers []webrtc.ICEServer
+
+	// OnError (if set) is called on errors which do not stop the server,
+	// like failures of particular peers.
+	OnError func(error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.InitialBitrate == 0 {
+		cfg.InitialBitrate = DefaultInitialBitrate
+	}
+	if cfg.MinBitrate == 0 {
+		cfg.MinBitrate = DefaultMinBitrate
+	}
+	if cfg.MaxBitrate == 0 {
+		cfg.MaxBitrate = DefaultMaxBitrate
+	}
+	cfg.InitialBitrate = min(max(cfg.InitialBitrate, cfg.MinBitrate), cfg.MaxBitrate)
+	return cfg
+}
+
+// Server serves a single camera to any amount of peers. The camera should
+// be already streaming; the server does not close it (nor the encoder).
+type Server struct {
+	Config Config
+
+	source sampleSource
+	api    *webrtc.API
+	track  *webrtc.TrackLocalStaticSample
+
+	locker sync.Mutex
+	peers  map[string]*peer
+
+	keyFrameRequested atomic.Bool
+	targetBitrate     atomic.Uint64
+}
+
+// New returns a server encoding the frames of the camera.
+func New(
+	cam camera.Camera,
+	enc Encoder,
+	cfg Config,
+) (*Server, error) {
+	return newServer(&encodingSource{
+		Camera:  cam,
+		Encoder: enc,
+	}, cfg.Codec, cfg)
+}
+
+// NewForwarding returns a server sending the frames of the camera as
+// they are, without re-encoding; only H.264 is supported. The bitrate
+// cannot be adapted and the key frames cannot be requested in this case,
+// so the stream should contain key frames (and the parameter sets)
+// regularly.
+func NewForwarding(
+	cam camera.CameraCompressed,
+	cfg Config,
+) (*Server, error) {
+	return newServer(&forwardingSource{
+		Camera: cam,
+	}, cam.GetFormat().PixelFormat, cfg)
+}
+
+func newServer(
+	source sampleSource,
+	codec camera.PixelFormat,
+	cfg Config,
+) (*Server, error) {
+	var capability webrtc.RTPCodecCapability
+	switch codec {
+	case camera.PixelFormatVP8:
+		capability = webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypeVP8,
+			ClockRate: 90000,
+		}
+	case camera.PixelFormatH264:
+		capability = webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeH264,
+			ClockRate:   90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		}
+	default:
+		return nil, fmt.Errorf("codec '%s': %w", codec, camera.ErrNotSupported)
+	}
+
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, fmt.Errorf("unable to register the codecs: %w", err)
+	}
+	interceptors := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, interceptors); err != nil {
+		return nil, fmt.Errorf("unable to register the interceptors: %w", err)
+	}
+
+	track, err := webrtc.NewTrackLocalStaticSample(capability, "video", "camera")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a track: %w", err)
+	}
+
+	s := &Server{
+		Config: cfg.withDefaults(),
+		source: source,
+		api: webrtc.NewAPI(
+			webrtc.WithMediaEngine(mediaEngine),
+			webrtc.WithInterceptorRegistry(interceptors),
+		),
+		track: track,
+		peers: map[string]*peer{},
+	}
+	s.targetBitrate.Store(s.Config.InitialBitrate)
+	return s, nil
+}
+
+func (s *Server) reportError(err error) {
+	if s.Config.OnError != nil {
+		s.Config.OnError(err)
+	}
+}
+
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen '%s': %w", addr, err)
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve handles the signaling requests and sends the frames (see Run)
+// until the context is done or the camera fails. The listener is
+// closed on return.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+
+	httpServer := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(ctx)
+		cancelFn()
+	}()
+	stop := context.AfterFunc(ctx, func() { httpServer.Close() })
+	defer stop()
+
+	err := httpServer.Serve(l)
+	cancelFn()
+	captureErr := <-runErr
+	if errors.Is(err, http.ErrServerClosed) {
+		return captureErr
+	}
+	return fmt.Errorf("unable to serve HTTP: %w", err)
+}
+
+// Run sends the frames to the connected peers until the context is done
+// or the camera fails; it is needed only if the server is used as an
+// http.Handler instead of Serve. The peers are closed on return.
+func (s *Server) Run(ctx context.Context) error {
+	defer s.closePeers()
+
+	frameDuration := time.Second / 30
+	if fps := s.source.format().FPS.Float64(); fps > 0 {
+		frameDuration = time.Duration(float64(time.Second) / fps)
+	}
+
+	var appliedBitrate uint64
+	var prevTS time.Time
+	for {
+		skip := !s.hasConnectedPeers()
+		keyFrame := !skip && s.keyFrameRequested.Swap(false)
+		if bitrate := s.targetBitrate.Load(); !skip && bitrate != appliedBitrate {
+			if err := s.source.setBitrate(bitrate); err != nil {
+				s.reportError(fmt.Errorf("unable to set the bitrate %d: %w", bitrate, err))
+			}
+			appliedBitrate = bitrate
+		}
+
+		data, err := s.source.next(ctx, skip, keyFrame)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, camera.ErrNoFrame) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if data == nil {
+			prevTS = time.Time{}
+			continue
+		}
+
+		duration := frameDuration
+		if !prevTS.IsZero() {
+			duration = now.Sub(prevTS)
+		}
+		prevTS = now
+		if err := s.track.WriteSample(media.Sample{Data: data, Duration: duration}); err != nil {
+			s.reportError(fmt.Errorf("unable to send a frame: %w", err))
+		}
+	}
+}
+
+// ServeHTTP implements the signaling.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, playerHTML)
+	case http.MethodPost:
+		s.handleOffer(w, r)
+	case http.MethodDelete:
+		if !s.removePeer(path.Base(r.URL.Path)) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleOffer(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" && contentType != "application/sdp" {
+		http.Error(w, fmt.Sprintf("unexpected content type '%s', expected 'application/sdp'", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	offer, err := io.ReadAll(io.LimitReader(r.Body, maxOfferSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to read the offer: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	p, answer, err := s.newPeer(r.Context(), string(offer))
+	if err != nil {
+		s.reportError(fmt.Errorf("unable to accept an offer from %s: %w", r.RemoteAddr, err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", path.Join(r.URL.Path, p.ID))
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, answer)
+}
+
+func (s *Server) addPeer(p *peer) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.peers[p.ID] = p
+}
+
+func (s *Server) removePeer(id string) bool {
+	s.locker.Lock()
+	p := s.peers[id]
+	delete(s.peers, id)
+	s.locker.Unlock()
+	if p == nil {
+		return false
+	}
+	if err := p.PeerConnection.Close(); err != nil {
+		s.reportError(fmt.Errorf("unable to close peer %s: %w", id, err))
+	}
+	s.updateBitrate()
+	return true
+}
+
+func (s *Server) closePeers() {
+	s.locker.Lock()
+	var ids []string
+	for id := range s.peers {
+		ids = append(ids, id)
+	}
+	s.locker.Unlock()
+	for _, id := range ids {
+		s.removePeer(id)
+	}
+}
+
+func (s *Server) hasConnectedPeers() bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for _, p := range s.peers {
+		if p.connected.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// updateBitrate sets the target bitrate to the one
+// acceptable by the worst of the peers.
+func (s *Server) updateBitrate() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	bitrate := uint64(0)
+	for _, p := range s.peers {
+		if b := p.Bitrate.Bitrate(); bitrate == 0 || b < bitrate {
+			bitrate = b
+		}
+	}
+	if bitrate == 0 {
+		// nobody is connected, so starting from the scratch for the next peer
+		bitrate = s.Config.InitialBitrate
+	}
+	s.targetBitrate.Store(bitrate)
+}
@@ -0,0 +1,232 @@
+package webrtcserver
+
+import (
+	"context"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/xaionaro-go/camera"
+)
+
+// fakeEncoder produces dummy frames and records the bitrate.
+type fakeEncoder struct {
+	locker    sync.Mutex
+	bitrate   uint64
+	keyFrames int
+}
+
+func (e *fakeEncoder) Close() error {
+	return nil
+}
+
+func (e *fakeEncoder) Encode(img image.Image, keyFrame bool) ([]byte, error) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	if keyFrame {
+		e.keyFrames++
+	}
+	return []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, nil
+}
+
+func (e *fakeEncoder) SetBitrate(bitrate uint64) error {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	e.bitrate = bitrate
+	return nil
+}
+
+func (e *fakeEncoder) Bitrate() uint64 {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	return e.bitrate
+}
+
+// testCamera produces gray frames at 30 FPS.
+type testCamera struct {
+	img    *image.YCbCr
+	ticker *time.Ticker
+}
+
+func newTestCamera(width, height int) *testCamera {
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = 128
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 128, 128
+	}
+	return &testCamera{
+		img:    img,
+		ticker: time.NewTicker(time.Second / 30),
+	}
+}
+
+func (c *testCamera) Close() error {
+	c.ticker.Stop()
+	return nil
+}
+
+func (c *testCamera) StartStreaming() error {
+	return nil
+}
+
+func (c *testCamera) StopStreaming() error {
+	return nil
+}
+
+func (c *testCamera) GetFormat() camera.Format {
+	return camera.Format{
+		Width:       uint64(c.img.Rect.Dx()),
+		Height:      uint64(c.img.Rect.Dy()),
+		PixelFormat: camera.PixelFormatYU12,
+		FPS:         camera.Fraction{Numerator: 30, Denominator: 1},
+	}
+}
+
+func (c *testCamera) GetFrame(ctx context.Context) (camera.Frame, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ticker.C:
+		return camera.FrameFromImage(c.img), nil
+	}
+}
+
+func (c *testCamera) ReleaseFrame(camera.Frame) error {
+	return nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestServerPeer connects a pion peer, receives the frames and
+// checks that REMB of the peer limits the bitrate of the encoder.
+func TestServerPeer(t *testing.T) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	cam := newTestCamera(64, 48)
+	defer cam.Close()
+
+	enc := &fakeEncoder{}
+	srv, err := New(cam, enc, Config{Codec: camera.PixelFormatVP8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ssrcCh := make(chan webrtc.SSRC, 1)
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := track.ReadRTP(); err != nil {
+			return
+		}
+		ssrcCh <- track.SSRC()
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gatheringComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gatheringComplete
+
+	resp, err := http.Post(httpServer.URL+"/", "application/sdp", strings.NewReader(pc.LocalDescription().SDP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, answer)
+	}
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  string(answer),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ssrc webrtc.SSRC
+	select {
+	case ssrc = <-ssrcCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no frames received")
+	}
+	enc.locker.Lock()
+	keyFrames := enc.keyFrames
+	enc.locker.Unlock()
+	if keyFrames == 0 {
+		t.Errorf("no key frame was requested for the new peer")
+	}
+
+	const remb = 200_000
+	waitFor(t, "the bitrate limited by REMB", func() bool {
+		err := pc.WriteRTCP([]rtcp.Packet{&rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: remb,
+			SSRCs:   []uint32{uint32(ssrc)},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bitrate := enc.Bitrate()
+		return bitrate != 0 && bitrate <= remb
+	})
+
+	req, err := http.NewRequest(http.MethodDelete, httpServer.URL+resp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status of DELETE: %d", resp.StatusCode)
+	}
+
+	cancelFn()
+	if err := <-runErr; err != context.Canceled {
+		t.Fatalf("unexpected error of Run: %v", err)
+	}
+}
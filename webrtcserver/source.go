@@ -0,0 +1,88 @@
+package webrtcserver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/xaionaro-go/camera"
+)
+
+// sampleSource provides the compressed frames to send.
+type sampleSource interface {
+	// next returns the next compressed frame; if skip is true, then
+	// the frame is dropped without compressing and nil is returned.
+	next(ctx context.Context, skip bool, keyFrame bool) ([]byte, error)
+	setBitrate(bitrate uint64) error
+	format() camera.Format
+}
+
+type encodingSource struct {
+	Camera  camera.Camera
+	Encoder Encoder
+}
+
+func (s *encodingSource) next(
+	ctx context.Context,
+	skip bool,
+	keyFrame bool,
+) ([]byte, error) {
+	frame, err := s.Camera.GetFrame(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get a frame: %w", err)
+	}
+
+	var data []byte
+	if !skip {
+		data, err = s.Encoder.Encode(frame.Image(), keyFrame)
+	}
+	if releaseErr := s.Camera.ReleaseFrame(frame); releaseErr != nil {
+		return nil, fmt.Errorf("unable to release the frame: %w", releaseErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode the frame: %w", err)
+	}
+	return data, nil
+}
+
+func (s *encodingSource) setBitrate(bitrate uint64) error {
+	return s.Encoder.SetBitrate(bitrate)
+}
+
+func (s *encodingSource) format() camera.Format {
+	return s.Camera.GetFormat()
+}
+
+type forwardingSource struct {
+	Camera camera.CameraCompressed
+}
+
+func (s *forwardingSource) next(
+	ctx context.Context,
+	skip bool,
+	keyFrame bool,
+) ([]byte, error) {
+	frames, err := s.Camera.GetCompressedFrames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get frames: %w", err)
+	}
+
+	var data []byte
+	if !skip {
+		// the frames are not valid after the release
+		data = slices.Clone(frames.Bytes())
+	}
+	if err := s.Camera.ReleaseFrames(frames); err != nil {
+		return nil, fmt.Errorf("unable to release the frames: %w", err)
+	}
+	return data, nil
+}
+
+// setBitrate does nothing, since the bitrate is defined by the camera.
+func (s *forwardingSource) setBitrate(bitrate uint64) error {
+	return nil
+}
+
+func (s *forwardingSource) format() camera.Format {
+	return s.Camera.GetFormat()
+}
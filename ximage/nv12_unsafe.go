@@ -12,3 +12,8 @@ func (p *NV12) setCbCrBytes(b []byte) {
 	sliceLen := len(b) / int(cbCrSize)
 	p.CbCr = (unsafe.Slice((*CbCr)(unsafe.Pointer(unsafe.SliceData(b))), sliceLen))
 }
+
+// CbCrBytes returns the CbCr plane as a slice of bytes (without copying).
+func (p *NV12) CbCrBytes() []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(p.CbCr))), len(p.CbCr)*int(cbCrSize))
+}
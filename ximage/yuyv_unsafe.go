@@ -12,3 +12,8 @@ func (p *YUYV) setY0CbY1CrBytes(b []byte) {
 	sliceLen := len(b) / int(y0CbY1CrSize)
 	p.Y0CbY1Cr = (unsafe.Slice((*Y0CbY1Cr)(unsafe.Pointer(unsafe.SliceData(b))), sliceLen))
 }
+
+// Y0CbY1CrBytes returns the pixel data as a slice of bytes (without copying).
+func (p *YUYV) Y0CbY1CrBytes() []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(p.Y0CbY1Cr))), len(p.Y0CbY1Cr)*int(y0CbY1CrSize))
+}